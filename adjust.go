@@ -0,0 +1,95 @@
+// adjust.go - Nudge a habit's quantity up or down by one from the index page, outside the
+// week review. Every nudge is written to an audit trail (AppData.Adjustments) so it's clear
+// later why a target changed. Set ADJUST_WEEKLY_CAP in .env to limit how many nudges a habit
+// may get in any 7 days (0 or unset = no limit), so the weekly review stays the main way to grow.
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// adjustWeeklyCap returns ADJUST_WEEKLY_CAP, or 0 for no limit.
+func adjustWeeklyCap() int {
+	n, err := strconv.Atoi(os.Getenv("ADJUST_WEEKLY_CAP"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// AdjustmentsInLastWeek counts the manual nudges of a habit in the 7 days up to now.
+func AdjustmentsInLastWeek(data *AppData, habitID int, now time.Time) int {
+	since := now.AddDate(0, 0, -7)
+	count := 0
+	for _, a := range data.Adjustments {
+		if a.HabitID == habitID && a.Time.After(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// AdjustQuantity changes a habit's quantity by delta (minimum 1, maximum its MaxQuantity) and
+// records it in the audit trail. It returns false if nothing changed (already at a limit).
+func AdjustQuantity(data *AppData, h *Habit, delta int, now time.Time) bool {
+	to := h.capQuantity(h.Quantity + delta)
+	if to == h.Quantity {
+		return false
+	}
+	data.Adjustments = append(data.Adjustments, QuantityAdjustment{
+		Time:    now,
+		HabitID: h.ID,
+		From:    h.Quantity,
+		To:      to,
+	})
+	log.Printf("audit: %q quantity %d -> %d (manual adjust)", h.Name, h.Quantity, to)
+	h.Quantity = to
+	return true
+}
+
+// HandleAdjustQuantity handles POST from the −/+ buttons. Form: habit_id=1&delta=1 (or -1)
+func HandleAdjustQuantity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	delta, err := strconv.Atoi(r.FormValue("delta"))
+	if err != nil || (delta != 1 && delta != -1) {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	now := time.Now()
+	if limit := adjustWeeklyCap(); limit > 0 && AdjustmentsInLastWeek(data, habitID, now) >= limit {
+		http.Redirect(w, r, "/?error=adjustcap", http.StatusFound)
+		return
+	}
+	if !AdjustQuantity(data, habit, delta, now) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?adjusted=1", http.StatusFound)
+}
@@ -0,0 +1,228 @@
+// api.go - JSON endpoints under /api/v1/ for the installable web app (PWA) and scripts:
+// the offline completion batch, today's habits and the app icon badge count.
+// Unlike the HTML handlers, these answer with JSON instead of redirecting. status.txt is the
+// exception: today's habits as plain text, for tools that can't read JSON easily.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BatchCompletion is one completion recorded while offline. Date is the day it was done on the
+// device (YYYY-MM-DD), so a habit ticked offline last night still counts for last night.
+type BatchCompletion struct {
+	HabitID int    `json:"habit_id"`
+	Action  string `json:"action"` // "complete" (default) or "uncomplete"
+	Date    string `json:"date"`
+}
+
+// BatchRequest is the body of POST /api/v1/batch.
+type BatchRequest struct {
+	Completions []BatchCompletion `json:"completions"`
+}
+
+// BatchResult reports what happened to each queued completion, in the same order.
+type BatchResult struct {
+	Applied int      `json:"applied"`
+	Errors  []string `json:"errors"` // one entry per completion: "" if applied, else why not
+}
+
+// maxBatchAgeDays is how far back an offline completion may be dated.
+const maxBatchAgeDays = 7
+
+// recentDate reports whether date is a YYYY-MM-DD from today back to maxBatchAgeDays ago.
+func recentDate(date, today string) bool {
+	oldest := time.Now().AddDate(0, 0, -maxBatchAgeDays).Format(dateLayout)
+	_, err := ParseDate(date)
+	return err == nil && date <= today && date >= oldest
+}
+
+// writeJSON sends v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// HandleBatchAPI handles POST /api/v1/batch: completions queued by the offline page are
+// applied in one load/save. Each entry is checked on its own, so one bad entry (a deleted
+// habit, a date too far back) doesn't reject the rest.
+func HandleBatchAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	today := Today()
+	res := BatchResult{Errors: make([]string, len(req.Completions))}
+	for i, c := range req.Completions {
+		if c.Date == "" {
+			c.Date = today
+		}
+		switch {
+		case FindHabitByID(data, c.HabitID) == nil:
+			res.Errors[i] = "habit not found"
+		case c.Action != "" && c.Action != "complete" && c.Action != "uncomplete":
+			res.Errors[i] = "unknown action"
+		default:
+			if !recentDate(c.Date, today) {
+				res.Errors[i] = "date must be within the last 7 days"
+				continue
+			}
+			if c.Action != "uncomplete" {
+				if msg := completionBlocked(data, FindHabitByID(data, c.HabitID), c.Date); msg != "" {
+					res.Errors[i] = msg
+					continue
+				}
+			}
+			SetHabitCompleted(data, c.HabitID, c.Date, c.Action != "uncomplete")
+			res.Applied++
+		}
+	}
+	if res.Applied > 0 {
+		if err := SaveData(data); err != nil {
+			writeJSON(w, saveStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// TodayHabit is one habit in the /api/v1/today payload.
+type TodayHabit struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Unit     string `json:"unit"`
+	Done     bool   `json:"done"`
+	Streak   int    `json:"streak"`
+	Best     int    `json:"best_streak"`     // the longest streak ever
+	Key      int    `json:"key,omitempty"`   // the number key for it on the main page (shortcuts.go)
+	Color    string `json:"color,omitempty"` // appearance.go
+	Icon     string `json:"icon,omitempty"`
+}
+
+// todayHabit is h as listed in /api/v1/today, with its number key (0 for none).
+func todayHabit(data *AppData, h Habit, key int) TodayHabit {
+	return TodayHabit{
+		ID: h.ID, Name: h.Name, Quantity: h.Quantity, Unit: h.Unit, Key: key, Color: h.Color, Icon: h.Icon,
+		Done:   containsInt(data.History[Today()].CompletedHabits, h.ID),
+		Streak: GetStreakForHabit(data, h.ID), Best: h.LongestStreak,
+	}
+}
+
+// TodayResponse is the /api/v1/today payload: today's habits and how many are still open.
+type TodayResponse struct {
+	Date       string       `json:"date"`
+	Habits     []TodayHabit `json:"habits"`
+	Incomplete int          `json:"incomplete"` // same number as /api/v1/badge
+}
+
+// IncompleteHabitsToday counts the habits not completed today (paused ones don't count).
+func IncompleteHabitsToday(data *AppData) int {
+	done := data.History[Today()].CompletedHabits
+	n := 0
+	for _, h := range data.Habits {
+		if !containsInt(done, h.ID) && !h.PausedOn(Today()) {
+			n++
+		}
+	}
+	return n
+}
+
+// HandleTodayAPI handles GET /api/v1/today: today's habits with done/streak, as JSON.
+func HandleTodayAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	today := Today()
+	resp := TodayResponse{Date: today, Habits: []TodayHabit{}, Incomplete: IncompleteHabitsToday(data)}
+	w.Header().Set("ETag", revisionETag(data.Revision)) // for If-Match on the next change (revision.go)
+	habits, _ := todaysHabits(data, today)              // in the same order as the main page
+	keys := habitKeys(habits)
+	for _, h := range habits {
+		resp.Habits = append(resp.Habits, todayHabit(data, h, keys[h.ID]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleBadgeAPI handles GET /api/v1/badge: just {"count": N}, the habits still open today.
+// It is small enough to poll; the installed app shows the number on its icon.
+func HandleBadgeAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"count": IncompleteHabitsToday(data)})
+}
+
+// StatusText is today's habits as plain text, one line each ("Read: done, 12-day streak"), and
+// a last line with how many are done ("2 of 3 done"). Paused habits are left out.
+func StatusText(data *AppData) string {
+	today := Today()
+	rec := data.History[today]
+	habits, _ := todaysHabits(data, today)
+	var sb strings.Builder
+	done := 0
+	for _, h := range habits {
+		state := "pending"
+		switch {
+		case containsInt(rec.CompletedHabits, h.ID):
+			state = "done"
+			done++
+		case containsInt(rec.SkippedHabits, h.ID):
+			state = "skipped"
+		}
+		fmt.Fprintf(&sb, "%s: %s, %d-day streak\n", h.Name, state, GetStreakForHabit(data, h.ID))
+	}
+	fmt.Fprintf(&sb, "%d of %d done\n", done, len(habits))
+	return sb.String()
+}
+
+// HandleStatusText handles GET /api/v1/status.txt: StatusText, for iOS Shortcuts, status bars
+// and shell prompts. ?short gives only the last line, shorter still: "2/3".
+func HandleStatusText(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Has("short") {
+		habits, _ := todaysHabits(data, Today())
+		fmt.Fprintf(w, "%d/%d\n", len(habits)-IncompleteHabitsToday(data), len(habits))
+		return
+	}
+	fmt.Fprint(w, StatusText(data))
+}
@@ -0,0 +1,37 @@
+// appearance.go - A color and an icon per habit, so a long list is easy to scan: the icon (an emoji,
+// like 🏃) goes in front of the habit's name, and the color fills its done days in the calendar on
+// the main page and in the year heatmaps (archive.go, share links). Both are optional; without a
+// color, done days are green as before.
+//
+// Colors are picked from a small palette that reads well in the light and the dark theme, but any
+// "#rrggbb" is accepted (the API, an edited data.json).
+
+package main
+
+import "regexp"
+
+// HabitColor is one color of the palette offered in the forms.
+type HabitColor struct {
+	Name string
+	Hex  string
+}
+
+// habitColors is the palette, in the order the forms list it.
+var habitColors = []HabitColor{
+	{"Blue", "#4a90d9"},
+	{"Teal", "#2a9d8f"},
+	{"Purple", "#8e6cc9"},
+	{"Pink", "#d46a9f"},
+	{"Red", "#d9534f"},
+	{"Amber", "#e0a526"},
+	{"Brown", "#a0785a"},
+	{"Slate", "#6c7a89"},
+}
+
+// maxIconChars is how long an icon may be; emoji made of several (👩‍💻, flags) need a few.
+const maxIconChars = 8
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidColor reports whether c is "" (the default green) or a "#rrggbb" color.
+func ValidColor(c string) bool { return c == "" || hexColor.MatchString(c) }
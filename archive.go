@@ -0,0 +1,205 @@
+// archive.go - "Generate static archive": writes a year of data as plain HTML files that can be
+// opened straight from disk (no server needed). Run it with:
+//
+//	go run . -archive 2025            (writes ./archive-2025/)
+//	go run . -archive 2025 -out ~/habits-2025
+//
+// The archive has two pages: index.html (per-habit stats and a year heatmap) and journal.html
+// (a day-by-day log of completions, missed-day penalties, logged minutes and week reviews).
+// CSS is inlined into every page so the folder stays self-contained.
+// To publish or share the archive, add -shareable: private habits (privacy.go) are left out.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveCell is one day in a heatmap: Type is "done", "missed", "empty" (no record, or the
+// habit didn't exist yet) or "pad" (a filler cell before Jan 1 so weeks line up). A column is
+// one week, from the first day of the week in the user's date style (dates.go).
+type ArchiveCell struct {
+	Date string
+	Type string
+}
+
+// ArchiveHabit is one habit's stats for the year.
+type ArchiveHabit struct {
+	Name          string
+	Quantity      int
+	Unit          string
+	Color, Icon   string // appearance.go
+	Completions   int
+	TrackedDays   int // days in the year the habit existed (up to today)
+	Rate          int // completion percentage of TrackedDays
+	LongestStreak int
+	Minutes       int
+	Cells         []ArchiveCell // Jan 1 .. Dec 31, preceded by padding to the start of its week
+}
+
+// ArchiveDay is one journal entry.
+type ArchiveDay struct {
+	Date       string
+	Completed  []string
+	Penalized  []string
+	Minutes    []string // e.g. "Meditate: 20 min"
+	WeekReview bool
+}
+
+// ArchiveData is what the archive templates render.
+type ArchiveData struct {
+	Year        int
+	GeneratedAt string
+	Dates       DateStyle // how dates are written and when weeks start (dates.go)
+	Habits      []ArchiveHabit
+	Days        []ArchiveDay
+}
+
+// BuildArchive collects the stats, heatmaps and journal for one calendar year. The days are read
+// from src in a single pass (see history.go), so the year is never loaded as a whole.
+func BuildArchive(data *AppData, src HistorySource, year int, now time.Time) (ArchiveData, error) {
+	first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+	ad, err := BuildArchiveRange(data, src, first, last, now)
+	ad.Year = year
+	return ad, err
+}
+
+// BuildArchiveRange is BuildArchive for any span of days, e.g. the last year for share links.
+func BuildArchiveRange(data *AppData, src HistorySource, first, last, now time.Time) (ArchiveData, error) {
+	today := now.Format(dateLayout)
+	ad := ArchiveData{GeneratedAt: now.Format("2006-01-02 15:04"), Dates: data.Settings.Dates()}
+	// Padding so the first column starts on the first day of the week (Sunday, like GitHub's
+	// contribution graph, or Monday), as in the user's date style.
+	pad := ad.Dates.weekdayOffset(first)
+
+	// First lay out every habit's cells as if nothing was done: "missed" for tracked past days,
+	// "empty" otherwise. The pass over the history below then marks the completed days.
+	index := make(map[int]int) // habit ID -> position in ad.Habits
+	for _, h := range data.Habits {
+		ah := ArchiveHabit{Name: h.Name, Quantity: h.Quantity, Unit: h.Unit, Color: h.Color, Icon: h.Icon}
+		for i := 0; i < pad; i++ {
+			ah.Cells = append(ah.Cells, ArchiveCell{Type: "pad"})
+		}
+		created := ""
+		if !h.CreatedAt.IsZero() {
+			created = h.CreatedAt.Format(dateLayout)
+		}
+		for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+			ds := d.Format(dateLayout)
+			cell := ArchiveCell{Date: ds, Type: "empty"}
+			if ds <= today && (created == "" || ds >= created) {
+				ah.TrackedDays++
+				if ds < today {
+					cell.Type = "missed"
+				}
+			}
+			ah.Cells = append(ah.Cells, cell)
+		}
+		index[h.ID] = len(ad.Habits)
+		ad.Habits = append(ad.Habits, ah)
+	}
+
+	name := func(id int) string {
+		if h := FindHabitByID(data, id); h != nil {
+			return h.Name
+		}
+		return fmt.Sprintf("Habit #%d (deleted)", id)
+	}
+	err := src.Days(first.Format(dateLayout), last.Format(dateLayout), func(rec DayRecord) bool {
+		d, err := ParseDate(rec.Date)
+		if err != nil {
+			return true
+		}
+		cell := pad + int(d.Sub(first).Hours()/24)
+		for _, id := range rec.CompletedHabits {
+			if i, ok := index[id]; ok {
+				ad.Habits[i].Cells[cell].Type = "done"
+				ad.Habits[i].Completions++
+			}
+		}
+		for id, mins := range rec.MinutesLogged {
+			if i, ok := index[id]; ok {
+				ad.Habits[i].Minutes += mins
+			}
+		}
+
+		day := ArchiveDay{Date: rec.Date, WeekReview: rec.WeekReviewDone || data.LastWeekReview == rec.Date}
+		for _, id := range rec.CompletedHabits {
+			day.Completed = append(day.Completed, name(id))
+		}
+		for _, id := range rec.PenaltyAppliedForHabits {
+			day.Penalized = append(day.Penalized, name(id))
+		}
+		for id, mins := range rec.MinutesLogged {
+			day.Minutes = append(day.Minutes, fmt.Sprintf("%s: %d min", name(id), mins))
+		}
+		if len(day.Completed)+len(day.Penalized)+len(day.Minutes) > 0 || day.WeekReview {
+			ad.Days = append(ad.Days, day)
+		}
+		return true
+	})
+	if err != nil {
+		return ad, err
+	}
+
+	for i := range ad.Habits {
+		ah := &ad.Habits[i]
+		run := 0
+		for _, c := range ah.Cells {
+			if c.Type != "done" {
+				run = 0
+				continue
+			}
+			run++
+			if run > ah.LongestStreak {
+				ah.LongestStreak = run
+			}
+		}
+		if ah.TrackedDays > 0 {
+			ah.Rate = ah.Completions * 100 / ah.TrackedDays
+		}
+	}
+	return ad, nil
+}
+
+// WriteStaticArchive renders the archive for year into dir (created if needed).
+func WriteStaticArchive(year int, dir string, shareable bool) error {
+	data, err := LoadDataWithoutHistory()
+	if err != nil {
+		return err
+	}
+	var src HistorySource = FileHistory(dataFile)
+	if shareable {
+		src = SharedHistory(src, PrivateHabitIDs(data))
+		data.Habits = SharedHabits(data.Habits)
+	}
+	ad, err := BuildArchive(data, src, year, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	pages := map[string]string{
+		"index.html":   "archive.html",
+		"journal.html": "archive-journal.html",
+	}
+	for file, name := range pages {
+		f, err := os.Create(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		if err := tmpl.ExecuteTemplate(f, name, ad); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// assets.go - Templates and static files are built into the binary with go:embed, so the app
+// runs from any directory (not only the repo root). To customise the look without rebuilding
+// or forking, put files in ./overrides (or another folder, set in .env):
+//
+//	ASSETS_DIR=/home/me/habit-theme
+//
+// with the same layout as the repo (templates/layout.html, static/icon.svg, ...). A file found
+// there is used instead of the built-in one; everything else still comes from the binary, so
+// an upgrade keeps your changes. For small changes, static/custom.css is the safest: it's
+// loaded after the built-in styles on every page, and doesn't replace anything that a new
+// version might change. The folder is read at startup, and the log lists what it overrides.
+
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The go:embed line below tells the compiler to store these files inside the binary.
+// embed.FS is a read-only file system (an fs.FS) holding them, with paths like "templates/layout.html".
+// locales holds the translations (i18n.go).
+//
+//go:embed templates/*.html static locales
+var embeddedAssets embed.FS
+
+// overlayFS looks up files in dir first and falls back to base. It implements fs.FS (Open) and
+// fs.ReadDirFS (ReadDir), which is all template.ParseFS and http.FileServer need.
+type overlayFS struct {
+	dir  fs.FS // the override directory (may be nil)
+	base fs.FS // the embedded files
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if o.dir != nil {
+		if f, err := o.dir.Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return o.base.Open(name)
+}
+
+// ReadDir lists a directory from both layers, so a template that only exists in the override
+// directory is picked up too. Entries with the same name come from the override directory.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	baseList, baseErr := fs.ReadDir(o.base, name)
+	for _, e := range baseList {
+		entries[e.Name()] = e
+	}
+	var dirErr error = fs.ErrNotExist
+	if o.dir != nil {
+		var list []fs.DirEntry
+		list, dirErr = fs.ReadDir(o.dir, name)
+		for _, e := range list {
+			entries[e.Name()] = e
+		}
+	}
+	if baseErr != nil && dirErr != nil {
+		return nil, baseErr
+	}
+	out := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// defaultAssetsDir is the override folder used when ASSETS_DIR isn't set, if it exists.
+const defaultAssetsDir = "overrides"
+
+// assetsDir returns the override folder: ASSETS_DIR, or ./overrides if there is one, or "".
+func assetsDir() string {
+	if dir := os.Getenv("ASSETS_DIR"); dir != "" {
+		return dir
+	}
+	if fi, err := os.Stat(defaultAssetsDir); err == nil && fi.IsDir() {
+		return defaultAssetsDir
+	}
+	return ""
+}
+
+// assetFS returns the files to use: the embedded ones, overlaid with the override folder.
+func assetFS() fs.FS {
+	o := overlayFS{base: embeddedAssets}
+	if dir := assetsDir(); dir != "" {
+		o.dir = os.DirFS(dir)
+	}
+	return o
+}
+
+// overriddenAssets lists the files in dir that take the place of (or are added to) the
+// built-in ones: those under templates/, static/ and locales/.
+func overriddenAssets(dir string) []string {
+	var files []string
+	for _, sub := range []string{"templates", "static", "locales"} {
+		fs.WalkDir(os.DirFS(dir), sub, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, path)
+			}
+			return nil // a missing sub folder is fine
+		})
+	}
+	return files
+}
+
+// hasCustomCSS is set by loadTemplates when there is a static/custom.css to load.
+var hasCustomCSS bool
+
+// templateFuncs are the functions templates can call besides the built-in ones: t translates
+// (i18n.go), date and shortdate write a date in the user's style (dates.go), markdown and
+// markdownInline render what you wrote (markdown.go), bytes writes a file size (instance.go),
+// customCSS says whether there is a static/custom.css. They have to be known before parsing.
+var templateFuncs = template.FuncMap{
+	"t":              translate,
+	"date":           formatDate,
+	"shortdate":      formatShortDate,
+	"markdown":       RenderMarkdown,
+	"markdownInline": RenderMarkdownInline,
+	"bytes":          formatBytes,
+	"customCSS":      func() bool { return hasCustomCSS },
+}
+
+// loadTemplates parses every page template and loads the translations. It is called from main
+// after .env is loaded, so ASSETS_DIR is known. ParseFS is like ParseGlob, but reads from an
+// fs.FS instead of the disk.
+func loadTemplates() error {
+	if err := loadCatalogs(); err != nil {
+		return err
+	}
+	if dir := assetsDir(); dir != "" {
+		files := overriddenAssets(dir)
+		if len(files) == 0 {
+			log.Printf("override folder %s has no templates/, static/ or locales/ files", dir)
+		} else {
+			log.Printf("overrides from %s: %s", dir, strings.Join(files, ", "))
+		}
+		hasCustomCSS = containsString(files, "static/custom.css")
+	}
+	t, err := template.New("").Funcs(templateFuncs).ParseFS(assetFS(), "templates/*.html")
+	if err != nil {
+		return err
+	}
+	tmpl = t
+	return nil
+}
+
+// staticHandler serves the static files under /static/. http.FileServer does the work;
+// StripPrefix turns "/static/sw.js" into "sw.js" and fs.Sub makes "static" the root.
+// The service worker gets "Service-Worker-Allowed: /" so it may control the whole site.
+func staticHandler() http.Handler {
+	static, err := fs.Sub(assetFS(), "static")
+	if err != nil {
+		panic(err) // only fails for an invalid path name, which "static" is not
+	}
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/static/sw.js" {
+			w.Header().Set("Service-Worker-Allowed", "/")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,165 @@
+// auth.go - A password in front of the whole app, for running it where others can reach it.
+// The app has one owner, so there are no accounts: set one password in .env,
+//
+//	APP_PASSWORD=a long passphrase
+//
+// and every page asks for it once per browser (a login page, then a cookie for 30 days).
+// Scripts send it with HTTP basic auth instead, under any user name:
+//
+//	curl -u :a-long-passphrase http://localhost:8080/api/v1/today
+//	./crescendo -remote http://:a-long-passphrase@localhost:8080 status
+//
+// Links meant for other people or devices keep working without it, because they carry their
+// own secret: share, widget, share card, challenge and household links, quick-log links, the
+// signed week review link, the inbound email webhook, and the sync, admin and profiling
+// endpoints (which check SYNC_TOKEN and ADMIN_TOKEN). Changing the password logs every browser out.
+
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie = "crescendo_session"
+	sessionDays   = 30
+)
+
+// publicPrefixes are the paths that don't need the password (see the top of this file). An
+// entry ending in "/" covers everything under it; any other entry is that exact path only, so
+// "/review" (the signed link) doesn't also open "/reviews" (your reflections).
+var publicPrefixes = []string{"/login", "/static/", "/share/", "/share-card/", "/widget/", "/inbound-email/", "/quick/", "/quick-todo", "/challenges/join/", "/challenges/me/", "/household/", "/review", "/api/v1/sync", "/admin/reset", "/debug/pprof/"}
+
+// appPassword returns APP_PASSWORD from .env; "" means no password.
+func appPassword() string {
+	return os.Getenv("APP_PASSWORD")
+}
+
+// passwordMatches compares in constant time, so the answer time doesn't give the password away.
+func passwordMatches(got string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(appPassword())) == 1
+}
+
+// sessionValue is the cookie for a login: when it expires, signed with LINK_SECRET (review.go).
+// The password is part of what is signed, so changing it makes old cookies invalid.
+func sessionValue(expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + signLink("session:"+appPassword(), exp)
+}
+
+// validSession checks the session cookie of r.
+func validSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	exp, sig, _ := strings.Cut(c.Value, ".")
+	n, err := strconv.ParseInt(exp, 10, 64)
+	return err == nil && time.Now().Unix() < n && validLink("session:"+appPassword(), exp, sig)
+}
+
+// RequirePassword wraps the app's handler: without APP_PASSWORD it changes nothing; with it,
+// requests need the session cookie or basic auth. Pages send you to the login page; the API
+// answers 401, which makes browsers and curl ask for the password.
+func RequirePassword(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if appPassword() == "" || validSession(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, pass, ok := r.BasicAuth(); ok && passwordMatches(pass) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.Method != http.MethodGet {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Habit Tracker"`)
+			http.Error(w, "Password required", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	})
+}
+
+// isPublicPath reports whether path is in publicPrefixes.
+func isPublicPath(path string) bool {
+	for _, p := range publicPrefixes {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginPageData is what templates/login.html shows.
+type LoginPageData struct {
+	Settings Settings
+	Next     string
+	Wrong    bool
+}
+
+// safeNext returns where to go after logging in: next if it is a path on this site, else "/".
+// (Only paths: "//evil.example" or "https://..." would send you elsewhere.)
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// HandleLogin shows the login page (GET /login) and checks the password (POST).
+func HandleLogin(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.FormValue("next"))
+	if appPassword() == "" {
+		http.Redirect(w, r, next, http.StatusFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		pd := LoginPageData{Next: next, Wrong: r.URL.Query().Get("wrong") == "1"}
+		if data, err := LoadData(); err == nil {
+			pd.Settings = data.Settings // only for the theme
+		}
+		if err := tmpl.ExecuteTemplate(w, "login.html", pd); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		if !passwordMatches(r.FormValue("password")) {
+			time.Sleep(time.Second) // makes guessing slow
+			http.Redirect(w, r, "/login?wrong=1&next="+url.QueryEscape(next), http.StatusFound)
+			return
+		}
+		expires := time.Now().AddDate(0, 0, sessionDays)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    sessionValue(expires),
+			Path:     "/",
+			Expires:  expires,
+			HttpOnly: true,                 // not readable from JavaScript
+			Secure:   r.TLS != nil,         // only sent over HTTPS when we're on HTTPS
+			SameSite: http.SameSiteLaxMode, // not sent with forms posted from other sites
+		})
+		http.Redirect(w, r, next, http.StatusFound)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleLogout forgets the session cookie (POST /logout).
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
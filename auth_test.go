@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequirePasswordPublicPaths checks that only the exact public paths (and what's under the
+// ones ending in "/") skip the password: /reviews holds your reflections and must not.
+func TestRequirePasswordPublicPaths(t *testing.T) {
+	t.Setenv("APP_PASSWORD", "secret")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := RequirePassword(ok)
+
+	cases := []struct {
+		path   string
+		public bool
+	}{
+		{"/review", true},
+		{"/reviews", false},
+		{"/login", true},
+		{"/loginx", false},
+		{"/quick-todo", true},
+		{"/quick-todo-admin", false},
+		{"/share/abc", true},
+		{"/challenges/me/tok", true},
+		{"/", false},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if c.public && rec.Code != http.StatusOK {
+			t.Errorf("GET %s: got %d, want 200 (public)", c.path, rec.Code)
+		}
+		if !c.public && rec.Code != http.StatusFound {
+			t.Errorf("GET %s: got %d, want a redirect to /login", c.path, rec.Code)
+		}
+	}
+}
+
+func TestReviewsRedirectsToLogin(t *testing.T) {
+	t.Setenv("APP_PASSWORD", "secret")
+	h := RequirePassword(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the reviews page was served without the password")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reviews", nil))
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/login?next=%2Freviews") {
+		t.Fatalf("GET /reviews: got %d to %q, want a redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,340 @@
+// autobackup.go - Backups the app takes by itself. Once a day (BACKUP_EVERY, default 24h; "off"
+// turns it off) the whole data is written as one file, "snapshot-20250301-030000.json", to the
+// backup store (blobs.go): BACKUP_DIR (default ./backups) on disk, or backups/ in the S3 bucket.
+// Unlike -backup (backup.go) every snapshot is complete on its own, so old ones can simply be
+// deleted. After each one the retention policy does that: it keeps the newest snapshot of each
+// of the last 7 days (BACKUP_KEEP_DAILY) and of each of the last 4 weeks (BACKUP_KEEP_WEEKLY).
+//
+// /backups lists the snapshots, with what's in each, to download one, take one now, or restore
+// one (restore.go).
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// snapshotLayout is the time in a snapshot's name, which is all we need to know when it was taken.
+const snapshotLayout = "20060102-150405"
+
+// snapshotName matches the names WriteSnapshot gives snapshots: the kind, then the time.
+var snapshotName = regexp.MustCompile(`^(snapshot|pre-restore)-(\d{8}-\d{6})\.json$`)
+
+// The kinds of snapshot: the scheduled ones, and the copy of the data taken before a restore
+// replaces it (restore.go). Those aren't touched by the retention policy.
+const (
+	scheduledSnapshot  = "snapshot"
+	preRestoreSnapshot = "pre-restore"
+)
+
+// Snapshot is one snapshot in the backup store.
+type Snapshot struct {
+	Name    string
+	Kind    string // scheduledSnapshot or preRestoreSnapshot
+	Time    time.Time
+	Size    int64
+	Kept    string           // why it's kept: "daily", "weekly" or "before a restore" ("" = it goes next time)
+	Summary *SnapshotSummary // what's in it, when it could be read (restore.go)
+}
+
+// KB is the snapshot's size in kilobytes, rounded up.
+func (s Snapshot) KB() int64 {
+	return (s.Size + 1023) / 1024
+}
+
+// backupDir is where snapshots are kept on disk: BACKUP_DIR, or ./backups.
+func backupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return "backups"
+}
+
+// snapshotStore is the store snapshots are kept in (blobs.go).
+func snapshotStore() BlobStore {
+	return newBlobStore(backupDir(), "backups/")
+}
+
+// backupInterval is how often a snapshot is taken: BACKUP_EVERY, default 24h. 0 means never.
+func backupInterval() time.Duration {
+	s := os.Getenv("BACKUP_EVERY")
+	if s == "" {
+		return 24 * time.Hour
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// ListSnapshots returns the snapshots in store, newest first, with what the retention policy
+// makes of them.
+func ListSnapshots(store BlobStore) ([]Snapshot, error) {
+	blobs, err := store.List("")
+	if err != nil {
+		return nil, err
+	}
+	var list []Snapshot
+	for _, b := range blobs {
+		m := snapshotName.FindStringSubmatch(b.Key)
+		if m == nil {
+			continue
+		}
+		t, err := time.ParseInLocation(snapshotLayout, m[2], time.Local)
+		if err != nil {
+			continue
+		}
+		list = append(list, Snapshot{Name: b.Key, Kind: m[1], Time: t, Size: b.Size})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	markKept(list, envInt("BACKUP_KEEP_DAILY", 7), envInt("BACKUP_KEEP_WEEKLY", 4))
+	return list, nil
+}
+
+// markKept fills in Kept for list (newest first): the newest scheduled snapshot of each of the
+// last keepDaily days that have one is kept as "daily", and the newest of each of the last
+// keepWeekly weeks (Monday to Sunday) as "weekly". The newest scheduled snapshot is always kept,
+// and so are all pre-restore ones.
+func markKept(list []Snapshot, keepDaily, keepWeekly int) {
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	newest := -1
+	for i := range list {
+		if list[i].Kind != scheduledSnapshot {
+			list[i].Kept = "before a restore"
+			continue
+		}
+		if newest < 0 {
+			newest = i
+		}
+		day := list[i].Time.Format(dateLayout)
+		year, w := list[i].Time.ISOWeek()
+		week := fmt.Sprintf("%d-W%02d", year, w)
+		if !days[day] {
+			days[day] = true
+			if len(days) <= keepDaily {
+				list[i].Kept = "daily"
+			}
+		}
+		if !weeks[week] {
+			weeks[week] = true
+			if len(weeks) <= keepWeekly && list[i].Kept == "" {
+				list[i].Kept = "weekly"
+			}
+		}
+	}
+	if newest >= 0 && list[newest].Kept == "" {
+		list[newest].Kept = "daily"
+	}
+}
+
+// WriteSnapshot writes the current data to store as a new snapshot of kind and returns its name.
+func WriteSnapshot(store BlobStore, kind string, now time.Time) (string, error) {
+	data, err := LoadData()
+	if err != nil {
+		return "", err
+	}
+	content, err := json.MarshalIndent(BackupBase{Time: now, AppVersion: GetBuildInfo().String(), Data: data}, "", "  ")
+	if err == nil {
+		content, err = sealData(content) // as private as data.json (encrypt.go)
+	}
+	if err != nil {
+		return "", err
+	}
+	name := kind + "-" + now.Format(snapshotLayout) + ".json"
+	return name, store.Put(name, content, "application/json")
+}
+
+// PruneSnapshots deletes the snapshots the retention policy doesn't keep.
+func PruneSnapshots(store BlobStore) error {
+	list, err := ListSnapshots(store)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		if s.Kept != "" {
+			continue
+		}
+		if err := store.Delete(s.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSnapshot reads the snapshot called name from store. Its data is upgraded to the current
+// schema, like data.json when it's loaded.
+func ReadSnapshot(store BlobStore, name string) (*AppData, error) {
+	content, err := store.Get(name)
+	if err == nil {
+		content, err = openData(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var base struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(content, &base); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(base.Data) == 0 || string(base.Data) == "null" {
+		return nil, fmt.Errorf("%s: no data in snapshot", name)
+	}
+	return decodeData(base.Data)
+}
+
+// takeSnapshot writes a snapshot now and applies the retention policy.
+func takeSnapshot(store BlobStore) (string, error) {
+	name, err := WriteSnapshot(store, scheduledSnapshot, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if err := PruneSnapshots(store); err != nil {
+		log.Println("pruning backups:", err)
+	}
+	return name, nil
+}
+
+// RunBackups takes a snapshot whenever the newest one is older than backupInterval. It checks
+// once a minute, so a computer that was asleep catches up soon after waking.
+func RunBackups() {
+	every := backupInterval()
+	if every == 0 {
+		return
+	}
+	backups := snapshotStore()
+	var last time.Time
+	if list, err := ListSnapshots(backups); err != nil {
+		log.Println("backups:", err)
+	} else if len(list) > 0 {
+		last = list[0].Time
+	}
+	for {
+		if time.Since(last) >= every {
+			if _, err := takeSnapshot(backups); err != nil {
+				log.Println("backup:", err)
+				last = time.Now().Add(time.Hour - every) // try again in an hour
+			} else {
+				last = time.Now()
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// BackupsPageData is what backups.html gets.
+type BackupsPageData struct {
+	Settings  Settings
+	Revision  int64
+	Dates     DateStyle
+	Current   SnapshotSummary // the data as it is now, to compare the snapshots with
+	Snapshots []Snapshot
+	Store     string // "disk" or "s3"
+	Dir       string
+	Every     time.Duration
+	Daily     int
+	Weekly    int
+	Message   string
+}
+
+// HandleBackups handles GET /backups: the list of snapshots.
+func HandleBackups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	backups := snapshotStore()
+	pd := BackupsPageData{
+		Settings: data.Settings,
+		Revision: data.Revision,
+		Dates:    RequestDates(r, data.Settings),
+		Store:    backups.Name(),
+		Dir:      backupDir(),
+		Every:    backupInterval(),
+		Daily:    envInt("BACKUP_KEEP_DAILY", 7),
+		Weekly:   envInt("BACKUP_KEEP_WEEKLY", 4),
+	}
+	pd.Current = SummarizeData(data)
+	pd.Snapshots, err = ListSnapshots(backups)
+	if err != nil {
+		pd.Message = "The backups can't be listed: " + err.Error()
+	}
+	for i := range pd.Snapshots {
+		if snap, err := ReadSnapshot(backups, pd.Snapshots[i].Name); err != nil {
+			log.Println("reading backup:", err)
+		} else {
+			sum := SummarizeData(snap)
+			pd.Snapshots[i].Summary = &sum
+		}
+	}
+	switch q := r.URL.Query(); {
+	case q.Get("saved") != "":
+		pd.Message = "Backup " + q.Get("saved") + " saved."
+	case q.Get("restored") != "":
+		pd.Message = "Restored the data from " + q.Get("restored") + "."
+		if before := q.Get("before"); before != "" {
+			pd.Message += " The data from before is kept as " + before + ", to undo it."
+		}
+	case q.Get("error") == "notfound":
+		pd.Message = "That backup doesn't exist (any more)."
+	case q.Get("error") == "backup":
+		pd.Message = "The backup failed, see the server log."
+	case q.Get("error") == "restore":
+		pd.Message = "That backup can't be read, so nothing was restored. See the server log."
+	}
+	if err := tmpl.ExecuteTemplate(w, "backups.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleBackupDownload handles GET /backups/download?name=snapshot-...json: the file itself
+// (encrypted, if DATA_PASSPHRASE is set).
+func HandleBackupDownload(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if !snapshotName.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := snapshotStore().Get(name)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Write(content)
+}
+
+// HandleBackupNow handles POST /backups/now: takes a snapshot right away.
+func HandleBackupNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, err := takeSnapshot(snapshotStore())
+	if err != nil {
+		log.Println("backup:", err)
+		http.Redirect(w, r, "/backups?error=backup", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/backups?saved="+name, http.StatusFound)
+}
@@ -0,0 +1,194 @@
+// backup.go - Differential backups. The first backup into a folder is a full copy of the data
+// (the "base"); every later one only holds the journal events (journal.go) saved since the
+// previous backup, which is usually a few kilobytes. That keeps copying backups to a remote
+// disk or server cheap.
+//
+//	go run . -backup /mnt/nas/habits          (base the first time, then only the changes)
+//	go run . -backup /mnt/nas/habits -full    (force a new base)
+//	go run . -restore /mnt/nas/habits -out restored.json
+//
+// Restoring replays the diffs over the base, in order. Like -rebuild-journal, it never touches
+// data.json: check the output, then swap it in by hand.
+//
+// The running app also takes a full backup every day by itself: see autobackup.go.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupManifestFile lists, inside the backup folder, the base and the diffs that follow it.
+const backupManifestFile = "backup-manifest.json"
+
+// BackupManifest says which files make up the current backup chain.
+type BackupManifest struct {
+	Base        string   `json:"base"`          // file name of the full copy
+	Diffs       []string `json:"diffs"`         // file names of the diffs, oldest first
+	LastEventID string   `json:"last_event_id"` // newest journal event included so far
+}
+
+// BackupBase is the content of a base file: the full data and where in the journal it was taken.
+type BackupBase struct {
+	Time        time.Time `json:"time"`
+	AppVersion  string    `json:"app_version,omitempty"` // the build that wrote it (version.go)
+	LastEventID string    `json:"last_event_id"`
+	Data        *AppData  `json:"data"`
+}
+
+// loadBackupManifest reads the manifest in dir (an empty one if this is a new backup folder).
+func loadBackupManifest(dir string) (BackupManifest, error) {
+	var m BackupManifest
+	b, err := os.ReadFile(filepath.Join(dir, backupManifestFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(b, &m)
+}
+
+// WriteBackup adds a backup to dir and returns the name of the file it wrote ("" if nothing
+// changed since the last backup). It writes a new base when full is set, when dir has no base
+// yet, or when the last backed-up event is no longer in the journal (the journal was replaced).
+func WriteBackup(dir string, full bool) (string, error) {
+	// Take the data and the journal together under mu, so they match: SaveData writes the
+	// journal first, and nothing can be halfway saved while we hold the lock.
+	mu.Lock()
+	data, err := storedDataLocked()
+	var events []JournalEvent
+	if err == nil {
+		events, err = readJournal()
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	m, err := loadBackupManifest(dir)
+	if err != nil {
+		return "", err
+	}
+	lastID := ""
+	if len(events) > 0 {
+		lastID = events[len(events)-1].ID
+	}
+
+	// Find where the previous backup stopped. -1 means "not found": a new base is needed.
+	start := -1
+	if m.Base != "" && !full {
+		if m.LastEventID == "" {
+			start = 0
+		}
+		for i, ev := range events {
+			if ev.ID == m.LastEventID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	var name string
+	var content []byte
+	if start < 0 {
+		name = "base-" + stamp + ".json"
+		content, err = json.MarshalIndent(BackupBase{Time: time.Now(), AppVersion: GetBuildInfo().String(), LastEventID: lastID, Data: data}, "", "  ")
+		if err == nil {
+			content, err = sealData(content) // backups are as private as data.json (encrypt.go)
+		}
+		if err != nil {
+			return "", err
+		}
+		m = BackupManifest{Base: name}
+	} else {
+		if start == len(events) {
+			return "", nil // nothing new since the last backup
+		}
+		name = fmt.Sprintf("diff-%04d-%s.jsonl", len(m.Diffs)+1, stamp) // numbered, so names never clash
+		for _, ev := range events[start:] {
+			line, err := json.Marshal(ev)
+			if err == nil {
+				line, err = sealData(line)
+			}
+			if err != nil {
+				return "", err
+			}
+			content = append(append(content, line...), '\n')
+		}
+		m.Diffs = append(m.Diffs, name)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+		return "", err
+	}
+	// The manifest is written last: if we crash before this, the new file is simply ignored.
+	m.LastEventID = lastID
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return name, os.WriteFile(filepath.Join(dir, backupManifestFile), mb, 0644)
+}
+
+// RestoreBackup rebuilds the data from the backup chain in dir and writes it to outPath.
+func RestoreBackup(dir, outPath string) error {
+	m, err := loadBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	if m.Base == "" {
+		return fmt.Errorf("no backup found in %s", dir)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, m.Base))
+	if err == nil {
+		b, err = openData(b)
+	}
+	if err != nil {
+		return err
+	}
+	var base BackupBase
+	if err := json.Unmarshal(b, &base); err != nil {
+		return fmt.Errorf("%s: %w", m.Base, err)
+	}
+	data := base.Data
+	if data == nil {
+		return fmt.Errorf("%s: no data in base", m.Base)
+	}
+	if now := GetBuildInfo().String(); base.AppVersion != "" && base.AppVersion != now {
+		log.Printf("%s was written by version %s, restoring with %s", m.Base, base.AppVersion, now)
+	}
+	if data.History == nil {
+		data.History = make(map[string]DayRecord)
+	}
+	for _, name := range m.Diffs {
+		events, err := ReadJournal(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, ev := range events {
+			if err := ApplyJournalEvent(data, ev); err != nil {
+				return fmt.Errorf("%s: event %s: %w", name, ev.ID, err)
+			}
+		}
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err == nil {
+		out, err = sealData(out)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, out, 0644)
+}
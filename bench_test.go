@@ -0,0 +1,108 @@
+// bench_test.go - Benchmarks for the parts that get slow as the data grows: loading and saving
+// the data, and building the calendars on the main page. They run on generated data (seed.go)
+// in a temporary folder, so data.json is never touched:
+//
+//	go test -run '^$' -bench . -benchmem
+//
+// Each line says how long one operation took and how much it allocated, for a small and a large
+// dataset. Run it before and after a change to the storage (store.go, journal.go) or the main
+// page, on the same machine, to see whether it got slower (benchstat compares two runs).
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// benchSizes are the datasets the benchmarks run on: habits and months of history.
+var benchSizes = []struct{ habits, months int }{
+	{10, 6},
+	{40, 36},
+}
+
+// forEachBenchSize runs fn as a sub-benchmark for each size, with that much generated data in
+// data.json. data.json and the journal are relative paths, so the test works in a b.TempDir()
+// for each size and goes back afterwards; only the test binary moves, never the app.
+func forEachBenchSize(b *testing.B, fn func(b *testing.B)) {
+	b.Setenv("WRITE_DELAY_MS", "0") // every save writes data.json, so SaveData measures all of it
+	wd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Now()
+	for _, size := range benchSizes {
+		if err := os.Chdir(b.TempDir()); err != nil {
+			b.Fatal(err)
+		}
+		// The store notices data.json is a different (here: missing) file and starts over.
+		if err := replaceWithSeed(SeedData(size.habits, size.months, 1, now)); err != nil {
+			os.Chdir(wd)
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("%dhabits-%dmonths", size.habits, size.months), fn)
+		if err := os.Chdir(wd); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadData measures LoadData when the data is already in memory: that's every request.
+func BenchmarkLoadData(b *testing.B) {
+	forEachBenchSize(b, func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := LoadData(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkReadDataFile measures reading and decoding data.json, as on startup or after a sync.
+func BenchmarkReadDataFile(b *testing.B) {
+	forEachBenchSize(b, func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := loadDataFile(dataFile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSaveData measures a Done click: load, mark one habit done (or not) today, save.
+func BenchmarkSaveData(b *testing.B) {
+	forEachBenchSize(b, func(b *testing.B) {
+		b.ReportAllocs()
+		today := Today()
+		for i := 0; i < b.N; i++ {
+			data, err := LoadData()
+			if err != nil {
+				b.Fatal(err)
+			}
+			SetHabitCompleted(data, data.Habits[0].ID, today, i%2 == 0)
+			if err := SaveData(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkBuildCalendars measures building the calendars of all habits for the main page.
+func BenchmarkBuildCalendars(b *testing.B) {
+	forEachBenchSize(b, func(b *testing.B) {
+		data, err := LoadData()
+		if err != nil {
+			b.Fatal(err)
+		}
+		now := time.Now()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			buildCalendars(data, now)
+		}
+	})
+}
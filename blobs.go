@@ -0,0 +1,303 @@
+// blobs.go - Where files that aren't data.json are kept: photos (photos.go) and backups
+// (backup.go). A BlobStore keeps "blobs" (any bytes) under a key like "3/2025-03-01-abc.jpg".
+// There are two kinds:
+//
+//   - on disk (the default): photos in UPLOADS_DIR, backups in BACKUP_DIR.
+//   - S3 or anything that speaks its API (MinIO, Backblaze B2, Cloudflare R2, ...), when
+//     S3_BUCKET is set in .env:
+//
+//     S3_BUCKET=habits S3_ACCESS_KEY=... S3_SECRET_KEY=...
+//     S3_ENDPOINT=http://minio:9000   (default https://s3.<region>.amazonaws.com)
+//     S3_REGION=eu-central-1          (default us-east-1)
+//     S3_PREFIX=home/                 (optional, put in front of every key)
+//
+//     Photos then go under photos/ in the bucket, and backups under backups/.
+//
+// Requests to S3 are signed with AWS Signature Version 4 (signV4 below), by hand rather than
+// with the AWS SDK, to keep the app's dependencies small. Buckets are addressed path-style
+// (endpoint/bucket/key), which MinIO and the others expect and AWS still accepts.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BlobStore keeps blobs by key. Keys use "/" between folders. Get returns an error that
+// errors.Is(err, fs.ErrNotExist) for a key that isn't there. List returns the blobs whose keys
+// start with prefix, in no particular order.
+type BlobStore interface {
+	Name() string
+	Put(key string, content []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	List(prefix string) ([]BlobInfo, error)
+}
+
+// BlobInfo is one blob in a list.
+type BlobInfo struct {
+	Key  string
+	Size int64
+}
+
+// newBlobStore returns the store for one kind of file: S3 under prefix if S3_BUCKET is set,
+// otherwise the folder dir on disk.
+func newBlobStore(dir, prefix string) BlobStore {
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		s := s3Blobs{
+			endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+			bucket:    bucket,
+			region:    os.Getenv("S3_REGION"),
+			accessKey: os.Getenv("S3_ACCESS_KEY"),
+			secretKey: os.Getenv("S3_SECRET_KEY"),
+			prefix:    os.Getenv("S3_PREFIX") + prefix,
+		}
+		if s.region == "" {
+			s.region = "us-east-1"
+		}
+		if s.endpoint == "" {
+			s.endpoint = "https://s3." + s.region + ".amazonaws.com"
+		}
+		return s
+	}
+	return diskBlobs{dir: dir}
+}
+
+// diskBlobs keeps blobs as files under dir.
+type diskBlobs struct {
+	dir string
+}
+
+func (diskBlobs) Name() string { return "disk" }
+
+// path is where key is on disk. Keys come from the app, but a ".." could still leave dir, so
+// it's refused.
+func (d diskBlobs) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) || filepath.IsAbs(clean) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(d.dir, clean), nil
+}
+
+func (d diskBlobs) Put(key string, content []byte, contentType string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, content, 0644)
+}
+
+func (d diskBlobs) Get(key string) ([]byte, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (d diskBlobs) Delete(key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List only looks at the files directly in dir: that's all the callers need.
+func (d diskBlobs) List(prefix string) ([]BlobInfo, error) {
+	entries, err := os.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []BlobInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		if fi, err := e.Info(); err == nil {
+			list = append(list, BlobInfo{Key: e.Name(), Size: fi.Size()})
+		}
+	}
+	return list, nil
+}
+
+// s3Blobs keeps blobs as objects in an S3 bucket, each key behind prefix.
+type s3Blobs struct {
+	endpoint, bucket, region, accessKey, secretKey, prefix string
+}
+
+func (s3Blobs) Name() string { return "s3" }
+
+// do sends one signed request for key (with the query, if any) and returns the response body;
+// a 404 is fs.ErrNotExist. An empty key is the bucket itself.
+func (s s3Blobs) do(method, key string, query url.Values, body []byte, contentType string) ([]byte, error) {
+	path := s.bucket
+	if key != "" {
+		path += "/" + s.prefix + key
+	}
+	var segments []string
+	for _, seg := range strings.Split(path, "/") {
+		segments = append(segments, url.PathEscape(seg))
+	}
+	u := s.endpoint + "/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		// S3 wants spaces in the query as %20, not the + that Encode writes.
+		u += "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signV4(req, body, s.accessKey, s.secretKey, s.region, time.Now())
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("s3 %s: %w", key, fs.ErrNotExist)
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("s3 %s %s returned %s: %s", method, key, resp.Status, bytes.TrimSpace(out))
+	}
+	return out, nil
+}
+
+func (s s3Blobs) Put(key string, content []byte, contentType string) error {
+	_, err := s.do(http.MethodPut, key, nil, content, contentType)
+	return err
+}
+
+func (s s3Blobs) Get(key string) ([]byte, error) {
+	return s.do(http.MethodGet, key, nil, nil, "")
+}
+
+func (s s3Blobs) Delete(key string) error {
+	_, err := s.do(http.MethodDelete, key, nil, nil, "")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3ListResult is the part of a ListObjectsV2 answer we use.
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List asks for the keys page by page (S3 answers with up to 1000 at a time). The keys it
+// returns are without the store's prefix, like the ones passed to Put.
+func (s s3Blobs) List(prefix string) ([]BlobInfo, error) {
+	var list []BlobInfo
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+	for {
+		body, err := s.do(http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var res s3ListResult
+		if err := xml.Unmarshal(body, &res); err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+		for _, c := range res.Contents {
+			list = append(list, BlobInfo{Key: strings.TrimPrefix(c.Key, s.prefix), Size: c.Size})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return list, nil
+		}
+		query.Set("continuation-token", res.NextContinuationToken)
+	}
+}
+
+// hmacSHA256 is one step of the Signature Version 4 key derivation.
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// signV4 signs req for S3 with AWS Signature Version 4: the request (method, path, query, the
+// headers set so far and a hash of the body) is written out in a fixed "canonical" form, and
+// that is signed with a key derived from the secret, the day and the region. The signature
+// goes in the Authorization header.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
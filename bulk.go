@@ -0,0 +1,153 @@
+// bulk.go - Several changes in one request: POST /api/v1/bulk takes a list of operations and
+// applies them all, or none. They are made one after the other on one copy of the data and saved
+// once, so a script or the terminal (cli.go) marking five habits done makes one round trip and one
+// save (one transaction on Postgres), and never leaves half of them done:
+//
+//	{"ops": [
+//	  {"op": "complete", "habit_id": 3},
+//	  {"op": "uncomplete", "habit_id": 4, "date": "2025-10-14"},
+//	  {"op": "add_todo", "text": "Call the dentist", "priority": "high", "due_date": "2025-10-20"},
+//	  {"op": "complete_todo", "todo_id": 7}
+//	]}
+//
+// If any operation can't be done, nothing is saved and the answer is 422 with the reason for each
+// one that failed. /api/v1/batch (the offline queue, api.go) is different on purpose: there each
+// completion counts on its own, so one deleted habit doesn't hold up the rest of the queue.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxBulkOps is how many operations one request may have.
+const maxBulkOps = 100
+
+// BulkOp is one operation. Op says which; the other fields are what it needs.
+type BulkOp struct {
+	Op       string `json:"op"`                 // "complete", "uncomplete", "add_todo" or "complete_todo"
+	HabitID  int    `json:"habit_id,omitempty"` // complete, uncomplete
+	Date     string `json:"date,omitempty"`     // complete, uncomplete: default today, at most 7 days back
+	Text     string `json:"text,omitempty"`     // add_todo
+	Priority string `json:"priority,omitempty"` // add_todo: "high", "medium", "low" or ""
+	DueDate  string `json:"due_date,omitempty"` // add_todo: YYYY-MM-DD or ""
+	TodoID   int    `json:"todo_id,omitempty"`  // complete_todo
+}
+
+// BulkRequest is the body of POST /api/v1/bulk.
+type BulkRequest struct {
+	Ops []BulkOp `json:"ops"`
+}
+
+// BulkResult is the answer: how many operations were applied (all or none), the IDs of the
+// added todos, and the revision after the save (for If-Match on the next change, revision.go).
+type BulkResult struct {
+	Applied  int      `json:"applied"`
+	TodoIDs  []int    `json:"todo_ids,omitempty"`
+	Revision int64    `json:"revision"`
+	Errors   []string `json:"errors,omitempty"` // when nothing was applied: one per operation, "" for the fine ones
+}
+
+// applyBulk makes ops on data in order, so an operation sees what the ones before it did (a habit
+// completed first counts for the habit that comes after it). It returns the IDs of added todos,
+// and errs with one entry per operation if any failed; data is then half changed and must not be
+// saved.
+func applyBulk(data *AppData, ops []BulkOp) (todoIDs []int, errs []string) {
+	today := Today()
+	errs = make([]string, len(ops))
+	failed := false
+	for i, op := range ops {
+		if err := applyBulkOp(data, op, today, &todoIDs); err != "" {
+			errs[i], failed = err, true
+		}
+	}
+	if !failed {
+		errs = nil
+	}
+	return todoIDs, errs
+}
+
+// applyBulkOp makes one operation, returning why it can't ("" if it was made).
+func applyBulkOp(data *AppData, op BulkOp, today string, todoIDs *[]int) string {
+	switch op.Op {
+	case "complete", "uncomplete":
+		h := FindHabitByID(data, op.HabitID)
+		if h == nil {
+			return "habit not found"
+		}
+		if op.Date == "" {
+			op.Date = today
+		}
+		if !recentDate(op.Date, today) {
+			return "date must be within the last 7 days"
+		}
+		if op.Op == "complete" {
+			if msg := completionBlocked(data, h, op.Date); msg != "" {
+				return msg
+			}
+		}
+		SetHabitCompleted(data, h.ID, op.Date, op.Op == "complete")
+	case "add_todo":
+		text := strings.TrimSpace(op.Text)
+		switch {
+		case text == "":
+			return "text is empty"
+		case !ValidPriority(op.Priority):
+			return fmt.Sprintf("unknown priority %q", op.Priority)
+		case op.DueDate != "":
+			if _, err := ParseDate(op.DueDate); err != nil {
+				return "due_date must be YYYY-MM-DD"
+			}
+		}
+		t := Todo{ID: NextTodoID(data), Text: text, Priority: op.Priority, DueDate: op.DueDate}
+		data.Todos = append(data.Todos, t)
+		*todoIDs = append(*todoIDs, t.ID)
+	case "complete_todo":
+		for i, t := range data.Todos {
+			if t.ID == op.TodoID {
+				data.Todos = append(data.Todos[:i], data.Todos[i+1:]...)
+				markTodoDone(data, op.TodoID)
+				return ""
+			}
+		}
+		return "todo not found"
+	default:
+		return fmt.Sprintf("unknown op %q", op.Op)
+	}
+	return ""
+}
+
+// HandleBulkAPI handles POST /api/v1/bulk (see the top of this file).
+func HandleBulkAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if len(req.Ops) > maxBulkOps {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d ops per request", maxBulkOps)})
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	todoIDs, errs := applyBulk(data, req.Ops)
+	if errs != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, BulkResult{Revision: data.Revision, Errors: errs})
+		return
+	}
+	if err := SaveData(data); err != nil {
+		writeJSON(w, saveStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, BulkResult{Applied: len(req.Ops), TodoIDs: todoIDs, Revision: data.Revision})
+}
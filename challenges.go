@@ -0,0 +1,394 @@
+// challenges.go - Challenge rooms: several people doing the same habit for N days, with a
+// leaderboard of completion rates. The app has a single owner, so friends don't get accounts:
+// you create a challenge for one of your habits on /challenges and share its invite link
+// (/challenges/join/<token>). Whoever opens it picks a name and gets a personal link
+// (/challenges/me/<token>) where they check in each day and see the leaderboard.
+// Your own days come from your habit's history. Check-ins are on trust, like a paper chart.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Challenge is one challenge room.
+type Challenge struct {
+	ID           int                    `json:"id"`
+	Name         string                 `json:"name"`
+	HabitID      int                    `json:"habit_id"` // your habit that counts for you
+	Days         int                    `json:"days"`
+	StartDate    string                 `json:"start_date"`
+	InviteToken  string                 `json:"invite_token"`
+	Participants []ChallengeParticipant `json:"participants,omitempty"`
+}
+
+// ChallengeParticipant is someone who joined through the invite link.
+type ChallengeParticipant struct {
+	Name     string   `json:"name"`
+	Token    string   `json:"token"` // their personal check-in link
+	CheckIns []string `json:"check_ins,omitempty"`
+}
+
+// EndDate is the last day of the challenge.
+func (c Challenge) EndDate() string {
+	t, err := ParseDate(c.StartDate)
+	if err != nil {
+		return c.StartDate
+	}
+	return t.AddDate(0, 0, c.Days-1).Format(dateLayout)
+}
+
+// daysSoFar returns the challenge days up to today (all of them once it's over).
+func (c Challenge) daysSoFar(today string) []string {
+	end := c.EndDate()
+	if today < end {
+		end = today
+	}
+	days, err := DatesInRange(c.StartDate, end)
+	if err != nil {
+		return nil
+	}
+	return days
+}
+
+// LeaderboardRow is one person on a challenge's leaderboard.
+type LeaderboardRow struct {
+	Rank int
+	Name string
+	Done int // days done so far
+	Rate int // percent of the days so far
+	Me   bool
+}
+
+// Leaderboard ranks the host and the participants by completion rate. me is the token of the
+// participant looking at it ("" = the host; a visitor passes something that matches no one).
+func Leaderboard(data *AppData, c Challenge, today, me string) []LeaderboardRow {
+	days := c.daysSoFar(today)
+	row := func(name string, isMe bool, isDone func(day string) bool) LeaderboardRow {
+		r := LeaderboardRow{Name: name, Me: isMe}
+		for _, d := range days {
+			if isDone(d) {
+				r.Done++
+			}
+		}
+		if len(days) > 0 {
+			r.Rate = r.Done * 100 / len(days)
+		}
+		return r
+	}
+	// A habit made private after the challenge started stays hidden from the participants.
+	hidden := false
+	if h := FindHabitByID(data, c.HabitID); h != nil && h.Private && me != "" {
+		hidden = true
+	}
+	rows := []LeaderboardRow{row("Host", me == "", func(d string) bool {
+		return !hidden && containsInt(data.History[d].CompletedHabits, c.HabitID)
+	})}
+	for _, p := range c.Participants {
+		rows = append(rows, row(p.Name, p.Token == me, func(d string) bool {
+			return containsString(p.CheckIns, d)
+		}))
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Rate != rows[j].Rate {
+			return rows[i].Rate > rows[j].Rate
+		}
+		return rows[i].Done > rows[j].Done
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+	return rows
+}
+
+// findChallengeBy returns the challenge whose invite token is invite, or nil.
+func findChallengeBy(data *AppData, invite string) *Challenge {
+	for i := range data.Challenges {
+		if data.Challenges[i].InviteToken == invite {
+			return &data.Challenges[i]
+		}
+	}
+	return nil
+}
+
+// findParticipant returns the challenge and participant with the personal token, or nils.
+func findParticipant(data *AppData, token string) (*Challenge, *ChallengeParticipant) {
+	for i := range data.Challenges {
+		c := &data.Challenges[i]
+		for j := range c.Participants {
+			if c.Participants[j].Token == token {
+				return c, &c.Participants[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// nextChallengeID returns an unused challenge ID.
+func nextChallengeID(data *AppData) int {
+	max := 0
+	for _, c := range data.Challenges {
+		if c.ID > max {
+			max = c.ID
+		}
+	}
+	return max + 1
+}
+
+// NewChallenge makes a challenge for one of your habits, starting today. It returns an error
+// code for the page instead: "notfound" for a missing habit, "private" for a private one (its
+// days would show on the participants' leaderboard), "invalid" for a bad name or length.
+func NewChallenge(data *AppData, name string, habitID, days int) (Challenge, string) {
+	name = strings.TrimSpace(name)
+	h := FindHabitByID(data, habitID)
+	switch {
+	case h == nil:
+		return Challenge{}, "notfound"
+	case h.Private:
+		return Challenge{}, "private"
+	case name == "" || days < 1 || days > 365:
+		return Challenge{}, "invalid"
+	}
+	return Challenge{
+		ID:          nextChallengeID(data),
+		Name:        name,
+		HabitID:     habitID,
+		Days:        days,
+		StartDate:   Today(),
+		InviteToken: newQuickToken(),
+	}, ""
+}
+
+// ChallengeView is a challenge on the host's page.
+type ChallengeView struct {
+	Challenge
+	HabitName   string
+	EndDate     string
+	InviteURL   string
+	Leaderboard []LeaderboardRow
+	Over        bool
+}
+
+// ChallengesPageData is what challenges.html gets.
+type ChallengesPageData struct {
+	Settings   Settings
+	Revision   int64 // sent back with the forms (revision.go)
+	Challenges []ChallengeView
+	Habits     []Habit // the habits a challenge can use (not private)
+	Message    string
+}
+
+// HandleChallenges shows your challenges (GET) and creates or deletes one (POST).
+// Form: name=...&habit_id=1&days=30 (create), delete=<id>, or remove=<participant token>.
+func HandleChallenges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		flag := "created=1"
+		switch {
+		case r.FormValue("delete") != "":
+			id, _ := strconv.Atoi(r.FormValue("delete"))
+			var kept []Challenge
+			for _, c := range data.Challenges {
+				if c.ID != id {
+					kept = append(kept, c)
+				}
+			}
+			data.Challenges = kept
+			flag = "deleted=1"
+		case r.FormValue("remove") != "":
+			c, _ := findParticipant(data, r.FormValue("remove"))
+			if c == nil {
+				http.Redirect(w, r, "/challenges?error=notfound", http.StatusFound)
+				return
+			}
+			var kept []ChallengeParticipant
+			for _, p := range c.Participants {
+				if p.Token != r.FormValue("remove") {
+					kept = append(kept, p)
+				}
+			}
+			c.Participants = kept
+			flag = "removed=1"
+		default:
+			habitID, _ := strconv.Atoi(r.FormValue("habit_id"))
+			days, err := strconv.Atoi(r.FormValue("days"))
+			if err != nil {
+				days = 0
+			}
+			c, code := NewChallenge(data, r.FormValue("name"), habitID, days)
+			if code != "" {
+				http.Redirect(w, r, "/challenges?error="+code, http.StatusFound)
+				return
+			}
+			data.Challenges = append(data.Challenges, c)
+		}
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, "/challenges?"+flag, http.StatusFound)
+		return
+	}
+
+	today := Today()
+	pd := ChallengesPageData{Settings: data.Settings, Revision: data.Revision, Habits: SharedHabits(data.Habits)}
+	for _, c := range data.Challenges {
+		v := ChallengeView{
+			Challenge:   c,
+			EndDate:     c.EndDate(),
+			InviteURL:   publicURL() + "/challenges/join/" + c.InviteToken,
+			Leaderboard: Leaderboard(data, c, today, ""),
+			Over:        c.EndDate() < today,
+		}
+		if h := FindHabitByID(data, c.HabitID); h != nil {
+			v.HabitName = h.Name
+		}
+		pd.Challenges = append(pd.Challenges, v)
+	}
+	q := r.URL.Query()
+	switch {
+	case q.Get("created") == "1":
+		pd.Message = "Challenge created. Share its invite link."
+	case q.Get("deleted") == "1":
+		pd.Message = "Challenge deleted."
+	case q.Get("removed") == "1":
+		pd.Message = "Participant removed."
+	case q.Get("error") == "notfound":
+		pd.Message = "Not found."
+	case q.Get("error") == "invalid":
+		pd.Message = "Give the challenge a name and a length of 1 to 365 days."
+	case q.Get("error") == "private":
+		pd.Message = "Private habits can't be used for a challenge: the participants would see your days."
+	}
+	if err := tmpl.ExecuteTemplate(w, "challenges.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ChallengeGuestPageData is what challenge-guest.html gets, for the join and check-in pages.
+type ChallengeGuestPageData struct {
+	Settings     Settings
+	Challenge    Challenge
+	EndDate      string
+	Joining      bool // the invite page (a name form) rather than the personal page
+	Leaderboard  []LeaderboardRow
+	CanCheckIn   bool // the challenge is running today
+	CheckedToday bool
+	Message      string
+}
+
+// HandleChallengeJoin handles the invite link /challenges/join/{invite}: GET shows the challenge
+// and a name form, POST (name=...) adds the participant and sends them to their personal link.
+func HandleChallengeJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	invite := strings.TrimPrefix(r.URL.Path, "/challenges/join/")
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	c := findChallengeBy(data, invite)
+	if c == nil || c.EndDate() < Today() {
+		http.Error(w, "This invite link is not valid (anymore).", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" || len(name) > 40 {
+			http.Redirect(w, r, r.URL.Path+"?error=name", http.StatusFound)
+			return
+		}
+		token := newQuickToken()
+		c.Participants = append(c.Participants, ChallengeParticipant{Name: name, Token: token})
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, "/challenges/me/"+token+"?joined=1", http.StatusFound)
+		return
+	}
+
+	pd := ChallengeGuestPageData{
+		Settings:    data.Settings,
+		Challenge:   *c,
+		EndDate:     c.EndDate(),
+		Joining:     true,
+		Leaderboard: Leaderboard(data, *c, Today(), "visitor"),
+	}
+	if r.URL.Query().Get("error") == "name" {
+		pd.Message = "Enter a name of up to 40 characters."
+	}
+	if err := tmpl.ExecuteTemplate(w, "challenge-guest.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleChallengeMe handles a participant's personal link /challenges/me/{token}: GET shows the
+// leaderboard, POST checks in for today.
+func HandleChallengeMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/challenges/me/")
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	c, p := findParticipant(data, token)
+	if c == nil {
+		http.Error(w, "This link is not valid (anymore).", http.StatusNotFound)
+		return
+	}
+	today := Today()
+	running := c.StartDate <= today && today <= c.EndDate()
+
+	if r.Method == http.MethodPost {
+		if running && !containsString(p.CheckIns, today) {
+			p.CheckIns = append(p.CheckIns, today)
+			if err := SaveData(data); err != nil {
+				saveFailed(w, err)
+				return
+			}
+		}
+		http.Redirect(w, r, r.URL.Path+"?checked=1", http.StatusFound)
+		return
+	}
+
+	pd := ChallengeGuestPageData{
+		Settings:     data.Settings,
+		Challenge:    *c,
+		EndDate:      c.EndDate(),
+		Leaderboard:  Leaderboard(data, *c, today, token),
+		CanCheckIn:   running,
+		CheckedToday: containsString(p.CheckIns, today),
+	}
+	switch {
+	case r.URL.Query().Get("joined") == "1":
+		pd.Message = "You're in, " + p.Name + "! Bookmark this page: it's your personal link for checking in."
+	case r.URL.Query().Get("checked") == "1":
+		pd.Message = "Checked in for today. 🎉"
+	}
+	if err := tmpl.ExecuteTemplate(w, "challenge-guest.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
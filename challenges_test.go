@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestPrivateHabitCantBackChallenge checks that a private habit can't be picked for a challenge,
+// and that one made private afterwards doesn't show its days to the participants.
+func TestPrivateHabitCantBackChallenge(t *testing.T) {
+	data := &AppData{
+		History: map[string]DayRecord{"2026-03-01": {Date: "2026-03-01", CompletedHabits: []int{1, 2}}},
+		Habits:  []Habit{{ID: 1, Name: "Journal", Private: true}, {ID: 2, Name: "Run"}},
+	}
+	if _, code := NewChallenge(data, "30 days", 1, 30); code != "private" {
+		t.Fatalf("challenge on a private habit: code %q, want \"private\"", code)
+	}
+	c, code := NewChallenge(data, "30 days", 2, 30)
+	if code != "" {
+		t.Fatalf("challenge on a shared habit: code %q", code)
+	}
+	if got := SharedHabits(data.Habits); len(got) != 1 || got[0].ID != 2 {
+		t.Fatalf("habits offered for a challenge = %+v, want only Run", got)
+	}
+
+	c.StartDate = "2026-03-01"
+	data.Habits[1].Private = true // made private after the challenge started
+	for _, r := range Leaderboard(data, c, "2026-03-01", "visitor") {
+		if r.Name == "Host" && r.Done != 0 {
+			t.Errorf("a participant sees the host's private days: %+v", r)
+		}
+	}
+	for _, r := range Leaderboard(data, c, "2026-03-01", "") {
+		if r.Name == "Host" && r.Done != 1 {
+			t.Errorf("the host's own view lost their day: %+v", r)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// cli.go - Using the tracker from a terminal. The same binary that runs the server takes a few
+// commands; build it once under a shorter name:
+//
+//	go build -o crescendo .
+//	./crescendo done pushups        (or: done 3 - a habit's name or ID)
+//	./crescendo done pushups, read  (several at once: all of them or none)
+//	./crescendo undo pushups
+//	./crescendo status              (today's habits, streaks, and whether a week review is due)
+//	./crescendo review              (the week review, one question per habit)
+//	./crescendo tui                 (a full-screen dashboard, see tui.go)
+//
+// By default the commands read and write data.json in the current directory, through the same
+// LoadData/SaveData (and change journal) as the server. To use a tracker running elsewhere, pass
+// its address: ./crescendo -remote http://localhost:8080 done pushups. That goes through the
+// JSON API (api.go), which has no week review, so review only works on the local file.
+//
+// The commands share the storage through being in the same package, not through separate
+// packages: the code was not split into internal/storage, internal/logic and internal/models.
+// Everything here is one package main, on purpose (it's a project to learn Go from, one file
+// per feature), and a split would touch every file, so it's left for a change of its own.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cliCommands are the commands RunCLI knows; anything else is left to the server.
+var cliCommands = map[string]bool{"done": true, "undo": true, "status": true, "review": true, "tui": true, "help": true}
+
+// IsCLICommand reports whether args start with a command (so main doesn't start the server).
+func IsCLICommand(args []string) bool {
+	return len(args) > 0 && cliCommands[args[0]]
+}
+
+// RunCLI runs one command and returns the exit code. remote is the server's address, or "" to
+// work on the local data file. Answers to the review's questions are read from in.
+func RunCLI(args []string, remote string, in io.Reader, out io.Writer) int {
+	cmd, arg := args[0], strings.TrimSpace(strings.Join(args[1:], " "))
+	var err error
+	switch {
+	case cmd == "help":
+		fmt.Fprintln(out, "Commands: done <habit>[, <habit>...], undo <habit>[, <habit>...], status, review, tui. Add -remote URL to use a running server.")
+	case (cmd == "done" || cmd == "undo") && arg == "":
+		err = fmt.Errorf("usage: %s <habit name or ID>[, <habit>...]", cmd)
+	case cmd == "review" && remote != "":
+		err = errors.New("review works on the local data file only (the API has no week review)")
+	case cmd == "tui" && remote != "":
+		err = errors.New("tui works on the local data file only")
+	case cmd == "tui":
+		err = RunTUI(in, out)
+	case remote != "":
+		err = runRemote(cmd, arg, strings.TrimSuffix(remote, "/"), out)
+	case cmd == "review":
+		err = cliReview(in, out)
+	default:
+		err = runLocal(cmd, arg, out)
+	}
+	if err != nil {
+		fmt.Fprintln(out, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// cliFindHabit matches a habit by name (ignoring case) or ID. Unlike the Discord bot, the
+// terminal is yours, so private habits count too.
+func cliFindHabit(data *AppData, arg string) *Habit {
+	if h := findHabitNamed(data, arg); h != nil {
+		return h
+	}
+	if id, err := strconv.Atoi(arg); err == nil {
+		return FindHabitByID(data, id)
+	}
+	return nil
+}
+
+// runLocal runs done, undo or status on data.json.
+func runLocal(cmd, arg string, out io.Writer) error {
+	data, err := LoadData()
+	if err != nil {
+		return err
+	}
+	today := Today()
+	if cmd == "status" {
+		printStatus(out, data, today)
+		return nil
+	}
+	var ops []BulkOp
+	var habits []*Habit
+	for _, name := range cliHabitList(arg) {
+		h := cliFindHabit(data, name)
+		if h == nil {
+			return fmt.Errorf("no habit called %q (see: status)", name)
+		}
+		done := containsInt(data.History[today].CompletedHabits, h.ID)
+		switch {
+		case cmd == "done" && done:
+			fmt.Fprintf(out, "%s is already done today.\n", h.Name)
+			continue
+		case cmd == "undo" && !done:
+			fmt.Fprintf(out, "%s isn't done today.\n", h.Name)
+			continue
+		}
+		ops = append(ops, cliBulkOp(cmd, h.ID))
+		habits = append(habits, h)
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	// All of them or none, with one save (bulk.go).
+	if _, errs := applyBulk(data, ops); errs != nil {
+		return bulkError(errs)
+	}
+	if err := SaveData(data); err != nil {
+		return err
+	}
+	for _, h := range habits {
+		if cmd == "done" {
+			fmt.Fprintf(out, "✅ %s done (%d %s), %d-day streak.\n", h.Name, h.Quantity, h.Unit, streakEndingOn(data, h.ID, today))
+		} else {
+			fmt.Fprintf(out, "%s marked not done.\n", h.Name)
+		}
+	}
+	return nil
+}
+
+// cliHabitList splits "pushups, reading" into the habits it names.
+func cliHabitList(arg string) []string {
+	var names []string
+	for _, name := range strings.Split(arg, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// cliBulkOp is the bulk operation (bulk.go) for done or undo of a habit today.
+func cliBulkOp(cmd string, habitID int) BulkOp {
+	if cmd == "undo" {
+		return BulkOp{Op: "uncomplete", HabitID: habitID}
+	}
+	return BulkOp{Op: "complete", HabitID: habitID}
+}
+
+// bulkError joins the reasons applyBulk gave into one error.
+func bulkError(errs []string) error {
+	var reasons []string
+	for _, e := range errs {
+		if e != "" {
+			reasons = append(reasons, e)
+		}
+	}
+	return errors.New(strings.Join(reasons, "; "))
+}
+
+// printStatus lists today's habits like the main page: done or not, target and streak.
+func printStatus(out io.Writer, data *AppData, today string) {
+	if len(data.Habits) == 0 {
+		fmt.Fprintln(out, "No habits yet.")
+		return
+	}
+	done := data.History[today].CompletedHabits
+	open, shown := 0, 0
+	fmt.Fprintf(out, "Today (%s)\n", today)
+	for _, h := range data.Habits {
+		if h.PausedOn(today) {
+			fmt.Fprintf(out, "⏸  %-3d %s (paused)\n", h.ID, h.Name)
+			continue
+		}
+		shown++
+		mark := "✅"
+		if !containsInt(done, h.ID) {
+			mark = "⬜"
+			open++
+		}
+		fmt.Fprintf(out, "%s %-3d %s (%d %s), streak %d (best %d)\n", mark, h.ID, h.Name, h.Quantity, h.Unit, GetStreakForHabit(data, h.ID), h.LongestStreak)
+	}
+	fmt.Fprintf(out, "%d of %d still open.\n", open, shown)
+	if needs, _ := NeedsWeekReview(data); needs {
+		fmt.Fprintln(out, "Your week review is due: run review.")
+	}
+}
+
+// cliReview asks per habit how much to change its target (Enter = the habit's usual step,
+// 0 = keep, -2 = lower by 2), then completes the review like the /week-review page.
+func cliReview(in io.Reader, out io.Writer) error {
+	data, err := LoadData()
+	if err != nil {
+		return err
+	}
+	if needs, _ := NeedsWeekReview(data); !needs {
+		fmt.Fprintf(out, "No review due: the last one was on %s.\n", GetOrSetLastWeekReview(data))
+		return nil
+	}
+	summaries := ReviewSummaries(data)
+	changes := make(map[int]int)
+	sc := bufio.NewScanner(in)
+	for _, h := range data.Habits {
+		if h.PausedOn(Today()) {
+			continue // keeps its target (pause.go)
+		}
+		s := summaries[h.ID]
+		fmt.Fprintf(out, "%s: %d %s, done %d of %d days, %d penalties.\n", h.Name, h.Quantity, h.Unit, s.Days-s.Misses, s.Days, s.Penalties)
+		for {
+			fmt.Fprintf(out, "  Change by [+%d]: ", h.WeeklyStep())
+			if !sc.Scan() {
+				return errors.New("review cancelled, nothing saved")
+			}
+			answer := strings.TrimSpace(sc.Text())
+			if answer == "" {
+				changes[h.ID] = h.WeeklyStep()
+				break
+			}
+			if n, err := strconv.Atoi(strings.TrimPrefix(answer, "+")); err == nil {
+				changes[h.ID] = n
+				break
+			}
+			fmt.Fprintln(out, "  Type a number like 2, 0 or -1.")
+		}
+	}
+	fmt.Fprint(out, "How did the week go? (optional, Enter to skip): ")
+	reflection := ""
+	if sc.Scan() {
+		reflection = sc.Text()
+	}
+	CompleteWeekReview(data, changes, reflection)
+	if err := SaveData(data); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Week review complete.")
+	return nil
+}
+
+// runRemote runs done, undo or status against a running server's JSON API.
+func runRemote(cmd, arg, base string, out io.Writer) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(base + "/api/v1/today")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", base, resp.Status)
+	}
+	var today TodayResponse
+	if err := json.NewDecoder(resp.Body).Decode(&today); err != nil {
+		return err
+	}
+	if cmd == "status" {
+		fmt.Fprintf(out, "Today (%s)\n", today.Date)
+		for _, h := range today.Habits {
+			mark := "⬜"
+			if h.Done {
+				mark = "✅"
+			}
+			fmt.Fprintf(out, "%s %-3d %s (%d %s), streak %d (best %d)\n", mark, h.ID, h.Name, h.Quantity, h.Unit, h.Streak, h.Best)
+		}
+		fmt.Fprintf(out, "%d of %d still open.\n", today.Incomplete, len(today.Habits))
+		return nil
+	}
+
+	var ops []BulkOp
+	var habits []TodayHabit
+	for _, name := range cliHabitList(arg) {
+		var habit *TodayHabit
+		for i, h := range today.Habits {
+			if strings.EqualFold(h.Name, name) || strconv.Itoa(h.ID) == name {
+				habit = &today.Habits[i]
+				break
+			}
+		}
+		switch {
+		case habit == nil:
+			return fmt.Errorf("no habit called %q (see: status)", name)
+		case cmd == "done" && habit.Done:
+			fmt.Fprintf(out, "%s is already done today.\n", habit.Name)
+			continue
+		case cmd == "undo" && !habit.Done:
+			fmt.Fprintf(out, "%s isn't done today.\n", habit.Name)
+			continue
+		}
+		op := cliBulkOp(cmd, habit.ID)
+		op.Date = today.Date // the server's today, as the list came from it
+		ops = append(ops, op)
+		habits = append(habits, *habit)
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	// One request for all of them (bulk.go).
+	body, _ := json.Marshal(BulkRequest{Ops: ops})
+	resp, err = client.Post(base+"/api/v1/bulk", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		BulkResult
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("%s answered %s", base, resp.Status)
+	}
+	switch {
+	case res.Errors != nil:
+		return bulkError(res.Errors)
+	case res.Error != "":
+		return errors.New(res.Error)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s answered %s", base, resp.Status)
+	}
+	for _, h := range habits {
+		if cmd == "done" {
+			fmt.Fprintf(out, "✅ %s done (%d %s).\n", h.Name, h.Quantity, h.Unit)
+		} else {
+			fmt.Fprintf(out, "%s marked not done.\n", h.Name)
+		}
+	}
+	return nil
+}
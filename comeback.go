@@ -0,0 +1,53 @@
+// comeback.go - Picking a habit back up after missing it. The first completion after one or more
+// missed days is a comeback: it unlocks the Comeback badge (gamify.go), counts in the habit's
+// BreaksRecovered (on the stats page), and the main page answers it with a message that fits the
+// break - one missed day, a few, weeks, or the end of a long streak - instead of the usual
+// "marked complete".
+
+package main
+
+// maxComebackGap is how far back comebackGap looks for missed days.
+const maxComebackGap = 366
+
+// comebackGap returns how many days in a row h was missed right before day: 0 if the day before
+// wasn't missed, so completing h on day is no comeback.
+func comebackGap(data *AppData, h *Habit, day string) int {
+	t, err := ParseDate(day)
+	if err != nil {
+		return 0
+	}
+	gap := 0
+	for gap < maxComebackGap {
+		t = t.AddDate(0, 0, -1)
+		if !habitMissedOn(data, h, t.Format(dateLayout)) {
+			break
+		}
+		gap++
+	}
+	return gap
+}
+
+// ComebackMessage is what the main page says when habitID was completed on day after a break,
+// or "" if that wasn't a comeback. lost is the streak the break ended.
+func ComebackMessage(data *AppData, habitID int, day string, loc Locale) string {
+	h := FindHabitByID(data, habitID)
+	if h == nil {
+		return ""
+	}
+	gap := comebackGap(data, h, day)
+	if gap == 0 {
+		return ""
+	}
+	t, _ := ParseDate(day)
+	lost := streakEndingOn(data, h.ID, t.AddDate(0, 0, -gap-1).Format(dateLayout))
+	switch {
+	case lost >= 7:
+		return loc.T("Welcome back to %s! Your %d-day streak ended, but this is how the next one starts.", h.Name, lost)
+	case gap == 1:
+		return loc.T("Back on track with %s: one missed day doesn't undo your progress.", h.Name)
+	case gap < 7:
+		return loc.T("%s is back after %d days off. Picking it up again is what counts.", h.Name, gap)
+	default:
+		return loc.T("Good to see %s again after %d days. Day one of a new streak!", h.Name, gap)
+	}
+}
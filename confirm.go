@@ -0,0 +1,129 @@
+// confirm.go - Optional confirmation before completing (or undoing) a habit, for habits where a
+// mis-click would inflate a streak. Each habit chooses a mode in Habit.Confirm:
+//   - ""         no confirmation (default)
+//   - "quantity" type the amount you did; it must reach the target (type the target to undo)
+//   - "twostep"  the first click only asks "are you sure?"; a second click within
+//     confirmWindow actually saves it
+//
+// Pending two-step confirmations live in memory only: after a restart you just click again.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// confirmWindow is how long a two-step confirmation stays valid.
+const confirmWindow = 60 * time.Second
+
+// ValidConfirmMode reports whether m is a confirmation mode we know.
+func ValidConfirmMode(m string) bool {
+	return m == "" || m == "quantity" || m == "twostep"
+}
+
+// pendingConfirm is a first click waiting for its second one.
+type pendingConfirm struct {
+	action  string // "complete" or "uncomplete"
+	expires time.Time
+}
+
+// pendingConfirms maps habit ID -> the click waiting for confirmation. Handlers run in
+// parallel goroutines, so the map is guarded by its own mutex.
+var (
+	pendingMu       sync.Mutex
+	pendingConfirms = make(map[int]pendingConfirm)
+)
+
+// requestConfirm records a first click; the page then shows the "are you sure?" prompt.
+func requestConfirm(habitID int, action string) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	pendingConfirms[habitID] = pendingConfirm{action: action, expires: time.Now().Add(confirmWindow)}
+}
+
+// takeConfirm reports whether a matching, unexpired first click exists, and removes it.
+func takeConfirm(habitID int, action string) bool {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	p, ok := pendingConfirms[habitID]
+	delete(pendingConfirms, habitID)
+	return ok && p.action == action && time.Now().Before(p.expires)
+}
+
+// cancelConfirm drops a pending confirmation (the "Cancel" button).
+func cancelConfirm(habitID int) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	delete(pendingConfirms, habitID)
+}
+
+// PendingConfirmation returns the action waiting for confirmation for a habit, or "".
+func PendingConfirmation(habitID int) string {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if p, ok := pendingConfirms[habitID]; ok && time.Now().Before(p.expires) {
+		return p.action
+	}
+	return ""
+}
+
+// checkConfirmation applies the habit's confirmation mode to a complete/uncomplete request.
+// It returns "" when the change may go ahead, or the redirect URL to send the user to instead.
+func checkConfirmation(r *http.Request, h *Habit, action string) string {
+	switch h.Confirm {
+	case "quantity":
+		typed, err := strconv.Atoi(r.FormValue("confirm_quantity"))
+		if err != nil || typed < h.Quantity || (action == "uncomplete" && typed != h.Quantity) {
+			return "/?error=confirm"
+		}
+	case "twostep":
+		if r.FormValue("confirm") != "1" || !takeConfirm(h.ID, action) {
+			requestConfirm(h.ID, action)
+			return "/?confirm=" + strconv.Itoa(h.ID)
+		}
+	}
+	return ""
+}
+
+// HandleHabitConfirm handles POST to choose a habit's confirmation mode. Form: habit_id=1&confirm=twostep
+// With cancel=1 it instead drops a pending two-step confirmation.
+func HandleHabitConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	if r.FormValue("cancel") == "1" {
+		cancelConfirm(habitID)
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	mode := r.FormValue("confirm")
+	if !ValidConfirmMode(mode) {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.Confirm = mode
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?confirmset=1", http.StatusFound)
+}
@@ -0,0 +1,267 @@
+// conflicts.go - Support for keeping data.json in a synced folder (Syncthing, Dropbox).
+// When two devices change the file at the same time, the sync tool keeps both versions by
+// writing a "conflict copy" next to it. Here we find those copies, merge them back into
+// data.json record by record, and watch data.json for changes made by another program.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FindConflictFiles returns the conflict copies of dataFile that sit in the same directory.
+// Syncthing names them "data.sync-conflict-20250128-093000-ABCDEFG.json";
+// Dropbox names them "data (Alex's conflicted copy 2025-01-28).json".
+func FindConflictFiles() ([]string, error) {
+	dir := filepath.Dir(dataFile)
+	ext := filepath.Ext(dataFile)
+	base := strings.TrimSuffix(filepath.Base(dataFile), ext)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, base) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if strings.Contains(name, ".sync-conflict-") || strings.Contains(name, "conflicted copy") {
+			out = append(out, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// MergeAppData folds other into data record by record:
+//   - habits and todos are matched by ID; records that only exist in other are added,
+//     records in both keep the version from data (the file we are merging into);
+//   - history days are combined: a habit completed on either device counts as completed,
+//     and a penalty recorded on either device is not applied again;
+//   - the later week review and last processed day, and the earlier start date win.
+//
+// It returns a short description of what was added, for logging.
+func MergeAppData(data, other *AppData) string {
+	addedHabits, addedTodos, mergedDays := 0, 0, 0
+
+	for _, h := range other.Habits {
+		if FindHabitByID(data, h.ID) == nil {
+			data.Habits = append(data.Habits, h)
+			addedHabits++
+		}
+	}
+
+	todoIDs := make(map[int]bool)
+	for _, t := range data.Todos {
+		todoIDs[t.ID] = true
+	}
+	for _, t := range other.Todos {
+		if !todoIDs[t.ID] {
+			data.Todos = append(data.Todos, t)
+			addedTodos++
+		}
+	}
+
+	for _, a := range other.Adjustments {
+		if !containsAdjustment(data.Adjustments, a) {
+			data.Adjustments = append(data.Adjustments, a)
+		}
+	}
+
+	for date, theirs := range other.History {
+		ours, exists := data.History[date]
+		if !exists {
+			data.History[date] = theirs
+			mergedDays++
+			continue
+		}
+		before := len(ours.CompletedHabits) + len(ours.PenaltyAppliedForHabits)
+		ours.Date = date
+		ours.CompletedHabits = unionInts(ours.CompletedHabits, theirs.CompletedHabits)
+		ours.PenaltyAppliedForHabits = unionInts(ours.PenaltyAppliedForHabits, theirs.PenaltyAppliedForHabits)
+		ours.SkippedHabits = unionInts(ours.SkippedHabits, theirs.SkippedHabits)
+		for id, amount := range theirs.PenaltyAmounts {
+			if ours.PenaltyAmounts == nil {
+				ours.PenaltyAmounts = make(map[int]int)
+			}
+			if _, ok := ours.PenaltyAmounts[id]; !ok {
+				ours.PenaltyAmounts[id] = amount
+			}
+		}
+		ours.WeekReviewDone = ours.WeekReviewDone || theirs.WeekReviewDone
+		if ours.WeekReview == nil {
+			ours.WeekReview = theirs.WeekReview
+		}
+		if ours.MonthReview == nil {
+			ours.MonthReview = theirs.MonthReview
+		}
+		if ours.QuarterReview == nil {
+			ours.QuarterReview = theirs.QuarterReview
+		}
+		for id, source := range theirs.CompletionSources {
+			if ours.CompletionSources == nil {
+				ours.CompletionSources = make(map[int]string)
+			}
+			if _, ok := ours.CompletionSources[id]; !ok {
+				ours.CompletionSources[id] = source
+			}
+		}
+		// Check-ins are kept per device as a list; keep the longer one per habit.
+		for id, list := range theirs.CheckIns {
+			if ours.CheckIns == nil {
+				ours.CheckIns = make(map[int][]CheckIn)
+			}
+			if len(list) > len(ours.CheckIns[id]) {
+				ours.CheckIns[id] = list
+			}
+		}
+		// Photos have unique names, so keep the photos of both.
+		for id, list := range theirs.Photos {
+			if ours.Photos == nil {
+				ours.Photos = make(map[int][]Photo)
+			}
+			for _, p := range list {
+				if !containsPhoto(ours.Photos[id], p.Name) {
+					ours.Photos[id] = append(ours.Photos[id], p)
+				}
+			}
+		}
+		// Logged minutes can't be told apart per device, so keep the larger total per habit.
+		for id, mins := range theirs.MinutesLogged {
+			if ours.MinutesLogged == nil {
+				ours.MinutesLogged = make(map[int]int)
+			}
+			if mins > ours.MinutesLogged[id] {
+				ours.MinutesLogged[id] = mins
+			}
+		}
+		if len(ours.CompletedHabits)+len(ours.PenaltyAppliedForHabits) != before {
+			mergedDays++
+		}
+		data.History[date] = ours
+	}
+
+	if other.LastWeekReview > data.LastWeekReview {
+		data.LastWeekReview = other.LastWeekReview
+	}
+	if other.LastProcessedDate > data.LastProcessedDate {
+		data.LastProcessedDate = other.LastProcessedDate
+	}
+	if other.CreatedAt != "" && (data.CreatedAt == "" || other.CreatedAt < data.CreatedAt) {
+		data.CreatedAt = other.CreatedAt
+	}
+	refreshLongestStreaks(data) // the merged days can join two runs
+	return fmt.Sprintf("%d habits, %d todos, %d days", addedHabits, addedTodos, mergedDays)
+}
+
+// containsAdjustment reports whether list already has the same audit entry.
+func containsAdjustment(list []QuantityAdjustment, a QuantityAdjustment) bool {
+	for _, b := range list {
+		if b.HabitID == a.HabitID && b.Time.Equal(a.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// unionInts returns a followed by every value of b that isn't already in a.
+func unionInts(a, b []int) []int {
+	out := append([]int{}, a...)
+	for _, v := range b {
+		if !containsInt(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// MergeConflictFiles merges every conflict copy into data.json and renames each copy to
+// "<name>.merged" so it isn't merged twice (and can still be inspected or deleted by hand).
+// It returns how many files were merged.
+func MergeConflictFiles() (int, error) {
+	files, err := FindConflictFiles()
+	if err != nil || len(files) == 0 {
+		return 0, err
+	}
+	data, err := LoadData()
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		other, err := loadDataFile(f)
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %w", f, err)
+		}
+		log.Printf("merging %s: added %s", f, MergeAppData(data, other))
+	}
+	if err := SaveData(data); err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := os.Rename(f, f+".merged"); err != nil {
+			return 0, err
+		}
+	}
+	return len(files), nil
+}
+
+// WatchDataFile checks data.json every interval and calls onChange when another program
+// (e.g. the sync tool) has replaced it. Go's standard library has no file-change events,
+// so we poll the modification time and size - cheap for a single small file.
+// Our own writes are ignored: SaveData records what it wrote in lastSaved.
+// Run it in its own goroutine: go WatchDataFile(...)
+func WatchDataFile(interval time.Duration, onChange func()) {
+	var lastMod time.Time
+	var lastSize int64
+	if fi, err := os.Stat(dataFile); err == nil {
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+	}
+	for range time.Tick(interval) {
+		fi, err := os.Stat(dataFile)
+		if err != nil {
+			continue // file missing for a moment while the sync tool swaps it in
+		}
+		if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+		if wroteItOurselves(fi) {
+			continue
+		}
+		onChange()
+	}
+}
+
+// handleExternalChange is the WatchDataFile callback used by main: it reloads the file so
+// broken JSON is reported right away, and warns about conflict copies that need merging.
+func handleExternalChange() {
+	log.Println("data.json changed on disk, reloading")
+	if _, err := LoadData(); err != nil {
+		log.Println("reloading data.json:", err)
+	}
+	if files, err := FindConflictFiles(); err == nil && len(files) > 0 {
+		log.Printf("%d sync conflict file(s) found, merge them from the web page", len(files))
+	}
+}
+
+// HandleMergeConflicts handles POST from the "Merge" button shown when conflict copies exist.
+func HandleMergeConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := MergeConflictFiles(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/?merged=1", http.StatusFound)
+}
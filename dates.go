@@ -0,0 +1,118 @@
+// dates.go - Dates written the way you're used to: 10/15/2025 in the US, 15.10.2025 in Germany,
+// and weeks starting on Sunday or Monday in the year heatmaps (archive.go, share links). Dates
+// are still stored as YYYY-MM-DD; only what's shown changes.
+//
+// The date style is picked on the settings page, or else follows the page's language (i18n.go):
+// English gets the US style unless the browser asks for British English (en-GB), German the
+// German one, Spanish the Spanish one. In templates:
+//
+//	{{date .Dates .Today}}  → 15.10.2025      {{shortdate .Dates .DueDate}}  → 15.10.
+//
+// Pages that don't pass a style (nil) show the date as stored.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DateStyle is how dates are written and which day a week starts on.
+type DateStyle struct {
+	Code      string       // "en-US", "de-DE", ... as stored in Settings.DateLocale
+	Label     string       // for the settings page
+	Full      string       // Go layout for day, month and year: "01/02/2006"
+	Short     string       // day and month: "01/02"
+	WeekStart time.Weekday // the first row of a heatmap column
+}
+
+// dateStyles are the styles to pick from, by code.
+var dateStyles = map[string]DateStyle{
+	"en-US": {Code: "en-US", Label: "US: 10/15/2025, weeks start on Sunday", Full: "01/02/2006", Short: "01/02", WeekStart: time.Sunday},
+	"en-GB": {Code: "en-GB", Label: "UK: 15/10/2025, weeks start on Monday", Full: "02/01/2006", Short: "02/01", WeekStart: time.Monday},
+	"de-DE": {Code: "de-DE", Label: "German: 15.10.2025, weeks start on Monday", Full: "02.01.2006", Short: "02.01.", WeekStart: time.Monday},
+	"es-ES": {Code: "es-ES", Label: "Spanish: 15/10/2025, weeks start on Monday", Full: "02/01/2006", Short: "02/01", WeekStart: time.Monday},
+	"iso":   {Code: "iso", Label: "ISO: 2025-10-15, weeks start on Monday", Full: "2006-01-02", Short: "01-02", WeekStart: time.Monday},
+}
+
+// languageDateStyles is the style each language gets when none is picked.
+var languageDateStyles = map[Locale]string{"en": "en-US", "de": "de-DE", "es": "es-ES"}
+
+// ValidDateLocale reports whether code can be picked on the settings page ("" = from the language).
+func ValidDateLocale(code string) bool {
+	_, ok := dateStyles[code]
+	return code == "" || ok
+}
+
+// DateStyleOptions lists the styles for the settings page, by code.
+func DateStyleOptions() []DateStyle {
+	out := make([]DateStyle, 0, len(dateStyles))
+	for _, s := range dateStyles {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// styleFor returns the style for lang when none is picked.
+func styleFor(lang Locale) DateStyle {
+	if code, ok := languageDateStyles[lang]; ok {
+		return dateStyles[code]
+	}
+	return dateStyles["en-US"]
+}
+
+// Dates is the date style from the settings alone, for what has no browser to ask: the static
+// archive and share links.
+func (s Settings) Dates() DateStyle {
+	if ds, ok := dateStyles[s.DateLocale]; ok {
+		return ds
+	}
+	return styleFor(Locale(s.Language))
+}
+
+// RequestDates is the date style for r: the one from the settings, or else the one for the
+// page's language, or the browser's region if we have a style for it (en-GB).
+func RequestDates(r *http.Request, s Settings) DateStyle {
+	if ds, ok := dateStyles[s.DateLocale]; ok {
+		return ds
+	}
+	lang := RequestLocale(r, s)
+	for _, tag := range acceptLanguages(r.Header.Get("Accept-Language")) {
+		code, region, _ := strings.Cut(tag, "-")
+		if ds, ok := dateStyles[code+"-"+strings.ToUpper(region)]; ok && Locale(code) == lang {
+			return ds
+		}
+	}
+	return styleFor(lang)
+}
+
+// weekdayOffset is how many days t is into its week.
+func (ds DateStyle) weekdayOffset(t time.Time) int {
+	return (int(t.Weekday()) - int(ds.WeekStart) + 7) % 7
+}
+
+// formatDate is the "date" template function: a YYYY-MM-DD date in style's full form. Anything
+// else, or a page without a style, is shown as it is.
+func formatDate(style any, date string) string {
+	return formatWith(style, date, func(ds DateStyle) string { return ds.Full })
+}
+
+// formatShortDate is the "shortdate" template function: day and month only.
+func formatShortDate(style any, date string) string {
+	return formatWith(style, date, func(ds DateStyle) string { return ds.Short })
+}
+
+func formatWith(style any, date string, layout func(DateStyle) string) string {
+	ds, ok := style.(DateStyle)
+	if !ok {
+		return date
+	}
+	t, err := ParseDate(date)
+	if err != nil {
+		return date
+	}
+	return t.Format(layout(ds))
+}
@@ -0,0 +1,217 @@
+// demo.go - Resetting the instance to a known dataset, for demos, workshops and reproducing bug
+// reports. One call replaces everything in data.json with a generated scenario:
+//
+//	curl -X POST -H "Authorization: Bearer $ADMIN_TOKEN" \
+//	     "http://localhost:8080/admin/reset?scenario=sample-30"
+//
+// Scenarios: "empty" (a fresh install, the setup wizard shows again), "sample-30" (a few habits
+// used for the last 30 days) and "power-2y" (many habits and two years of history).
+// The days are generated with a fixed random seed (seed=N to pick another), so the same call on
+// the same day always gives the same data. Settings (theme, time zone, keys) are kept.
+// The endpoint only works when ADMIN_TOKEN is set in .env.
+
+package main
+
+import (
+	"crypto/subtle"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// demoHabit describes a habit in a scenario: started daysAgo days ago, done with probability rate.
+type demoHabit struct {
+	name     string
+	quantity int
+	unit     string
+	daysAgo  int
+	rate     float64
+}
+
+// demoScenarios are the datasets /admin/reset knows, by name.
+var demoScenarios = map[string]struct {
+	habits []demoHabit
+	todos  []Todo
+}{
+	"empty": {},
+	"sample-30": {
+		habits: []demoHabit{
+			{"Pushups", 5, "pushups", 30, 0.8},
+			{"Read", 10, "pages", 30, 0.7},
+			{"Drink water", 4, "glasses", 21, 0.9},
+			{"Meditate", 5, "minutes", 12, 0.6},
+		},
+		todos: []Todo{
+			{Text: "Buy running shoes", Priority: "medium"},
+			{Text: "Plan next week's workouts", Priority: "high", DueDate: "+1"},
+			{Text: "Return library books", DueDate: "-2"},
+		},
+	},
+	"power-2y": {
+		habits: []demoHabit{
+			{"Pushups", 5, "pushups", 730, 0.85},
+			{"Squats", 10, "squats", 700, 0.8},
+			{"Run", 1, "km", 640, 0.6},
+			{"Read", 5, "pages", 730, 0.9},
+			{"Language practice", 10, "minutes", 500, 0.75},
+			{"Meditate", 3, "minutes", 420, 0.7},
+			{"Journal", 3, "sentences", 365, 0.65},
+			{"Drink water", 4, "glasses", 300, 0.95},
+			{"Stretch", 5, "minutes", 180, 0.5},
+			{"Guitar", 1, "hours", 90, 0.55},
+			{"No sugar", 1, "days", 20, 0.4},
+		},
+		todos: []Todo{
+			{Text: "Renew gym membership", Priority: "high", DueDate: "-5"},
+			{Text: "Sign up for the half marathon", Priority: "high", DueDate: "+14"},
+			{Text: "Back up photos", Priority: "low"},
+			{Text: "Write monthly review", Priority: "medium", DueDate: "+0"},
+			{Text: "Fix bike brakes", Priority: "medium"},
+			{Text: "Order new notebook"},
+		},
+	},
+}
+
+// adminAuthorized checks "Authorization: Bearer <ADMIN_TOKEN>" (compare syncAuthorized in sync.go).
+func adminAuthorized(r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// DemoData generates the named scenario as it would look on the day of now. It walks every day
+// the way the app would have: habits are done (or not) at random, misses are penalized and a
+// week review adds 1 to every habit each 7 days. ok is false for an unknown scenario.
+func DemoData(scenario string, seed int64, now time.Time) (data *AppData, ok bool) {
+	sc, ok := demoScenarios[scenario]
+	if !ok {
+		return nil, false
+	}
+	rng := rand.New(rand.NewSource(seed))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	data = &AppData{Habits: []Habit{}, Todos: []Todo{}, History: make(map[string]DayRecord)}
+	if len(sc.habits) == 0 {
+		return data, true // a fresh install
+	}
+
+	start := 0
+	for _, dh := range sc.habits {
+		if dh.daysAgo > start {
+			start = dh.daysAgo
+		}
+	}
+	data.CreatedAt = today.AddDate(0, 0, -start).Format(dateLayout)
+	data.LastWeekReview = data.CreatedAt
+	data.SetupDone = true
+
+	rates := make(map[int]float64)
+	for _, dh := range sc.habits {
+		h := NewHabit(data, dh.name, dh.quantity, dh.unit)
+		h.CreatedAt = today.AddDate(0, 0, -dh.daysAgo).Add(8 * time.Hour)
+		data.Habits = append(data.Habits, h)
+		rates[h.ID] = dh.rate
+	}
+	simulateDays(data, rates, rng, today.AddDate(0, 0, -start), today)
+
+	// Todo due dates are written relative to today ("+1" = tomorrow) so they never go stale.
+	for _, t := range sc.todos {
+		t.ID = NextTodoID(data)
+		if n, err := strconv.Atoi(t.DueDate); err == nil {
+			t.DueDate = today.AddDate(0, 0, n).Format(dateLayout)
+		}
+		data.Todos = append(data.Todos, t)
+	}
+	refreshLongestStreaks(data)
+	return data, true
+}
+
+// simulateDays fills data's history from start up to (not including) today: each habit is done
+// with the chance in rates, misses are penalized and a week review adds 1 to every habit each
+// 7 days. The habits' CreatedAt says from which day they count.
+func simulateDays(data *AppData, rates map[int]float64, rng *rand.Rand, start, today time.Time) {
+	for d := start; d.Before(today); d = d.AddDate(0, 0, 1) {
+		day := d.Format(dateLayout)
+		rec := DayRecord{Date: day, CompletedHabits: []int{}}
+		for i := range data.Habits {
+			h := &data.Habits[i]
+			if h.CreatedAt.Format(dateLayout) > day {
+				continue
+			}
+			if rng.Float64() < rates[h.ID] {
+				rec.CompletedHabits = append(rec.CompletedHabits, h.ID)
+				if IsTimeBased(*h) {
+					if rec.MinutesLogged == nil {
+						rec.MinutesLogged = make(map[int]int)
+					}
+					rec.MinutesLogged[h.ID] = TargetMinutes(*h)
+				}
+			} else if !InGracePeriod(*h, day, data.Settings.GraceDays()) {
+				recordMissPenalty(&rec, h)
+			}
+		}
+		if days, _ := DaysBetween(data.LastWeekReview, day); days >= 7 {
+			for i := range data.Habits {
+				if h := &data.Habits[i]; h.CreatedAt.Format(dateLayout) <= day {
+					h.Quantity++
+					h.CycleStartQuantity = h.Quantity
+				}
+			}
+			data.LastWeekReview = day
+			rec.WeekReviewDone = true
+		}
+		data.History[day] = rec
+	}
+	data.LastProcessedDate = today.AddDate(0, 0, -1).Format(dateLayout)
+}
+
+// HandleAdminReset handles POST /admin/reset?scenario=sample-30[&seed=7]: it replaces all data
+// with the scenario (keeping the settings) and answers with a short JSON summary.
+func HandleAdminReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	scenario := r.FormValue("scenario")
+	seed := int64(1)
+	if s := r.FormValue("seed"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "seed must be a number", http.StatusBadRequest)
+			return
+		}
+		seed = n
+	}
+	fresh, ok := DemoData(scenario, seed, time.Now())
+	if !ok {
+		http.Error(w, "unknown scenario (use empty, sample-30 or power-2y)", http.StatusBadRequest)
+		return
+	}
+	old, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fresh.Settings = old.Settings
+	fresh.Revision = old.Revision // it replaces the data on purpose
+	if err := SaveData(fresh); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"scenario": scenario,
+		"seed":     seed,
+		"habits":   len(fresh.Habits),
+		"todos":    len(fresh.Todos),
+		"days":     len(fresh.History),
+	})
+}
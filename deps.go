@@ -0,0 +1,157 @@
+// deps.go - Habit chains. A habit can list prerequisites (DependsOn): it only counts once they
+// are done the same day, e.g. "Protein shake" after "Workout". Completing it earlier is refused
+// everywhere a habit can be completed (the main page, quick links, Discord, the batch API).
+// The main page shows each habit's prerequisites and whether they are done yet.
+//
+// completionBlocked is the check all those places share: it also refuses completions while the
+// week review is due (weekreview.go). Integrations that complete habits on their own (health.go)
+// only wait for prerequisites, so a due review doesn't lose their data.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PrereqView is a prerequisite as shown next to a habit on the main page.
+type PrereqView struct {
+	Name string
+	Done bool
+}
+
+// MissingPrerequisites returns the names of h's prerequisites that aren't done on day.
+// Prerequisites that were deleted, or are paused that day (pause.go), are ignored. The message
+// can reach Discord, household members and Home Assistant, so private habits aren't named:
+// they're counted as "a private habit" (or "2 private habits") at the end.
+func MissingPrerequisites(data *AppData, h *Habit, day string) []string {
+	var missing []string
+	private := 0
+	done := data.History[day].CompletedHabits
+	for _, id := range h.DependsOn {
+		p := FindHabitByID(data, id)
+		switch {
+		case p == nil || p.PausedOn(day) || containsInt(done, id):
+		case p.Private:
+			private++
+		default:
+			missing = append(missing, p.Name)
+		}
+	}
+	switch {
+	case private == 1:
+		missing = append(missing, "a private habit")
+	case private > 1:
+		missing = append(missing, strconv.Itoa(private)+" private habits")
+	}
+	return missing
+}
+
+// prerequisiteError is the message for a habit that can't be completed yet ("" if it can).
+func prerequisiteError(data *AppData, h *Habit, day string) string {
+	missing := MissingPrerequisites(data, h, day)
+	if len(missing) == 0 {
+		return ""
+	}
+	return "Finish " + strings.Join(missing, ", ") + " first (" + h.Name + " only counts after that)"
+}
+
+// weekReviewFirst is completionBlocked's answer while the week review is due.
+const weekReviewFirst = "Finish the week review first"
+
+// completionBlocked returns why h can't be completed on day yet, "" if it can: a due week review
+// comes first, then h's prerequisites. Every way of completing a habit by hand asks it.
+func completionBlocked(data *AppData, h *Habit, day string) string {
+	if needs, _ := NeedsWeekReview(data); needs {
+		return weekReviewFirst
+	}
+	return prerequisiteError(data, h, day)
+}
+
+// completionRedirect is completionBlocked for the pages: where to send the browser instead of
+// completing h, "" to go ahead.
+func completionRedirect(data *AppData, h *Habit, day string) string {
+	switch msg := completionBlocked(data, h, day); {
+	case msg == weekReviewFirst:
+		return "/week-review?blocked=1"
+	case msg != "":
+		return prerequisiteRedirect(MissingPrerequisites(data, h, day))
+	}
+	return ""
+}
+
+// createsCycle reports whether letting habitID depend on deps would make a loop, like A after B
+// after A (then neither could ever be completed). It follows the chains from each dependency.
+func createsCycle(data *AppData, habitID int, deps []int) bool {
+	seen := make(map[int]bool)
+	stack := append([]int{}, deps...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == habitID {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if h := FindHabitByID(data, id); h != nil {
+			stack = append(stack, h.DependsOn...)
+		}
+	}
+	return false
+}
+
+// HandleHabitDeps handles POST to set a habit's prerequisites.
+// Form: habit_id=3&depends_on=1&depends_on=2 (none = no prerequisites)
+func HandleHabitDeps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	var deps []int
+	for _, v := range r.Form["depends_on"] {
+		id, err := strconv.Atoi(v)
+		if err != nil || FindHabitByID(data, id) == nil || containsInt(deps, id) {
+			http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+			return
+		}
+		deps = append(deps, id)
+	}
+	if createsCycle(data, habitID, deps) {
+		http.Redirect(w, r, "/?error=chain", http.StatusFound)
+		return
+	}
+	habit.DependsOn = deps
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?chainset=1", http.StatusFound)
+}
+
+// prerequisiteRedirect is where HandleCompleteHabit sends you when prerequisites are missing.
+func prerequisiteRedirect(missing []string) string {
+	return "/?error=prereq&need=" + url.QueryEscape(strings.Join(missing, ", "))
+}
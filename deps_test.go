@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCompletionBlockedByWeekReview checks the guard every completion goes through: a due week
+// review comes first, then prerequisites, and the bulk API (used by the CLI) is refused too.
+func TestCompletionBlockedByWeekReview(t *testing.T) {
+	today := Today()
+	data := &AppData{
+		CreatedAt:      "2025-01-01",
+		LastWeekReview: time.Now().AddDate(0, 0, -10).Format(dateLayout),
+		Habits: []Habit{
+			{ID: 1, Name: "Workout", Quantity: 1, Unit: "set"},
+			{ID: 2, Name: "Protein shake", Quantity: 1, Unit: "glass", DependsOn: []int{1}},
+		},
+		History: map[string]DayRecord{},
+	}
+	if got := completionBlocked(data, &data.Habits[0], today); got != weekReviewFirst {
+		t.Errorf("review due: got %q, want %q", got, weekReviewFirst)
+	}
+	if got := completionRedirect(data, &data.Habits[0], today); got != "/week-review?blocked=1" {
+		t.Errorf("review due: redirect %q", got)
+	}
+	if _, errs := applyBulk(data, []BulkOp{{Op: "complete", HabitID: 1}}); len(errs) != 1 || errs[0] != weekReviewFirst {
+		t.Errorf("bulk complete with the review due: errs = %q", errs)
+	}
+	if containsInt(data.History[today].CompletedHabits, 1) {
+		t.Error("bulk completed the habit anyway")
+	}
+
+	data.LastWeekReview = today
+	if got := completionBlocked(data, &data.Habits[0], today); got != "" {
+		t.Errorf("review done: got %q, want no block", got)
+	}
+	if got := completionBlocked(data, &data.Habits[1], today); got == "" || got == weekReviewFirst {
+		t.Errorf("prerequisite open: got %q, want the prerequisite message", got)
+	}
+}
+
+// TestPrerequisiteErrorHidesPrivateHabits checks that the message, which can go to Discord or a
+// household member, doesn't name private habits.
+func TestPrerequisiteErrorHidesPrivateHabits(t *testing.T) {
+	data := &AppData{
+		Habits: []Habit{
+			{ID: 1, Name: "Therapy exercises", Private: true},
+			{ID: 2, Name: "Journal", Private: true},
+			{ID: 3, Name: "Workout"},
+			{ID: 4, Name: "Protein shake", DependsOn: []int{1, 3}},
+			{ID: 5, Name: "Stretch", DependsOn: []int{1, 2}},
+		},
+		History: map[string]DayRecord{},
+	}
+	day := "2025-03-01"
+	want := "Finish Workout, a private habit first (Protein shake only counts after that)"
+	if got := prerequisiteError(data, &data.Habits[3], day); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := MissingPrerequisites(data, &data.Habits[4], day); len(got) != 1 || got[0] != "2 private habits" {
+		t.Errorf("two private prerequisites: got %q", got)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build dev
+
+// devbuild.go - Compiled in only with "-tags dev" (go run -tags dev .), for things meant for
+// working on the app rather than using it, like generating test data (seed.go). Without the
+// tag, devbuild_off.go is compiled instead.
+
+package main
+
+// devBuild reports whether this is a dev build.
+const devBuild = true
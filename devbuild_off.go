@@ -0,0 +1,7 @@
+//go:build !dev
+
+// devbuild_off.go - The normal build: see devbuild.go.
+
+package main
+
+const devBuild = false
@@ -0,0 +1,394 @@
+// discord.go - A Discord bot for logging habits from a chat. It connects to the Discord gateway
+// (a WebSocket, see websocket.go), listens for commands in one channel and posts a summary of
+// the day there every morning. Configure it in .env:
+//
+//	DISCORD_BOT_TOKEN=...          (Bot token from the Discord developer portal)
+//	DISCORD_CHANNEL_ID=1234567890  (the channel the bot listens to and posts in)
+//	DISCORD_SUMMARY_TIME=08:00     (optional, default 08:00)
+//
+// The bot needs the "Message Content" privileged intent turned on in the developer portal.
+// Commands (only in the chosen channel):
+//
+//	!habits        today's habits and whether they are done
+//	!done <habit>  mark a habit done (name or ID); confirmation modes are skipped like quick links
+//	!todos         open tasks, overdue and due today first
+//	!help          this list
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	discordAPI     = "https://discord.com/api/v10"
+	discordGateway = "wss://gateway.discord.gg/?v=10&encoding=json"
+	// Gateway intents: which events we receive. GUILD_MESSAGES (1<<9) and MESSAGE_CONTENT (1<<15)
+	// let us read commands typed in a server channel.
+	discordIntents = 1<<9 | 1<<15
+)
+
+// Gateway opcodes we use.
+const (
+	discordOpDispatch       = 0
+	discordOpHeartbeat      = 1
+	discordOpIdentify       = 2
+	discordOpReconnect      = 7
+	discordOpInvalidSession = 9
+	discordOpHello          = 10
+	discordOpHeartbeatAck   = 11
+)
+
+// discordPayload is the envelope of every gateway message.
+type discordPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d,omitempty"`
+	S  *int            `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// discordMessage is the part of a MESSAGE_CREATE event we need.
+type discordMessage struct {
+	ChannelID string `json:"channel_id"`
+	Content   string `json:"content"`
+	Author    struct {
+		Bot bool `json:"bot"`
+	} `json:"author"`
+}
+
+// discordBot holds the configuration and the HTTP client for the REST API.
+type discordBot struct {
+	token     string
+	channelID string
+	client    *http.Client
+}
+
+// Send posts a message into a channel (REST API). Discord limits messages to 2000 characters.
+func (b *discordBot) Send(channelID, text string) error {
+	if r := []rune(text); len(r) > 2000 {
+		text = string(r[:1997]) + "..."
+	}
+	body, err := json.Marshal(map[string]string{"content": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, discordAPI+"/channels/"+channelID+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("discord returned %s", resp.Status)
+	}
+	return nil
+}
+
+// findHabitByNameOrID matches "3" or a (case-insensitive) habit name. The channel can be read
+// by others, so private habits (privacy.go) are never found.
+func findHabitByNameOrID(data *AppData, arg string) *Habit {
+	for i := range data.Habits {
+		h := &data.Habits[i]
+		if h.Private {
+			continue
+		}
+		if strconv.Itoa(h.ID) == arg || strings.EqualFold(h.Name, arg) {
+			return h
+		}
+	}
+	return nil
+}
+
+// habitStatusLines lists the shared habits as "✅ Run (5 km)" / "⬜ Read (10 pages)".
+func habitStatusLines(data *AppData, today string) string {
+	done := data.History[today].CompletedHabits
+	var sb strings.Builder
+	for _, h := range SharedHabits(data.Habits) {
+		mark := "⬜"
+		if containsInt(done, h.ID) {
+			mark = "✅"
+		}
+		fmt.Fprintf(&sb, "%s %s (%d %s)\n", mark, h.Name, h.Quantity, h.Unit)
+	}
+	return sb.String()
+}
+
+// todoLines lists open todos, overdue and due today first.
+func todoLines(data *AppData, today string) string {
+	var sb strings.Builder
+	for _, t := range SortTodos(data.Todos, "due") {
+		line := "• " + t.Text
+		switch {
+		case IsOverdue(t, today):
+			line += " (overdue since " + t.DueDate + ")"
+		case t.DueDate == today:
+			line += " (due today)"
+		case t.DueDate != "":
+			line += " (due " + t.DueDate + ")"
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// DiscordCommand runs one chat command and returns the reply ("" if text isn't a command).
+func DiscordCommand(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "!") {
+		return ""
+	}
+	cmd, arg, _ := strings.Cut(strings.TrimPrefix(text, "!"), " ")
+	arg = strings.TrimSpace(arg)
+	today := Today()
+
+	switch strings.ToLower(cmd) {
+	case "help":
+		return "Commands: `!habits`, `!done <habit>`, `!todos`"
+	case "habits":
+		data, err := LoadData()
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		if len(SharedHabits(data.Habits)) == 0 {
+			return "No habits yet."
+		}
+		return "**Today (" + today + ")**\n" + habitStatusLines(data, today)
+	case "todos":
+		data, err := LoadData()
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		if len(data.Todos) == 0 {
+			return "No open tasks. 🎉"
+		}
+		return "**Tasks**\n" + todoLines(data, today)
+	case "done":
+		if arg == "" {
+			return "Usage: `!done <habit name or ID>`"
+		}
+		data, err := LoadData()
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		h := findHabitByNameOrID(data, arg)
+		if h == nil {
+			return "No habit called \"" + arg + "\". Try `!habits`."
+		}
+		if containsInt(data.History[today].CompletedHabits, h.ID) {
+			return h.Name + " is already done today."
+		}
+		if msg := completionBlocked(data, h, today); msg != "" {
+			return msg + "."
+		}
+		SetHabitCompleted(data, h.ID, today, true)
+		if err := SaveData(data); err != nil {
+			return "Error: " + err.Error()
+		}
+		return fmt.Sprintf("✅ %s done (%d %s).", h.Name, h.Quantity, h.Unit)
+	}
+	return ""
+}
+
+// DiscordSummary is the morning message: habits still to do, and tasks due today or overdue.
+func DiscordSummary(data *AppData, today string) string {
+	var sb strings.Builder
+	sb.WriteString("**Good morning! Today is " + today + ".**\n")
+	if len(SharedHabits(data.Habits)) > 0 {
+		sb.WriteString("\n**Habits**\n" + habitStatusLines(data, today))
+	}
+	var due []Todo
+	for _, t := range data.Todos {
+		if t.DueDate != "" && t.DueDate <= today {
+			due = append(due, t)
+		}
+	}
+	if len(due) > 0 {
+		sb.WriteString("\n**Due**\n" + todoLines(&AppData{Todos: due}, today))
+	}
+	if needs, _ := NeedsWeekReview(data); needs {
+		sb.WriteString("\n📅 Your week review is waiting: " + WeekReviewLink(data) + "\n")
+	}
+	return sb.String()
+}
+
+// runSummaries posts the morning summary once a day at DISCORD_SUMMARY_TIME (default 08:00),
+// remembering the day in data.LastDiscordSummaryDate.
+func (b *discordBot) runSummaries() {
+	hh, mm := 8, 0
+	if t, err := time.Parse("15:04", os.Getenv("DISCORD_SUMMARY_TIME")); err == nil {
+		hh, mm = t.Hour(), t.Minute()
+	}
+	for range time.Tick(time.Minute) {
+		now := time.Now()
+		if now.Before(time.Date(now.Year(), now.Month(), now.Day(), hh, mm, 0, 0, now.Location())) {
+			continue
+		}
+		data, err := LoadData()
+		if err != nil {
+			log.Println("discord:", err)
+			continue
+		}
+		today := now.Format(dateLayout)
+		if data.LastDiscordSummaryDate == today {
+			continue
+		}
+		if err := b.Send(b.channelID, DiscordSummary(data, today)); err != nil {
+			log.Println("discord summary:", err)
+			continue
+		}
+		data.LastDiscordSummaryDate = today
+		if err := SaveData(data); err != nil {
+			log.Println("discord:", err)
+		}
+	}
+}
+
+// session runs one gateway connection until it breaks: Hello, Identify, then heartbeats in a
+// goroutine while this one reads events.
+func (b *discordBot) session() error {
+	ws, err := dialWebSocket(discordGateway)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	send := func(op int, d any) error {
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		msg, err := json.Marshal(discordPayload{Op: op, D: raw})
+		if err != nil {
+			return err
+		}
+		return ws.WriteMessage(wsText, msg)
+	}
+
+	// The first message is Hello, telling us how often to send a heartbeat.
+	_, msg, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	var hello discordPayload
+	if err := json.Unmarshal(msg, &hello); err != nil || hello.Op != discordOpHello {
+		return fmt.Errorf("expected Hello, got %s", msg)
+	}
+	var helloData struct {
+		HeartbeatInterval int `json:"heartbeat_interval"`
+	}
+	json.Unmarshal(hello.D, &helloData)
+
+	identify := map[string]any{
+		"token":      b.token,
+		"intents":    discordIntents,
+		"properties": map[string]string{"os": "linux", "browser": "habit-tracker", "device": "habit-tracker"},
+	}
+	if err := send(discordOpIdentify, identify); err != nil {
+		return err
+	}
+
+	// Heartbeats carry the last sequence number we saw. seq is shared with the goroutine,
+	// so it goes through a channel instead of a plain variable.
+	seqCh := make(chan int, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var seq *int
+		ticker := time.NewTicker(time.Duration(helloData.HeartbeatInterval) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case s := <-seqCh:
+				seq = &s
+			case <-ticker.C:
+				raw, _ := json.Marshal(seq)
+				msg, _ := json.Marshal(discordPayload{Op: discordOpHeartbeat, D: raw})
+				if err := ws.WriteMessage(wsText, msg); err != nil {
+					ws.conn.Close() // makes ReadMessage below fail, so we reconnect
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var p discordPayload
+		if err := json.Unmarshal(msg, &p); err != nil {
+			continue
+		}
+		if p.S != nil {
+			select {
+			case seqCh <- *p.S:
+			default:
+			}
+		}
+		switch p.Op {
+		case discordOpReconnect, discordOpInvalidSession:
+			return fmt.Errorf("gateway asked to reconnect (op %d)", p.Op)
+		case discordOpHeartbeat:
+			send(discordOpHeartbeat, nil)
+		case discordOpDispatch:
+			if p.T == "READY" {
+				log.Println("discord: connected")
+			}
+			if p.T != "MESSAGE_CREATE" {
+				continue
+			}
+			var m discordMessage
+			if err := json.Unmarshal(p.D, &m); err != nil || m.Author.Bot || m.ChannelID != b.channelID {
+				continue
+			}
+			if reply := DiscordCommand(m.Content); reply != "" {
+				if err := b.Send(m.ChannelID, reply); err != nil {
+					log.Println("discord reply:", err)
+				}
+			}
+		}
+	}
+}
+
+// RunDiscordBot starts the bot if DISCORD_BOT_TOKEN and DISCORD_CHANNEL_ID are set, reconnecting
+// with a growing delay when the connection drops. Run it in its own goroutine: go RunDiscordBot()
+func RunDiscordBot() {
+	b := &discordBot{
+		token:     os.Getenv("DISCORD_BOT_TOKEN"),
+		channelID: os.Getenv("DISCORD_CHANNEL_ID"),
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+	if b.token == "" || b.channelID == "" {
+		return
+	}
+	go b.runSummaries()
+	wait := time.Second
+	for {
+		start := time.Now()
+		err := b.session()
+		log.Println("discord: disconnected:", err)
+		if time.Since(start) > time.Minute {
+			wait = time.Second // the connection was fine for a while: reconnect quickly
+		}
+		time.Sleep(wait)
+		if wait < 5*time.Minute {
+			wait *= 2
+		}
+	}
+}
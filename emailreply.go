@@ -0,0 +1,274 @@
+// emailreply.go - Answering the day wrap-up (wrapup.go) by email. When the wrap-up arrives by
+// email, a reply saying "done" marks every habit it listed done, and "done Read, Run" only those.
+// The reply reaches the app through a mail provider's inbound webhook (Mailgun routes, SendGrid
+// Inbound Parse or Postmark inbound), which POSTs each email to a secret address:
+//
+//	INBOUND_EMAIL_TOKEN=a-long-random-string   (the webhook is /inbound-email/a-long-random-string)
+//	INBOUND_EMAIL_FROM=me@example.com          (who may reply; default NOTIFY_EMAIL)
+//	MAILGUN_SIGNING_KEY=...                    (optional: also check Mailgun's signature)
+//
+// A From address is easy to fake, so a reply only counts when it comes through the secret
+// address, from an allowed sender, and (when the provider reports it) passed SPF. With Mailgun's
+// signing key the webhook's signature is checked too. Replies count for the latest wrap-up, on
+// the day it was sent, if that was today or yesterday; the result is confirmed by email.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxInboundEmail is the largest email the webhook reads (attachments included).
+const maxInboundEmail = 10 << 20
+
+// inboundEmailEnabled reports whether replies by email are set up.
+func inboundEmailEnabled() bool {
+	return os.Getenv("INBOUND_EMAIL_TOKEN") != ""
+}
+
+// inboundEmailSenders are the addresses replies are accepted from, in lowercase.
+func inboundEmailSenders() []string {
+	list := os.Getenv("INBOUND_EMAIL_FROM")
+	if list == "" {
+		list = os.Getenv("NOTIFY_EMAIL")
+	}
+	var out []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// inboundEmail is the part of an incoming email we need, whichever provider sent it.
+type inboundEmail struct {
+	From string // the sender's address, in lowercase
+	Text string // the plain-text body (only the reply, when the provider strips the quote)
+	SPF  string // the provider's SPF result ("pass", "fail", ...), "" if it doesn't say
+}
+
+// parseInboundEmail reads the email from a provider's webhook: JSON from Postmark, a form from
+// Mailgun and SendGrid.
+func parseInboundEmail(r *http.Request) (inboundEmail, error) {
+	var e inboundEmail
+	var from string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var pm struct {
+			From              string
+			TextBody          string
+			StrippedTextReply string
+			Headers           []struct{ Name, Value string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&pm); err != nil {
+			return e, err
+		}
+		from, e.Text = pm.From, pm.StrippedTextReply
+		if e.Text == "" {
+			e.Text = pm.TextBody
+		}
+		for _, h := range pm.Headers {
+			if strings.EqualFold(h.Name, "Received-SPF") {
+				e.SPF, _, _ = strings.Cut(strings.TrimSpace(h.Value), " ")
+			}
+		}
+	} else {
+		if err := r.ParseMultipartForm(maxInboundEmail); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return e, err
+		}
+		from = r.FormValue("from")
+		for _, field := range []string{"stripped-text", "body-plain", "text"} { // Mailgun, then SendGrid
+			if e.Text = r.FormValue(field); e.Text != "" {
+				break
+			}
+		}
+		e.SPF = r.FormValue("SPF") // SendGrid
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return e, fmt.Errorf("sender %q: %w", from, err)
+	}
+	e.From = strings.ToLower(addr.Address)
+	e.SPF = strings.ToLower(e.SPF)
+	return e, nil
+}
+
+// validMailgunSignature checks the signature Mailgun adds to each webhook: an HMAC of the
+// timestamp and token with the signing key.
+func validMailgunSignature(key string, r *http.Request) bool {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(r.FormValue("timestamp") + r.FormValue("token")))
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.FormValue("signature")))
+}
+
+// verifyInboundEmail returns why e can't be trusted ("" if it can).
+func verifyInboundEmail(r *http.Request, e inboundEmail) string {
+	if key := os.Getenv("MAILGUN_SIGNING_KEY"); key != "" && !validMailgunSignature(key, r) {
+		return "bad Mailgun signature"
+	}
+	allowed := false
+	for _, s := range inboundEmailSenders() {
+		allowed = allowed || s == e.From
+	}
+	if !allowed {
+		return "sender " + e.From + " isn't allowed"
+	}
+	if e.SPF != "" && e.SPF != "pass" {
+		return "sender " + e.From + " failed SPF (" + e.SPF + ")"
+	}
+	return ""
+}
+
+// replyCommand reads the reply's first line: "done" (ok, all habits) or "done Read, Run" (ok,
+// those names). The quoted wrap-up below it is ignored.
+func replyCommand(text string) (names []string, ok bool) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		if !strings.EqualFold(strings.TrimRight(word, ".!"), "done") {
+			return nil, false
+		}
+		for _, name := range strings.Split(rest, ",") {
+			if name = strings.TrimSpace(strings.TrimRight(name, ".!")); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, true
+	}
+	return nil, false
+}
+
+// EmailReplyResult is what a reply did.
+type EmailReplyResult struct {
+	Day     string   // the wrap-up's day, which the habits were marked done on
+	Done    []string // habits marked done
+	Skipped []string // habits that weren't, with the reason
+	Unknown []string // names in the reply that weren't on the wrap-up
+}
+
+// ApplyEmailReply marks the habits of the latest wrap-up done: all of them, or those named.
+func ApplyEmailReply(data *AppData, names []string, now time.Time) (EmailReplyResult, error) {
+	res := EmailReplyResult{Day: data.LastWrapUpDate}
+	today := now.Format(dateLayout)
+	if res.Day != today && res.Day != now.AddDate(0, 0, -1).Format(dateLayout) {
+		return res, errors.New("there's no wrap-up from today or yesterday to reply to")
+	}
+	named := make(map[string]bool)
+	for _, n := range names {
+		named[strings.ToLower(n)] = false
+	}
+	for _, id := range data.WrapUpHabits {
+		h := FindHabitByID(data, id)
+		if h == nil {
+			continue
+		}
+		if len(names) > 0 {
+			if _, ok := named[strings.ToLower(h.Name)]; !ok {
+				continue
+			}
+			named[strings.ToLower(h.Name)] = true
+		}
+		if containsInt(data.History[res.Day].CompletedHabits, h.ID) {
+			continue // done since the wrap-up went out
+		}
+		if msg := completionBlocked(data, h, res.Day); msg != "" {
+			res.Skipped = append(res.Skipped, h.Name+" ("+msg+")")
+			continue
+		}
+		SetHabitCompleted(data, h.ID, res.Day, true)
+		res.Done = append(res.Done, h.Name)
+	}
+	for _, n := range names {
+		if !named[strings.ToLower(n)] {
+			res.Unknown = append(res.Unknown, n)
+		}
+	}
+	return res, nil
+}
+
+// emailReplyMessage writes the confirmation sent back for a reply.
+func emailReplyMessage(res EmailReplyResult) string {
+	var sb strings.Builder
+	if len(res.Done) > 0 {
+		fmt.Fprintf(&sb, "Marked done for %s: %s.\n", res.Day, strings.Join(res.Done, ", "))
+	} else {
+		sb.WriteString("Nothing was marked done.\n")
+	}
+	if len(res.Skipped) > 0 {
+		fmt.Fprintf(&sb, "Not done yet: %s.\n", strings.Join(res.Skipped, ", "))
+	}
+	if len(res.Unknown) > 0 {
+		fmt.Fprintf(&sb, "Not on the wrap-up: %s.\n", strings.Join(res.Unknown, ", "))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// HandleInboundEmail handles POST /inbound-email/{INBOUND_EMAIL_TOKEN}, the mail provider's
+// webhook. Emails that aren't a "done" reply are accepted and ignored, so the provider doesn't
+// retry them; rejected senders get 406, which tells Mailgun not to retry either.
+func HandleInboundEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/inbound-email/")
+	secret := os.Getenv("INBOUND_EMAIL_TOKEN")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundEmail)
+	e, err := parseInboundEmail(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if why := verifyInboundEmail(r, e); why != "" {
+		log.Println("email reply rejected:", why)
+		http.Error(w, why, http.StatusNotAcceptable)
+		return
+	}
+	names, ok := replyCommand(e.Text)
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res, err := ApplyEmailReply(data, names, time.Now())
+	if err != nil {
+		log.Println("email reply:", err)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored", "reason": err.Error()})
+		return
+	}
+	if len(res.Done) > 0 {
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+	}
+	go func() {
+		if _, err := NotifyVia("email", "Day wrap-up: reply received", emailReplyMessage(res)); err != nil {
+			log.Println("email reply confirmation:", err)
+		}
+	}()
+	writeJSON(w, http.StatusOK, res)
+}
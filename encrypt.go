@@ -0,0 +1,193 @@
+// encrypt.go - Encryption at rest, for running on a server other people can read files on.
+// Set a passphrase in .env:
+//
+//	DATA_PASSPHRASE=a long sentence only you know
+//
+// From then on data.json, each line of journal.jsonl, backups and conflict copies are written
+// encrypted with AES-256-GCM, and read back transparently by LoadData, ReadJournal and the rest.
+// The key is derived from the passphrase with PBKDF2-HMAC-SHA256 (golang.org/x/crypto/pbkdf2)
+// and a random salt that is stored with the data, so the same passphrase gives a different key
+// on every install.
+//
+// An encrypted file (or journal line) is one line of text:
+//
+//	enc1:<base64 of salt (16 bytes), nonce (12 bytes), ciphertext>
+//
+// Files that are still plain JSON are read as they are, so turning encryption on for existing
+// data just works: the next save writes data.json encrypted (old journal lines stay plain).
+// Keep the passphrase safe: without it the data can't be read, by anyone, including you.
+// On Postgres (postgres.go) the database does the storing, so this doesn't apply there.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// encPrefix starts every encrypted blob. JSON never starts like this, so plain and encrypted
+// files can't be mixed up.
+const encPrefix = "enc1:"
+
+const (
+	encSaltSize = 16
+	// pbkdf2Iterations makes guessing passphrases slow: each guess costs this many HMACs.
+	pbkdf2Iterations = 600000
+	// maxCachedKeys is how many derived keys encKeys keeps. Each salt read (data.json, journal
+	// lines, old backups, copies from another install) adds one, so without a limit a folder
+	// full of foreign files would grow the cache for as long as the app runs.
+	maxCachedKeys = 16
+)
+
+// encKeys caches derived keys by salt (deriving one takes a noticeable fraction of a second),
+// and remembers the salt new data is encrypted with: the one found in existing data, or a new
+// random one.
+var encKeys struct {
+	sync.Mutex
+	bySalt    map[string][]byte
+	writeSalt []byte
+}
+
+// dataPassphrase returns DATA_PASSPHRASE from .env; "" means no encryption.
+func dataPassphrase() string {
+	return os.Getenv("DATA_PASSPHRASE")
+}
+
+// keyForSalt returns the AES-256 key for salt, deriving it the first time.
+func keyForSalt(salt []byte) []byte {
+	encKeys.Lock()
+	defer encKeys.Unlock()
+	if key, ok := encKeys.bySalt[string(salt)]; ok {
+		return key
+	}
+	if encKeys.bySalt == nil {
+		encKeys.bySalt = make(map[string][]byte)
+	}
+	if len(encKeys.bySalt) >= maxCachedKeys {
+		// Full: forget them all but the one new data is written with, and derive again if needed.
+		for s := range encKeys.bySalt {
+			if s != string(encKeys.writeSalt) {
+				delete(encKeys.bySalt, s)
+			}
+		}
+	}
+	key := pbkdf2.Key([]byte(dataPassphrase()), salt, pbkdf2Iterations, 32, sha256.New)
+	encKeys.bySalt[string(salt)] = key
+	if encKeys.writeSalt == nil {
+		encKeys.writeSalt = salt
+	}
+	return key
+}
+
+// currentSalt returns the salt to encrypt with, making a random one if none is known yet.
+func currentSalt() ([]byte, error) {
+	encKeys.Lock()
+	salt := encKeys.writeSalt
+	encKeys.Unlock()
+	if salt != nil {
+		return salt, nil
+	}
+	salt = make([]byte, encSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// newGCM returns AES-GCM with key: AES encrypts, GCM adds a tag that detects any change.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealData encrypts plain when a passphrase is set, and returns it unchanged otherwise.
+func sealData(plain []byte) ([]byte, error) {
+	if dataPassphrase() == "" {
+		return plain, nil
+	}
+	salt, err := currentSalt()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(keyForSalt(salt))
+	if err != nil {
+		return nil, err
+	}
+	// A fresh random nonce for every message: GCM must never reuse one with the same key.
+	blob := make([]byte, encSaltSize+gcm.NonceSize(), encSaltSize+gcm.NonceSize()+len(plain)+gcm.Overhead())
+	copy(blob, salt)
+	nonce := blob[encSaltSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	blob = gcm.Seal(blob, nonce, plain, nil)
+	out := make([]byte, len(encPrefix)+base64.StdEncoding.EncodedLen(len(blob)))
+	copy(out, encPrefix)
+	base64.StdEncoding.Encode(out[len(encPrefix):], blob)
+	return out, nil
+}
+
+// openData decrypts b if it is encrypted; plain data is returned as it is.
+func openData(b []byte) ([]byte, error) {
+	b = bytes.TrimSpace(b)
+	if !bytes.HasPrefix(b, []byte(encPrefix)) {
+		return b, nil
+	}
+	if dataPassphrase() == "" {
+		return nil, errors.New("the data is encrypted: set DATA_PASSPHRASE in .env")
+	}
+	blob := make([]byte, base64.StdEncoding.DecodedLen(len(b)-len(encPrefix)))
+	n, err := base64.StdEncoding.Decode(blob, b[len(encPrefix):])
+	if err != nil {
+		return nil, err
+	}
+	blob = blob[:n]
+	gcm, err := newGCM(make([]byte, 32)) // any key: only for the nonce size
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < encSaltSize+gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	salt, nonce, sealed := blob[:encSaltSize], blob[encSaltSize:encSaltSize+gcm.NonceSize()], blob[encSaltSize+gcm.NonceSize():]
+	if gcm, err = newGCM(keyForSalt(salt)); err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.New("can't decrypt the data: wrong DATA_PASSPHRASE, or the file is damaged")
+	}
+	return plain, nil
+}
+
+// plainReader returns r's content as plain JSON: decrypted in full first if it's encrypted
+// (so streaming an encrypted file uses as much memory as loading it), read as it goes if not.
+func plainReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if p, _ := br.Peek(len(encPrefix)); string(p) != encPrefix {
+		return br, nil
+	}
+	all, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openData(all)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(plain), nil
+}
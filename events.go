@@ -0,0 +1,138 @@
+// events.go - Reminders on the open page, and the same live messages as server-sent events for
+// networks that block WebSockets. Once a minute the reminder scheduler (RunReminders in
+// reminders.go) tells open pages about habits whose reminder time is coming up and a week review
+// that is ready; the page shows them in a banner (layout.html). A page that connects gets the
+// ones that apply right now.
+//
+// Server-sent events are a plain GET that never ends: the server writes "data: ..." lines as
+// things happen, and the browser's EventSource reads them (and reconnects by itself). The page
+// uses /events when its WebSocket to /ws (live.go) can't be opened; the messages are the same.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dueSoonWindow is how long before a habit's reminder time the page mentions it.
+const dueSoonWindow = 15 * time.Minute
+
+// announced remembers which reminders the scheduler has sent to open pages, so each goes out
+// once ("habit:3:2025-10-15", "review:2025-10-15"). It lives in memory: after a restart, pages
+// that connect get the current ones anyway.
+var announced = struct {
+	sync.Mutex
+	keys map[string]bool
+	day  string
+}{keys: make(map[string]bool)}
+
+// reminderEvents returns the reminders that apply at now: habits not done yet whose reminder
+// time is within dueSoonWindow, and the week review if it is due. keys names each one for
+// announced.
+func reminderEvents(data *AppData, now time.Time) (events []LiveEvent, keys []string) {
+	today := now.Format(dateLayout)
+	done := data.History[today].CompletedHabits
+	for _, h := range data.Habits {
+		if h.PausedOn(today) || containsInt(done, h.ID) {
+			continue
+		}
+		at := habitReminderClock(h, now)
+		if at.Before(now) || at.Sub(now) > dueSoonWindow {
+			continue
+		}
+		events = append(events, LiveEvent{Type: "habit_due", HabitID: h.ID, Name: h.Name, Time: at.Format("15:04")})
+		keys = append(keys, fmt.Sprintf("habit:%d:%s", h.ID, today))
+	}
+	if needs, err := NeedsWeekReview(data); err == nil && needs {
+		days, _ := DaysBetween(GetOrSetLastWeekReview(data), today)
+		events = append(events, LiveEvent{Type: "week_review", Days: days})
+		keys = append(keys, "review:"+today)
+	}
+	return events, keys
+}
+
+// PublishReminders sends open pages the reminders from reminderEvents they haven't had yet.
+// Called by the scheduler once a minute.
+func PublishReminders(data *AppData, now time.Time) {
+	events, keys := reminderEvents(data, now)
+	announced.Lock()
+	defer announced.Unlock()
+	if today := now.Format(dateLayout); announced.day != today {
+		announced.keys, announced.day = make(map[string]bool), today
+	}
+	for i, ev := range events {
+		if announced.keys[keys[i]] {
+			continue
+		}
+		announced.keys[keys[i]] = true
+		broadcastLive(ev)
+	}
+}
+
+// liveGreeting is what a page gets on connecting: the current revision, then the reminders that
+// apply now.
+func liveGreeting(now time.Time) ([][]byte, error) {
+	data, err := storedData()
+	if err != nil {
+		return nil, err
+	}
+	events, _ := reminderEvents(data, now)
+	events = append([]LiveEvent{{Type: "change", Revision: data.Revision}}, events...)
+	msgs := make([][]byte, 0, len(events))
+	for _, ev := range events {
+		msg, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// HandleEvents streams the live messages (live.go) as server-sent events: GET /events.
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	greeting, err := liveGreeting(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{}) // the stream stays open; a write timeout would end it
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: pass each event on at once
+
+	messages := subscribeLive()
+	defer unsubscribeLive(messages)
+	// "retry" is how long the browser waits before reconnecting.
+	fmt.Fprint(w, "retry: 5000\n\n")
+	for _, msg := range greeting {
+		fmt.Fprintf(w, "data: %s\n\n", msg)
+	}
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+	for {
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case msg := <-messages:
+			_, err = fmt.Fprintf(w, "data: %s\n\n", msg)
+		case <-ping.C:
+			_, err = fmt.Fprint(w, ": ping\n\n") // a comment line, ignored by the browser
+		case <-r.Context().Done():
+			return // the page was closed
+		}
+		if err != nil {
+			return
+		}
+	}
+}
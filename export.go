@@ -0,0 +1,177 @@
+// export.go - CSV export of one habit's history, for analysis in a spreadsheet:
+//
+//	GET /export/habit/3.csv
+//
+// One row per day from the day the habit was created up to today, with the columns
+//
+//	date,completed,amount,quantity
+//
+// completed is 1 or 0, amount is the minutes logged that day (timers and focus sessions, 0 if
+// none), and quantity is the habit's target as it was on that day. Targets change over time
+// (week reviews, penalties, manual −/+), so the old ones are read back from the change journal
+// (journal.go); without a journal, the manual adjustments are used and the rest is unknown.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quantityChange is a habit's target changing from Before to After on Day.
+type quantityChange struct {
+	Day           string
+	Before, After int
+}
+
+// quantityHistory lists h's target changes in order: from the journal's habit records, or from
+// the manual adjustments when the journal has none.
+func quantityHistory(data *AppData, h *Habit, events []JournalEvent) []quantityChange {
+	var changes []quantityChange
+	key := strconv.Itoa(h.ID)
+	last := -1
+	for _, ev := range events {
+		if ev.Entity != entityHabit || ev.Key != key || len(ev.Record) == 0 {
+			continue
+		}
+		var rec Habit
+		if err := json.Unmarshal(ev.Record, &rec); err != nil || rec.Quantity == last {
+			continue
+		}
+		before := last
+		if before < 0 {
+			before = rec.Quantity // the first record: nothing known before it
+		}
+		changes = append(changes, quantityChange{Day: ev.Time.Local().Format(dateLayout), Before: before, After: rec.Quantity})
+		last = rec.Quantity
+	}
+	if len(changes) > 0 {
+		return changes
+	}
+	for _, a := range data.Adjustments {
+		if a.HabitID == h.ID {
+			changes = append(changes, quantityChange{Day: a.Time.Local().Format(dateLayout), Before: a.From, After: a.To})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Day < changes[j].Day })
+	return changes
+}
+
+// quantityOn returns the target at the end of day; current when there's no history at all.
+func quantityOn(changes []quantityChange, day string, current int) int {
+	if len(changes) == 0 {
+		return current
+	}
+	q := changes[0].Before
+	for _, c := range changes {
+		if c.Day > day {
+			break
+		}
+		q = c.After
+	}
+	return q
+}
+
+// WriteHabitCSV writes h's rows (see the top of this file) up to today.
+func WriteHabitCSV(w io.Writer, src HistorySource, h *Habit, changes []quantityChange, today string) error {
+	days := make(map[string]DayRecord)
+	first := today
+	if !h.CreatedAt.IsZero() {
+		first = h.CreatedAt.Format(dateLayout)
+	}
+	err := HabitDays(src, h.ID, "", today, func(rec DayRecord) bool {
+		days[rec.Date] = rec
+		if rec.Date < first { // older data without a creation date
+			first = rec.Date
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	start, err := ParseDate(first)
+	if err != nil {
+		return err
+	}
+	end, err := ParseDate(today)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "completed", "amount", "quantity"})
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		ds := d.Format(dateLayout)
+		rec := days[ds]
+		completed := "0"
+		if containsInt(rec.CompletedHabits, h.ID) {
+			completed = "1"
+		}
+		cw.Write([]string{ds, completed, strconv.Itoa(rec.MinutesLogged[h.ID]), strconv.Itoa(quantityOn(changes, ds, h.Quantity))})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// HandleExportHabit serves GET /export/habit/{id}.csv as a download.
+func HandleExportHabit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/export/habit/")
+	habitID, err := strconv.Atoi(strings.TrimSuffix(name, ".csv"))
+	if err != nil || !strings.HasSuffix(name, ".csv") {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := LoadDataWithoutHistory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.NotFound(w, r)
+		return
+	}
+	events, err := readJournal()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// A damaged journal only costs the old targets; the export still works.
+		log.Printf("export: reading the journal: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFileName(habit)+`"`)
+	changes := quantityHistory(data, habit, events)
+	if err := WriteHabitCSV(w, FileHistory(dataFile), habit, changes, time.Now().Format(dateLayout)); err != nil {
+		log.Printf("export: %v", err)
+	}
+}
+
+// exportFileName turns the habit's name into a safe file name like "read-pages-3.csv".
+func exportFileName(h *Habit) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(h.Name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			sb.WriteRune(c)
+		case sb.Len() > 0 && !strings.HasSuffix(sb.String(), "-"):
+			sb.WriteByte('-')
+		}
+	}
+	name := strings.TrimSuffix(sb.String(), "-")
+	if name == "" {
+		name = "habit"
+	}
+	return name + "-" + strconv.Itoa(h.ID) + ".csv"
+}
@@ -0,0 +1,225 @@
+// focus.go - Pomodoro focus sessions. A session is started from the /focus page, optionally
+// linked to a habit or a todo, and stored in data.json when it ends. Minutes spent focusing on
+// a time-based habit (unit "minutes" or "hours") count toward that habit's daily target.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFocusMinutes is the classic pomodoro length.
+const defaultFocusMinutes = 25
+
+// unitMinutes returns how many minutes one unit is worth for time-based units
+// ("min", "minutes" -> 1, "h", "hours" -> 60), or 0 if the unit isn't a time unit.
+func unitMinutes(unit string) int {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "m", "min", "mins", "minute", "minutes":
+		return 1
+	case "h", "hr", "hrs", "hour", "hours":
+		return 60
+	}
+	return 0
+}
+
+// IsTimeBased reports whether a habit is measured in time (e.g. "Read 30 minutes").
+func IsTimeBased(h Habit) bool {
+	return unitMinutes(h.Unit) > 0
+}
+
+// TargetMinutes returns the habit's daily target in minutes (0 if it isn't time-based).
+func TargetMinutes(h Habit) int {
+	return h.Quantity * unitMinutes(h.Unit)
+}
+
+// ActiveFocusSession returns the running session (one without an end time), or nil.
+func ActiveFocusSession(data *AppData) *FocusSession {
+	for i := range data.FocusSessions {
+		if data.FocusSessions[i].End.IsZero() {
+			return &data.FocusSessions[i]
+		}
+	}
+	return nil
+}
+
+// NextFocusSessionID returns the next unused session ID (max existing + 1).
+func NextFocusSessionID(data *AppData) int {
+	max := 0
+	for _, s := range data.FocusSessions {
+		if s.ID > max {
+			max = s.ID
+		}
+	}
+	return max + 1
+}
+
+// StopFocusSession ends s at the given time. The recorded minutes are capped at the planned
+// length, so a timer left running in a closed tab doesn't count as hours of focus.
+// Sessions for a time-based habit log their minutes like a habit timer (see LogHabitMinutes),
+// which marks the habit complete once the day's target is reached.
+func StopFocusSession(data *AppData, s *FocusSession, now time.Time) {
+	s.End = now
+	s.Minutes = int(now.Sub(s.Start).Minutes())
+	if s.Minutes > s.PlannedMinutes {
+		s.Minutes = s.PlannedMinutes
+	}
+	if h := FindHabitByID(data, s.HabitID); h != nil && IsTimeBased(*h) {
+		LogHabitMinutes(data, h.ID, s.Date, s.Minutes)
+	}
+}
+
+// focusLabel describes what a session was for, e.g. "Read" or "Task: Pay bills".
+func focusLabel(data *AppData, s FocusSession) string {
+	if h := FindHabitByID(data, s.HabitID); h != nil {
+		return h.Name
+	}
+	for _, t := range data.Todos {
+		if t.ID == s.TodoID {
+			return "Task: " + t.Text
+		}
+	}
+	return "Free focus"
+}
+
+// FocusSessionView is a session plus its label, for the template.
+type FocusSessionView struct {
+	FocusSession
+	Label string
+}
+
+// FocusPageData holds everything the /focus template needs.
+type FocusPageData struct {
+	Settings         Settings
+	Revision         int64 // sent back with the forms (revision.go)
+	Habits           []Habit
+	Todos            []Todo
+	Active           *FocusSessionView
+	RemainingSeconds int // countdown for the running session
+	TodaySessions    []FocusSessionView
+	MinutesByHabit   map[int]int // habit ID -> minutes logged today (focus sessions and timers)
+	TargetByHabit    map[int]int // habit ID -> target minutes (time-based habits only)
+	Message          string
+}
+
+// HandleFocus serves the /focus page: the running timer (if any), a form to start a new
+// session and the list of today's sessions.
+func HandleFocus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	today := Today()
+	pd := FocusPageData{
+		Settings:       data.Settings,
+		Revision:       data.Revision,
+		Habits:         data.Habits,
+		Todos:          data.Todos,
+		MinutesByHabit: make(map[int]int),
+		TargetByHabit:  make(map[int]int),
+	}
+	if s := ActiveFocusSession(data); s != nil {
+		pd.Active = &FocusSessionView{FocusSession: *s, Label: focusLabel(data, *s)}
+		ends := s.Start.Add(time.Duration(s.PlannedMinutes) * time.Minute)
+		if left := int(time.Until(ends).Seconds()); left > 0 {
+			pd.RemainingSeconds = left
+		}
+	}
+	for _, s := range data.FocusSessions {
+		if s.Date == today && !s.End.IsZero() {
+			pd.TodaySessions = append(pd.TodaySessions, FocusSessionView{FocusSession: s, Label: focusLabel(data, s)})
+		}
+	}
+	for _, h := range data.Habits {
+		pd.MinutesByHabit[h.ID] = MinutesLoggedOn(data, h.ID, today)
+		if IsTimeBased(h) {
+			pd.TargetByHabit[h.ID] = TargetMinutes(h)
+		}
+	}
+	switch {
+	case r.URL.Query().Get("stopped") == "1":
+		pd.Message = "Session saved. Nice focus!"
+	case r.URL.Query().Get("error") == "running":
+		pd.Message = "A session is already running. Stop it first."
+	}
+	if err := tmpl.ExecuteTemplate(w, "focus.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleStartFocus handles POST to start a session.
+// Form: target=habit_3 or target=todo_5 (or empty for free focus), minutes=25
+func HandleStartFocus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ActiveFocusSession(data) != nil {
+		http.Redirect(w, r, "/focus?error=running", http.StatusFound)
+		return
+	}
+	minutes := defaultFocusMinutes
+	if n, err := strconv.Atoi(r.FormValue("minutes")); err == nil && n > 0 && n <= 180 {
+		minutes = n
+	}
+	s := FocusSession{
+		ID:             NextFocusSessionID(data),
+		Date:           Today(),
+		Start:          time.Now(),
+		PlannedMinutes: minutes,
+	}
+	// The target select sends "habit_<id>" or "todo_<id>"; strings.Cut splits on the first "_".
+	if kind, idStr, ok := strings.Cut(r.FormValue("target"), "_"); ok {
+		id, _ := strconv.Atoi(idStr)
+		switch {
+		case kind == "habit" && FindHabitByID(data, id) != nil:
+			s.HabitID = id
+		case kind == "todo":
+			s.TodoID = id
+		}
+	}
+	data.FocusSessions = append(data.FocusSessions, s)
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/focus", http.StatusFound)
+}
+
+// HandleStopFocus handles POST to end the running session (the page also posts here
+// automatically when the countdown reaches zero).
+func HandleStopFocus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s := ActiveFocusSession(data)
+	if s == nil {
+		http.Redirect(w, r, "/focus", http.StatusFound)
+		return
+	}
+	StopFocusSession(data, s, time.Now())
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/focus?stopped=1", http.StatusFound)
+}
@@ -0,0 +1,181 @@
+// gamify.go - XP, levels and badges. Every completed habit earns XP, with a bonus when a streak
+// reaches a milestone (7, 30, 100, 365 days). XP adds up to levels, and some moments unlock a
+// badge: a 30-day streak, your first week review, a comeback after a missed day.
+// Everything is kept in data.Profile; the main page shows a small header and /achievements the rest.
+
+package main
+
+import "net/http"
+
+// xpPerCompletion is the XP for each habit completion.
+const xpPerCompletion = 10
+
+// streakBonusXP is the extra XP for reaching a streak of that many days.
+var streakBonusXP = map[int]int{7: 50, 30: 200, 100: 500, 365: 1000}
+
+// Badge is an achievement that can be unlocked once.
+type Badge struct {
+	Key         string
+	Name        string
+	Description string
+}
+
+// allBadges are the badges in the order the achievements page shows them.
+var allBadges = []Badge{
+	{Key: "streak-30", Name: "🔥 30 days strong", Description: "Keep a habit going for 30 days in a row."},
+	{Key: "first-review", Name: "📅 First review", Description: "Complete your first week review."},
+	{Key: "comeback", Name: "💪 Comeback", Description: "Complete a habit the day after missing it."},
+}
+
+// LevelForXP returns the level for an amount of XP. Each level needs 100 XP more than the one
+// before: level 2 at 100 XP, level 3 at 300, level 4 at 600, and so on.
+func LevelForXP(xp int) int {
+	level := 1
+	for xp >= levelStartXP(level+1) {
+		level++
+	}
+	return level
+}
+
+// levelStartXP is the XP at which a level is reached.
+func levelStartXP(level int) int {
+	return 50 * level * (level - 1)
+}
+
+// unlockBadge records a badge as unlocked on day (it keeps the first date if it already is).
+func unlockBadge(data *AppData, key, day string) {
+	if _, ok := data.Profile.Badges[key]; ok {
+		return
+	}
+	if data.Profile.Badges == nil {
+		data.Profile.Badges = make(map[string]string)
+	}
+	data.Profile.Badges[key] = day
+}
+
+// streakMilestoneBonus returns the bonus XP for completing habitID on date (0 unless that makes a
+// milestone streak) and the streak it makes. Only today's completions count towards streaks.
+func streakMilestoneBonus(data *AppData, habitID int, date string) (int, int) {
+	if date != Today() {
+		return 0, 0
+	}
+	streak := streakEndingOn(data, habitID, Yesterday()) + 1 // the streak up to yesterday, and today
+	return streakBonusXP[streak], streak
+}
+
+// missedDayBefore reports whether the habit was missed the day before date.
+func missedDayBefore(data *AppData, h *Habit, date string) bool {
+	t, err := ParseDate(date)
+	if err != nil {
+		return false
+	}
+	return habitMissedOn(data, h, t.AddDate(0, 0, -1).Format(dateLayout))
+}
+
+// awardCompletion gives the XP and badges for completing habitID on date. It's called by
+// SetHabitCompleted just before the completion is recorded.
+func awardCompletion(data *AppData, habitID int, date string) {
+	bonus, streak := streakMilestoneBonus(data, habitID, date)
+	data.Profile.XP += xpPerCompletion + bonus
+	if h := FindHabitByID(data, habitID); h != nil && bonus > 0 {
+		notifyMilestone(h, streak, date) // with a card to share (sharecard.go)
+	}
+	if streak >= 30 {
+		unlockBadge(data, "streak-30", date)
+	}
+	if h := FindHabitByID(data, habitID); h != nil && missedDayBefore(data, h, date) {
+		unlockBadge(data, "comeback", date)
+		h.BreaksRecovered++ // comeback.go
+	}
+}
+
+// revokeCompletion takes back the XP of a completion that is undone (badges stay unlocked), so
+// ticking and unticking a habit can't farm XP. It's called before the completion is removed,
+// and the streak bonus is worked out without today, so it is the same one awardCompletion gave.
+// An undone comeback no longer counts either.
+func revokeCompletion(data *AppData, habitID int, date string) {
+	bonus, _ := streakMilestoneBonus(data, habitID, date)
+	data.Profile.XP -= xpPerCompletion + bonus
+	if data.Profile.XP < 0 {
+		data.Profile.XP = 0
+	}
+	if h := FindHabitByID(data, habitID); h != nil && missedDayBefore(data, h, date) && h.BreaksRecovered > 0 {
+		h.BreaksRecovered--
+	}
+}
+
+// ProfileView is the level and progress shown in the header and on the achievements page.
+type ProfileView struct {
+	XP          int
+	Level       int
+	NextLevel   int
+	LevelXP     int // XP earned since the current level started
+	LevelNeeded int // XP between this level and the next
+	Percent     int // progress towards the next level
+	Badges      int // how many badges are unlocked
+}
+
+// NewProfileView works out the level and progress for the profile.
+func NewProfileView(p Profile) ProfileView {
+	level := LevelForXP(p.XP)
+	v := ProfileView{
+		XP:          p.XP,
+		Level:       level,
+		NextLevel:   level + 1,
+		LevelXP:     p.XP - levelStartXP(level),
+		LevelNeeded: levelStartXP(level+1) - levelStartXP(level),
+		Badges:      len(p.Badges),
+	}
+	v.Percent = v.LevelXP * 100 / v.LevelNeeded
+	return v
+}
+
+// BadgeView is a badge on the achievements page.
+type BadgeView struct {
+	Badge
+	Unlocked string // the day it was unlocked ("" = still locked)
+}
+
+// StreakBonusView is one line of the streak bonus table.
+type StreakBonusView struct {
+	Days int
+	XP   int
+}
+
+// AchievementsPageData is what achievements.html gets.
+type AchievementsPageData struct {
+	Settings      Settings
+	Profile       ProfileView
+	Badges        []BadgeView
+	XPPerHabit    int
+	StreakBonuses []StreakBonusView
+	ShareCards    []ShareCardView // milestones reached, to share (sharecard.go)
+}
+
+// HandleAchievements shows the level, XP and badges (GET /achievements).
+func HandleAchievements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := AchievementsPageData{
+		Settings:   data.Settings,
+		Profile:    NewProfileView(data.Profile),
+		XPPerHabit: xpPerCompletion,
+		ShareCards: reachedMilestones(data),
+	}
+	for _, b := range allBadges {
+		pd.Badges = append(pd.Badges, BadgeView{Badge: b, Unlocked: data.Profile.Badges[b.Key]})
+	}
+	for _, days := range []int{7, 30, 100, 365} {
+		pd.StreakBonuses = append(pd.StreakBonuses, StreakBonusView{Days: days, XP: streakBonusXP[days]})
+	}
+	if err := tmpl.ExecuteTemplate(w, "achievements.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
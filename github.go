@@ -0,0 +1,176 @@
+// github.go - Completing a "Code every day" habit from your GitHub contributions. Every hour the
+// app asks the GitHub API for your contribution calendar of the last week and completes the
+// habit on each day with enough contributions. Configure it in .env:
+//
+//	GITHUB_USER=octocat
+//	GITHUB_TOKEN=ghp_...            (a token; no scopes needed, add "repo" to count private work)
+//	GITHUB_HABIT=Code every day     (optional: the habit's name or ID, default "Code every day")
+//	GITHUB_MIN_CONTRIBUTIONS=1      (optional: contributions needed per day, default 1)
+//
+// Completions are tagged "github" (DayRecord's CompletionSources), like imported health data.
+// The calendar's days are those of GitHub's contribution graph, which may differ from your
+// time zone around midnight.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const githubGraphQL = "https://api.github.com/graphql"
+
+// githubConfig is the GitHub integration's settings from .env.
+type githubConfig struct {
+	user, token, habit string
+	min                int
+}
+
+// loadGitHubConfig reads the GITHUB_* settings; ok is false when the integration is off.
+func loadGitHubConfig() (c githubConfig, ok bool) {
+	c = githubConfig{user: os.Getenv("GITHUB_USER"), token: os.Getenv("GITHUB_TOKEN"), habit: os.Getenv("GITHUB_HABIT"), min: 1}
+	if c.habit == "" {
+		c.habit = "Code every day"
+	}
+	if n, err := strconv.Atoi(os.Getenv("GITHUB_MIN_CONTRIBUTIONS")); err == nil && n > 0 {
+		c.min = n
+	}
+	return c, c.user != "" && c.token != ""
+}
+
+// FetchGitHubContributions returns the user's contributions per day ("2025-01-28" -> 3) from
+// from to to, using the GraphQL API (the REST API has no contribution calendar).
+func FetchGitHubContributions(client *http.Client, user, token string, from, to time.Time) (map[string]int, error) {
+	query := `query($user: String!, $from: DateTime!, $to: DateTime!) {
+  user(login: $user) {
+    contributionsCollection(from: $from, to: $to) {
+      contributionCalendar { weeks { contributionDays { date contributionCount } } }
+    }
+  }
+}`
+	body, err := json.Marshal(map[string]any{
+		"query":     query,
+		"variables": map[string]string{"user": user, "from": from.Format(time.RFC3339), "to": to.Format(time.RFC3339)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, githubGraphQL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+	var out struct {
+		Data struct {
+			User *struct {
+				ContributionsCollection struct {
+					ContributionCalendar struct {
+						Weeks []struct {
+							ContributionDays []struct {
+								Date              string `json:"date"`
+								ContributionCount int    `json:"contributionCount"`
+							} `json:"contributionDays"`
+						} `json:"weeks"`
+					} `json:"contributionCalendar"`
+				} `json:"contributionsCollection"`
+			} `json:"user"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out.Errors) > 0 {
+		return nil, fmt.Errorf("GitHub: %s", out.Errors[0].Message)
+	}
+	if out.Data.User == nil {
+		return nil, fmt.Errorf("GitHub user %q not found", user)
+	}
+	counts := make(map[string]int)
+	for _, w := range out.Data.User.ContributionsCollection.ContributionCalendar.Weeks {
+		for _, d := range w.ContributionDays {
+			counts[d.Date] = d.ContributionCount
+		}
+	}
+	return counts, nil
+}
+
+// findGitHubHabit returns the habit named (or numbered) name, or nil.
+func findGitHubHabit(data *AppData, name string) *Habit {
+	for i := range data.Habits {
+		h := &data.Habits[i]
+		if strconv.Itoa(h.ID) == name || strings.EqualFold(h.Name, name) {
+			return h
+		}
+	}
+	return nil
+}
+
+// ApplyGitHubContributions completes habit h on each day with at least min contributions (never
+// after today). Returns how many days were completed.
+func ApplyGitHubContributions(data *AppData, h *Habit, counts map[string]int, min int, now time.Time) int {
+	today := now.Format(dateLayout)
+	added := 0
+	for day, n := range counts {
+		if n >= min && day <= today && completeFromSource(data, h, day, "github") {
+			added++
+		}
+	}
+	return added
+}
+
+// RunGitHubSync polls GitHub every hour, if GITHUB_USER and GITHUB_TOKEN are set. Run it in its
+// own goroutine: go RunGitHubSync()
+func RunGitHubSync() {
+	cfg, ok := loadGitHubConfig()
+	if !ok {
+		return
+	}
+	client := &http.Client{Timeout: 20 * time.Second}
+	sync := func() {
+		now := time.Now()
+		counts, err := FetchGitHubContributions(client, cfg.user, cfg.token, now.AddDate(0, 0, -7), now)
+		if err != nil {
+			log.Println("github:", err)
+			return
+		}
+		data, err := LoadData()
+		if err != nil {
+			log.Println("github:", err)
+			return
+		}
+		h := findGitHubHabit(data, cfg.habit)
+		if h == nil {
+			log.Printf("github: no habit %q (set GITHUB_HABIT)", cfg.habit)
+			return
+		}
+		if ApplyGitHubContributions(data, h, counts, cfg.min, now) == 0 {
+			return
+		}
+		if err := SaveData(data); err != nil {
+			log.Println("github:", err)
+		}
+	}
+	sync()
+	for range time.Tick(time.Hour) {
+		sync()
+	}
+}
@@ -5,3 +5,13 @@ module habit-tracker
 
 // Go version required to build this module.
 go 1.21
+
+require (
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.31.0
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -6,40 +6,80 @@ package main
 import (
 	"html/template"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
 // We parse templates once at startup and reuse them (more efficient than parsing on every request).
+// loadTemplates (assets.go) fills this in: the base layout, the index page, the shared styles
+// and the other pages (each page is executed by its file name).
 var tmpl *template.Template
 
-func init() {
-	// template.Must panics if there's an error - we want to fail fast at startup if templates are broken.
-	// ParseFiles can take multiple files - we'll have one base and one page.
-	tmpl = template.Must(template.ParseFiles("templates/layout.html", "templates/index.html"))
-}
-
-// CalCell is a single calendar box: "empty", "green" (1–6 completed days), or "orange" (7 completed days).
+// CalCell is a single calendar box: "empty", "green" (1–6 completed days), "orange" (7 completed days)
+// "partial" (part of the target done, shaded by Level), "grace" (not done, but in a new habit's
+// grace period, so no penalty), "skip" (excused with a skip token) or "paused" (the habit was
+// paused, see pause.go).
 type CalCell struct {
-	Type string // "empty", "green", "orange"
+	Type  string // "empty", "green", "orange", "partial", "grace", "skip", "paused"
+	Level int    // "partial": 1 to heatmapLevels-1, see heatmapLevel
 }
 
 // TemplateData holds everything we pass to the HTML template.
 type TemplateData struct {
-	Habits              []Habit
-	Todos               []Todo
-	History             map[string]DayRecord
-	Today               string
-	TodayRecord         DayRecord
-	NeedsWeekReview     bool
-	Streaks             map[int]int       // habit ID -> current streak
-	CompletedToday      map[int]bool      // habit ID -> completed today (for easy template checks)
-	CalendarByHabit     map[int][]string  // habit ID -> list of dates (kept for any legacy use)
-	CalendarHabit       map[string]bool   // "habitID_date" -> completed (for heatmap)
-	CalendarCellsByHabit map[int][]CalCell // habit ID -> cells: orange = 7 days, green = 1–6, empty = missed
-	Message             string
+	Settings             Settings
+	Revision             int64        // sent back with the forms (revision.go)
+	Lang                 Locale       // the language the page is shown in (i18n.go)
+	Dates                DateStyle    // how dates are written (dates.go)
+	Version              string       // the footer: "1.4.0 (3f2a9c1)" (version.go)
+	Habits               []Habit      // the habits on today's list
+	PausedHabits         []Habit      // habits paused today (pause.go), listed apart with a Resume button
+	HabitKeys            map[int]int  // habit ID -> the number key that marks it done (shortcuts.go)
+	HabitColors          []HabitColor // the palette offered for a habit's color (appearance.go)
+	Todos                []Todo       // filtered and sorted for display
+	DueToday             []Todo       // todos due today, shown at the top of the page
+	OverdueTodos         map[int]bool // todo ID -> due date has passed
+	TodoSort             string       // "priority", "due" or "" (stored order)
+	TodoPriorityFilter   string       // "high", "medium", "low", "none" or ""
+	TodoDueFilter        string       // "today", "overdue", "none" or ""
+	History              map[string]DayRecord
+	Today                string
+	Yesterday            string
+	TodayRecord          DayRecord
+	NeedsWeekReview      bool
+	NeedsMonthReview     bool // tierreview.go
+	NeedsQuarterReview   bool
+	GraceDays            int                  // penalty grace period for new habits, for the calendar legend
+	Streaks              map[int]int          // habit ID -> current streak
+	CompletedToday       map[int]bool         // habit ID -> completed today (for easy template checks)
+	CalendarByHabit      map[int][]string     // habit ID -> list of dates (kept for any legacy use)
+	CalendarHabit        map[string]int       // "habitID_date" -> heatmapLevel: 0 nothing, 1–3 part of the target, 4 done
+	LoggedMinutes        map[int]int          // habit ID -> minutes logged today (time-based habits only)
+	TargetMinutes        map[int]int          // habit ID -> daily target in minutes (time-based habits only)
+	CheckedIn            map[int]int          // habit ID -> amount checked in today (habits done in sessions only, sessions.go)
+	TimerStarted         map[int]time.Time    // habit ID -> start of its running timer
+	ReminderPreview      map[int]string       // habit ID -> its reminder as it would be sent now
+	SnoozedUntil         map[int]string       // habit ID -> "HH:MM" its snoozed reminder comes back
+	NotifyChannels       []string             // configured notification channels a reminder can go to (notify.go)
+	Prerequisites        map[int][]PrereqView // habit ID -> its chain prerequisites and whether they're done today
+	DependsOnSet         map[int]map[int]bool // habit ID -> set of prerequisite IDs (ticks the checkboxes)
+	Profile              ProfileView          // level and XP for the header (gamify.go)
+	CompletedFrom        map[int]string       // habit ID -> where today's completion came from (health.go, github.go)
+	HealthMetrics        []MetricOption       // what a habit can be linked to (health.go)
+	StravaTypes          []string             // Strava activity types, if Strava is configured (strava.go)
+	SkipTokensLeft       map[int]int          // habit ID -> skip tokens left this month
+	SkippedToday         map[int]bool         // habit ID -> today is excused with a skip token
+	MissedYesterday      map[int]bool         // habit ID -> yesterday was missed and can still be excused
+	PendingConfirm       map[int]string       // habit ID -> "complete"/"uncomplete" waiting for a second click
+	CalendarCellsByHabit map[int][]CalCell    // habit ID -> cells: orange = 7 days, green = 1–6, empty = missed
+	ConflictFiles        []string             // sync conflict copies of data.json waiting to be merged
+	IntegrityWarnings    []string             // suspicious changes found by the last nightly snapshot
+	AIEnabled            bool                 // an OpenAI key is set: voice-note todos (voice.go) and triage (triage.go)
+	DuplicateTodo        *Todo                // a task already on the list, to confirm before adding it again
+	Draft                *ParsedHabit         // a habit described in words, to confirm in the add form (parsehabit.go)
+	Form                 FormState            // a form sent back with errors, or the draft (validation.go)
+	Message              string
 }
 
 // HandleIndex serves the main page: load data, process yesterday's misses, check week review, render HTML.
@@ -53,27 +93,48 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	renderIndex(w, r, FormState{})
+}
 
+// renderIndex renders the main page. form is a form sent back with errors (validation.go), shown
+// with what was typed and the messages; the page then answers 422 Unprocessable Entity.
+func renderIndex(w http.ResponseWriter, r *http.Request, form FormState) {
 	data, err := LoadData()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Nothing entered yet: start with the setup wizard (setup.go).
+	if NeedsSetup(data) {
+		http.Redirect(w, r, "/setup", http.StatusFound)
+		return
+	}
+
 	// Ensure CreatedAt is set on first run (so we have a start date for 7-day cycle).
 	if data.CreatedAt == "" {
 		data.CreatedAt = Today()
 		_ = SaveData(data)
 	}
 
-	// Apply miss penalty for yesterday if any habit wasn't completed (only once per day).
-	ProcessYesterdayMisses(data)
-	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Apply the miss penalty for every day since the last visit on which a habit wasn't completed
+	// (only once per habit per day). With several instances on Postgres, one at a time does this;
+	// the data is loaded again under the lock, so the next one finds the days already processed.
+	err = withRowLock("penalties", func() error {
+		if data, err = LoadData(); err != nil {
+			return err
+		}
+		ProcessMissesSince(data, data.LastProcessedDate)
+		return SaveData(data)
+	})
+	if err != nil {
+		saveFailed(w, err)
 		return
 	}
 
 	needsReview, _ := NeedsWeekReview(data)
+	needsMonthReview, _ := NeedsMonthReview(data)
+	needsQuarterReview, _ := NeedsQuarterReview(data)
 	todayRec := data.History[Today()]
 
 	streaks := make(map[int]int)
@@ -81,108 +142,271 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
 	for _, id := range todayRec.CompletedHabits {
 		completedToday[id] = true
 	}
-	for _, h := range data.Habits {
-		streaks[h.ID] = GetStreakForHabit(data, h.ID)
+	loggedMinutes := make(map[int]int)
+	targetMinutes := make(map[int]int)
+	checkedIn := make(map[int]int)
+	reminderPreview := make(map[int]string)
+	pendingConfirm := make(map[int]string)
+	snoozedUntil := make(map[int]string)
+	skipTokensLeft := make(map[int]int)
+	skippedToday := make(map[int]bool)
+	missedYesterday := make(map[int]bool)
+	yesterdayRec := data.History[Yesterday()]
+	completedFrom := make(map[int]string)
+	for id, source := range data.History[Today()].CompletionSources {
+		completedFrom[id] = source
+		if label, ok := sourceLabels[source]; ok {
+			completedFrom[id] = label
+		} else if name, ok := strings.CutPrefix(source, "household:"); ok {
+			completedFrom[id] = name
+		}
 	}
-
-	// Build per-habit date ranges and completion map, then calendar cells (orange = 7 days, green = 1–6, empty = missed).
-	calMap := make(map[string]bool)
-	calendarByHabit := make(map[int][]string)
-	calendarCellsByHabit := make(map[int][]CalCell)
-	now := time.Now()
-	todayEnd := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
+	prerequisites := make(map[int][]PrereqView)
+	dependsOnSet := make(map[int]map[int]bool)
 	for _, h := range data.Habits {
-		start := h.CreatedAt
-		if start.IsZero() {
-			if data.CreatedAt != "" {
-				if t, err := time.Parse("2006-01-02", data.CreatedAt); err == nil {
-					start = t
-				}
-			}
-			if start.IsZero() {
-				start = now
+		dependsOnSet[h.ID] = make(map[int]bool)
+		for _, id := range h.DependsOn {
+			dependsOnSet[h.ID][id] = true
+			if p := FindHabitByID(data, id); p != nil {
+				prerequisites[h.ID] = append(prerequisites[h.ID], PrereqView{Name: p.Name, Done: completedToday[id]})
 			}
 		}
-		var dates []string
-		for d := start; !d.After(todayEnd); d = d.AddDate(0, 0, 1) {
-			ds := d.Format("2006-01-02")
-			dates = append(dates, ds)
-			rec := data.History[ds]
-			for _, id := range rec.CompletedHabits {
-				if id == h.ID {
-					calMap[calendarKey(h.ID, ds)] = true
-					break
-				}
-			}
+		skipTokensLeft[h.ID] = SkipTokensLeft(data, h.ID, time.Now())
+		skippedToday[h.ID] = containsInt(todayRec.SkippedHabits, h.ID)
+		missedYesterday[h.ID] = containsInt(yesterdayRec.PenaltyAppliedForHabits, h.ID)
+		if t, ok := data.SnoozedUntil[h.ID]; ok && time.Now().Before(t) {
+			snoozedUntil[h.ID] = t.Format("15:04")
 		}
-		calendarByHabit[h.ID] = dates
-		// Build cells: every 7 consecutive completed days → 1 orange box, remainder → green; missed → empty.
-		var cells []CalCell
-		run := 0
-		for _, ds := range dates {
-			done := calMap[calendarKey(h.ID, ds)]
-			if done {
-				run++
-			} else {
-				// Flush completed run: full weeks → orange, remainder → green
-				for run >= 7 {
-					cells = append(cells, CalCell{Type: "orange"})
-					run -= 7
-				}
-				for run > 0 {
-					cells = append(cells, CalCell{Type: "green"})
-					run--
-				}
-				cells = append(cells, CalCell{Type: "empty"})
-			}
+		if action := PendingConfirmation(h.ID); action != "" {
+			pendingConfirm[h.ID] = action
 		}
-		for run >= 7 {
-			cells = append(cells, CalCell{Type: "orange"})
-			run -= 7
+		streaks[h.ID] = GetStreakForHabit(data, h.ID)
+		if msg, err := RenderReminder(h, streaks[h.ID]); err == nil {
+			reminderPreview[h.ID] = msg
 		}
-		for run > 0 {
-			cells = append(cells, CalCell{Type: "green"})
-			run--
+		if IsTimeBased(h) {
+			loggedMinutes[h.ID] = MinutesLoggedOn(data, h.ID, Today())
+			targetMinutes[h.ID] = TargetMinutes(h)
+		}
+		if h.SessionSize() > 0 {
+			checkedIn[h.ID] = CheckedIn(todayRec, h.ID)
 		}
-		calendarCellsByHabit[h.ID] = cells
 	}
 
+	// Per-habit date ranges and calendar cells (orange = 7 days, green = 1–6, empty = missed).
+	calMap, calendarByHabit, calendarCellsByHabit := buildCalendars(data, time.Now())
+
+	// Messages are shown in the page's language (i18n.go).
+	loc := RequestLocale(r, data.Settings)
 	msg := ""
 	switch {
 	case r.URL.Query().Get("done") == "1":
-		msg = "Habit marked complete for today!"
+		msg = loc.T("Habit marked complete for today!")
+		if id, err := strconv.Atoi(r.URL.Query().Get("comeback")); err == nil {
+			if text := ComebackMessage(data, id, Today(), loc); text != "" {
+				msg = text
+			}
+		}
 	case r.URL.Query().Get("review") == "1":
-		msg = "Week review complete. All habits incremented!"
+		msg = loc.T("Week review complete. Targets updated!")
+	case r.URL.Query().Get("tierreview") == "month":
+		msg = loc.T("Monthly review done.")
+	case r.URL.Query().Get("tierreview") == "quarter":
+		msg = loc.T("Quarterly review done. Your goals are set for the next three months.")
+	case r.URL.Query().Get("setup") == "1":
+		msg = loc.T("You're all set. Mark a habit done when you've done it today.")
 	case r.URL.Query().Get("added") == "1":
-		msg = "Habit added!"
+		msg = loc.T("Habit added!")
+	case r.URL.Query().Get("added") != "":
+		msg = loc.T("%s habits added!", r.URL.Query().Get("added"))
 	case r.URL.Query().Get("edited") == "1":
-		msg = "Habit name updated!"
-	case r.URL.Query().Get("error") == "name":
-		msg = "Please enter a habit name."
-	case r.URL.Query().Get("error") == "todo":
-		msg = "Please enter a task."
+		msg = loc.T("Habit name updated!")
+	case r.URL.Query().Get("error") == "describe":
+		msg = loc.T("Couldn't make a habit of that. Try something like \"do 20 squats every weekday morning\" (up to 200 characters).")
+	case r.URL.Query().Get("draft") == "1" && r.URL.Query().Get("duplicate") == "1":
+		msg = loc.T("You already have a habit called \"%s\". Press Add below to add a second one anyway.", r.URL.Query().Get("name"))
+	case r.URL.Query().Get("draft") == "1":
+		msg = loc.T("Check the new habit below and press Add.")
+	case r.URL.Query().Get("duplicate_todo") == "1":
+		msg = loc.T("That task is already on your list. Add it anyway?")
 	case r.URL.Query().Get("todo") == "1":
-		msg = "Task added!"
+		msg = loc.T("Task added!")
+	case r.URL.Query().Get("todo") == "triaged":
+		msg = loc.T("Tasks put in the suggested order.")
+	case r.URL.Query().Get("todo") == "voice":
+		msg = loc.T("Task added from your voice note.")
+	case r.URL.Query().Get("error") == "voice-file":
+		msg = loc.T("Upload a voice note (m4a, mp3, wav, webm, ogg or flac, up to 25 MB).")
+	case r.URL.Query().Get("error") == "voice":
+		msg = loc.T("Could not turn that voice note into a task. Check OPENAI_KEY, or try a clearer recording.")
 	case r.URL.Query().Get("todo") == "simplified":
-		msg = "Task broken down into simpler steps!"
+		msg = loc.T("Task broken down into simpler steps!")
 	case r.URL.Query().Get("error") == "simplify":
-		msg = "Could not simplify task. Check OPENAI_KEY and try again."
+		msg = loc.T("Could not simplify task. Check OPENAI_KEY and try again.")
+	case r.URL.Query().Get("error") == "simplify-long":
+		msg = loc.T("That task is too long to simplify. Shorten it first.")
+	case r.URL.Query().Get("timer") != "":
+		msg = loc.T("Timer stopped: %s min logged.", r.URL.Query().Get("timer"))
+	case r.URL.Query().Get("error") == "confirm":
+		msg = loc.T("Not saved: type the amount you did (at least the target) to confirm.")
+	case r.URL.Query().Get("adjusted") == "1":
+		msg = loc.T("Target adjusted.")
+	case r.URL.Query().Get("error") == "adjustcap":
+		msg = loc.T("This habit's target was already adjusted the maximum number of times this week.")
+	case r.URL.Query().Get("skipped") == "1":
+		msg = loc.T("Day skipped. No penalty, and your streak is safe.")
+	case r.URL.Query().Get("error") == "skip":
+		msg = loc.T("That day can't be skipped (it's done, already skipped, or more than a week ago).")
+	case r.URL.Query().Get("error") == "notokens":
+		msg = loc.T("No skip tokens left for this habit this month.")
+	case r.URL.Query().Get("trashed") == "habit":
+		msg = loc.T("Habit moved to the trash. You can restore it there for 30 days.")
+	case r.URL.Query().Get("trashed") == "todo":
+		msg = loc.T("Task moved to the trash. You can restore it there for 30 days.")
+	case r.URL.Query().Get("paused") == "1":
+		msg = loc.T("Habit paused. It keeps its target and streak until you resume it.")
+	case r.URL.Query().Get("resumed") == "1":
+		msg = loc.T("Habit resumed. It's back on today's list.")
+	case r.URL.Query().Get("error") == "pause":
+		msg = loc.T("Pick an end date from today on, or leave it empty to pause until you resume.")
+	case r.URL.Query().Get("error") == "prereq":
+		msg = loc.T("Finish %s first: this habit only counts after that.", r.URL.Query().Get("need"))
+	case r.URL.Query().Get("error") == "chain":
+		msg = loc.T("That would make a loop: habits can't wait for each other.")
+	case r.URL.Query().Get("partner") == "1":
+		msg = loc.T("Partner alerts updated.")
+	case r.URL.Query().Get("imported") != "":
+		msg = loc.T("Imported %s completed days (%s new habits).", r.URL.Query().Get("imported"), r.URL.Query().Get("habits"))
+	case r.URL.Query().Get("strava") == "1":
+		msg = loc.T("Strava link saved.")
+	case r.URL.Query().Get("error") == "strava":
+		msg = loc.T("Pick an activity type; the minimums can't be negative.")
+	case r.URL.Query().Get("health") == "1":
+		msg = loc.T("Health link saved.")
+	case r.URL.Query().Get("error") == "health":
+		msg = loc.T("Pick a metric and a minimum above 0.")
+	case r.URL.Query().Get("chainset") == "1":
+		msg = loc.T("Prerequisites saved.")
+	case r.URL.Query().Get("privacy") == "1":
+		msg = loc.T("Privacy setting saved.")
+	case r.URL.Query().Get("penaltyset") == "1":
+		msg = loc.T("Penalty setting saved.")
+	case r.URL.Query().Get("photo") == "1":
+		msg = loc.T("Photo saved.")
+	case r.URL.Query().Get("error") == "photo":
+		msg = loc.T("Upload a JPEG, PNG, GIF or WebP photo of up to %d MB.", int(maxPhotoBytes()>>20))
+	case r.URL.Query().Get("sessionsset") == "1":
+		msg = loc.T("Sessions saved.")
+	case r.URL.Query().Get("error") == "sessions":
+		msg = loc.T("Split a target into 1 to %d sessions.", maxSessions)
+	case r.URL.Query().Get("confirmset") == "1":
+		msg = loc.T("Confirmation setting saved.")
+	case r.URL.Query().Get("confirm") != "":
+		msg = loc.T("Please confirm below.")
+	case r.URL.Query().Get("reminder") == "1":
+		msg = loc.T("Reminder updated!")
+	case r.URL.Query().Get("error") == "reminder":
+		msg = loc.T("That reminder template has an error. Use variables like {{.Name}}, {{.Streak}}, {{.Quantity}}.")
+	case r.URL.Query().Get("snoozed") != "":
+		msg = loc.T("Reminder snoozed for %s minutes.", r.URL.Query().Get("snoozed"))
+	case r.URL.Query().Get("reviewdone") == "1":
+		msg = loc.T("That week review is already done.")
+	case r.URL.Query().Get("error") == "link":
+		msg = loc.T("That link is not valid.")
+	case r.URL.Query().Get("merged") == "1":
+		msg = loc.T("Sync conflicts merged into your data.")
+	}
+
+	if len(form.Errors) > 0 {
+		msg = loc.T("Please fix the fields marked below.")
+		form = form.Localize(loc)
+	}
+	// A draft (parsehabit.go) fills in the add-habit form the same way.
+	draft := DraftFromQuery(r.URL.Query())
+	if draft != nil && !form.Sent() {
+		form = FormState{Form: "add-habit", Values: url.Values{
+			"name": {draft.Name}, "quantity": {strconv.Itoa(draft.Quantity)}, "unit": {draft.Unit}, "reminder_time": {draft.ReminderTime},
+			"color": {r.URL.Query().Get("color")}, "icon": {r.URL.Query().Get("icon")},
+		}}
+	}
+
+	conflicts, _ := FindConflictFiles() // a failed directory read just means no banner
+	var integrityWarnings []string
+	if snap, ok, _ := LastIntegritySnapshot(); ok && snap.Date == Today() {
+		integrityWarnings = snap.Warnings
+	}
+
+	// Todo sorting/filtering comes from the query string, e.g. /?sort=due&priority=high
+	today := Today()
+	todoSort := r.URL.Query().Get("sort")
+	priorityFilter := r.URL.Query().Get("priority")
+	dueFilter := r.URL.Query().Get("due")
+	todos := SortTodos(FilterTodos(data.Todos, priorityFilter, dueFilter, today), todoSort)
+	overdue := make(map[int]bool)
+	for _, t := range data.Todos {
+		if IsOverdue(t, today) {
+			overdue[t.ID] = true
+		}
 	}
+	habits, paused := todaysHabits(data, today)
 
 	td := TemplateData{
-		Habits:               data.Habits,
-		Todos:                data.Todos,
+		Settings:             data.Settings,
+		Revision:             data.Revision,
+		Lang:                 loc,
+		Dates:                RequestDates(r, data.Settings),
+		Version:              GetBuildInfo().String(),
+		Habits:               habits,
+		PausedHabits:         paused,
+		HabitKeys:            habitKeys(habits),
+		HabitColors:          habitColors,
+		Todos:                todos,
+		DueToday:             SortTodos(TodosDueOn(data.Todos, today), "priority"),
+		OverdueTodos:         overdue,
+		TodoSort:             todoSort,
+		TodoPriorityFilter:   priorityFilter,
+		TodoDueFilter:        dueFilter,
 		History:              data.History,
-		Today:                Today(),
+		Today:                today,
+		Yesterday:            Yesterday(),
 		TodayRecord:          todayRec,
 		NeedsWeekReview:      needsReview,
+		NeedsMonthReview:     needsMonthReview,
+		NeedsQuarterReview:   needsQuarterReview,
+		GraceDays:            data.Settings.GraceDays(),
 		Streaks:              streaks,
 		CompletedToday:       completedToday,
 		CalendarByHabit:      calendarByHabit,
 		CalendarHabit:        calMap,
+		LoggedMinutes:        loggedMinutes,
+		TargetMinutes:        targetMinutes,
+		CheckedIn:            checkedIn,
+		TimerStarted:         data.RunningTimers,
+		ReminderPreview:      reminderPreview,
+		SnoozedUntil:         snoozedUntil,
+		NotifyChannels:       NotifyChannels(),
+		Prerequisites:        prerequisites,
+		DependsOnSet:         dependsOnSet,
+		Profile:              NewProfileView(data.Profile),
+		CompletedFrom:        completedFrom,
+		HealthMetrics:        healthMetrics,
+		StravaTypes:          stravaTypesIfConfigured(),
+		SkipTokensLeft:       skipTokensLeft,
+		SkippedToday:         skippedToday,
+		MissedYesterday:      missedYesterday,
+		PendingConfirm:       pendingConfirm,
 		CalendarCellsByHabit: calendarCellsByHabit,
+		ConflictFiles:        conflicts,
+		IntegrityWarnings:    integrityWarnings,
+		AIEnabled:            openAIKey(data) != "",
+		DuplicateTodo:        DuplicateTodoFromQuery(r.URL.Query()),
+		Draft:                draft,
+		Form:                 form,
 		Message:              msg,
 	}
+	if len(form.Errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
 	// Execute the template named by the first file we parsed: "layout.html"
 	if err := tmpl.ExecuteTemplate(w, "layout.html", td); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -191,6 +415,7 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
 
 // HandleCompleteHabit handles POST when user marks a habit as done for today.
 // Form value: habit_id=1 (and optionally action=uncomplete to uncheck).
+// Habits with a confirmation mode also need confirm_quantity=N or confirm=1 (see confirm.go).
 func HandleCompleteHabit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -208,106 +433,131 @@ func HandleCompleteHabit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if FindHabitByID(data, habitID) == nil {
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
 		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
 		return
 	}
-
-	today := Today()
-	rec := data.History[today]
-	rec.Date = today
-	if rec.CompletedHabits == nil {
-		rec.CompletedHabits = []int{}
+	action := r.FormValue("action")
+	if action != "uncomplete" {
+		action = "complete"
+	}
+	// A due week review (weekreview.go) and a habit's prerequisites (deps.go) come first.
+	if redirect := completionRedirect(data, habit, Today()); action == "complete" && redirect != "" {
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	// High-stakes habits may ask for a typed quantity or a second click first (see confirm.go).
+	if redirect := checkConfirmation(r, habit, action); redirect != "" {
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
 	}
 
-	action := r.FormValue("action")
-	if action == "uncomplete" {
-		// Remove habit from completed list.
-		var newList []int
-		for _, id := range rec.CompletedHabits {
-			if id != habitID {
-				newList = append(newList, id)
-			}
-		}
-		rec.CompletedHabits = newList
-	} else {
-		// Add to completed if not already there.
-		found := false
-		for _, id := range rec.CompletedHabits {
-			if id == habitID {
-				found = true
-				break
-			}
-		}
-		if !found {
-			rec.CompletedHabits = append(rec.CompletedHabits, habitID)
-		}
+	// The first completion after a missed day gets its own message (comeback.go).
+	redirect := "/?done=1"
+	if action == "complete" && missedDayBefore(data, habit, Today()) {
+		redirect += "&comeback=" + strconv.Itoa(habitID)
 	}
-	data.History[today] = rec
+	SetHabitCompleted(data, habitID, Today(), action != "uncomplete")
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
-	http.Redirect(w, r, "/?done=1", http.StatusFound)
+	http.Redirect(w, r, redirect, http.StatusFound)
 }
 
-// HandleWeekReview handles POST when user completes the 7-day review with per-habit increment amounts.
-// Form: increment_<habit_id>=<number> for each habit. User must choose an amount (0 or positive) per habit.
-func HandleWeekReview(w http.ResponseWriter, r *http.Request) {
+// HandleAddHabit handles POST to add a new habit. Form: name=Pushups&quantity=5&unit=pushups
+func HandleAddHabit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if err := r.ParseForm(); err != nil {
-		http.Redirect(w, r, "/?error=review", http.StatusFound)
+	v := NewValidator(r)
+	name := v.Text("name", "Please enter a habit name.", 0)
+	qty := v.Int("quantity", 5, 1, 999)
+	unit := v.Text("unit", "", 0)
+	if unit == "" {
+		unit = "units"
+	}
+	// An optional reminder time, from a habit described in words (parsehabit.go).
+	reminder := v.Clock("reminder_time")
+	color := v.Color("color")
+	icon := v.Text("icon", "", maxIconChars)
+	if !v.Valid() {
+		renderIndex(w, r, v.State("add-habit", 0))
 		return
 	}
+
 	data, err := LoadData()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	increments := make(map[int]int)
-	for _, h := range data.Habits {
-		key := "increment_" + strconv.Itoa(h.ID)
-		val := r.FormValue(key)
-		amount := 0
-		if val != "" {
-			if n, err := strconv.Atoi(val); err == nil && n >= 0 {
-				amount = n
-			}
-		}
-		increments[h.ID] = amount
+	// A second habit with the same name is most likely a mistake: the form comes back with a
+	// warning, and confirm_duplicate=1 adds it anyway.
+	if hasHabitNamed(data, name) && r.FormValue("confirm_duplicate") != "1" {
+		q := url.Values{"draft": {"1"}, "duplicate": {"1"}, "name": {name}, "quantity": {strconv.Itoa(qty)}, "unit": {unit}, "reminder_time": {reminder}, "color": {color}, "icon": {icon}}
+		http.Redirect(w, r, "/?"+q.Encode()+"#add-habit", http.StatusFound)
+		return
 	}
-	CompleteWeekReview(data, increments)
+	h := NewHabit(data, name, qty, unit)
+	h.ReminderTime = reminder
+	h.Color, h.Icon = color, icon
+	data.Habits = append(data.Habits, h)
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
-	http.Redirect(w, r, "/?review=1", http.StatusFound)
+	http.Redirect(w, r, "/?added=1", http.StatusFound)
 }
 
-// HandleAddHabit handles POST to add a new habit. Form: name=Pushups&quantity=5&unit=pushups
-func HandleAddHabit(w http.ResponseWriter, r *http.Request) {
+// HandleEditHabit handles POST to edit a habit's name (and optionally quantity/unit, growth, or
+// color and icon). Available anytime; especially useful during the 7-day review. Form: habit_id=1&name=New Name
+func HandleEditHabit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	name := strings.TrimSpace(r.FormValue("name"))
-	if name == "" {
-		http.Redirect(w, r, "/?error=name", http.StatusFound)
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
 		return
 	}
-	qtyStr := r.FormValue("quantity")
-	qty := 5
-	if qtyStr != "" {
-		if n, err := strconv.Atoi(qtyStr); err == nil && n > 0 {
-			qty = n
+	v := NewValidator(r)
+	name := v.Text("name", "Please enter a habit name.", 0)
+	qty := v.Int("quantity", 0, 1, maxInt)
+	unit := v.Text("unit", "", 0)
+	// Weekly growth: step 1–999, ceiling empty (none) or at least 1. Only checked when the form
+	// has the fields, so the plain rename form leaves them alone.
+	form := "rename"
+	step, max := 0, 0
+	if r.Form.Has("increment_step") {
+		form = "growth"
+		step = v.Int("increment_step", 0, 1, 999)
+		if step == 0 {
+			v.fail("increment_step", "Enter a whole number from %d to %d.", 1, 999)
 		}
 	}
-	unit := strings.TrimSpace(r.FormValue("unit"))
-	if unit == "" {
-		unit = "units"
+	if r.Form.Has("max_quantity") {
+		form = "growth"
+		max = v.Int("max_quantity", 0, 1, maxInt)
+	}
+	// Color and icon (appearance.go), from the look form; empty fields clear them.
+	color, icon := "", ""
+	if r.Form.Has("color") {
+		form = "look"
+		color = v.Color("color")
+		icon = v.Text("icon", "", maxIconChars)
+	}
+	// Notes (markdown.go), from the notes form; empty clears them.
+	notes := ""
+	if r.Form.Has("notes") {
+		form = "notes"
+		notes = v.Text("notes", "", maxNotesChars)
+	}
+	if !v.Valid() {
+		renderIndex(w, r, v.State(form, habitID))
+		return
 	}
 
 	data, err := LoadData()
@@ -315,24 +565,42 @@ func HandleAddHabit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h := Habit{
-		ID:        NextHabitID(data),
-		Name:      name,
-		Quantity:  qty,
-		Unit:      unit,
-		CreatedAt: time.Now(),
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.Name = name
+	// Optional: allow editing quantity and unit at week review
+	if qty > 0 {
+		habit.Quantity = qty
+	}
+	if unit != "" {
+		habit.Unit = unit
+	}
+	if step > 0 {
+		habit.IncrementStep = step
+	}
+	if r.Form.Has("max_quantity") {
+		habit.MaxQuantity = max
+		habit.Quantity = habit.capQuantity(habit.Quantity)
+	}
+	if r.Form.Has("color") {
+		habit.Color, habit.Icon = color, icon
+	}
+	if r.Form.Has("notes") {
+		habit.Notes = notes
 	}
-	data.Habits = append(data.Habits, h)
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
-	http.Redirect(w, r, "/?added=1", http.StatusFound)
+	http.Redirect(w, r, "/?edited=1", http.StatusFound)
 }
 
-// HandleEditHabit handles POST to edit a habit's name (and optionally quantity/unit).
-// Available anytime; especially useful during the 7-day review. Form: habit_id=1&name=New Name
-func HandleEditHabit(w http.ResponseWriter, r *http.Request) {
+// HandleHabitPenalty handles POST to exempt a habit from miss penalties, or not.
+// Form: habit_id=1&exempt=1
+func HandleHabitPenalty(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -342,12 +610,6 @@ func HandleEditHabit(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
 		return
 	}
-	name := strings.TrimSpace(r.FormValue("name"))
-	if name == "" {
-		http.Redirect(w, r, "/?error=name", http.StatusFound)
-		return
-	}
-
 	data, err := LoadData()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -358,32 +620,27 @@ func HandleEditHabit(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
 		return
 	}
-	habit.Name = name
-	// Optional: allow editing quantity and unit at week review
-	if qtyStr := r.FormValue("quantity"); qtyStr != "" {
-		if qty, err := strconv.Atoi(qtyStr); err == nil && qty > 0 {
-			habit.Quantity = qty
-		}
-	}
-	if unit := strings.TrimSpace(r.FormValue("unit")); unit != "" {
-		habit.Unit = unit
-	}
+	habit.PenaltyExempt = r.FormValue("exempt") == "1"
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
-	http.Redirect(w, r, "/?edited=1", http.StatusFound)
+	http.Redirect(w, r, "/?penaltyset=1", http.StatusFound)
 }
 
-// HandleAddTodo handles POST to add a task to the todo list. Form: text=Task description
+// HandleAddTodo handles POST to add a task to the todo list.
+// Form: text=Task description, optional priority=high|medium|low and due_date=YYYY-MM-DD
 func HandleAddTodo(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	text := strings.TrimSpace(r.FormValue("text"))
-	if text == "" {
-		http.Redirect(w, r, "/?error=todo", http.StatusFound)
+	v := NewValidator(r)
+	text := v.Text("text", "Please enter a task.", 0)
+	priority := v.Priority("priority")
+	dueDate := v.Date("due_date")
+	if !v.Valid() {
+		renderIndex(w, r, v.State("add-todo", 0))
 		return
 	}
 	data, err := LoadData()
@@ -391,18 +648,45 @@ func HandleAddTodo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// The same task twice is most likely a mistake: ask first (confirm_duplicate=1 adds it anyway).
+	if hasTodo(data, text) && r.FormValue("confirm_duplicate") != "1" {
+		q := url.Values{"duplicate_todo": {"1"}, "text": {text}, "priority": {priority}, "due_date": {dueDate}}
+		http.Redirect(w, r, "/?"+q.Encode(), http.StatusFound)
+		return
+	}
 	t := Todo{
-		ID:   NextTodoID(data),
-		Text: text,
+		ID:       NextTodoID(data),
+		Text:     text,
+		Priority: priority,
+		DueDate:  dueDate,
 	}
 	data.Todos = append(data.Todos, t)
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
 	http.Redirect(w, r, "/?todo=1", http.StatusFound)
 }
 
+// hasTodo reports whether one of the open todos says text (ignoring case).
+func hasTodo(data *AppData, text string) bool {
+	for _, t := range data.Todos {
+		if strings.EqualFold(t.Text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// DuplicateTodoFromQuery reads the task HandleAddTodo sent back because it is already on the
+// list (nil if none).
+func DuplicateTodoFromQuery(q url.Values) *Todo {
+	if q.Get("duplicate_todo") != "1" || strings.TrimSpace(q.Get("text")) == "" {
+		return nil
+	}
+	return &Todo{Text: strings.TrimSpace(q.Get("text")), Priority: q.Get("priority"), DueDate: q.Get("due_date")}
+}
+
 // HandleSimplifyTodo handles POST when user clicks Simplify — breaks the task into 3 subtasks via OpenAI.
 func HandleSimplifyTodo(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -424,10 +708,12 @@ func HandleSimplifyTodo(w http.ResponseWriter, r *http.Request) {
 
 	var todoText string
 	var todoIndex int
+	var parent Todo
 	for i, t := range data.Todos {
 		if t.ID == todoID {
 			todoText = t.Text
 			todoIndex = i
+			parent = t
 			break
 		}
 	}
@@ -435,9 +721,12 @@ func HandleSimplifyTodo(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
+	if len([]rune(todoText)) > maxSimplifyChars {
+		http.Redirect(w, r, "/?error=simplify-long", http.StatusFound)
+		return
+	}
 
-	apiKey := os.Getenv("OPENAI_KEY")
-	subs, err := BreakIntoSubtasks(todoText, apiKey)
+	subs, err := BreakIntoSubtasks(todoText, openAIKey(data))
 	if err != nil {
 		http.Redirect(w, r, "/?error=simplify", http.StatusFound)
 		return
@@ -446,17 +735,18 @@ func HandleSimplifyTodo(w http.ResponseWriter, r *http.Request) {
 	// Remove the original todo
 	withoutTodo := append(append([]Todo{}, data.Todos[:todoIndex]...), data.Todos[todoIndex+1:]...)
 	data.Todos = withoutTodo
+	dropTodoLink(data, todoID)
 
-	// Assign IDs and build new todos (insert at same position)
+	// Assign IDs and build new todos (insert at same position). Subtasks keep the parent's priority and due date.
 	nextID := NextTodoID(data)
 	var newTodos []Todo
 	for j, text := range subs {
-		newTodos = append(newTodos, Todo{ID: nextID + j, Text: strings.TrimSpace(text)})
+		newTodos = append(newTodos, Todo{ID: nextID + j, Text: strings.TrimSpace(text), Priority: parent.Priority, DueDate: parent.DueDate})
 	}
 	data.Todos = append(append(data.Todos[:todoIndex], newTodos...), data.Todos[todoIndex:]...)
 
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
 	http.Redirect(w, r, "/?todo=simplified", http.StatusFound)
@@ -486,14 +776,15 @@ func HandleCompleteTodo(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	data.Todos = newTodos
+	markTodoDone(data, todoID) // a synced todo is completed in Todoist/TickTick too (todosync.go)
 	if err := SaveData(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		saveFailed(w, err)
 		return
 	}
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-// HandleDeleteHabit handles POST to delete a habit (optional - for cleanup).
+// HandleDeleteHabit handles POST to delete a habit: it goes to the trash (trash.go).
 func HandleDeleteHabit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -505,15 +796,145 @@ func HandleDeleteHabit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var newHabits []Habit
+	if !trashHabit(data, habitID, time.Now()) {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?trashed=habit", http.StatusFound)
+}
+
+// HandleDeleteTodo handles POST to delete a task (instead of completing it): it goes to the
+// trash (trash.go). Form: todo_id=3
+func HandleDeleteTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	todoID, _ := strconv.Atoi(r.FormValue("todo_id"))
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !trashTodo(data, todoID, time.Now()) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?trashed=todo", http.StatusFound)
+}
+
+// buildCalendars builds the calendar of each habit on the main page, from its first day up to
+// now's day: calMap has the heatmapLevel of each "habitID_date" with progress, calendarByHabit
+// the days, and calendarCellsByHabit the cells (orange = 7 days in a row, green = 1–6, empty =
+// missed). It's the slowest part of the page with years of history (see bench_test.go).
+func buildCalendars(data *AppData, now time.Time) (calMap map[string]int, calendarByHabit map[int][]string, calendarCellsByHabit map[int][]CalCell) {
+	calMap = make(map[string]int)
+	calendarByHabit = make(map[int][]string)
+	calendarCellsByHabit = make(map[int][]CalCell)
+	todayEnd := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
+	graceDays := data.Settings.GraceDays()
 	for _, h := range data.Habits {
-		if h.ID != habitID {
-			newHabits = append(newHabits, h)
+		start := h.CreatedAt
+		if start.IsZero() {
+			if data.CreatedAt != "" {
+				if t, err := time.Parse("2006-01-02", data.CreatedAt); err == nil {
+					start = t
+				}
+			}
+			if start.IsZero() {
+				start = now
+			}
 		}
+		var dates []string
+		skipped := make(map[string]bool) // days excused with a skip token
+		for d := start; !d.After(todayEnd); d = d.AddDate(0, 0, 1) {
+			dates = append(dates, d.Format("2006-01-02"))
+		}
+		if len(dates) > 0 {
+			HabitDays(MemoryHistory(data.History), h.ID, dates[0], dates[len(dates)-1], func(rec DayRecord) bool {
+				if level := heatmapLevel(h, rec); level > 0 {
+					calMap[calendarKey(h.ID, rec.Date)] = level
+				}
+				if containsInt(rec.SkippedHabits, h.ID) {
+					skipped[rec.Date] = true
+				}
+				return true
+			})
+		}
+		calendarByHabit[h.ID] = dates
+		// Build cells: every 7 consecutive completed days → 1 orange box, remainder → green; missed → empty.
+		var cells []CalCell
+		run := 0
+		for _, ds := range dates {
+			level := calMap[calendarKey(h.ID, ds)]
+			if level == heatmapLevels {
+				run++
+			} else {
+				// Flush completed run: full weeks → orange, remainder → green
+				for run >= 7 {
+					cells = append(cells, CalCell{Type: "orange"})
+					run -= 7
+				}
+				for run > 0 {
+					cells = append(cells, CalCell{Type: "green"})
+					run--
+				}
+				if level > 0 {
+					cells = append(cells, CalCell{Type: "partial", Level: level})
+				} else if InGracePeriod(h, ds, graceDays) {
+					cells = append(cells, CalCell{Type: "grace"})
+				} else if skipped[ds] {
+					cells = append(cells, CalCell{Type: "skip"})
+				} else if h.PausedOn(ds) {
+					cells = append(cells, CalCell{Type: "paused"})
+				} else {
+					cells = append(cells, CalCell{Type: "empty"})
+				}
+			}
+		}
+		for run >= 7 {
+			cells = append(cells, CalCell{Type: "orange"})
+			run -= 7
+		}
+		for run > 0 {
+			cells = append(cells, CalCell{Type: "green"})
+			run--
+		}
+		calendarCellsByHabit[h.ID] = cells
 	}
-	data.Habits = newHabits
-	_ = SaveData(data)
-	http.Redirect(w, r, "/", http.StatusFound)
+	return calMap, calendarByHabit, calendarCellsByHabit
+}
+
+// heatmapLevels is how many shades a calendar day can have: 1 to heatmapLevels-1 for part of the
+// target, heatmapLevels for done.
+const heatmapLevels = 4
+
+// heatmapLevel is how much of h's target was reached in rec, from 0 (nothing) to heatmapLevels
+// (done), like the shades of GitHub's contribution graph. Part of a target is recorded for
+// time-based habits (minutes from a timer or focus session, focus.go) and habits done in sessions
+// (sessions.go); it is measured against today's target, since past targets aren't kept.
+func heatmapLevel(h Habit, rec DayRecord) int {
+	if containsInt(rec.CompletedHabits, h.ID) {
+		return heatmapLevels
+	}
+	target, logged := TargetMinutes(h), rec.MinutesLogged[h.ID]
+	if done := CheckedIn(rec, h.ID); done > 0 {
+		target, logged = h.Quantity, done
+	}
+	if target <= 0 || logged <= 0 {
+		return 0
+	}
+	// Thirds of the target: under a third is 1, under two thirds 2, the rest 3. A day with
+	// enough minutes that wasn't marked done (the target was raised since) stays at 3.
+	return min(1+logged*(heatmapLevels-1)/target, heatmapLevels-1)
 }
 
 // calendarKey builds a key for the calendar map: "habitID_date".
@@ -0,0 +1,429 @@
+// health.go - Importing health data (steps, workouts, sleep) from Apple Health and Google Fit.
+// A habit can be linked to a metric with a minimum, e.g. "Walk" to 10000 steps: every imported
+// day that reaches it completes the habit, tagged with where it came from (DayRecord's
+// CompletionSources), so the page can show "from Apple Health".
+//
+// Ways in:
+//   - Upload a file on the settings page: Apple Health's export (export.zip, or export.xml from
+//     it) or Google Fit's Takeout (the Takeout .zip, or "Daily activity metrics.csv" from it).
+//   - POST /api/v1/health with JSON, e.g. from an iOS Shortcut or Tasker once a day:
+//     {"source": "shortcuts", "days": [{"date": "2025-01-28", "steps": 10234, "sleep_hours": 7.5}]}
+//
+// Google Fit's daily CSV has steps and "move minutes" (counted as workout minutes), no sleep.
+// Days before a habit was created or in the future are ignored, and so is anything already done.
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The metrics a habit can be linked to.
+const (
+	MetricSteps          = "steps"
+	MetricWorkoutMinutes = "workout_minutes"
+	MetricSleepHours     = "sleep_hours"
+)
+
+// MetricOption is a metric as offered in the habit settings.
+type MetricOption struct {
+	Key   string
+	Label string
+}
+
+// healthMetrics are the metrics in the order the habit settings list them.
+var healthMetrics = []MetricOption{
+	{MetricSteps, "steps"},
+	{MetricWorkoutMinutes, "workout minutes"},
+	{MetricSleepHours, "hours of sleep"},
+}
+
+// sourceLabels are the names shown for where a completion came from (CompletionSources).
+var sourceLabels = map[string]string{
+	"apple-health": "Apple Health",
+	"google-fit":   "Google Fit",
+	"github":       "GitHub",
+	"strava":       "Strava",
+	"habitica":     "Habitica",
+	"loop":         "Loop",
+	"streaks":      "Streaks",
+}
+
+// HealthDay is one day of health data.
+type HealthDay struct {
+	Date           string  `json:"date"`
+	Steps          float64 `json:"steps,omitempty"`
+	WorkoutMinutes float64 `json:"workout_minutes,omitempty"`
+	SleepHours     float64 `json:"sleep_hours,omitempty"`
+}
+
+// Value returns the day's value for a metric.
+func (d HealthDay) Value(metric string) float64 {
+	switch metric {
+	case MetricSteps:
+		return d.Steps
+	case MetricWorkoutMinutes:
+		return d.WorkoutMinutes
+	case MetricSleepHours:
+		return d.SleepHours
+	}
+	return 0
+}
+
+// ApplyHealthDays completes the linked habits on every day whose metric reaches the habit's
+// minimum, tagging the completion with source. Returns how many completions were added.
+func ApplyHealthDays(data *AppData, days []HealthDay, source string, now time.Time) int {
+	today := now.Format(dateLayout)
+	added := 0
+	for _, d := range days {
+		if _, err := ParseDate(d.Date); err != nil || d.Date > today {
+			continue
+		}
+		// Go round until nothing changes, so a habit waiting on another one (deps.go) is
+		// completed once that one is.
+		for changed := true; changed; {
+			changed = false
+			for i := range data.Habits {
+				h := &data.Habits[i]
+				if h.HealthMetric == "" || d.Value(h.HealthMetric) < h.HealthMin {
+					continue
+				}
+				if completeFromSource(data, h, d.Date, source) {
+					added++
+					changed = true
+				}
+			}
+		}
+	}
+	return added
+}
+
+// completeFromSource completes h on day on behalf of an integration and tags the completion with
+// source. It reports false (and changes nothing) if the habit is already done, didn't exist yet
+// or is waiting for a prerequisite (deps.go).
+func completeFromSource(data *AppData, h *Habit, day, source string) bool {
+	if !h.ExistedOn(day) {
+		return false
+	}
+	if containsInt(data.History[day].CompletedHabits, h.ID) || prerequisiteError(data, h, day) != "" {
+		return false
+	}
+	SetHabitCompleted(data, h.ID, day, true)
+	rec := data.History[day]
+	if rec.CompletionSources == nil {
+		rec.CompletionSources = make(map[int]string)
+	}
+	rec.CompletionSources[h.ID] = source
+	data.History[day] = rec
+	return true
+}
+
+// perSource adds up a metric per day and per device/app, then keeps the largest device total of
+// each day. An iPhone and a watch both count steps; adding them up would count twice.
+type perSource map[string]map[string]float64 // day -> source -> total
+
+func (p perSource) add(day, source string, v float64) {
+	if p[day] == nil {
+		p[day] = make(map[string]float64)
+	}
+	p[day][source] += v
+}
+
+func (p perSource) max(day string) float64 {
+	best := 0.0
+	for _, v := range p[day] {
+		if v > best {
+			best = v
+		}
+	}
+	return best
+}
+
+// appleTime is the date format in Apple Health exports: "2025-01-28 07:45:00 +0100".
+const appleTime = "2006-01-02 15:04:05 -0700"
+
+// ParseAppleHealth reads Apple Health's export.xml. It streams the file, since exports of a few
+// years easily pass a gigabyte.
+func ParseAppleHealth(r io.Reader) ([]HealthDay, error) {
+	steps, sleep := perSource{}, perSource{}
+	workouts := make(map[string]float64)
+	dec := xml.NewDecoder(bufio.NewReader(r))
+	dec.Strict = false // the export has a DTD with entities the decoder doesn't know
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		attr := func(name string) string {
+			for _, a := range el.Attr {
+				if a.Name.Local == name {
+					return a.Value
+				}
+			}
+			return ""
+		}
+		switch el.Name.Local {
+		case "Record":
+			switch attr("type") {
+			case "HKQuantityTypeIdentifierStepCount":
+				v, err := strconv.ParseFloat(attr("value"), 64)
+				if err == nil && len(attr("startDate")) >= 10 {
+					steps.add(attr("startDate")[:10], attr("sourceName"), v)
+				}
+			case "HKCategoryTypeIdentifierSleepAnalysis":
+				// Only time asleep counts (not "in bed" or "awake"); a night belongs to the
+				// day you wake up.
+				if !strings.Contains(attr("value"), "Asleep") {
+					continue
+				}
+				start, err1 := time.Parse(appleTime, attr("startDate"))
+				end, err2 := time.Parse(appleTime, attr("endDate"))
+				if err1 == nil && err2 == nil && end.After(start) {
+					sleep.add(attr("endDate")[:10], attr("sourceName"), end.Sub(start).Hours())
+				}
+			}
+		case "Workout":
+			v, err := strconv.ParseFloat(attr("duration"), 64)
+			if err != nil || len(attr("startDate")) < 10 {
+				continue
+			}
+			switch attr("durationUnit") {
+			case "hr":
+				v *= 60
+			case "s":
+				v /= 60
+			}
+			workouts[attr("startDate")[:10]] += v
+		}
+	}
+
+	dates := make(map[string]bool)
+	for _, m := range []perSource{steps, sleep} {
+		for d := range m {
+			dates[d] = true
+		}
+	}
+	for d := range workouts {
+		dates[d] = true
+	}
+	var days []HealthDay
+	for d := range dates {
+		days = append(days, HealthDay{Date: d, Steps: steps.max(d), WorkoutMinutes: workouts[d], SleepHours: sleep.max(d)})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
+
+// ParseGoogleFitCSV reads "Daily activity metrics.csv" from a Google Fit Takeout: one row per
+// day with (among others) the columns "Date", "Step count" and "Move Minutes count".
+func ParseGoogleFitCSV(r io.Reader) ([]HealthDay, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	dateCol, ok := col["Date"]
+	if !ok {
+		return nil, errors.New(`no "Date" column; is this Google Fit's daily activity metrics?`)
+	}
+	value := func(row []string, name string) float64 {
+		i, ok := col[name]
+		if !ok || i >= len(row) {
+			return 0
+		}
+		v, _ := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+		return v
+	}
+	var days []HealthDay
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if dateCol >= len(row) {
+			continue
+		}
+		days = append(days, HealthDay{
+			Date:           strings.TrimSpace(row[dateCol]),
+			Steps:          value(row, "Step count"),
+			WorkoutMinutes: value(row, "Move Minutes count"),
+		})
+	}
+	return days, nil
+}
+
+// ParseHealthUpload reads an uploaded export and returns its days and its source. It accepts
+// the zips as downloaded and the files inside them.
+func ParseHealthUpload(f io.ReaderAt, size int64, name string) ([]HealthDay, string, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, zf := range zr.File {
+			base := path.Base(zf.Name)
+			if base != "export.xml" && base != "Daily activity metrics.csv" {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, "", err
+			}
+			defer rc.Close()
+			if base == "export.xml" {
+				days, err := ParseAppleHealth(rc)
+				return days, "apple-health", err
+			}
+			days, err := ParseGoogleFitCSV(rc)
+			return days, "google-fit", err
+		}
+		return nil, "", errors.New("no export.xml or Daily activity metrics.csv in the zip")
+	}
+	r := io.NewSectionReader(f, 0, size)
+	head := make([]byte, 64)
+	n, _ := r.ReadAt(head, 0)
+	if strings.HasPrefix(strings.TrimSpace(string(head[:n])), "<") {
+		days, err := ParseAppleHealth(r)
+		return days, "apple-health", err
+	}
+	days, err := ParseGoogleFitCSV(r)
+	return days, "google-fit", err
+}
+
+// maxHealthUpload caps uploads; Apple Health's zip is usually well below this.
+const maxHealthUpload = 512 << 20
+
+// HandleHealthImport handles POST /import/health: an uploaded export (form field "file").
+func HandleHealthImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxHealthUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Redirect(w, r, "/settings?error=health#health", http.StatusFound)
+		return
+	}
+	defer file.Close()
+	days, source, err := ParseHealthUpload(file, header.Size, header.Filename)
+	if err != nil {
+		http.Redirect(w, r, "/settings?error=health#health", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	added := ApplyHealthDays(data, days, source, time.Now())
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?imported="+strconv.Itoa(added)+"#health", http.StatusFound)
+}
+
+// HealthRequest is the body of POST /api/v1/health.
+type HealthRequest struct {
+	Source string      `json:"source"`
+	Days   []HealthDay `json:"days"`
+}
+
+// HandleHealthAPI handles POST /api/v1/health: health data pushed by a script or phone automation.
+func HandleHealthAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req HealthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if req.Source == "" {
+		req.Source = "api"
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	added := ApplyHealthDays(data, req.Days, req.Source, time.Now())
+	if err := SaveData(data); err != nil {
+		writeJSON(w, saveStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"completed": added})
+}
+
+// HandleHabitHealth handles POST to link a habit to a health metric.
+// Form: habit_id=1&health_metric=steps&health_min=10000 (empty metric = not linked)
+func HandleHabitHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	metric := r.FormValue("health_metric")
+	min, err := strconv.ParseFloat(r.FormValue("health_min"), 64)
+	known := metric == ""
+	for _, m := range healthMetrics {
+		known = known || m.Key == metric
+	}
+	if !known || (metric != "" && (err != nil || min <= 0)) {
+		http.Redirect(w, r, "/?error=health", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.HealthMetric = metric
+	habit.HealthMin = 0
+	if metric != "" {
+		habit.HealthMin = min
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?health=1", http.StatusFound)
+}
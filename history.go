@@ -0,0 +1,201 @@
+// history.go - Reading day records one at a time instead of all at once. LoadData decodes the
+// whole History map, which grows by one entry per day forever. Code that only needs to walk
+// through the days (stats, heatmaps, the yearly archive) can use a HistorySource instead:
+//
+//	src := FileHistory(dataFile)                 // streams data.json, never builds the map
+//	src := MemoryHistory(data.History)           // the same API over data already loaded
+//	src.Days("2025-01-01", "2025-12-31", func(rec DayRecord) bool { ...; return true })
+//
+// Days come in date order; returning false from the callback stops early.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// HistorySource yields day records between from and to (inclusive, "" = unbounded) in order.
+type HistorySource interface {
+	Days(from, to string, fn func(rec DayRecord) bool) error
+}
+
+// inRange reports whether date is between from and to ("" = no bound). Dates in YYYY-MM-DD
+// compare correctly as plain strings.
+func inRange(date, from, to string) bool {
+	return (from == "" || date >= from) && (to == "" || date <= to)
+}
+
+// MemoryHistory is a HistorySource over an already loaded History map.
+type MemoryHistory map[string]DayRecord
+
+// Days walks the map in date order (Go maps have no order, so the keys are sorted first).
+func (m MemoryHistory) Days(from, to string, fn func(rec DayRecord) bool) error {
+	dates := make([]string, 0, len(m))
+	for date := range m {
+		if inRange(date, from, to) {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		rec := m[date]
+		rec.Date = date
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// FileHistory is a HistorySource that streams the "history" object of a data file. Only one
+// DayRecord is in memory at a time, so memory use stays flat however many years are stored.
+// It relies on the days being stored in date order, which encoding/json does for maps.
+type FileHistory string
+
+// Days reads the file under mu, so it never sees a half-written save; for data.json, changes
+// still waiting in memory (store.go) are written first. Don't call LoadData or SaveData from
+// fn: they wait for the same lock.
+func (path FileHistory) Days(from, to string, fn func(rec DayRecord) bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if string(path) == dataFile && pg != nil {
+		// On Postgres (postgres.go) there is no file: walk the days in memory.
+		data, err := storedDataLocked()
+		if err != nil {
+			return err
+		}
+		return MemoryHistory(data.History).Days(from, to, fn)
+	}
+	if string(path) == dataFile {
+		if err := flushLocked(); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(string(path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := plainReader(f) // decrypted first if DATA_PASSPHRASE is set (encrypt.go)
+	if err != nil {
+		return err
+	}
+
+	// json.Decoder reads the file piece by piece. Token() returns the next delimiter ({ } [ ]),
+	// key or value; Decode() reads a whole value into a Go variable.
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "history" {
+			if err := skipJSONValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+		tok, err := dec.Token()
+		if err != nil || tok == nil { // "history": null
+			return err
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '{' {
+			return fmt.Errorf("%s: history is not an object", path)
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			date, _ := tok.(string)
+			if !inRange(date, from, to) {
+				if err := skipJSONValue(dec); err != nil {
+					return err
+				}
+				continue
+			}
+			var rec DayRecord
+			if err := dec.Decode(&rec); err != nil {
+				return err
+			}
+			rec.Date = date
+			if !fn(rec) {
+				return nil
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// expectDelim reads the next token and checks it is the given delimiter.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil // empty file: no history
+	}
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q in data file", want)
+	}
+	return nil
+}
+
+// skipJSONValue reads past the next value (which may be a whole object or array) without
+// keeping it, by counting opening and closing delimiters.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// HabitDays yields only the days that mention a habit: completed, penalized, skipped, or with
+// minutes logged or check-ins.
+func HabitDays(src HistorySource, habitID int, from, to string, fn func(rec DayRecord) bool) error {
+	return src.Days(from, to, func(rec DayRecord) bool {
+		if containsInt(rec.CompletedHabits, habitID) || containsInt(rec.PenaltyAppliedForHabits, habitID) ||
+			containsInt(rec.SkippedHabits, habitID) || rec.MinutesLogged[habitID] > 0 || len(rec.CheckIns[habitID]) > 0 {
+			return fn(rec)
+		}
+		return true
+	})
+}
+
+// LoadDataWithoutHistory is LoadData for callers that read the days through FileHistory:
+// everything except History, which is left empty. Skipping the days saves copying them.
+func LoadDataWithoutHistory() (*AppData, error) {
+	d, err := storedData()
+	if err != nil {
+		return nil, err
+	}
+	rest := *d
+	rest.History = nil
+	data := cloneData(&rest)
+	data.History = make(map[string]DayRecord)
+	return data, nil
+}
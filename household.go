@@ -0,0 +1,281 @@
+// household.go - Household habits: one habit that several people share, like "Cook dinner",
+// where whoever does it ticks it off. The app has a single owner, so (as with challenges) the
+// others don't get accounts: on the habit's page you add a member by name, and they get a
+// personal link (/household/<token>) where they can mark the habit done for today, or undo their
+// own tick. That is all a member can do; adding and removing members stays with you.
+//
+// A member's completion is an ordinary completion of the habit, tagged with their name in the
+// day's CompletionSources ("household:Sam"), so the habit has one combined streak and the main
+// page says "from Sam". Counting the tags gives each member's contribution. Private habits
+// can't have members.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HouseholdMember is someone who shares a habit through their personal link.
+type HouseholdMember struct {
+	Name    string `json:"name"`
+	Token   string `json:"token"`
+	AddedOn string `json:"added_on"`
+}
+
+// householdSource is the CompletionSources tag for a completion by a member.
+func householdSource(name string) string {
+	return "household:" + name
+}
+
+// findHouseholdMember returns the habit and member with the given link token, or nils.
+func findHouseholdMember(data *AppData, token string) (*Habit, *HouseholdMember) {
+	if token == "" {
+		return nil, nil
+	}
+	for i := range data.Habits {
+		for j := range data.Habits[i].Household {
+			if data.Habits[i].Household[j].Token == token {
+				return &data.Habits[i], &data.Habits[i].Household[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// doneBy returns who did h on day: a member's name, "" for you (or an import), and false if
+// it wasn't done.
+func doneBy(data *AppData, h Habit, day string) (string, bool) {
+	rec := data.History[day]
+	if !containsInt(rec.CompletedHabits, h.ID) {
+		return "", false
+	}
+	name, _ := strings.CutPrefix(rec.CompletionSources[h.ID], "household:")
+	if name == rec.CompletionSources[h.ID] {
+		name = "" // not a member's tag
+	}
+	return name, true
+}
+
+// ContributionRow is one person's share of a household habit.
+type ContributionRow struct {
+	Name   string
+	Last30 int // days done in the last 30 days
+	Total  int // days done ever
+	Me     bool
+}
+
+// Contributions counts who did h: you ("You" for you, "Owner" for the members) and each member,
+// most in the last 30 days first. me is the member token looking at it ("" = you).
+func Contributions(data *AppData, h Habit, today, me string) []ContributionRow {
+	owner := ContributionRow{Name: "You", Me: me == ""}
+	if me != "" {
+		owner.Name = "Owner"
+	}
+	rows := []ContributionRow{owner}
+	index := map[string]int{"": 0}
+	for _, m := range h.Household {
+		index[m.Name] = len(rows)
+		rows = append(rows, ContributionRow{Name: m.Name, Me: m.Token == me})
+	}
+	from := ""
+	if t, err := ParseDate(today); err == nil {
+		from = t.AddDate(0, 0, -29).Format(dateLayout)
+	}
+	for day := range data.History {
+		name, done := doneBy(data, h, day)
+		if !done {
+			continue
+		}
+		i, ok := index[name]
+		if !ok {
+			// A member who was removed: they still did it.
+			i = len(rows)
+			index[name] = i
+			rows = append(rows, ContributionRow{Name: name + " (removed)"})
+		}
+		rows[i].Total++
+		if day >= from && day <= today {
+			rows[i].Last30++
+		}
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		if rows[a].Last30 != rows[b].Last30 {
+			return rows[a].Last30 > rows[b].Last30
+		}
+		return rows[a].Total > rows[b].Total
+	})
+	return rows
+}
+
+// HouseholdView is the household card on the habit page.
+type HouseholdView struct {
+	Members       []HouseholdMemberView
+	Contributions []ContributionRow
+}
+
+// HouseholdMemberView is a member with their link.
+type HouseholdMemberView struct {
+	HouseholdMember
+	URL string
+}
+
+// NewHouseholdView fills in the habit page's household card.
+func NewHouseholdView(data *AppData, h Habit) HouseholdView {
+	var v HouseholdView
+	for _, m := range h.Household {
+		v.Members = append(v.Members, HouseholdMemberView{HouseholdMember: m, URL: publicURL() + "/household/" + m.Token})
+	}
+	if len(h.Household) > 0 {
+		v.Contributions = Contributions(data, h, Today(), "")
+	}
+	return v
+}
+
+// HandleHouseholdMembers handles POST /habit/household from the habit page: habit_id=1&name=Sam
+// adds a member, habit_id=1&remove=<token> removes one (their past completions stay).
+func HandleHouseholdMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := FindHabitByID(data, habitID)
+	if h == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	back := "/habit?id=" + strconv.Itoa(h.ID)
+	flag := "household=1"
+	if token := r.FormValue("remove"); token != "" {
+		var kept []HouseholdMember
+		for _, m := range h.Household {
+			if m.Token != token {
+				kept = append(kept, m)
+			}
+		}
+		h.Household = kept
+		flag = "household=removed"
+	} else {
+		name := strings.TrimSpace(r.FormValue("name"))
+		taken := false
+		for _, m := range h.Household {
+			taken = taken || strings.EqualFold(m.Name, name)
+		}
+		if h.Private || name == "" || len(name) > 40 || taken {
+			http.Redirect(w, r, back+"&error=household#household", http.StatusFound)
+			return
+		}
+		h.Household = append(h.Household, HouseholdMember{Name: name, Token: newQuickToken(), AddedOn: Today()})
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, back+"&"+flag+"#household", http.StatusFound)
+}
+
+// HouseholdPageData is what household.html gets.
+type HouseholdPageData struct {
+	Settings      Settings
+	Habit         Habit
+	Member        HouseholdMember
+	Streak        int    // the combined streak
+	DoneToday     bool   // the habit is done today
+	DoneByName    string // who did it: a member, or "the owner"
+	DoneByMe      bool   // this member did it, so they may undo it
+	Paused        bool
+	Contributions []ContributionRow
+	Message       string
+}
+
+// HandleHousehold handles a member's link /household/{token}: GET shows the habit, today's
+// state and the contributions, POST marks it done for today (done=1) or undoes the member's
+// own completion (undo=1).
+func HandleHousehold(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/household/")
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h, m := findHouseholdMember(data, token)
+	if h == nil || h.Private {
+		http.Error(w, "This link is not valid (anymore).", http.StatusNotFound)
+		return
+	}
+	today := Today()
+	by, done := doneBy(data, *h, today)
+
+	if r.Method == http.MethodPost {
+		flag := ""
+		switch {
+		case r.FormValue("undo") != "" && done && by == m.Name:
+			SetHabitCompleted(data, h.ID, today, false)
+			flag = "undone=1"
+		case r.FormValue("done") != "" && !done && !h.PausedOn(today):
+			if completionBlocked(data, h, today) != "" {
+				http.Redirect(w, r, r.URL.Path+"?error=prereq", http.StatusFound)
+				return
+			}
+			SetHabitCompleted(data, h.ID, today, true)
+			rec := data.History[today]
+			if rec.CompletionSources == nil {
+				rec.CompletionSources = make(map[int]string)
+			}
+			rec.CompletionSources[h.ID] = householdSource(m.Name)
+			data.History[today] = rec
+			flag = "done=1"
+		}
+		if flag != "" {
+			if err := SaveData(data); err != nil {
+				saveFailed(w, err)
+				return
+			}
+		}
+		http.Redirect(w, r, r.URL.Path+"?"+flag, http.StatusFound)
+		return
+	}
+
+	pd := HouseholdPageData{
+		Settings:      data.Settings,
+		Habit:         *h,
+		Member:        *m,
+		Streak:        GetStreakForHabit(data, h.ID),
+		DoneToday:     done,
+		DoneByName:    by,
+		DoneByMe:      done && by == m.Name,
+		Paused:        h.PausedOn(today),
+		Contributions: Contributions(data, *h, today, token),
+	}
+	if done && by == "" {
+		pd.DoneByName = "the owner"
+	}
+	switch q := r.URL.Query(); {
+	case q.Get("done") == "1":
+		pd.Message = "Done for today, thanks " + m.Name + "! 🎉"
+	case q.Get("undone") == "1":
+		pd.Message = "Undone."
+	case q.Get("error") == "prereq":
+		pd.Message = completionBlocked(data, h, today)
+	}
+	if err := tmpl.ExecuteTemplate(w, "household.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
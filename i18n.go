@@ -0,0 +1,144 @@
+// i18n.go - The app in other languages. The main page, the navigation bar and the messages the
+// server shows there go through a message catalog: locales/es.json (Spanish), locales/de.json
+// (German), built into the binary like the templates (assets.go), so ASSETS_DIR can fix a
+// translation or add a language (locales/fr.json). A catalog maps the English text to the
+// translation; English is the text itself, and anything not translated yet stays English.
+//
+// The language is the one picked on the settings page, or else the first language the browser
+// asks for (the Accept-Language header) that has a catalog. In templates:
+//
+//	{{t .Lang "Add a habit"}}  {{t $.Lang "%d day streak" 3}}
+//
+// with fmt verbs for values, so a translation can put them elsewhere in the sentence.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locale is a language code like "es"; "" and "en" are English.
+type Locale string
+
+// catalogs holds the translations by language, loaded at startup by loadCatalogs.
+var catalogs = map[Locale]map[string]string{}
+
+// languageNames are the languages shipped with the app, in their own words, for the settings page.
+var languageNames = map[Locale]string{"en": "English", "es": "Español", "de": "Deutsch"}
+
+// T translates msg and fills in args (fmt verbs). Text without a translation stays English.
+func (l Locale) T(msg string, args ...any) string {
+	if s, ok := catalogs[l][msg]; ok && s != "" {
+		msg = s
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// translate is the "t" template function. lang is the page's Lang; pages that don't pass one
+// (nil) get English.
+func translate(lang any, msg string, args ...any) string {
+	l, _ := lang.(Locale)
+	return l.T(msg, args...)
+}
+
+// loadCatalogs reads locales/*.json. Each file is one language, named by its code.
+func loadCatalogs() error {
+	files, err := fs.Glob(assetFS(), "locales/*.json")
+	if err != nil {
+		return err
+	}
+	loaded := make(map[Locale]map[string]string)
+	for _, name := range files {
+		b, err := fs.ReadFile(assetFS(), name)
+		if err != nil {
+			return err
+		}
+		var c map[string]string
+		if err := json.Unmarshal(b, &c); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		loaded[Locale(strings.TrimSuffix(path.Base(name), ".json"))] = c
+	}
+	catalogs = loaded
+	return nil
+}
+
+// ValidLanguage reports whether code can be picked on the settings page ("" = the browser's).
+func ValidLanguage(code string) bool {
+	return code == "" || code == "en" || catalogs[Locale(code)] != nil
+}
+
+// LanguageOption is a language for the settings page.
+type LanguageOption struct {
+	Code, Name string
+}
+
+// LanguageOptions lists English and every language with a catalog, by code.
+func LanguageOptions() []LanguageOption {
+	out := []LanguageOption{{Code: "en", Name: languageNames["en"]}}
+	for code := range catalogs {
+		if code == "en" {
+			continue
+		}
+		name := languageNames[code]
+		if name == "" {
+			name = string(code)
+		}
+		out = append(out, LanguageOption{Code: string(code), Name: name})
+	}
+	sort.Slice(out[1:], func(i, j int) bool { return out[i+1].Code < out[j+1].Code })
+	return out
+}
+
+// RequestLocale is the language to show r in: the one from the settings, or else the browser's.
+func RequestLocale(r *http.Request, s Settings) Locale {
+	if s.Language != "" && ValidLanguage(s.Language) {
+		return Locale(s.Language)
+	}
+	for _, tag := range acceptLanguages(r.Header.Get("Accept-Language")) {
+		code, _, _ := strings.Cut(tag, "-")
+		if code == "en" || catalogs[Locale(code)] != nil {
+			return Locale(code)
+		}
+	}
+	return "en"
+}
+
+// acceptLanguages reads an Accept-Language header ("de-CH, de;q=0.9, en;q=0.8") into lower-case
+// language tags ("de-ch", "de", "en"), most wanted first.
+func acceptLanguages(header string) []string {
+	type wanted struct {
+		tag string
+		q   float64
+	}
+	var list []wanted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && tag != "*" && q > 0 {
+			list = append(list, wanted{tag, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	tags := make([]string, len(list))
+	for i, w := range list {
+		tags[i] = w.tag
+	}
+	return tags
+}
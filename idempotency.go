@@ -0,0 +1,154 @@
+// idempotency.go - Making a form post count once. A double click on "Add", or the browser sending
+// a form again (a retry on a bad connection, Back and resubmit), would otherwise add the habit or
+// task twice, or run into the revision check (revision.go) and show an error for a change that
+// did go through. So every form on the app's pages carries a random form_token (the "revision"
+// template adds it when the form is first sent). The first post with a token is handled as usual
+// and its answer - the redirect - is remembered for idempotencyWindow; posts with the same token
+// get that answer again without being handled. A second post that arrives while the first is
+// still running waits for it. Scripts can do the same with an Idempotency-Key header: for the
+// JSON API (/api/...) the answer remembered is the JSON itself, so a retried call gets the same
+// result back.
+//
+// Only answers that went through are remembered (redirects, and 2xx answers from the API): a
+// post that failed can simply be sent again.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idempotencyWindow is how long an answer is remembered.
+const idempotencyWindow = 10 * time.Minute
+
+// maxIdempotentBody is the largest API answer that is remembered; a larger one isn't replayed.
+const maxIdempotentBody = 64 << 10
+
+// idempotentResult is what the first post with a token got.
+type idempotentResult struct {
+	done     chan struct{} // closed when the first post has been answered
+	status   int
+	location string // the redirect's target
+	json     []byte // or, from the API, the JSON answer
+	replay   bool   // false if the answer isn't one to give again
+	expires  time.Time
+}
+
+var (
+	idempotencyMu      sync.Mutex
+	idempotencyResults = make(map[string]*idempotentResult) // token -> result
+)
+
+// idempotencyKey returns the request's token: the Idempotency-Key header or the form_token field
+// of a plain form post ("" if none).
+func idempotencyKey(r *http.Request) string {
+	if k := r.Header.Get("Idempotency-Key"); k != "" {
+		return k
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return r.PostFormValue("form_token")
+	}
+	return ""
+}
+
+// answerRecorder passes the answer through, noting its status and, for the API, keeping a copy
+// of the body.
+type answerRecorder struct {
+	http.ResponseWriter
+	status   int
+	keepBody bool
+	body     bytes.Buffer
+}
+
+func (rec *answerRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *answerRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.keepBody && rec.body.Len() <= maxIdempotentBody {
+		rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// remember fills in res from the answer recorded, if it's one to give again.
+func (rec *answerRecorder) remember(res *idempotentResult, w http.ResponseWriter) {
+	switch {
+	case rec.status >= 300 && rec.status < 400:
+		res.status, res.location, res.replay = rec.status, w.Header().Get("Location"), true
+	case rec.keepBody && rec.status >= 200 && rec.status < 300 && rec.body.Len() <= maxIdempotentBody:
+		res.status, res.json, res.replay = rec.status, rec.body.Bytes(), true
+	}
+}
+
+// claimIdempotencyKey returns the result for key: ours to fill in (first is true) or the one
+// from an earlier post.
+func claimIdempotencyKey(key string, now time.Time) (res *idempotentResult, first bool) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	if len(idempotencyResults) > 1000 {
+		for k, v := range idempotencyResults {
+			if now.After(v.expires) {
+				delete(idempotencyResults, k)
+			}
+		}
+	}
+	if res, ok := idempotencyResults[key]; ok && now.Before(res.expires) {
+		return res, false
+	}
+	res = &idempotentResult{done: make(chan struct{}), expires: now.Add(idempotencyWindow)}
+	idempotencyResults[key] = res
+	return res, true
+}
+
+// Idempotent answers repeated posts of the same form with the first answer (see the top of
+// this file). It goes before RevisionGuard, which would refuse the repeat as outdated.
+func Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := idempotencyKey(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		res, first := claimIdempotencyKey(key, time.Now())
+		if !first {
+			<-res.done
+			switch {
+			case !res.replay:
+				next.ServeHTTP(w, r) // the first one failed: this is a retry
+			case res.location != "":
+				http.Redirect(w, r, res.location, res.status)
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(res.status)
+				w.Write(res.json)
+			}
+			return
+		}
+		rec := &answerRecorder{ResponseWriter: w, keepBody: strings.HasPrefix(r.URL.Path, "/api/")}
+		defer func() {
+			idempotencyMu.Lock()
+			rec.remember(res, w)
+			if !res.replay {
+				delete(idempotencyResults, key)
+			}
+			idempotencyMu.Unlock()
+			close(res.done)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestIdempotentAPIReplaysJSON retries an API call with the same Idempotency-Key: the change must
+// run once and the retry get the first answer back. A call that failed may run again.
+func TestIdempotentAPIReplaysJSON(t *testing.T) {
+	calls := 0
+	h := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/api/v1/fails" {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "not now"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"call": fmt.Sprint(calls)})
+	}))
+	post := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first, again := post("/api/v1/complete", "k1"), post("/api/v1/complete", "k1")
+	if calls != 1 {
+		t.Errorf("handled %d times, want once", calls)
+	}
+	if again.Code != first.Code || again.Body.String() != first.Body.String() {
+		t.Errorf("retry got %d %q, want the first answer %d %q", again.Code, again.Body, first.Code, first.Body)
+	}
+	if ct := again.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("retry Content-Type %q", ct)
+	}
+
+	calls = 0
+	post("/api/v1/fails", "k2")
+	post("/api/v1/fails", "k2")
+	if calls != 2 {
+		t.Errorf("a failed call was handled %d times, want it run again (2)", calls)
+	}
+}
@@ -0,0 +1,496 @@
+// importers.go - Moving over from another habit app. The /import page takes an export from one
+// of the apps below, shows what it found (habits, days done, date range) and only changes
+// data.json once you confirm. Each format has its own parser in the importers table:
+//   - Habitica: Settings → Export Data → "User Data" as JSON. Dailies count on the days they were
+//     completed, habits (+/−) on the days they were scored up.
+//   - Loop Habit Tracker: Settings → "Export as CSV" (the .zip, or Checkmarks.csv from it). Days
+//     you checked count; days Loop filled in by itself (YES_AUTO) don't. Loop's .db backups are
+//     SQLite files, which we can't read - export as CSV instead.
+//   - Streaks: Settings → Export. One row per entry with the task's title, date and entry type;
+//     completed entries count, missed and skipped ones don't.
+//
+// Imported habits are matched to existing ones by name (ignoring case), otherwise created. The
+// completions are tagged with the app they came from (CompletionSources) and earn no XP.
+// Parsed uploads wait in memory for the confirm step: after a restart, upload again.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImportedHabit is one habit found in an export, with the days it was done (sorted, no repeats).
+type ImportedHabit struct {
+	Name     string
+	Quantity int
+	Unit     string
+	Days     []string
+}
+
+// Importer is one supported app: Parse turns its export into habits.
+type Importer struct {
+	Key    string // also the completions' source tag, e.g. "loop"
+	Label  string
+	Accept string // file types for the upload field
+	Parse  func(f io.ReaderAt, size int64, name string) ([]ImportedHabit, error)
+}
+
+// importers are the formats in the order the /import page lists them.
+var importers = []Importer{
+	{"habitica", "Habitica", ".json", ParseHabitica},
+	{"loop", "Loop Habit Tracker", ".zip,.csv", ParseLoop},
+	{"streaks", "Streaks", ".csv", ParseStreaks},
+}
+
+// findImporter returns the importer with the given key, or nil.
+func findImporter(key string) *Importer {
+	for i := range importers {
+		if importers[i].Key == key {
+			return &importers[i]
+		}
+	}
+	return nil
+}
+
+// habitDays collects days per habit name while parsing; list turns it into ImportedHabits.
+type habitDays struct {
+	order []string
+	days  map[string]map[string]bool
+}
+
+func (hd *habitDays) add(name, day string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+	if hd.days == nil {
+		hd.days = make(map[string]map[string]bool)
+	}
+	if hd.days[name] == nil {
+		hd.days[name] = make(map[string]bool)
+		hd.order = append(hd.order, name)
+	}
+	if day != "" {
+		hd.days[name][day] = true
+	}
+}
+
+func (hd *habitDays) list() []ImportedHabit {
+	var out []ImportedHabit
+	for _, name := range hd.order {
+		ih := ImportedHabit{Name: name, Quantity: 1}
+		for day := range hd.days[name] {
+			ih.Days = append(ih.Days, day)
+		}
+		sort.Strings(ih.Days)
+		out = append(out, ih)
+	}
+	return out
+}
+
+// importDateLayouts are the date formats the exports use.
+var importDateLayouts = []string{dateLayout, "20060102", time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "01/02/2006"}
+
+// importDate turns an export's date into YYYY-MM-DD, or "" if it isn't one.
+func importDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(dateLayout)
+		}
+	}
+	return ""
+}
+
+// ParseHabitica reads Habitica's user data JSON.
+func ParseHabitica(f io.ReaderAt, size int64, name string) ([]ImportedHabit, error) {
+	type entry struct {
+		Date      json.RawMessage `json:"date"` // Unix milliseconds, or an ISO date in older exports
+		Completed bool            `json:"completed"`
+		ScoredUp  int             `json:"scoredUp"`
+	}
+	type task struct {
+		Text    string  `json:"text"`
+		History []entry `json:"history"`
+	}
+	var export struct {
+		Tasks *struct {
+			Habits  []task `json:"habits"`
+			Dailies []task `json:"dailys"`
+		} `json:"tasks"`
+	}
+	err := json.NewDecoder(io.NewSectionReader(f, 0, size)).Decode(&export)
+	if err != nil || export.Tasks == nil {
+		return nil, errors.New("no tasks in the file: is it Habitica's user data JSON?")
+	}
+	day := func(raw json.RawMessage) string {
+		var ms int64
+		if err := json.Unmarshal(raw, &ms); err == nil {
+			return time.UnixMilli(ms).Format(dateLayout)
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return importDate(s)
+		}
+		return ""
+	}
+	var hd habitDays
+	for _, t := range export.Tasks.Dailies {
+		hd.add(t.Text, "")
+		for _, e := range t.History {
+			if e.Completed {
+				hd.add(t.Text, day(e.Date))
+			}
+		}
+	}
+	for _, t := range export.Tasks.Habits {
+		hd.add(t.Text, "")
+		for _, e := range t.History {
+			if e.ScoredUp > 0 {
+				hd.add(t.Text, day(e.Date))
+			}
+		}
+	}
+	return hd.list(), nil
+}
+
+// ParseLoop reads Loop Habit Tracker's CSV export: the zip, or its top-level Checkmarks.csv
+// (a Date column, then one column per habit).
+func ParseLoop(f io.ReaderAt, size int64, name string) ([]ImportedHabit, error) {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".db") {
+		return nil, errors.New("Loop backups (.db) can't be read; use Loop's \"Export as CSV\"")
+	}
+	var r io.Reader = io.NewSectionReader(f, 0, size)
+	units := make(map[string]string)
+	if strings.HasSuffix(lower, ".zip") {
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return nil, err
+		}
+		r = nil
+		for _, zf := range zr.File {
+			// Only the top-level files; every habit also has a folder with its own Checkmarks.csv.
+			if strings.Contains(zf.Name, "/") {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			switch path.Base(zf.Name) {
+			case "Checkmarks.csv":
+				r = rc
+			case "Habits.csv":
+				units = loopUnits(rc)
+			}
+		}
+		if r == nil {
+			return nil, errors.New("no Checkmarks.csv in the zip")
+		}
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < 2 || !strings.EqualFold(strings.TrimSpace(header[0]), "date") {
+		return nil, errors.New("not Loop's Checkmarks.csv: the first column should be Date")
+	}
+	var hd habitDays
+	for _, h := range header[1:] {
+		hd.add(h, "")
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		day := importDate(row[0])
+		for i := 1; i < len(row) && i < len(header); i++ {
+			// YES_MANUAL (2 in older versions) is a day you checked.
+			if v := strings.TrimSpace(row[i]); day != "" && (v == "YES_MANUAL" || v == "2") {
+				hd.add(header[i], day)
+			}
+		}
+	}
+	habits := hd.list()
+	for i := range habits {
+		habits[i].Unit = units[habits[i].Name]
+	}
+	return habits, nil
+}
+
+// loopUnits reads the Unit column of Loop's Habits.csv (habit name -> unit), if there is one.
+func loopUnits(r io.Reader) map[string]string {
+	units := make(map[string]string)
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return units
+	}
+	nameCol, unitCol := -1, -1
+	for i, h := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "name":
+			nameCol = i
+		case "unit":
+			unitCol = i
+		}
+	}
+	if nameCol < 0 || unitCol < 0 {
+		return units
+	}
+	for _, row := range rows[1:] {
+		if nameCol < len(row) && unitCol < len(row) {
+			units[strings.TrimSpace(row[nameCol])] = strings.TrimSpace(row[unitCol])
+		}
+	}
+	return units
+}
+
+// ParseStreaks reads the Streaks app's CSV export. Columns are found by their header: the task
+// ("title" or "task"), the day ("entry_date" or "date") and, if present, "entry_type".
+func ParseStreaks(f io.ReaderAt, size int64, name string) ([]ImportedHabit, error) {
+	cr := csv.NewReader(io.NewSectionReader(f, 0, size))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := func(names ...string) int {
+		for i, h := range header {
+			for _, n := range names {
+				if strings.EqualFold(strings.TrimSpace(h), n) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	titleCol, dateCol, typeCol := col("title", "task"), col("entry_date", "date"), col("entry_type", "type")
+	if titleCol < 0 || dateCol < 0 {
+		return nil, errors.New("not a Streaks export: no title and date columns")
+	}
+	var hd habitDays
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if titleCol >= len(row) || dateCol >= len(row) {
+			continue
+		}
+		hd.add(row[titleCol], "")
+		// e.g. "completed_manually", "completed_auto", "missed_manually", "skipped"
+		if typeCol >= 0 && typeCol < len(row) && !strings.Contains(strings.ToLower(row[typeCol]), "complet") {
+			continue
+		}
+		hd.add(row[titleCol], importDate(row[dateCol]))
+	}
+	return hd.list(), nil
+}
+
+// ImportPreviewHabit is one line of the preview.
+type ImportPreviewHabit struct {
+	Name      string
+	Days      int
+	First     string
+	Last      string
+	MergeInto string // the existing habit it's added to, or "" for a new one
+}
+
+// PreviewImport describes what ApplyImport would do, without changing data.
+func PreviewImport(data *AppData, habits []ImportedHabit) []ImportPreviewHabit {
+	var out []ImportPreviewHabit
+	for _, ih := range habits {
+		p := ImportPreviewHabit{Name: ih.Name, Days: len(ih.Days)}
+		if len(ih.Days) > 0 {
+			p.First, p.Last = ih.Days[0], ih.Days[len(ih.Days)-1]
+		}
+		if h := findHabitNamed(data, ih.Name); h != nil {
+			p.MergeInto = h.Name
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// findHabitNamed returns the habit called name (ignoring case), or nil.
+func findHabitNamed(data *AppData, name string) *Habit {
+	for i := range data.Habits {
+		if strings.EqualFold(data.Habits[i].Name, name) {
+			return &data.Habits[i]
+		}
+	}
+	return nil
+}
+
+// ApplyImport adds the habits (or merges them into existing ones of the same name) and their
+// completions up to today, tagged with source. Returns how many habits were created and how
+// many completions were added.
+func ApplyImport(data *AppData, habits []ImportedHabit, source string, now time.Time) (created, completions int) {
+	today := now.Format(dateLayout)
+	for _, ih := range habits {
+		h := findHabitNamed(data, ih.Name)
+		if h == nil {
+			data.Habits = append(data.Habits, NewHabit(data, ih.Name, ih.Quantity, ih.Unit))
+			h = &data.Habits[len(data.Habits)-1]
+			created++
+		}
+		// The history starts with the first imported day, so stats count from there.
+		if len(ih.Days) > 0 {
+			if first, err := ParseDate(ih.Days[0]); err == nil && (h.CreatedAt.IsZero() || first.Before(h.CreatedAt)) {
+				h.CreatedAt = first
+			}
+		}
+		for _, day := range ih.Days {
+			if day > today {
+				continue
+			}
+			rec := data.History[day]
+			if containsInt(rec.CompletedHabits, h.ID) {
+				continue
+			}
+			// Straight into the record rather than SetHabitCompleted: past days earn no XP.
+			rec.Date = day
+			rec.CompletedHabits = append(rec.CompletedHabits, h.ID)
+			if rec.CompletionSources == nil {
+				rec.CompletionSources = make(map[int]string)
+			}
+			rec.CompletionSources[h.ID] = source
+			data.History[day] = rec
+			completions++
+		}
+	}
+	refreshLongestStreaks(data)
+	return created, completions
+}
+
+// pendingImport is a parsed upload waiting for the confirm step.
+type pendingImport struct {
+	source  string
+	habits  []ImportedHabit
+	expires time.Time
+}
+
+// pendingImportWindow is how long a preview can be confirmed.
+const pendingImportWindow = 30 * time.Minute
+
+var (
+	importMu       sync.Mutex
+	pendingImports = make(map[string]pendingImport) // token -> upload
+)
+
+// ImportPageData is what import.html renders.
+type ImportPageData struct {
+	Settings  Settings
+	Importers []Importer
+	Message   string
+	// After an upload: the preview and the token that confirms it.
+	Source  string
+	Preview []ImportPreviewHabit
+	Token   string
+}
+
+// maxImportUpload caps uploads to /import.
+const maxImportUpload = 64 << 20
+
+// HandleImport shows the import page (GET) or parses an upload and shows its preview (POST).
+// Form: format=loop&file=...
+func HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := ImportPageData{Settings: data.Settings, Importers: importers}
+	if r.URL.Query().Get("expired") == "1" {
+		pd.Message = "That preview expired. Upload the file again."
+	}
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportUpload)
+		imp := findImporter(r.FormValue("format"))
+		file, header, err := r.FormFile("file")
+		switch {
+		case imp == nil:
+			pd.Message = "Pick the app the file comes from."
+		case err != nil:
+			pd.Message = "Choose a file to import."
+		default:
+			defer file.Close()
+			habits, err := imp.Parse(file, header.Size, header.Filename)
+			if err != nil {
+				pd.Message = fmt.Sprintf("Could not read that %s export: %v", imp.Label, err)
+			} else if len(habits) == 0 {
+				pd.Message = "No habits found in that file."
+			} else {
+				pd.Source = imp.Label
+				pd.Preview = PreviewImport(data, habits)
+				pd.Token = newQuickToken()
+				importMu.Lock()
+				pendingImports[pd.Token] = pendingImport{source: imp.Key, habits: habits, expires: time.Now().Add(pendingImportWindow)}
+				importMu.Unlock()
+			}
+		}
+	}
+	if err := tmpl.ExecuteTemplate(w, "import.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleImportConfirm applies a previewed upload (POST /import/confirm, form: token=...).
+func HandleImportConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	importMu.Lock()
+	p, ok := pendingImports[r.FormValue("token")]
+	delete(pendingImports, r.FormValue("token"))
+	for token, other := range pendingImports { // drop abandoned previews
+		if time.Now().After(other.expires) {
+			delete(pendingImports, token)
+		}
+	}
+	importMu.Unlock()
+	if !ok || time.Now().After(p.expires) {
+		http.Redirect(w, r, "/import?expired=1", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created, completions := ApplyImport(data, p.habits, p.source, time.Now())
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/?imported=%d&habits=%d", completions, created), http.StatusFound)
+}
@@ -0,0 +1,258 @@
+// insights.go - The stats page (/stats) and the weekly insights report. The page shows how often
+// each habit was done in the last full week (Monday to Sunday) and, over the four weeks up to it,
+// weekdays against weekends and each day of the week. With an OpenAI key, those numbers (never
+// the history itself, never private habits) are turned into a short written report: "You meditate
+// on 90% of weekdays but only 40% of weekends...". A report is written once per week and kept in
+// data.json (insights), so it costs one request a week.
+//
+// Set SUMMARY_EMAIL in .env (and SMTP_HOST, see notify.go) to get the week's numbers and the
+// report by email once a week, on Monday at reminder time. Private habits are left out of it.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// HabitStats is one habit's numbers for a week.
+type HabitStats struct {
+	ID          int
+	Name, Unit  string
+	Target      int
+	Private     bool
+	WeekDone    int // the week: days done
+	WeekDays    int // the week: days counted (skipped and paused days, and days before the habit existed, aren't)
+	WeekdayDone int // the four weeks, Monday to Friday
+	WeekdayDays int
+	WeekendDone int // the four weeks, Saturday and Sunday
+	WeekendDays int
+	ByWeekday   [7]string // the four weeks, how often done on each day from Monday ("90%", "–" if never counted)
+	Streak      int       // at the end of the week
+	Comebacks   int       // all time: completions right after a missed day (comeback.go)
+}
+
+// rateText is done/days as a percentage, "–" if no days were counted.
+func rateText(done, days int) string {
+	if days == 0 {
+		return "–"
+	}
+	return fmt.Sprintf("%d%%", done*100/days)
+}
+
+// WeekRate is how often the habit was done in the week.
+func (h HabitStats) WeekRate() string { return rateText(h.WeekDone, h.WeekDays) }
+
+// WeekdayRate is how often the habit was done on weekdays in the four weeks.
+func (h HabitStats) WeekdayRate() string { return rateText(h.WeekdayDone, h.WeekdayDays) }
+
+// WeekendRate is how often the habit was done on weekends in the four weeks.
+func (h HabitStats) WeekendRate() string { return rateText(h.WeekendDone, h.WeekendDays) }
+
+// WeekdayRates is ByWeekday on one line: "100% 80% – 75% 50% 25% 0%".
+func (h HabitStats) WeekdayRates() string { return strings.Join(h.ByWeekday[:], " ") }
+
+// WeekStats are the numbers for one week.
+type WeekStats struct {
+	Week   string // the Monday it starts on; the report is kept under it
+	To     string // the Sunday it ends on
+	Since  string // the first day of the four weeks up to it
+	Habits []HabitStats
+}
+
+// lastFullWeek returns the Monday of the last full week (Monday to Sunday) before now.
+func lastFullWeek(now time.Time) time.Time {
+	day, _ := ParseDate(now.Format(dateLayout))
+	sinceMonday := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -sinceMonday-7)
+}
+
+// ComputeWeekStats works out the numbers for the week starting on monday.
+func ComputeWeekStats(data *AppData, monday time.Time) WeekStats {
+	st := WeekStats{
+		Week:  monday.Format(dateLayout),
+		To:    monday.AddDate(0, 0, 6).Format(dateLayout),
+		Since: monday.AddDate(0, 0, -21).Format(dateLayout),
+	}
+	for _, h := range data.Habits {
+		hs := HabitStats{ID: h.ID, Name: h.Name, Unit: h.Unit, Target: h.Quantity, Private: h.Private,
+			Streak: streakEndingOn(data, h.ID, st.To), Comebacks: h.BreaksRecovered}
+		created := ""
+		if !h.CreatedAt.IsZero() {
+			created = h.CreatedAt.Format(dateLayout)
+		}
+		var done, days [7]int // per weekday, from Monday
+		for i := 0; i < 28; i++ {
+			t := monday.AddDate(0, 0, i-21)
+			day := t.Format(dateLayout)
+			rec := data.History[day]
+			if day < created || h.PausedOn(day) || containsInt(rec.SkippedHabits, h.ID) {
+				continue
+			}
+			wd := (int(t.Weekday()) + 6) % 7
+			ok := containsInt(rec.CompletedHabits, h.ID)
+			days[wd]++
+			if ok {
+				done[wd]++
+			}
+			if i >= 21 {
+				hs.WeekDays++
+				if ok {
+					hs.WeekDone++
+				}
+			}
+		}
+		for wd := range days {
+			if wd < 5 {
+				hs.WeekdayDone += done[wd]
+				hs.WeekdayDays += days[wd]
+			} else {
+				hs.WeekendDone += done[wd]
+				hs.WeekendDays += days[wd]
+			}
+			hs.ByWeekday[wd] = rateText(done[wd], days[wd])
+		}
+		st.Habits = append(st.Habits, hs)
+	}
+	return st
+}
+
+// shared returns a copy of st without the private habits (privacy.go).
+func (st WeekStats) shared() WeekStats {
+	out := st
+	out.Habits = nil
+	for _, h := range st.Habits {
+		if !h.Private {
+			out.Habits = append(out.Habits, h)
+		}
+	}
+	return out
+}
+
+// EnsureInsights writes the report for st's week if there isn't one yet, and keeps it in
+// data.Insights. It reports whether a new report was written.
+func EnsureInsights(data *AppData, st WeekStats) (bool, error) {
+	if data.Insights != nil && data.Insights.Week == st.Week {
+		return false, nil
+	}
+	shared := st.shared()
+	if len(shared.Habits) == 0 {
+		return false, fmt.Errorf("no habits to report on")
+	}
+	text, err := WriteWeeklyInsights(shared, openAIKey(data))
+	if err != nil {
+		return false, err
+	}
+	data.Insights = &InsightsReport{Week: st.Week, Text: text, CreatedAt: time.Now()}
+	return true, nil
+}
+
+// WeeklySummaryText is the body of the weekly email: each shared habit's numbers, then the report.
+func WeeklySummaryText(data *AppData, st WeekStats) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Your week, %s to %s\n\n", st.Week, st.To)
+	for _, h := range st.shared().Habits {
+		fmt.Fprintf(&sb, "%s: done %d of %d days (%s). Last 4 weeks: weekdays %s, weekends %s. Streak: %d days.\n",
+			h.Name, h.WeekDone, h.WeekDays, h.WeekRate(), h.WeekdayRate(), h.WeekendRate(), h.Streak)
+	}
+	if data.Insights != nil && data.Insights.Week == st.Week {
+		sb.WriteString("\n" + data.Insights.Text + "\n")
+	}
+	sb.WriteString("\nMore on the stats page: " + publicURL() + "/stats\n")
+	return sb.String()
+}
+
+// SendWeeklySummary emails the last full week's summary to SUMMARY_EMAIL, once a week
+// (remembered in data.LastSummaryEmail), writing the insights report first if there is an
+// OpenAI key. Without a report the numbers are still sent. It reports whether an email went out.
+func SendWeeklySummary(data *AppData, now time.Time) bool {
+	to := os.Getenv("SUMMARY_EMAIL")
+	if to == "" {
+		return false
+	}
+	n, ok := smtpNotifier(to)
+	if !ok {
+		return false
+	}
+	monday := lastFullWeek(now)
+	st := ComputeWeekStats(data, monday)
+	if data.LastSummaryEmail >= st.Week {
+		return false
+	}
+	if openAIKey(data) != "" {
+		if _, err := EnsureInsights(data, st); err != nil {
+			log.Println("weekly insights:", err)
+		}
+	}
+	if err := n.Send("Your week in habits", WeeklySummaryText(data, st)); err != nil {
+		log.Println("weekly summary:", err)
+		return false // try again next minute
+	}
+	data.LastSummaryEmail = st.Week
+	return true
+}
+
+// StatsPageData is what templates/stats.html gets.
+type StatsPageData struct {
+	Settings Settings
+	Revision int64 // sent back with the form (revision.go)
+	Stats    WeekStats
+	Report   *InsightsReport // the week's report, nil if not written yet
+	CanWrite bool            // an OpenAI key is set
+	Message  string
+}
+
+// HandleStats shows the stats page (GET /stats) and writes the week's insights report (POST).
+func HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	st := ComputeWeekStats(data, lastFullWeek(time.Now()))
+
+	if r.Method == http.MethodPost {
+		if openAIKey(data) == "" {
+			http.Redirect(w, r, "/stats?error=nokey", http.StatusFound)
+			return
+		}
+		written, err := EnsureInsights(data, st)
+		if err != nil {
+			log.Println("weekly insights:", err)
+			http.Redirect(w, r, "/stats?error=ai", http.StatusFound)
+			return
+		}
+		if written {
+			if err := SaveData(data); err != nil {
+				saveFailed(w, err)
+				return
+			}
+		}
+		http.Redirect(w, r, "/stats?insights=1", http.StatusFound)
+		return
+	}
+
+	pd := StatsPageData{Settings: data.Settings, Revision: data.Revision, Stats: st, CanWrite: openAIKey(data) != ""}
+	if data.Insights != nil && data.Insights.Week == st.Week {
+		pd.Report = data.Insights
+	}
+	switch {
+	case r.URL.Query().Get("error") == "nokey":
+		pd.Message = "Writing a report needs an OpenAI key (OPENAI_KEY in .env, or the setup wizard)."
+	case r.URL.Query().Get("error") == "ai":
+		pd.Message = "Could not write the report. Check OPENAI_KEY and try again."
+	case r.URL.Query().Get("insights") == "1":
+		pd.Message = "The report is ready."
+	}
+	if err := tmpl.ExecuteTemplate(w, "stats.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
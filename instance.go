@@ -0,0 +1,75 @@
+// instance.go - What this instance holds, for /about: how much disk the data, journal, backups
+// and photos take, and totals (habits, todos, days of history, completions). The app has one
+// owner and no accounts, so these are the whole instance's numbers; there is no per-user view.
+// Sizes are of the local files only; data kept in Postgres or S3 (blobs.go) isn't counted.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// InstanceStats is the "Storage" and "Totals" part of /about.
+type InstanceStats struct {
+	DataFile, Journal, Backups, Photos int64 // bytes on disk, -1 if there is no such file or folder
+	Habits, Todos, Days, Completions   int
+	Challenges, TrashItems             int
+}
+
+// diskUsage returns the size of a file, or of everything in a folder; -1 if it doesn't exist.
+func diskUsage(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	if !info.IsDir() {
+		return info.Size()
+	}
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if fi, err := d.Info(); err == nil {
+				total += fi.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// NewInstanceStats measures the instance.
+func NewInstanceStats(data *AppData) InstanceStats {
+	s := InstanceStats{
+		DataFile:   diskUsage(dataFile),
+		Journal:    diskUsage(journalFile),
+		Backups:    diskUsage(backupDir()),
+		Photos:     diskUsage(uploadsDir()),
+		Habits:     len(data.Habits),
+		Todos:      len(data.Todos),
+		Days:       len(data.History),
+		Challenges: len(data.Challenges),
+		TrashItems: len(data.Trash),
+	}
+	for _, rec := range data.History {
+		s.Completions += len(rec.CompletedHabits)
+	}
+	return s
+}
+
+// formatBytes writes a size for people: "512 B", "3.4 KB", "12.0 MB".
+func formatBytes(n int64) string {
+	switch {
+	case n < 0:
+		return "—"
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+}
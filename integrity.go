@@ -0,0 +1,246 @@
+// integrity.go - A nightly "fingerprint" of the data so silent data loss is noticed quickly.
+// Once a day we write a compact summary of data.json (counts, date range, per-habit totals and
+// a hash) to integrity.jsonl, compare it with the previous one and log what changed. Totals that
+// go down (fewer history days, fewer completions for a habit) are flagged as warnings, because
+// in normal use they only ever grow.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// integrityFile holds one JSON snapshot per line (JSON Lines), oldest first.
+// integrityLogFile is the human-readable diff log.
+const (
+	integrityFile    = "integrity.jsonl"
+	integrityLogFile = "integrity.log"
+)
+
+// IntegritySnapshot is the daily summary of the data. It is small on purpose: enough to spot
+// that something disappeared, not a backup.
+type IntegritySnapshot struct {
+	Date               string      `json:"date"`
+	TakenAt            time.Time   `json:"taken_at"`
+	SHA256             string      `json:"sha256"`
+	Bytes              int         `json:"bytes"`
+	Habits             int         `json:"habits"`
+	Todos              int         `json:"todos"`
+	HistoryDays        int         `json:"history_days"`
+	FirstDay           string      `json:"first_day"`
+	LastDay            string      `json:"last_day"`
+	FocusSessions      int         `json:"focus_sessions"`
+	CompletionsByHabit map[int]int `json:"completions_by_habit"`
+	Warnings           []string    `json:"warnings,omitempty"` // suspicious changes since the previous snapshot
+}
+
+// TakeIntegritySnapshot summarizes data. raw is the file content the hash is computed from.
+func TakeIntegritySnapshot(data *AppData, raw []byte, now time.Time) IntegritySnapshot {
+	sum := sha256.Sum256(raw)
+	snap := IntegritySnapshot{
+		Date:               now.Format(dateLayout),
+		TakenAt:            now,
+		SHA256:             hex.EncodeToString(sum[:]),
+		Bytes:              len(raw),
+		Habits:             len(data.Habits),
+		Todos:              len(data.Todos),
+		HistoryDays:        len(data.History),
+		FocusSessions:      len(data.FocusSessions),
+		CompletionsByHabit: make(map[int]int),
+	}
+	for date, rec := range data.History {
+		if snap.FirstDay == "" || date < snap.FirstDay {
+			snap.FirstDay = date
+		}
+		if date > snap.LastDay {
+			snap.LastDay = date
+		}
+		for _, id := range rec.CompletedHabits {
+			snap.CompletionsByHabit[id]++
+		}
+	}
+	return snap
+}
+
+// DiffSnapshots compares two snapshots and returns the changes as readable lines, plus the
+// subset that looks like data loss (warnings).
+func DiffSnapshots(prev, cur IntegritySnapshot) (changes, warnings []string) {
+	count := func(what string, a, b int) {
+		if a == b {
+			return
+		}
+		line := fmt.Sprintf("%s: %d -> %d", what, a, b)
+		changes = append(changes, line)
+		if b < a && what != "todos" { // finishing todos removes them, so fewer todos is normal
+			warnings = append(warnings, line)
+		}
+	}
+	count("habits", prev.Habits, cur.Habits)
+	count("todos", prev.Todos, cur.Todos)
+	count("history days", prev.HistoryDays, cur.HistoryDays)
+	count("focus sessions", prev.FocusSessions, cur.FocusSessions)
+
+	if cur.FirstDay > prev.FirstDay && prev.FirstDay != "" {
+		line := fmt.Sprintf("first day: %s -> %s", prev.FirstDay, cur.FirstDay)
+		changes = append(changes, line)
+		warnings = append(warnings, line)
+	}
+	if cur.LastDay < prev.LastDay {
+		line := fmt.Sprintf("last day: %s -> %s", prev.LastDay, cur.LastDay)
+		changes = append(changes, line)
+		warnings = append(warnings, line)
+	}
+
+	// Go map iteration order is random, so sort the habit IDs for a stable log.
+	ids := make([]int, 0, len(prev.CompletionsByHabit))
+	for id := range prev.CompletionsByHabit {
+		ids = append(ids, id)
+	}
+	for id := range cur.CompletionsByHabit {
+		if _, seen := prev.CompletionsByHabit[id]; !seen {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		count(fmt.Sprintf("habit %d completions", id), prev.CompletionsByHabit[id], cur.CompletionsByHabit[id])
+	}
+	return changes, warnings
+}
+
+// LastIntegritySnapshot returns the most recent snapshot, or ok=false if there is none yet.
+func LastIntegritySnapshot() (snap IntegritySnapshot, ok bool, err error) {
+	f, err := os.Open(integrityFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snap, false, nil
+		}
+		return snap, false, err
+	}
+	defer f.Close()
+	var last string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := sc.Err(); err != nil || last == "" {
+		return snap, false, err
+	}
+	if err := json.Unmarshal([]byte(last), &snap); err != nil {
+		return snap, false, err
+	}
+	return snap, true, nil
+}
+
+// RecordIntegritySnapshot takes today's snapshot (unless one exists already), appends it to
+// integrity.jsonl and writes the diff against the previous one to integrity.log.
+func RecordIntegritySnapshot(now time.Time) error {
+	prev, hasPrev, err := LastIntegritySnapshot()
+	if err != nil {
+		return err
+	}
+	if hasPrev && prev.Date == now.Format(dateLayout) {
+		return nil // already done today
+	}
+
+	mu.Lock()
+	err = flushLocked() // the file as it is in memory (store.go)
+	var raw []byte
+	if err == nil {
+		raw, err = os.ReadFile(dataFile)
+	}
+	if err == nil {
+		raw, err = openData(raw) // hash the content, not the encryption (which differs each save)
+	}
+	mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // nothing saved yet
+		}
+		return err
+	}
+	data, err := LoadData()
+	if err != nil {
+		return err
+	}
+	snap := TakeIntegritySnapshot(data, raw, now)
+
+	var changes []string
+	if hasPrev {
+		changes, snap.Warnings = DiffSnapshots(prev, snap)
+	}
+	line, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := appendLine(integrityFile, string(line)); err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("%s snapshot %s (%d bytes)", snap.Date, snap.SHA256[:12], snap.Bytes)
+	if !hasPrev {
+		header += ": first snapshot"
+	} else if len(changes) == 0 {
+		header += ": no changes"
+	}
+	logLines := []string{header}
+	for _, c := range changes {
+		prefix := "  "
+		if containsString(snap.Warnings, c) {
+			prefix = "  WARNING "
+		}
+		logLines = append(logLines, prefix+c)
+	}
+	for _, w := range snap.Warnings {
+		log.Println("integrity warning:", w)
+	}
+	return appendLine(integrityLogFile, strings.Join(logLines, "\n"))
+}
+
+// appendLine appends text plus a newline to a file, creating it if needed.
+// os.O_APPEND makes every write go to the end of the file.
+func appendLine(path, text string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// containsString is like containsInt, for strings.
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RunIntegritySnapshots takes a snapshot at startup and then checks every hour whether a new
+// day has started. Checking hourly (instead of sleeping until midnight) means a laptop that was
+// asleep at midnight still gets its snapshot soon after waking up.
+// Run it in its own goroutine: go RunIntegritySnapshots()
+func RunIntegritySnapshots() {
+	for {
+		if err := RecordIntegritySnapshot(time.Now()); err != nil {
+			log.Println("integrity snapshot:", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,386 @@
+// journal.go - The change journal: an append-only log (journal.jsonl, one JSON event per line)
+// of every change saved to data.json. SaveData compares the data it is about to write with what
+// is on disk and appends one event per changed record *before* writing data.json ("write-ahead"),
+// so the journal is never behind the data file. Each event carries the full new version of the
+// record, which makes it possible to:
+//   - rebuild data.json from the journal after corruption (go run . -rebuild-journal out.json)
+//   - later sync two devices by exchanging events (each event names the device it came from).
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// journalFile is where events are appended, next to data.json.
+const journalFile = "journal.jsonl"
+
+// Entities a journal event can be about. "meta" is everything in AppData that isn't one of the
+// record lists (last week review, running timers, ...), stored as a single record.
+const (
+	entityHabit = "habit"
+	entityTodo  = "todo"
+	entityDay   = "day"
+	entityFocus = "focus_session"
+	entityMeta  = "meta"
+)
+
+// JournalEvent is one change. Op says what happened ("create", "edit", "delete", "complete",
+// "uncomplete", "import"); Entity and Key say which record (habit ID, todo ID, date, ...);
+// Record is the record after the change, or empty for "delete".
+type JournalEvent struct {
+	ID     string          `json:"id"`
+	Time   time.Time       `json:"time"`
+	Device string          `json:"device"`
+	Op     string          `json:"op"`
+	Entity string          `json:"entity"`
+	Key    string          `json:"key"`
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// DeviceID names this instance in the journal: DEVICE_ID from .env, or the machine's hostname.
+func DeviceID() string {
+	if id := os.Getenv("DEVICE_ID"); id != "" {
+		return id
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "unknown"
+}
+
+// metaOf returns a copy of data without the record lists - the "meta" record.
+func metaOf(d *AppData) AppData {
+	m := *d
+	m.Habits, m.Todos, m.History, m.FocusSessions = nil, nil, nil, nil
+	m.Revision = 0 // every save bumps it; it's this file's own counter, not part of the data
+	return m
+}
+
+// DiffAppData returns the events that turn old into cur. New records compared with an empty old
+// get the op firstOp ("create" normally, "import" when the journal is started for existing data).
+func DiffAppData(old, cur *AppData, firstOp string) []JournalEvent {
+	var events []JournalEvent
+	add := func(op, entity, key string, record any) {
+		ev := JournalEvent{Op: op, Entity: entity, Key: key}
+		if record != nil {
+			ev.Record, _ = json.Marshal(record)
+		}
+		events = append(events, ev)
+	}
+	same := func(a, b any) bool {
+		ja, _ := json.Marshal(a)
+		jb, _ := json.Marshal(b)
+		return bytes.Equal(ja, jb)
+	}
+
+	oldHabits := make(map[int]Habit)
+	for _, h := range old.Habits {
+		oldHabits[h.ID] = h
+	}
+	for _, h := range cur.Habits {
+		prev, existed := oldHabits[h.ID]
+		delete(oldHabits, h.ID)
+		if !existed {
+			add(firstOp, entityHabit, strconv.Itoa(h.ID), h)
+		} else if !same(prev, h) {
+			add("edit", entityHabit, strconv.Itoa(h.ID), h)
+		}
+	}
+	for _, h := range old.Habits {
+		if _, gone := oldHabits[h.ID]; gone {
+			add("delete", entityHabit, strconv.Itoa(h.ID), nil)
+		}
+	}
+
+	oldTodos := make(map[int]Todo)
+	for _, t := range old.Todos {
+		oldTodos[t.ID] = t
+	}
+	for _, t := range cur.Todos {
+		prev, existed := oldTodos[t.ID]
+		delete(oldTodos, t.ID)
+		if !existed {
+			add(firstOp, entityTodo, strconv.Itoa(t.ID), t)
+		} else if !same(prev, t) {
+			add("edit", entityTodo, strconv.Itoa(t.ID), t)
+		}
+	}
+	for _, t := range old.Todos {
+		if _, gone := oldTodos[t.ID]; gone {
+			add("delete", entityTodo, strconv.Itoa(t.ID), nil)
+		}
+	}
+
+	oldFocus := make(map[int]FocusSession)
+	for _, s := range old.FocusSessions {
+		oldFocus[s.ID] = s
+	}
+	for _, s := range cur.FocusSessions {
+		prev, existed := oldFocus[s.ID]
+		if !existed {
+			add(firstOp, entityFocus, strconv.Itoa(s.ID), s)
+		} else if !same(prev, s) {
+			add("edit", entityFocus, strconv.Itoa(s.ID), s)
+		}
+	}
+
+	// History: sort the dates so events come out in a stable order.
+	var dates []string
+	for date := range cur.History {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		rec := cur.History[date]
+		prev, existed := old.History[date]
+		if existed && same(prev, rec) {
+			continue
+		}
+		op := "edit"
+		switch {
+		case firstOp == "import":
+			op = "import"
+		case len(rec.CompletedHabits) > len(prev.CompletedHabits):
+			op = "complete"
+		case len(rec.CompletedHabits) < len(prev.CompletedHabits):
+			op = "uncomplete"
+		case !existed:
+			op = "create"
+		}
+		add(op, entityDay, date, rec)
+	}
+	for date := range old.History {
+		if _, kept := cur.History[date]; !kept {
+			add("delete", entityDay, date, nil)
+		}
+	}
+
+	if m := metaOf(cur); !same(metaOf(old), m) {
+		op := "edit"
+		if firstOp == "import" {
+			op = "import"
+		}
+		add(op, entityMeta, "", m)
+	}
+	return events
+}
+
+// appendJournal stamps events with time, device and an ID and appends them to the journal.
+// The caller holds mu (it is called from SaveData).
+func appendJournal(events []JournalEvent) error {
+	stampEvents(events)
+	return writeJournalEvents(events)
+}
+
+// stampEvents gives new events the current time, this device and an ID.
+func stampEvents(events []JournalEvent) {
+	now := time.Now()
+	device := DeviceID()
+	for i := range events {
+		events[i].Time = now
+		events[i].Device = device
+		events[i].ID = fmt.Sprintf("%s-%d-%d", device, now.UnixNano(), i)
+	}
+}
+
+// writeJournalEvents appends events to the journal exactly as they are (events received from
+// another device keep their original ID, time and device). The caller holds mu.
+func writeJournalEvents(events []JournalEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for i := range events {
+		line, err := json.Marshal(events[i])
+		if err == nil {
+			line, err = sealData(line) // each line on its own, see encrypt.go
+		}
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	// Arguments of a deferred call are evaluated now; the call itself runs when we return.
+	defer warnIfSlow("append", journalFile, buf.Len(), time.Now())
+	f, err := os.OpenFile(journalFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	// Sync forces the bytes onto the disk before data.json is replaced.
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// journalChanges works out and appends the events for saving cur, compared with prev (what
+// data.json holds now, nil if it can't be read). If there is no journal yet, everything in cur is
+// logged as "import" so the journal alone can rebuild the full state. It returns the events (none
+// if nothing changed). The caller holds mu.
+func journalChanges(prev, cur *AppData) ([]JournalEvent, error) {
+	old := &AppData{History: map[string]DayRecord{}}
+	firstOp := "create"
+	if _, err := os.Stat(journalFile); os.IsNotExist(err) {
+		firstOp = "import"
+	} else if prev != nil {
+		old = prev
+	}
+	events := DiffAppData(old, cur, firstOp)
+	return events, appendJournal(events)
+}
+
+// ApplyJournalEvent applies one event to data (upsert the record, or delete it).
+func ApplyJournalEvent(data *AppData, ev JournalEvent) error {
+	id, _ := strconv.Atoi(ev.Key)
+	del := ev.Op == "delete"
+	switch ev.Entity {
+	case entityHabit:
+		var h Habit
+		if !del {
+			if err := json.Unmarshal(ev.Record, &h); err != nil {
+				return err
+			}
+		}
+		for i := range data.Habits {
+			if data.Habits[i].ID == id {
+				if del {
+					data.Habits = append(data.Habits[:i], data.Habits[i+1:]...)
+				} else {
+					data.Habits[i] = h
+				}
+				return nil
+			}
+		}
+		if !del {
+			data.Habits = append(data.Habits, h)
+		}
+	case entityTodo:
+		var t Todo
+		if !del {
+			if err := json.Unmarshal(ev.Record, &t); err != nil {
+				return err
+			}
+		}
+		for i := range data.Todos {
+			if data.Todos[i].ID == id {
+				if del {
+					data.Todos = append(data.Todos[:i], data.Todos[i+1:]...)
+				} else {
+					data.Todos[i] = t
+				}
+				return nil
+			}
+		}
+		if !del {
+			data.Todos = append(data.Todos, t)
+		}
+	case entityFocus:
+		var s FocusSession
+		if err := json.Unmarshal(ev.Record, &s); err != nil {
+			return err
+		}
+		for i := range data.FocusSessions {
+			if data.FocusSessions[i].ID == id {
+				data.FocusSessions[i] = s
+				return nil
+			}
+		}
+		data.FocusSessions = append(data.FocusSessions, s)
+	case entityDay:
+		if del {
+			delete(data.History, ev.Key)
+			return nil
+		}
+		var rec DayRecord
+		if err := json.Unmarshal(ev.Record, &rec); err != nil {
+			return err
+		}
+		data.History[ev.Key] = rec
+	case entityMeta:
+		var m AppData
+		if err := json.Unmarshal(ev.Record, &m); err != nil {
+			return err
+		}
+		m.Habits, m.Todos, m.History, m.FocusSessions = data.Habits, data.Todos, data.History, data.FocusSessions
+		m.Revision = data.Revision
+		*data = m
+	default:
+		return fmt.Errorf("unknown journal entity %q", ev.Entity)
+	}
+	return nil
+}
+
+// readJournal returns this instance's journal: journal.jsonl, or the journal table on Postgres.
+func readJournal() ([]JournalEvent, error) {
+	if pg != nil {
+		return pgReadJournal()
+	}
+	return ReadJournal(journalFile)
+}
+
+// ReadJournal returns all events in the journal file, oldest first.
+func ReadJournal(path string) ([]JournalEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil {
+		defer warnIfSlow("read", path, int(fi.Size()), time.Now())
+	}
+	var events []JournalEvent
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // records can be long lines
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		line, err := openData(sc.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		var ev JournalEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, sc.Err()
+}
+
+// RebuildFromJournal replays the whole journal and writes the resulting data to outPath.
+// It never touches data.json itself: check the output, then swap it in by hand.
+func RebuildFromJournal(outPath string) error {
+	events, err := readJournal()
+	if err != nil {
+		return err
+	}
+	data := &AppData{Habits: []Habit{}, Todos: []Todo{}, History: map[string]DayRecord{}}
+	for _, ev := range events {
+		if err := ApplyJournalEvent(data, ev); err != nil {
+			return fmt.Errorf("event %s: %w", ev.ID, err)
+		}
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err == nil {
+		out, err = sealData(out) // encrypted like data.json, so it can be swapped in
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, out, 0644)
+}
@@ -0,0 +1,224 @@
+// library.go - Habit templates: ready-made habits with a sensible starting quantity and unit.
+// The /templates page lists a starter library (built into the app, below) and your own
+// templates (saved from existing habits, stored in data.HabitTemplates), and adds the ones
+// you tick as habits in one go - handy when starting out.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HabitTemplate is a habit to start from. Key identifies it in forms: starter templates have
+// fixed keys, your own ones get "my-1", "my-2", ...
+type HabitTemplate struct {
+	Key        string `json:"key"`
+	Category   string `json:"category"`
+	Name       string `json:"name"`
+	Quantity   int    `json:"quantity"`
+	Unit       string `json:"unit"`
+	Motivation string `json:"motivation,omitempty"`
+}
+
+// starterTemplates is the built-in library. Quantities are small on purpose: the week review
+// raises them as the habit sticks.
+var starterTemplates = []HabitTemplate{
+	{Key: "pushups", Category: "Exercise", Name: "Pushups", Quantity: 5, Unit: "pushups"},
+	{Key: "squats", Category: "Exercise", Name: "Squats", Quantity: 10, Unit: "squats"},
+	{Key: "walk", Category: "Exercise", Name: "Walk", Quantity: 15, Unit: "minutes"},
+	{Key: "stretch", Category: "Exercise", Name: "Stretch", Quantity: 5, Unit: "minutes"},
+	{Key: "read", Category: "Reading", Name: "Read", Quantity: 5, Unit: "pages"},
+	{Key: "read-news", Category: "Reading", Name: "Read an article", Quantity: 1, Unit: "articles"},
+	{Key: "water", Category: "Hydration", Name: "Drink water", Quantity: 4, Unit: "glasses"},
+	{Key: "meditate", Category: "Mind", Name: "Meditate", Quantity: 3, Unit: "minutes"},
+	{Key: "journal", Category: "Mind", Name: "Journal", Quantity: 3, Unit: "sentences"},
+	{Key: "language", Category: "Learning", Name: "Language practice", Quantity: 10, Unit: "minutes"},
+}
+
+// TemplateCategory is a group of starter templates on the /templates page.
+type TemplateCategory struct {
+	Name      string
+	Templates []HabitTemplate
+}
+
+// TemplatesPageData is what templates.html gets.
+type TemplatesPageData struct {
+	Settings   Settings
+	Revision   int64 // sent back with the forms (revision.go)
+	Categories []TemplateCategory
+	Mine       []HabitTemplate
+	Habits     []Habit
+	Have       map[string]bool // template key -> you already have a habit with its name
+	Message    string
+}
+
+// templateCategories groups the starter library by category, keeping the order above.
+func templateCategories() []TemplateCategory {
+	var out []TemplateCategory
+	for _, t := range starterTemplates {
+		if n := len(out); n > 0 && out[n-1].Name == t.Category {
+			out[n-1].Templates = append(out[n-1].Templates, t)
+			continue
+		}
+		out = append(out, TemplateCategory{Name: t.Category, Templates: []HabitTemplate{t}})
+	}
+	return out
+}
+
+// FindTemplate returns the starter or own template with the given key, or nil.
+func FindTemplate(data *AppData, key string) *HabitTemplate {
+	for _, list := range [][]HabitTemplate{starterTemplates, data.HabitTemplates} {
+		for i := range list {
+			if list[i].Key == key {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// AddHabitFromTemplate adds a new habit made from t, unless a habit with the same name exists
+// already (so ticking a template twice doesn't double it). Reports whether one was added.
+func AddHabitFromTemplate(data *AppData, t HabitTemplate) bool {
+	if hasHabitNamed(data, t.Name) {
+		return false
+	}
+	h := NewHabit(data, t.Name, t.Quantity, t.Unit)
+	h.Motivation = t.Motivation
+	data.Habits = append(data.Habits, h)
+	return true
+}
+
+// hasHabitNamed reports whether one of the habits is called name (ignoring case).
+func hasHabitNamed(data *AppData, name string) bool {
+	for _, h := range data.Habits {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextTemplateKey returns an unused key for one of your own templates.
+func nextTemplateKey(data *AppData) string {
+	max := 0
+	for _, t := range data.HabitTemplates {
+		if n, err := strconv.Atoi(strings.TrimPrefix(t.Key, "my-")); err == nil && n > max {
+			max = n
+		}
+	}
+	return "my-" + strconv.Itoa(max+1)
+}
+
+// HandleTemplates shows the template library (GET) and adds the ticked templates as habits
+// (POST). Form: template=pushups&template=water&template=my-1
+func HandleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/templates?error=invalid", http.StatusFound)
+			return
+		}
+		added := 0
+		for _, key := range r.Form["template"] {
+			if t := FindTemplate(data, key); t != nil && AddHabitFromTemplate(data, *t) {
+				added++
+			}
+		}
+		if added == 0 {
+			http.Redirect(w, r, "/templates?error=none", http.StatusFound)
+			return
+		}
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, "/?added="+strconv.Itoa(added), http.StatusFound)
+		return
+	}
+
+	pd := TemplatesPageData{
+		Settings:   data.Settings,
+		Revision:   data.Revision,
+		Categories: templateCategories(),
+		Mine:       data.HabitTemplates,
+		Habits:     data.Habits,
+		Have:       make(map[string]bool),
+	}
+	for _, list := range [][]HabitTemplate{starterTemplates, data.HabitTemplates} {
+		for _, t := range list {
+			pd.Have[t.Key] = hasHabitNamed(data, t.Name)
+		}
+	}
+	switch {
+	case r.URL.Query().Get("saved") == "1":
+		pd.Message = "Template saved."
+	case r.URL.Query().Get("deleted") == "1":
+		pd.Message = "Template deleted."
+	case r.URL.Query().Get("error") == "none":
+		pd.Message = "Tick at least one template you don't have as a habit yet."
+	case r.URL.Query().Get("error") == "notfound":
+		pd.Message = "Habit not found."
+	case r.URL.Query().Get("error") == "invalid":
+		pd.Message = "Something was wrong with that form."
+	}
+	if err := tmpl.ExecuteTemplate(w, "templates.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleMyTemplates handles POST to save one of your habits as a template (habit_id=1) or to
+// delete one of your templates (delete=my-2).
+func HandleMyTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	next := "/templates?saved=1"
+	if key := r.FormValue("delete"); key != "" {
+		var kept []HabitTemplate
+		for _, t := range data.HabitTemplates {
+			if t.Key != key {
+				kept = append(kept, t)
+			}
+		}
+		data.HabitTemplates = kept
+		next = "/templates?deleted=1"
+	} else {
+		habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+		h := FindHabitByID(data, habitID)
+		if err != nil || h == nil {
+			http.Redirect(w, r, "/templates?error=notfound", http.StatusFound)
+			return
+		}
+		data.HabitTemplates = append(data.HabitTemplates, HabitTemplate{
+			Key:        nextTemplateKey(data),
+			Category:   "Mine",
+			Name:       h.Name,
+			Quantity:   h.Quantity,
+			Unit:       h.Unit,
+			Motivation: h.Motivation,
+		})
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
@@ -0,0 +1,183 @@
+// limits.go - Keeping a public instance from being flooded or run up a bill. Per client address:
+//   - request bodies are capped: forms and JSON at MAX_BODY_KB (default 64); file uploads
+//     (/import, /import/health, voice notes, photos) have their own, larger caps, and sync may send 16 MB.
+//   - changes (any request that isn't GET or HEAD) are limited to RATE_LIMIT per minute
+//     (default 60); more get 429 Too Many Requests until the address slows down.
+//
+// "Simplify" and the other requests that call OpenAI (openai.go, see aiRequest) cost money every
+// time, so together they have stricter limits of their own: SIMPLIFY_PER_HOUR per address
+// (default 10) and SIMPLIFY_PER_DAY for everyone together (default 100), and tasks longer than
+// maxSimplifyChars aren't sent at all.
+//
+// Behind a reverse proxy every request comes from the proxy's address. Set TRUST_PROXY=true to
+// take the address from the X-Forwarded-For header instead - only then, since anyone can send
+// that header.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a "token bucket" per key: each bucket holds up to burst tokens and refills at
+// rate tokens per second; a request takes one token, and with none left it has to wait.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter allows n requests per period per key, all at once if they come together.
+func newRateLimiter(n int, period time.Duration) *rateLimiter {
+	return &rateLimiter{rate: float64(n) / period.Seconds(), burst: float64(n), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token for key. When there is none, it says how long until the next one.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buckets) > 10000 {
+		// Forget buckets that have refilled completely: they behave like new ones.
+		for k, b := range l.buckets {
+			if now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// envInt returns the .env setting name as a positive number, or def.
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// clientIP returns the address a request came from (see TRUST_PROXY at the top).
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",") // the client; later entries are proxies
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bodyLimit returns the largest body accepted for path, or -1 where the handler sets its own.
+func bodyLimit(path string) int64 {
+	if strings.HasPrefix(path, "/inbound-email/") {
+		return -1 // the mail service's post, attachments included (maxInboundEmail, emailreply.go)
+	}
+	switch path {
+	case "/import", "/import/health", "/voice-todo", "/api/v1/voice-todo", "/habit-photo":
+		return -1
+	case "/api/v1/sync":
+		return 16 << 20
+	}
+	return int64(envInt("MAX_BODY_KB", 64)) << 10
+}
+
+// tooMany answers 429, with Retry-After in whole seconds.
+func tooMany(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	const msg = "Too many requests. Wait a moment and try again."
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": msg})
+		return
+	}
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
+
+// aiPaths are the form posts that may call OpenAI.
+var aiPaths = map[string]bool{
+	"/simplify-todo":     true,
+	"/parse-habit":       true,
+	"/voice-todo":        true,
+	"/api/v1/voice-todo": true,
+	"/triage":            true,
+	"/stats":             true, // writes the weekly insights report (insights.go)
+}
+
+// aiRequest reports whether r may call OpenAI: a post to one of aiPaths, or the week review
+// page asking for suggestions (a GET, so it's not limited as a change).
+func aiRequest(r *http.Request) bool {
+	if r.URL.Path == "/week-review" && r.URL.Query().Get("suggest") == "1" {
+		return true
+	}
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && aiPaths[r.URL.Path]
+}
+
+// LimitRequests wraps the app's handler with the limits described at the top of this file.
+// Call it after loadEnv: the limits are read once, here.
+func LimitRequests(next http.Handler) http.Handler {
+	changes := newRateLimiter(envInt("RATE_LIMIT", 60), time.Minute)
+	simplifyPerIP := newRateLimiter(envInt("SIMPLIFY_PER_HOUR", 10), time.Hour)
+	simplifyAll := newRateLimiter(envInt("SIMPLIFY_PER_DAY", 100), 24*time.Hour)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now, ip := time.Now(), clientIP(r)
+		change := r.Method != http.MethodGet && r.Method != http.MethodHead
+		if change {
+			if ok, wait := changes.allow(ip, now); !ok {
+				tooMany(w, r, wait)
+				return
+			}
+		}
+		if aiRequest(r) {
+			if ok, wait := simplifyPerIP.allow(ip, now); !ok {
+				tooMany(w, r, wait)
+				return
+			}
+			if ok, wait := simplifyAll.allow("", now); !ok {
+				tooMany(w, r, wait)
+				return
+			}
+		}
+		if !change {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// MaxBytesReader makes reading past the limit fail, so FormValue and json decoding
+		// stop there instead of filling the memory.
+		if limit := bodyLimit(r.URL.Path); limit >= 0 && r.Body != nil {
+			if r.ContentLength > limit {
+				http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
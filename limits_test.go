@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// hitLimited sends n requests through a fresh LimitRequests and returns their status codes.
+func hitLimited(t *testing.T, method, target string, n int) []int {
+	t.Helper()
+	h := LimitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	var codes []int
+	for i := 0; i < n; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		codes = append(codes, rec.Code)
+	}
+	return codes
+}
+
+// TestAILimitCoversReviewSuggestionsAndInsights checks that asking the week review for
+// suggestions (a GET) and writing the insights report (POST /stats) count against the OpenAI
+// limit, while the plain week review page doesn't.
+func TestAILimitCoversReviewSuggestionsAndInsights(t *testing.T) {
+	t.Setenv("SIMPLIFY_PER_HOUR", "2")
+	t.Setenv("RATE_LIMIT", "1000")
+	for _, c := range []struct{ method, target string }{
+		{http.MethodGet, "/week-review?suggest=1"},
+		{http.MethodPost, "/stats"},
+	} {
+		codes := hitLimited(t, c.method, c.target, 3)
+		if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+			t.Errorf("%s %s: got %v, want [200 200 429]", c.method, c.target, codes)
+		}
+	}
+	for i, code := range hitLimited(t, http.MethodGet, "/week-review", 5) {
+		if code != http.StatusOK {
+			t.Errorf("GET /week-review #%d: got %d, want 200 (no suggestions, no limit)", i+1, code)
+		}
+	}
+}
+
+// TestInboundEmailBodyNotCapped posts a 100 KB email, over the 64 KB default: the inbound email
+// webhook sets its own limit, so it must get all of it, while a form post gets cut off.
+func TestInboundEmailBodyNotCapped(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "1000")
+	body := strings.Repeat("x", 100<<10)
+	h := LimitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}))
+	for target, want := range map[string]int{
+		"/inbound-email/abc123": http.StatusOK,
+		"/add-todo":             http.StatusRequestEntityTooLarge,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("POST %s with 100 KB: got %d, want %d", target, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// live.go - Open pages update themselves. Checking a habit on the phone changes the main page that
+// is open on the desktop at once, without a refresh: the page keeps a WebSocket open to /ws, and
+// after every save the server sends it what changed (the journal events of the save, journal.go,
+// without their records) and the new revision:
+//
+//	{"type":"change","revision":13,"changes":[{"entity":"day","op":"edit","key":"2025-10-15"}]}
+//
+// The page then loads itself again (layout.html). A message is also sent when data.json was
+// changed by another program, and right after connecting, so a tab that was asleep catches up.
+// With Postgres (postgres.go), only saves made by this instance are sent. Reminders for open
+// pages go the same way, and where WebSockets are blocked the same messages come as server-sent
+// events from /events instead (events.go).
+//
+// The server side of the WebSocket uses the frames from websocket.go; the server's frames are
+// not masked.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// livePingInterval is how often an idle connection is pinged, so proxies don't close it.
+const livePingInterval = 30 * time.Second
+
+// LiveEvent is a message sent to open pages: a "change", or one of the reminders from events.go
+// ("habit_due", "week_review").
+type LiveEvent struct {
+	Type     string       `json:"type"`
+	Revision int64        `json:"revision,omitempty"`
+	Changes  []LiveChange `json:"changes,omitempty"` // none in the message sent on connecting
+
+	HabitID int    `json:"habit_id,omitempty"` // habit_due: the habit, its name and reminder time
+	Name    string `json:"name,omitempty"`
+	Time    string `json:"time,omitempty"`
+	Days    int    `json:"days,omitempty"` // week_review: days since the last review
+}
+
+// LiveChange is one changed record: a journal event without the record.
+type LiveChange struct {
+	Entity string `json:"entity,omitempty"` // "habit", "todo", "day", ...; "" for "reload"
+	Op     string `json:"op"`               // as in JournalEvent, or "reload" for data.json read again
+	Key    string `json:"key,omitempty"`
+}
+
+// liveClients are the open connections, each with the channel its messages go to.
+var liveClients = struct {
+	sync.Mutex
+	chans map[chan []byte]bool
+}{chans: make(map[chan []byte]bool)}
+
+// subscribeLive returns a channel that gets every message sent from now on.
+func subscribeLive() chan []byte {
+	ch := make(chan []byte, 16)
+	liveClients.Lock()
+	liveClients.chans[ch] = true
+	liveClients.Unlock()
+	return ch
+}
+
+func unsubscribeLive(ch chan []byte) {
+	liveClients.Lock()
+	delete(liveClients.chans, ch)
+	liveClients.Unlock()
+}
+
+// broadcastLive sends ev to every open page. It doesn't wait: a connection that is too far
+// behind misses the message, which is fine since any message makes the page load itself again.
+func broadcastLive(ev LiveEvent) {
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	liveClients.Lock()
+	defer liveClients.Unlock()
+	for ch := range liveClients.chans {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// broadcastChanges tells open pages about a save: its journal events and the new revision.
+func broadcastChanges(events []JournalEvent, rev int64) {
+	changes := make([]LiveChange, len(events))
+	for i, ev := range events {
+		changes[i] = LiveChange{Entity: ev.Entity, Op: ev.Op, Key: ev.Key}
+	}
+	broadcastLive(LiveEvent{Type: "change", Revision: rev, Changes: changes})
+}
+
+// sameOrigin reports whether a WebSocket request comes from one of our own pages. Browsers send
+// the page's Origin with it, and don't stop other sites from opening WebSockets to us.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // not a browser
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// HandleLive upgrades GET /ws to a WebSocket and sends it a LiveEvent after each save, until
+// the page is closed. What the page sends is only read for pings and the close.
+func HandleLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "Expected a WebSocket request", http.StatusBadRequest)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	greeting, err := liveGreeting(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Hijack takes the TCP connection over from the HTTP server.
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Time{}) // the server's timeouts are for requests, not this connection
+	if _, err := conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")); err != nil {
+		return
+	}
+	c := &wsConn{conn: conn, br: brw.Reader}
+
+	messages := subscribeLive()
+	defer unsubscribeLive(messages)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, msg := range greeting {
+		if err := c.WriteMessage(wsText, msg); err != nil {
+			return
+		}
+	}
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case msg := <-messages:
+			err = c.WriteMessage(wsText, msg)
+		case <-ping.C:
+			err = c.WriteMessage(wsPing, nil)
+		case <-closed:
+			return
+		}
+		if err != nil {
+			return // the page was closed
+		}
+	}
+}
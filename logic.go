@@ -5,6 +5,7 @@ package main
 
 import (
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -58,6 +59,37 @@ func ApplyMissPenalty(h *Habit) {
 	}
 }
 
+// recordMissPenalty applies the miss penalty to h and records it in rec, including by how much
+// the target went down (so a skip token or a late completion can undo it, see refundMissPenalty).
+func recordMissPenalty(rec *DayRecord, h *Habit) {
+	before := h.Quantity
+	ApplyMissPenalty(h)
+	rec.PenaltyAppliedForHabits = append(rec.PenaltyAppliedForHabits, h.ID)
+	if before != h.Quantity {
+		if rec.PenaltyAmounts == nil {
+			rec.PenaltyAmounts = make(map[int]int)
+		}
+		rec.PenaltyAmounts[h.ID] = before - h.Quantity
+	}
+}
+
+// refundMissPenalty takes back the miss penalty recorded in rec for h, if there is one: a day
+// that turns out not to be missed (done late, or excused with a skip token) costs nothing.
+func refundMissPenalty(rec *DayRecord, h *Habit) {
+	if !containsInt(rec.PenaltyAppliedForHabits, h.ID) {
+		return
+	}
+	h.Quantity = h.capQuantity(h.Quantity + rec.PenaltyAmounts[h.ID])
+	delete(rec.PenaltyAmounts, h.ID)
+	var kept []int
+	for _, id := range rec.PenaltyAppliedForHabits {
+		if id != h.ID {
+			kept = append(kept, id)
+		}
+	}
+	rec.PenaltyAppliedForHabits = kept
+}
+
 // containsInt is a helper to check if a slice contains an integer (Go has no built-in for this).
 func containsInt(slice []int, id int) bool {
 	for _, v := range slice {
@@ -68,35 +100,132 @@ func containsInt(slice []int, id int) bool {
 	return false
 }
 
-// ProcessYesterdayMisses runs when you load the app: for yesterday only, for each habit
-// that was NOT completed, we apply the miss penalty once and record it (so we don't apply again).
-// So: one missed day = one reduction per habit. If you don't open the app for several days,
-// we only penalize for "yesterday" (the day before today) each time you open the app.
-func ProcessYesterdayMisses(data *AppData) {
+// ProcessMissesSince runs when you load the app: it walks every finished day after
+// lastProcessed (up to and including yesterday) and, for each habit that was NOT completed
+// that day, applies the miss penalty once and records it (so we never apply it again).
+// So: one missed day = one reduction per habit, even if you didn't open the app for a week.
+// Every walked day gets a DayRecord, and data.LastProcessedDate is set to yesterday.
+// Days before a habit was created, its first days (the grace period from settings) and days it
+// was paused don't count as misses for that habit; habits exempt from penalties are never shrunk.
+// If lastProcessed is empty (data from before we tracked it), only yesterday is processed.
+func ProcessMissesSince(data *AppData, lastProcessed string) {
 	yesterday := Yesterday()
-	rec, exists := data.History[yesterday]
-	if !exists {
-		rec = DayRecord{Date: yesterday}
+	start := yesterday
+	if lastProcessed != "" {
+		t, err := ParseDate(lastProcessed)
+		if err != nil {
+			return
+		}
+		start = t.AddDate(0, 0, 1).Format(dateLayout)
 	}
-	// Ensure we have a slice to track penalty-applied (might be nil from old JSON).
-	if rec.PenaltyAppliedForHabits == nil {
-		rec.PenaltyAppliedForHabits = []int{}
+	days, err := DatesInRange(start, yesterday) // empty when start is after yesterday
+	if err != nil {
+		return
 	}
 
-	changed := false
-	for i := range data.Habits {
-		h := &data.Habits[i]
-		completed := containsInt(rec.CompletedHabits, h.ID)
-		alreadyApplied := containsInt(rec.PenaltyAppliedForHabits, h.ID)
-		if !completed && !alreadyApplied {
-			ApplyMissPenalty(h)
-			rec.PenaltyAppliedForHabits = append(rec.PenaltyAppliedForHabits, h.ID)
-			changed = true
+	for _, day := range days {
+		rec, exists := data.History[day]
+		if !exists {
+			rec = DayRecord{Date: day}
+		}
+		// Ensure we have a slice to track penalty-applied (might be nil from old JSON).
+		if rec.PenaltyAppliedForHabits == nil {
+			rec.PenaltyAppliedForHabits = []int{}
+		}
+		for i := range data.Habits {
+			h := &data.Habits[i]
+			if !h.ExistedOn(day) {
+				continue // habit didn't exist yet
+			}
+			if InGracePeriod(*h, day, data.Settings.GraceDays()) {
+				continue // too new to be penalized
+			}
+			if h.PausedOn(day) {
+				continue // paused (pause.go)
+			}
+			if h.PenaltyExempt {
+				continue // opted out of miss penalties
+			}
+			completed := containsInt(rec.CompletedHabits, h.ID)
+			skipped := containsInt(rec.SkippedHabits, h.ID) // excused with a skip token (skip.go)
+			alreadyApplied := containsInt(rec.PenaltyAppliedForHabits, h.ID)
+			if !completed && !skipped && !alreadyApplied {
+				recordMissPenalty(&rec, h)
+			}
+		}
+		data.History[day] = rec
+	}
+	if lastProcessed < yesterday {
+		data.LastProcessedDate = yesterday
+	}
+}
+
+// SetHabitCompleted marks a habit as completed (done=true) or not completed on a given day.
+// It also gives (or takes back) the XP for it, see gamify.go. Completing a day that was already
+// penalised as missed (a late completion from the offline queue, the API or an import) gives the
+// penalty back.
+func SetHabitCompleted(data *AppData, habitID int, date string, done bool) {
+	rec := data.History[date]
+	rec.Date = date
+	if rec.CompletedHabits == nil {
+		rec.CompletedHabits = []int{}
+	}
+	if done {
+		// Add to completed if not already there.
+		if !containsInt(rec.CompletedHabits, habitID) {
+			awardCompletion(data, habitID, date)
+			rec.CompletedHabits = append(rec.CompletedHabits, habitID)
+			if h := FindHabitByID(data, habitID); h != nil {
+				refundMissPenalty(&rec, h)
+			}
+		}
+	} else {
+		// Remove habit from completed list.
+		var newList []int
+		for _, id := range rec.CompletedHabits {
+			if id != habitID {
+				newList = append(newList, id)
+			}
 		}
+		if len(newList) < len(rec.CompletedHabits) {
+			revokeCompletion(data, habitID, date)
+		}
+		delete(rec.CompletionSources, habitID)
+		rec.CompletedHabits = newList
+	}
+	data.History[date] = rec
+	// The best streak can grow with a completion, or shrink when one is undone.
+	if h := FindHabitByID(data, habitID); h != nil {
+		h.LongestStreak = longestStreak(data, *h)
 	}
-	if changed {
-		data.History[yesterday] = rec
+}
+
+// habitMissedOn reports whether h was missed on day: not done, not skipped, and the habit
+// already existed, was past its grace period and wasn't paused then.
+func habitMissedOn(data *AppData, h *Habit, day string) bool {
+	if !h.ExistedOn(day) || InGracePeriod(*h, day, data.Settings.GraceDays()) || h.PausedOn(day) {
+		return false
 	}
+	rec := data.History[day]
+	return !containsInt(rec.CompletedHabits, h.ID) && !containsInt(rec.SkippedHabits, h.ID)
+}
+
+// ExistedOn reports whether h had been created by day. A habit without a creation time (from
+// before it was recorded, and no history to guess it from) counts as always there, for the
+// miss penalties as for everything shown about misses.
+func (h Habit) ExistedOn(day string) bool {
+	return h.CreatedAt.IsZero() || h.CreatedAt.Format(dateLayout) <= day
+}
+
+// InGracePeriod reports whether day is within the first graceDays days of the habit (the day it
+// was created counts as the first). Habits without a creation time have no grace period.
+func InGracePeriod(h Habit, day string, graceDays int) bool {
+	if h.CreatedAt.IsZero() || graceDays <= 0 {
+		return false
+	}
+	created := h.CreatedAt.Format(dateLayout)
+	end := h.CreatedAt.AddDate(0, 0, graceDays).Format(dateLayout)
+	return day >= created && day < end
 }
 
 // GetOrSetLastWeekReview returns the date we use for "last 7-day review".
@@ -111,28 +240,128 @@ func GetOrSetLastWeekReview(data *AppData) string {
 	return t.Format(dateLayout)
 }
 
-// NeedsWeekReview returns true if 7 or more days have passed since the last week review.
+// ValidReviewCadence reports whether c is a review cadence we know ("" means every 7 days).
+func ValidReviewCadence(c string) bool {
+	return c == "" || c == "weekly" || c == "biweekly" || c == "monthly"
+}
+
+// NextReviewDate returns the day the next week review is due, going by the settings:
+//   - "" (default): 7 days after the last review.
+//   - "weekly": the first ReviewWeekday after the last review, so a late review doesn't move
+//     the next one.
+//   - "biweekly": the first ReviewWeekday at least 8 days after the last review.
+//   - "monthly": the first ReviewWeekday of the month, the first one after the last review.
+func NextReviewDate(data *AppData) (string, error) {
+	last, err := ParseDate(GetOrSetLastWeekReview(data))
+	if err != nil {
+		return "", err
+	}
+	weekday := time.Weekday(data.Settings.ReviewWeekday)
+	// onWeekday returns the first day from t on that falls on the review weekday.
+	onWeekday := func(t time.Time) time.Time {
+		return t.AddDate(0, 0, (int(weekday)-int(t.Weekday())+7)%7)
+	}
+	var next time.Time
+	switch data.Settings.ReviewCadence {
+	case "weekly":
+		next = onWeekday(last.AddDate(0, 0, 1))
+	case "biweekly":
+		next = onWeekday(last.AddDate(0, 0, 8))
+	case "monthly":
+		month := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if next = onWeekday(month); !next.After(last) {
+			next = onWeekday(month.AddDate(0, 1, 0))
+		}
+	default:
+		next = last.AddDate(0, 0, 7)
+	}
+	return next.Format(dateLayout), nil
+}
+
+// NeedsWeekReview returns true once the next review is due (by default, 7 or more days after
+// the last one; see NextReviewDate).
 func NeedsWeekReview(data *AppData) (bool, error) {
-	last := GetOrSetLastWeekReview(data)
-	days, err := DaysBetween(last, Today())
+	next, err := NextReviewDate(data)
 	if err != nil {
 		return false, err
 	}
-	return days >= 7, nil
+	return Today() >= next, nil
+}
+
+// CycleSummary is what happened to one habit since the last week review, shown on the review
+// form so the increment is chosen knowing how the week went.
+type CycleSummary struct {
+	Days          int // finished days in the cycle that counted for this habit
+	Misses        int // of those, days it wasn't completed
+	Penalties     int // days a miss penalty was applied
+	StartQuantity int // quantity at the start of the cycle (0 = unknown)
+}
+
+// ReviewSummaries returns a CycleSummary per habit ID for the days from the last week review up
+// to yesterday. Days before a habit existed, its grace period and paused days are left out, as
+// in ProcessMissesSince.
+func ReviewSummaries(data *AppData) map[int]CycleSummary {
+	return SummariesBetween(data, GetOrSetLastWeekReview(data), Yesterday())
 }
 
-// CompleteWeekReview increments each habit by the user-chosen amount and sets LastWeekReview to today.
-// increments maps habit ID -> amount to add (can be 0).
-func CompleteWeekReview(data *AppData, increments map[int]int) {
+// SummariesBetween is ReviewSummaries for the days from start to end (inclusive); the monthly
+// and quarterly reviews (tierreview.go) use it for their longer periods.
+func SummariesBetween(data *AppData, start, end string) map[int]CycleSummary {
+	out := make(map[int]CycleSummary)
+	days, err := DatesInRange(start, end)
+	if err != nil {
+		return out
+	}
+	for _, h := range data.Habits {
+		s := CycleSummary{StartQuantity: h.CycleStartQuantity}
+		for _, day := range days {
+			rec := data.History[day]
+			if containsInt(rec.PenaltyAppliedForHabits, h.ID) {
+				s.Penalties++
+			}
+			if !h.ExistedOn(day) || InGracePeriod(h, day, data.Settings.GraceDays()) || containsInt(rec.SkippedHabits, h.ID) || h.PausedOn(day) {
+				continue
+			}
+			s.Days++
+			if !containsInt(rec.CompletedHabits, h.ID) {
+				s.Misses++
+			}
+		}
+		out[h.ID] = s
+	}
+	return out
+}
+
+// CompleteWeekReview changes each habit by the user-chosen amount and sets LastWeekReview to today.
+// changes maps habit ID -> amount to add (0 keeps the target, negative lowers it). The result
+// stays between 1 and the habit's MaxQuantity. Habits paused today keep their target.
+// The decisions and the reflection are kept in today's record as its WeekReview.
+func CompleteWeekReview(data *AppData, changes map[int]int, reflection string) {
+	review := &WeekReview{Decisions: []ReviewDecision{}, Reflection: strings.TrimSpace(reflection)}
 	for i := range data.Habits {
-		id := data.Habits[i].ID
-		add := increments[id]
-		if add < 0 {
-			add = 0
+		h := &data.Habits[i]
+		if h.PausedOn(Today()) {
+			continue
+		}
+		d := ReviewDecision{HabitID: h.ID, Name: h.Name, Unit: h.Unit, Action: "keep", From: h.Quantity}
+		switch {
+		case changes[h.ID] > 0:
+			d.Action = "increase"
+		case changes[h.ID] < 0:
+			d.Action = "decrease"
 		}
-		data.Habits[i].Quantity += add
+		h.Quantity = h.capQuantity(h.Quantity + changes[h.ID])
+		h.CycleStartQuantity = h.Quantity
+		d.To = h.Quantity
+		review.Decisions = append(review.Decisions, d)
 	}
+	rec := data.History[Today()]
+	rec.Date = Today()
+	rec.WeekReviewDone = true
+	rec.WeekReview = review
+	data.History[Today()] = rec
 	data.LastWeekReview = Today()
+	unlockBadge(data, "first-review", Today())
 }
 
 // FindHabitByID returns a pointer to the habit with the given ID, or nil.
@@ -153,9 +382,27 @@ func NextHabitID(data *AppData) int {
 			max = h.ID
 		}
 	}
+	for _, t := range data.Trash { // a restored habit gets its ID back (trash.go)
+		if t.Habit != nil && t.Habit.ID > max {
+			max = t.Habit.ID
+		}
+	}
 	return max + 1
 }
 
+// NewHabit returns a new habit with the next free ID, created now. The caller appends it to
+// data.Habits.
+func NewHabit(data *AppData, name string, qty int, unit string) Habit {
+	return Habit{
+		ID:                 NextHabitID(data),
+		Name:               name,
+		Quantity:           qty,
+		Unit:               unit,
+		CreatedAt:          time.Now(),
+		CycleStartQuantity: qty,
+	}
+}
+
 // NextTodoID returns the next unused todo ID (max existing + 1).
 func NextTodoID(data *AppData) int {
 	max := 0
@@ -164,6 +411,11 @@ func NextTodoID(data *AppData) int {
 			max = t.ID
 		}
 	}
+	for _, t := range data.Trash {
+		if t.Todo != nil && t.Todo.ID > max {
+			max = t.Todo.ID
+		}
+	}
 	return max + 1
 }
 
@@ -186,22 +438,162 @@ func DatesInRange(start, end string) ([]string, error) {
 }
 
 // GetStreakForHabit returns the current streak (consecutive days completed) for a habit.
-// We count backwards from yesterday (today doesn't count until the day is over).
+// We count backwards from today if it's done already, else from yesterday (today isn't missed
+// until the day is over).
+// Days excused with a skip token (skip.go) or paused (pause.go) don't break the streak, but
+// don't add to it either.
 func GetStreakForHabit(data *AppData, habitID int) int {
+	if today := Today(); containsInt(data.History[today].CompletedHabits, habitID) {
+		return streakEndingOn(data, habitID, today)
+	}
+	return streakEndingOn(data, habitID, Yesterday())
+}
+
+// streakEndingOn is the streak counted backwards from day (inclusive).
+func streakEndingOn(data *AppData, habitID int, day string) int {
 	streak := 0
-	t := time.Now().AddDate(0, 0, -1) // yesterday
+	t, err := ParseDate(day)
+	if err != nil {
+		return 0
+	}
+	var h Habit // a deleted habit has no pause
+	if p := FindHabitByID(data, habitID); p != nil {
+		h = *p
+	}
 	for {
 		key := t.Format(dateLayout)
 		rec, exists := data.History[key]
-		completed := false
+		completed, skipped := false, h.PausedOn(key)
 		if exists {
 			completed = containsInt(rec.CompletedHabits, habitID)
+			skipped = skipped || containsInt(rec.SkippedHabits, habitID)
 		}
-		if !completed {
+		if !completed && !skipped {
 			break
 		}
-		streak++
+		if completed {
+			streak++
+		}
 		t = t.AddDate(0, 0, -1)
 	}
 	return streak
 }
+
+// longestStreak returns the longest streak h ever had, counted like streakEndingOn, from the
+// first day it was done up to today.
+func longestStreak(data *AppData, h Habit) int {
+	first := firstHistoryDay(data, func(rec DayRecord) bool { return containsInt(rec.CompletedHabits, h.ID) })
+	t, err := ParseDate(first)
+	if err != nil {
+		return 0 // never done
+	}
+	today := Today()
+	best, run := 0, 0
+	for day := first; day <= today; day = t.Format(dateLayout) {
+		rec := data.History[day]
+		switch {
+		case containsInt(rec.CompletedHabits, h.ID):
+			run++
+			best = max(best, run)
+		case h.PausedOn(day) || containsInt(rec.SkippedHabits, h.ID):
+			// neither breaks nor adds
+		default:
+			run = 0
+		}
+		t = t.AddDate(0, 0, 1)
+	}
+	return best
+}
+
+// refreshLongestStreaks stores each habit's best streak (Habit.LongestStreak) after its history
+// changed in bulk: an import, a merge, a migration.
+func refreshLongestStreaks(data *AppData) {
+	for i := range data.Habits {
+		data.Habits[i].LongestStreak = longestStreak(data, data.Habits[i])
+	}
+}
+
+// priorityRank turns a todo priority into a number so we can sort by it (higher = more important).
+func priorityRank(p string) int {
+	switch p {
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
+
+// ValidPriority reports whether p is one of the priorities we accept ("" means none).
+func ValidPriority(p string) bool {
+	return p == "" || priorityRank(p) > 0
+}
+
+// IsOverdue returns true if the todo has a due date that is before today.
+// Dates are YYYY-MM-DD strings, so comparing them as strings gives the same order as comparing dates.
+func IsOverdue(t Todo, today string) bool {
+	return t.DueDate != "" && t.DueDate < today
+}
+
+// TodosDueOn returns the todos whose due date is exactly the given day.
+func TodosDueOn(todos []Todo, day string) []Todo {
+	var out []Todo
+	for _, t := range todos {
+		if t.DueDate == day {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// FilterTodos keeps only the todos matching the given priority and due filters.
+// priority is "high", "medium", "low", "none" or "" (no filter).
+// due is "today", "overdue", "none" or "" (no filter).
+func FilterTodos(todos []Todo, priority, due, today string) []Todo {
+	var out []Todo
+	for _, t := range todos {
+		if priority == "none" && t.Priority != "" || priority != "" && priority != "none" && t.Priority != priority {
+			continue
+		}
+		switch due {
+		case "today":
+			if t.DueDate != today {
+				continue
+			}
+		case "overdue":
+			if !IsOverdue(t, today) {
+				continue
+			}
+		case "none":
+			if t.DueDate != "" {
+				continue
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// SortTodos returns a sorted copy of todos. by is "priority" (high first) or "due" (earliest first,
+// todos without a due date last). Any other value keeps the stored order.
+// sort.SliceStable keeps equal items in their original order, so ties stay predictable.
+func SortTodos(todos []Todo, by string) []Todo {
+	out := append([]Todo{}, todos...)
+	switch by {
+	case "priority":
+		sort.SliceStable(out, func(i, j int) bool {
+			return priorityRank(out[i].Priority) > priorityRank(out[j].Priority)
+		})
+	case "due":
+		sort.SliceStable(out, func(i, j int) bool {
+			a, b := out[i].DueDate, out[j].DueDate
+			if a == "" || b == "" {
+				return a != "" && b == ""
+			}
+			return a < b
+		})
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLateCompletionRefundsPenalty completes yesterday after the miss penalty was applied for it
+// (as when the offline queue is sent after the page loaded): the target goes back up, once.
+func TestLateCompletionRefundsPenalty(t *testing.T) {
+	yesterday := Yesterday()
+	data := &AppData{
+		Habits:  []Habit{{ID: 1, Name: "Pushups", Quantity: 10, Unit: "pushups", CreatedAt: time.Now().AddDate(0, 0, -30)}},
+		History: map[string]DayRecord{},
+	}
+	before, _ := ParseDate(yesterday)
+	ProcessMissesSince(data, before.AddDate(0, 0, -1).Format(dateLayout))
+	if got := data.Habits[0].Quantity; got != 8 {
+		t.Fatalf("after the miss: quantity %d, want 8", got)
+	}
+
+	SetHabitCompleted(data, 1, yesterday, true)
+	if got := data.Habits[0].Quantity; got != 10 {
+		t.Errorf("after completing it late: quantity %d, want 10", got)
+	}
+	rec := data.History[yesterday]
+	if containsInt(rec.PenaltyAppliedForHabits, 1) || rec.PenaltyAmounts[1] != 0 {
+		t.Errorf("penalty still recorded: %+v", rec)
+	}
+
+	SetHabitCompleted(data, 1, yesterday, false)
+	SetHabitCompleted(data, 1, yesterday, true)
+	if got := data.Habits[0].Quantity; got != 10 {
+		t.Errorf("undone and done again: quantity %d, want 10 (refunded once)", got)
+	}
+}
+
+// TestMissesAgreeWithoutCreatedAt checks that a habit without a creation time is missed (for the
+// heatmap and stats) exactly on the days it was penalised.
+func TestMissesAgreeWithoutCreatedAt(t *testing.T) {
+	yesterday := Yesterday()
+	data := &AppData{
+		Habits:  []Habit{{ID: 1, Name: "Read", Quantity: 10, Unit: "pages"}},
+		History: map[string]DayRecord{},
+	}
+	before, _ := ParseDate(yesterday)
+	ProcessMissesSince(data, before.AddDate(0, 0, -1).Format(dateLayout))
+	penalised := containsInt(data.History[yesterday].PenaltyAppliedForHabits, 1)
+	if missed := habitMissedOn(data, &data.Habits[0], yesterday); missed != penalised {
+		t.Errorf("habitMissedOn = %v, but penalised = %v", missed, penalised)
+	}
+}
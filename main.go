@@ -5,10 +5,16 @@ package main
 
 import (
 	"bufio"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // loadEnv reads .env from the current directory and sets KEY=VALUE as environment variables.
@@ -42,6 +48,104 @@ func loadEnv() {
 
 func main() {
 	loadEnv()
+
+	// Command-line flags. flag.Int defines "-archive 2025"; after flag.Parse() the pointer holds the value.
+	archiveYear := flag.Int("archive", 0, "write a static HTML archive of this year and exit")
+	archiveOut := flag.String("out", "", "output for -archive (directory, default archive-YEAR) or -restore (file, default restored.json)")
+	archiveShareable := flag.Bool("shareable", false, "with -archive: leave out private habits")
+	rebuildOut := flag.String("rebuild-journal", "", "rebuild the data from journal.jsonl into this file and exit")
+	backupDir := flag.String("backup", "", "write a differential backup into this directory and exit")
+	backupFull := flag.Bool("full", false, "with -backup: write a full base copy instead of a diff")
+	restoreDir := flag.String("restore", "", "restore the backup in this directory into -out and exit")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	seedCount := flag.Int("seed", 0, "dev builds: replace the data with this many generated habits and their history, and exit")
+	seedMonths := flag.Int("months", 6, "with -seed: months of history to generate")
+	remote := flag.String("remote", "", "run the command (done, undo, status) against the server at this URL instead of data.json")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(GetBuildInfo())
+		return
+	}
+	// With DATABASE_URL set, the data lives in Postgres instead of data.json (postgres.go).
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		if err := OpenPostgres(url); err != nil {
+			log.Fatal("postgres: ", err)
+		}
+	}
+	// "done pushups", "status", ... run one command in the terminal instead of the server (cli.go).
+	if IsCLICommand(flag.Args()) {
+		ApplySavedTimezone()
+		code := RunCLI(flag.Args(), *remote, os.Stdin, os.Stdout)
+		if err := FlushData(); err != nil { // changes wait in memory for a moment (store.go)
+			log.Println("writing data.json:", err)
+			code = 1
+		}
+		os.Exit(code)
+	}
+	// Fail fast at startup if the templates are broken (including ones from ASSETS_DIR).
+	if err := loadTemplates(); err != nil {
+		log.Fatal("templates: ", err)
+	}
+	if *rebuildOut != "" {
+		if err := RebuildFromJournal(*rebuildOut); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("data rebuilt from journal into", *rebuildOut)
+		return
+	}
+	if *seedCount > 0 {
+		if !devBuild {
+			log.Fatal("-seed is only in dev builds: go run -tags dev . -seed 20")
+		}
+		ApplySavedTimezone()
+		fresh := SeedData(*seedCount, *seedMonths, 1, time.Now())
+		err := replaceWithSeed(fresh)
+		if err == nil {
+			err = FlushData()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("generated %d habits, %d todos and %d days of history\n", len(fresh.Habits), len(fresh.Todos), len(fresh.History))
+		return
+	}
+	if *backupDir != "" {
+		name, err := WriteBackup(*backupDir, *backupFull)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if name == "" {
+			fmt.Println("no changes since the last backup")
+		} else {
+			fmt.Println("backup written to", filepath.Join(*backupDir, name))
+		}
+		return
+	}
+	if *restoreDir != "" {
+		out := *archiveOut
+		if out == "" {
+			out = "restored.json"
+		}
+		if err := RestoreBackup(*restoreDir, out); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("backup restored into", out)
+		return
+	}
+	if *archiveYear != 0 {
+		dir := *archiveOut
+		if dir == "" {
+			dir = fmt.Sprintf("archive-%d", *archiveYear)
+		}
+		if err := WriteStaticArchive(*archiveYear, dir, *archiveShareable); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("archive written to", dir)
+		return
+	}
+	// Days start at midnight in the time zone chosen in setup/settings (see setup.go).
+	ApplySavedTimezone()
+
 	// Register HTTP handlers: which function handles which URL path.
 	// http.HandleFunc takes a pattern and a function. When a request matches the pattern,
 	// Go calls your function with (http.ResponseWriter, *http.Request).
@@ -49,18 +153,171 @@ func main() {
 	http.HandleFunc("/", HandleIndex)
 	http.HandleFunc("/complete", HandleCompleteHabit)
 	http.HandleFunc("/week-review", HandleWeekReview)
+	http.HandleFunc("/reviews", HandleReviewHistory)
+	http.HandleFunc("/month-review", HandleMonthReview)
+	http.HandleFunc("/quarter-review", HandleQuarterReview)
+	http.HandleFunc("/simulate", HandleSimulate)
+	http.HandleFunc("/stats", HandleStats)
+	http.HandleFunc("/review", HandleReviewLink)
 	http.HandleFunc("/add-habit", HandleAddHabit)
+	http.HandleFunc("/parse-habit", HandleParseHabit)
 	http.HandleFunc("/edit-habit", HandleEditHabit)
 	http.HandleFunc("/delete-habit", HandleDeleteHabit)
 	http.HandleFunc("/add-todo", HandleAddTodo)
+	http.HandleFunc("/voice-todo", HandleVoiceTodo)
+	http.HandleFunc("/triage", HandleTriage)
+	http.HandleFunc("/triage/accept", HandleTriageAccept)
 	http.HandleFunc("/complete-todo", HandleCompleteTodo)
+	http.HandleFunc("/delete-todo", HandleDeleteTodo)
+	http.HandleFunc("/trash", HandleTrash)
+	http.HandleFunc("/trash/restore", HandleTrashRestore)
+	http.HandleFunc("/trash/delete", HandleTrashPurge)
+	http.HandleFunc("/backups", HandleBackups)
+	http.HandleFunc("/backups/download", HandleBackupDownload)
+	http.HandleFunc("/backups/now", HandleBackupNow)
+	http.HandleFunc("/backups/restore", HandleBackupRestore)
 	http.HandleFunc("/simplify-todo", HandleSimplifyTodo)
+	http.HandleFunc("/merge-conflicts", HandleMergeConflicts)
+	http.HandleFunc("/focus", HandleFocus)
+	http.HandleFunc("/focus/start", HandleStartFocus)
+	http.HandleFunc("/focus/stop", HandleStopFocus)
+	http.HandleFunc("/timer/start", HandleStartTimer)
+	http.HandleFunc("/timer/stop", HandleStopTimer)
+	http.HandleFunc("/habit-reminder", HandleHabitReminder)
+	http.HandleFunc("/snooze", HandleSnooze)
+	http.HandleFunc("/habit-confirm", HandleHabitConfirm)
+	http.HandleFunc("/habit-privacy", HandleHabitPrivacy)
+	http.HandleFunc("/habit-penalty", HandleHabitPenalty)
+	http.HandleFunc("/check-in", HandleCheckIn)
+	http.HandleFunc("/habit-sessions", HandleHabitSessions)
+	http.HandleFunc("/skip", HandleSkip)
+	http.HandleFunc("/pause-habit", HandlePauseHabit)
+	http.HandleFunc("/habit-deps", HandleHabitDeps)
+	http.HandleFunc("/achievements", HandleAchievements)
+	http.HandleFunc("/challenges", HandleChallenges)
+	http.HandleFunc("/challenges/join/", HandleChallengeJoin)
+	http.HandleFunc("/challenges/me/", HandleChallengeMe)
+	http.HandleFunc("/adjust-quantity", HandleAdjustQuantity)
+	http.HandleFunc("/settings", HandleSettings)
+	http.HandleFunc("/setup", HandleSetup)
+	http.HandleFunc("/admin/reset", HandleAdminReset)
+	if devBuild {
+		http.HandleFunc("/dev/seed", HandleDevSeed) // generated test data (seed.go)
+	}
+	http.HandleFunc("/templates", HandleTemplates)
+	http.HandleFunc("/templates/mine", HandleMyTemplates)
+	http.HandleFunc("/settings/quick-links", HandleQuickTokens)
+	http.HandleFunc("/subscribe", HandleSubscribe)
+	http.HandleFunc("/quick/", HandleQuickLog)
+	http.HandleFunc("/quick-todo", HandleQuickTodo)
+	http.HandleFunc("/inbound-email/", HandleInboundEmail)
+	http.HandleFunc("/today", HandleTodayPlan)
+	http.HandleFunc("/habit", HandleHabitPage)
+	http.HandleFunc("/habit/household", HandleHouseholdMembers)
+	http.HandleFunc("/household/", HandleHousehold)
+	http.HandleFunc("/habit-photo", HandleHabitPhoto)
+	http.HandleFunc("/habit-photo/delete", HandleDeletePhoto)
+	http.HandleFunc("/photos/", HandlePhotoFile)
+	http.HandleFunc("/settings/morning-plan", HandleMorningPlanSettings)
+	http.HandleFunc("/settings/wrap-up", HandleWrapUpSettings)
+	http.HandleFunc("/settings/todo-sync", HandleTodoSyncSettings)
+	http.HandleFunc("/settings/share-links", HandleShareLinks)
+	http.HandleFunc("/settings/widgets", HandleWidgetLinks)
+	http.HandleFunc("/widget/", HandleWidget)
+	http.HandleFunc("/share-card/", HandleShareCard)
+	http.HandleFunc("/share/", HandleShare)
+	http.HandleFunc("/export/habit/", HandleExportHabit)
+	http.HandleFunc("/settings/partner", HandlePartnerSettings)
+	http.HandleFunc("/habit-partner", HandleHabitPartner)
+	http.HandleFunc("/habit-health", HandleHabitHealth)
+	http.HandleFunc("/import/health", HandleHealthImport)
+	http.HandleFunc("/import", HandleImport)
+	http.HandleFunc("/import/confirm", HandleImportConfirm)
+	http.HandleFunc("/habit-strava", HandleHabitStrava)
+	http.HandleFunc("/strava/connect", HandleStravaConnect)
+	http.HandleFunc("/strava/callback", HandleStravaCallback)
+	http.HandleFunc("/strava/disconnect", HandleStravaDisconnect)
+	http.HandleFunc("/about", HandleAbout)
+	http.HandleFunc("/login", HandleLogin)
+	http.HandleFunc("/logout", HandleLogout)
+	http.HandleFunc("/api/v1/sync", HandleSyncAPI)
+	http.HandleFunc("/api/v1/batch", HandleBatchAPI)
+	http.HandleFunc("/api/v1/bulk", HandleBulkAPI)
+	http.HandleFunc("/api/v1/today", HandleTodayAPI)
+	http.HandleFunc("/api/v1/complete", HandleCompleteAPI)
+	http.HandleFunc("/api/v1/badge", HandleBadgeAPI)
+	http.HandleFunc("/api/v1/status.txt", HandleStatusText)
+	http.HandleFunc("/api/v1/health", HandleHealthAPI)
+	http.HandleFunc("/api/v1/voice-todo", HandleVoiceTodoAPI)
+	// Open pages update themselves after changes made elsewhere, and show reminders (see live.go;
+	// /events is the same for networks without WebSockets, see events.go).
+	http.HandleFunc("/ws", HandleLive)
+	http.HandleFunc("/events", HandleEvents)
+	// Static files (manifest, service worker, icon, scripts) are served under /static/ (see assets.go).
+	http.Handle("/static/", staticHandler())
 
-	// Start the HTTP server. ListenAndServe listens on port 8080 and blocks until the program exits.
-	// The second argument is the handler for all requests; nil means use the default multiplexer
-	// (which we configured with HandleFunc above).
-	// To stop: press Ctrl+C in the terminal.
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	// Watch data.json in the background (a goroutine) so changes made by Syncthing/Dropbox are noticed.
+	go WatchDataFile(2*time.Second, handleExternalChange)
+	// Once a day, record a summary of the data and log what changed (see integrity.go).
+	go RunIntegritySnapshots()
+	// Take a full backup every day and drop old ones by the retention policy (see autobackup.go).
+	go RunBackups()
+	// Send each habit's reminder at its time if it isn't done yet (see reminders.go).
+	go RunReminders()
+	// "3 habits left today" Web Push notifications in the evening (see webpush.go).
+	go RunPushReminders()
+	// Chat commands and a morning summary on Discord, if a bot token is configured (see discord.go).
+	go RunDiscordBot()
+	// Habit states and completion events on an MQTT broker for Home Assistant, if configured (see homeassistant.go).
+	go RunMQTT()
+	// Complete the coding habit from GitHub contributions, if configured (see github.go).
+	go RunGitHubSync()
+	// Complete exercise habits from Strava activities, once an account is connected (see strava.go).
+	go RunStravaSync()
+	// Add a row per finished day to a Notion database, if configured (see notion.go).
+	go RunNotionExport()
+	// Sync todos with Todoist or TickTick, once a token is set in settings (see todosync.go).
+	go RunTodoSync()
+	// On a sync client, push/pull changes with the authority instance (see sync.go).
+	if url := os.Getenv("SYNC_SERVER_URL"); url != "" {
+		go RunSyncClient(url)
+	}
+
+	// PORT lets two instances (e.g. a sync server and a client) run on the same machine.
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// Write changes still waiting in memory (store.go) before the program stops. signal.Notify
+	// delivers Ctrl+C (SIGINT) and SIGTERM (systemd, Docker) to the channel instead of exiting.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		if err := FlushData(); err != nil {
+			log.Println("writing data.json:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+
+	// Start the HTTP server. ListenAndServe listens on the port and blocks until the program exits.
+	// The second argument is the handler for all requests: the default multiplexer (which we
+	// configured with HandleFunc above), wrapped so outdated forms are refused (revision.go) and
+	// a form sent twice only counts once (idempotency.go).
+	// To stop: press Ctrl+C in the terminal (pending changes are written first, see above).
+	// Around that go the profiling guard (profiling.go), the APP_PASSWORD check (auth.go) and,
+	// outermost, the rate and size limits (limits.go), so password guesses count against the
+	// limit too.
+	handler := LimitRequests(RequirePassword(GuardProfiling(Idempotent(RevisionGuard(http.DefaultServeMux)))))
+	if httpsEnabled() {
+		// HTTPS with Let's Encrypt certificates on ports 443 and 80 (see tls.go).
+		if err := ListenAndServeHTTPS(handler); err != nil {
+			panic(err)
+		}
+	}
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
 		panic(err) // panic stops the program and prints the error (ok for startup failures)
 	}
 }
@@ -0,0 +1,114 @@
+// markdown.go - A small, safe part of Markdown for the text you write: habit notes (shown folded
+// under the habit on the main page), the reflections written at reviews, and todos.
+//
+//	# A heading            - a list item          1. a numbered item
+//	- [ ] a checklist item - [x] a ticked one
+//	**bold**  *italic*  `code`  [a link](https://example.com)
+//
+// Lines right after each other form one paragraph; an empty line starts a new one. Todos are a
+// single line, so they only get the inline part (bold, italic, code, links). The text is
+// HTML-escaped before anything else, so it can't put its own HTML on the page, and links only
+// go to http://, https:// and mailto: addresses.
+
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// maxNotesChars is the longest notes a habit can have.
+const maxNotesChars = 4000
+
+var (
+	mdOrdered = regexp.MustCompile(`^\d+[.)]\s+`)
+	mdTask    = regexp.MustCompile(`^\[([ xX])\]\s+`)
+	mdCode    = regexp.MustCompile("`([^`]+)`")
+	mdBold    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdItalic  = regexp.MustCompile(`\*([^*]+)\*`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(((?:https?://|mailto:)[^)\s]+)\)`)
+)
+
+// renderInline turns the inline Markdown of one (already escaped) line into HTML. Code spans are
+// set aside first, so nothing inside them is read as Markdown.
+func renderInline(s string) string {
+	var codes []string
+	s = mdCode.ReplaceAllStringFunc(s, func(m string) string {
+		codes = append(codes, "<code>"+mdCode.FindStringSubmatch(m)[1]+"</code>")
+		return "\x00"
+	})
+	s = mdLink.ReplaceAllString(s, `<a href="$2" rel="noopener noreferrer" target="_blank">$1</a>`)
+	s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+	s = mdItalic.ReplaceAllString(s, "<em>$1</em>")
+	for _, c := range codes {
+		s = strings.Replace(s, "\x00", c, 1)
+	}
+	return s
+}
+
+// RenderMarkdownInline turns one line of text, like a todo, into HTML: bold, italic, code and
+// links. It's registered as "markdownInline" for the templates (assets.go).
+func RenderMarkdownInline(text string) template.HTML {
+	return template.HTML(renderInline(html.EscapeString(text)))
+}
+
+// RenderMarkdown turns notes or a reflection into HTML. It's registered as "markdown" for the
+// templates (assets.go); template.HTML tells html/template the result is safe to put on the page
+// as it is.
+func RenderMarkdown(notes string) template.HTML {
+	var sb strings.Builder
+	var para []string
+	list := "" // "ul" or "ol" while inside a list
+	flush := func() {
+		if len(para) > 0 {
+			sb.WriteString("<p>" + strings.Join(para, "<br>") + "</p>")
+			para = nil
+		}
+		if list != "" {
+			sb.WriteString("</" + list + ">")
+			list = ""
+		}
+	}
+	item := func(kind, text string) {
+		if len(para) > 0 || (list != "" && list != kind) {
+			flush()
+		}
+		if list == "" {
+			sb.WriteString("<" + kind + ">")
+			list = kind
+		}
+		// A checklist item shows a checkbox that can't be clicked: ticking happens in the text.
+		if m := mdTask.FindStringSubmatch(text); m != nil {
+			box := `<input type="checkbox" disabled>`
+			if m[1] != " " {
+				box = `<input type="checkbox" checked disabled>`
+			}
+			sb.WriteString(`<li class="md-task">` + box + " " + renderInline(text[len(m[0]):]) + "</li>")
+			return
+		}
+		sb.WriteString("<li>" + renderInline(text) + "</li>")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(notes, "\r\n", "\n"), "\n") {
+		line = html.EscapeString(strings.TrimSpace(line))
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#"):
+			flush()
+			sb.WriteString("<h4>" + renderInline(strings.TrimSpace(strings.TrimLeft(line, "#"))) + "</h4>")
+		case strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* "):
+			item("ul", line[2:])
+		case mdOrdered.MatchString(line):
+			item("ol", mdOrdered.ReplaceAllString(line, ""))
+		default:
+			if list != "" {
+				flush()
+			}
+			para = append(para, renderInline(line))
+		}
+	}
+	flush()
+	return template.HTML(sb.String())
+}
@@ -0,0 +1,28 @@
+-- 001_init.sql - The tables for running on Postgres (see postgres.go).
+
+-- All of AppData as one JSON document, in a single row. revision is the same counter as
+-- AppData.Revision; a save only goes through if it still matches (and bumps it).
+CREATE TABLE crescendo_data (
+    id       integer PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    revision bigint  NOT NULL,
+    data     jsonb   NOT NULL
+);
+INSERT INTO crescendo_data (id, revision, data) VALUES (1, 0, '{}');
+
+-- The change journal (journal.go), one row per event instead of one line per event.
+CREATE TABLE journal (
+    seq    bigserial   PRIMARY KEY,
+    id     text        NOT NULL UNIQUE,
+    time   timestamptz NOT NULL,
+    device text        NOT NULL,
+    op     text        NOT NULL,
+    entity text        NOT NULL,
+    key    text        NOT NULL,
+    record jsonb
+);
+
+-- Rows to lock with SELECT ... FOR UPDATE, so only one instance at a time does a job.
+CREATE TABLE locks (
+    name text PRIMARY KEY
+);
+INSERT INTO locks (name) VALUES ('penalties');
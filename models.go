@@ -8,33 +8,284 @@ import "time"
 // Habit represents a single habit the user wants to track.
 // In Go, we use structs to group related data together.
 // The `json:"id"` tags tell the JSON encoder/decoder what field name to use.
+// Motivation ("why I do this") and ReminderTemplate personalize the daily reminder (see reminders.go).
+// Confirm is "", "quantity" or "twostep": an optional confirmation before completing (see confirm.go).
 type Habit struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Quantity  int       `json:"quantity"`
-	Unit      string    `json:"unit"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	Quantity         int       `json:"quantity"`
+	Unit             string    `json:"unit"`
+	CreatedAt        time.Time `json:"created_at"`
+	Motivation       string    `json:"motivation,omitempty"`
+	ReminderTemplate string    `json:"reminder_template,omitempty"`
+	Confirm          string    `json:"confirm,omitempty"`
+	ReminderTime     string    `json:"reminder_time,omitempty"` // "HH:MM" local time; empty = REMINDER_TIME
+	// ReminderVia is the channel the reminder goes to ("push", "telegram", ...; empty = every
+	// configured one); EscalateVia is where it goes again if the habit is still open two hours
+	// later (empty = no second reminder). See reminders.go.
+	ReminderVia string `json:"reminder_via,omitempty"`
+	EscalateVia string `json:"escalate_via,omitempty"`
+	// Notes are how-to notes in Markdown, shown folded under the habit (markdown.go).
+	Notes string `json:"notes,omitempty"`
+	// CycleStartQuantity is the quantity right after the last week review (or at creation),
+	// shown at the next review next to the current one. 0 = not known (older data).
+	CycleStartQuantity int `json:"cycle_start_quantity,omitempty"`
+	// Private habits are left out of everything others can see (see privacy.go).
+	Private bool `json:"private,omitempty"`
+	// IncrementStep is what the week review adds by default (0 = 1); MaxQuantity is a ceiling the
+	// target never grows past, e.g. 8 hours of sleep (0 = no ceiling).
+	IncrementStep int `json:"increment_step,omitempty"`
+	MaxQuantity   int `json:"max_quantity,omitempty"`
+	// DependsOn lists habit IDs that must be done the same day before this one counts (deps.go).
+	DependsOn []int `json:"depends_on,omitempty"`
+	// NotifyPartner opts the habit in to accountability partner alerts (partner.go).
+	NotifyPartner bool `json:"notify_partner,omitempty"`
+	// HealthMetric links the habit to imported health data (health.go): it's completed on days
+	// the metric ("steps", "workout_minutes", "sleep_hours") reaches HealthMin.
+	HealthMetric string  `json:"health_metric,omitempty"`
+	HealthMin    float64 `json:"health_min,omitempty"`
+	// StravaType links the habit to a Strava activity type like "Run" (strava.go); a day's
+	// activities of that type complete it once they reach both minimums.
+	StravaType       string  `json:"strava_type,omitempty"`
+	StravaMinKm      float64 `json:"strava_min_km,omitempty"`
+	StravaMinMinutes int     `json:"strava_min_minutes,omitempty"`
+	// Pauses take the habit off today's list while they last, the latest last (PausedOn). The
+	// days stay recorded after resuming, for streaks (pause.go). Before schema 5 only one pause
+	// was kept, in PausedFrom and PausedTo (and a "paused" flag, now ignored).
+	Pauses     []PausePeriod `json:"pauses,omitempty"`
+	PausedFrom string        `json:"paused_from,omitempty"`
+	PausedTo   string        `json:"paused_to,omitempty"`
+	// Color ("#rrggbb") fills the habit's done days in the calendars, Icon (an emoji) goes in
+	// front of its name (appearance.go). Both optional.
+	Color string `json:"color,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+	// LongestStreak is the best streak the habit ever had (longestStreak in logic.go), kept up
+	// to date whenever its history changes.
+	LongestStreak int `json:"longest_streak,omitempty"`
+	// PenaltyExempt habits never shrink after a missed day (e.g. "Take medication"): the miss
+	// still breaks the streak, but ProcessMissesSince leaves the target alone.
+	PenaltyExempt bool `json:"penalty_exempt,omitempty"`
+	// Sessions splits the daily target into that many check-ins, e.g. 50 pushups as 5×10
+	// (sessions.go). 0 = done in one go.
+	Sessions int `json:"sessions,omitempty"`
+	// BreaksRecovered counts comebacks: completions right after a missed day (comeback.go).
+	BreaksRecovered int `json:"breaks_recovered,omitempty"`
+	// Household are the people who share the habit through their own link (household.go).
+	Household []HouseholdMember `json:"household,omitempty"`
+}
+
+// WeeklyStep returns how much the week review adds to the habit by default.
+func (h Habit) WeeklyStep() int {
+	if h.IncrementStep > 0 {
+		return h.IncrementStep
+	}
+	return 1
+}
+
+// capQuantity keeps q within the habit's limits: at least 1 and at most MaxQuantity (if set).
+func (h Habit) capQuantity(q int) int {
+	if h.MaxQuantity > 0 && q > h.MaxQuantity {
+		q = h.MaxQuantity
+	}
+	if q < 1 {
+		q = 1
+	}
+	return q
 }
 
 // Todo is a single checklist task. When checked, it is removed.
+// Priority is "high", "medium", "low" or "" (none). DueDate is YYYY-MM-DD or "" (no due date).
+// `omitempty` leaves the field out of the JSON when it is empty, so old data.json files stay small.
 type Todo struct {
-	ID   int    `json:"id"`
-	Text string `json:"text"`
+	ID       int      `json:"id"`
+	Text     string   `json:"text"`
+	Priority string   `json:"priority,omitempty"`
+	DueDate  string   `json:"due_date,omitempty"`
+	Tags     []string `json:"tags,omitempty"` // from the Todoist/TickTick project (todosync.go)
 }
 
 // DayRecord stores what happened on a specific day.
+// MinutesLogged maps habit ID -> minutes tracked with timers/focus sessions (time-based habits).
+// PenaltyAmounts maps habit ID -> how much its penalty lowered the target, so a skip token
+// (skip.go) can undo it. SkippedHabits were excused with a skip token.
 type DayRecord struct {
-	Date                   string `json:"date"`
-	CompletedHabits        []int  `json:"completed_habits"`
-	WeekReviewDone         bool   `json:"week_review_done"`
-	PenaltyAppliedForHabits []int  `json:"penalty_applied_habits,omitempty"`
+	Date                    string      `json:"date"`
+	CompletedHabits         []int       `json:"completed_habits"`
+	WeekReviewDone          bool        `json:"week_review_done"`
+	PenaltyAppliedForHabits []int       `json:"penalty_applied_habits,omitempty"`
+	PenaltyAmounts          map[int]int `json:"penalty_amounts,omitempty"`
+	SkippedHabits           []int       `json:"skipped_habits,omitempty"`
+	MinutesLogged           map[int]int `json:"minutes_logged,omitempty"`
+	// CheckIns are the sessions of habits done in parts (sessions.go), with their times.
+	CheckIns map[int][]CheckIn `json:"check_ins,omitempty"`
+	// Photos are pictures uploaded as proof of a habit that day (photos.go).
+	Photos map[int][]Photo `json:"photos,omitempty"`
+	// CompletionSources tags completions that were imported, e.g. habit ID -> "apple-health".
+	CompletionSources map[int]string `json:"completion_sources,omitempty"`
+	// WeekReview is what the week review done on this day decided (weekreview.go); MonthReview
+	// and QuarterReview the same for the reviews above it (tierreview.go).
+	WeekReview    *WeekReview `json:"week_review,omitempty"`
+	MonthReview   *WeekReview `json:"month_review,omitempty"`
+	QuarterReview *WeekReview `json:"quarter_review,omitempty"`
+}
+
+// WeekReview is the outcome of one week review: a decision per habit and what you wrote about
+// the week (optional). Monthly and quarterly reviews are kept the same way.
+type WeekReview struct {
+	Decisions  []ReviewDecision `json:"decisions"`
+	Reflection string           `json:"reflection,omitempty"`
+}
+
+// ReviewDecision is one habit's change at a week review. Name and Unit are copied, so the
+// record still reads right after the habit is renamed or deleted.
+type ReviewDecision struct {
+	HabitID int    `json:"habit_id"`
+	Name    string `json:"name"`
+	Unit    string `json:"unit,omitempty"`
+	Action  string `json:"action"` // "increase", "keep" or "decrease"
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+}
+
+// FocusSession is one pomodoro run. End is the zero time while the session is still running.
+// HabitID/TodoID link the session to what it was for (0 = not linked).
+type FocusSession struct {
+	ID             int       `json:"id"`
+	HabitID        int       `json:"habit_id,omitempty"`
+	TodoID         int       `json:"todo_id,omitempty"`
+	Date           string    `json:"date"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	PlannedMinutes int       `json:"planned_minutes"`
+	Minutes        int       `json:"minutes"`
+}
+
+// QuantityAdjustment is one audit entry for a manual −/+ change of a habit's quantity.
+type QuantityAdjustment struct {
+	Time    time.Time `json:"time"`
+	HabitID int       `json:"habit_id"`
+	From    int       `json:"from"`
+	To      int       `json:"to"`
+}
+
+// QuickToken is a secret quick-log link for one habit (see quick.go).
+type QuickToken struct {
+	Token     string    `json:"token"`
+	HabitID   int       `json:"habit_id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used,omitempty"`
+}
+
+// Settings are preferences chosen on the /settings page.
+type Settings struct {
+	Theme  string `json:"theme,omitempty"`  // "dark" (default), "light" or "system" (follow the device)
+	Accent string `json:"accent,omitempty"` // accent colour as "#rrggbb"; empty = default blue
+	// Language is the language of the pages, like "de" (i18n.go); empty = the browser's.
+	Language string `json:"language,omitempty"`
+	// DateLocale is how dates are written and when weeks start, like "en-GB" (dates.go); empty =
+	// from the language.
+	DateLocale string `json:"date_locale,omitempty"`
+	// PenaltyGraceDays is how many days a new habit is spared miss penalties, counting the day it
+	// was created. It's a pointer so "not set" (nil, use the default) differs from 0 (no grace).
+	PenaltyGraceDays *int   `json:"penalty_grace_days,omitempty"`
+	Timezone         string `json:"timezone,omitempty"`   // IANA name like "Europe/Berlin"; empty = the server's zone
+	OpenAIKey        string `json:"openai_key,omitempty"` // set in the setup wizard; OPENAI_KEY in .env wins
+	// MonthlySkipTokens is how many skip tokens every habit gets per month (nil = the default).
+	MonthlySkipTokens *int `json:"monthly_skip_tokens,omitempty"`
+	// ReviewCadence is when the week review comes: "" (7 days after the last one), "weekly",
+	// "biweekly" or "monthly" (the first ReviewWeekday of the month). The weekly ones land on
+	// ReviewWeekday (0 = Sunday … 6 = Saturday), see NextReviewDate in logic.go.
+	ReviewCadence string `json:"review_cadence,omitempty"`
+	ReviewWeekday int    `json:"review_weekday,omitempty"`
+	// Accountability partner (partner.go): where alerts go, and their message templates.
+	PartnerEmail          string `json:"partner_email,omitempty"`
+	PartnerWebhook        string `json:"partner_webhook,omitempty"`
+	PartnerMissTemplate   string `json:"partner_miss_template,omitempty"`
+	PartnerStreakTemplate string `json:"partner_streak_template,omitempty"`
+	// Todo sync with Todoist and TickTick (todosync.go): API tokens, and the project rules.
+	TodoistToken  string `json:"todoist_token,omitempty"`
+	TickTickToken string `json:"ticktick_token,omitempty"`
+	TodoSyncRules string `json:"todo_sync_rules,omitempty"`
+	// WrapUpTime is when the day wrap-up goes out, "HH:MM" (wrapup.go); empty = never.
+	WrapUpTime string `json:"wrap_up_time,omitempty"`
+	// MorningPlanTime is when the day's plan is sent, "HH:MM" (plan.go); empty = never.
+	MorningPlanTime string `json:"morning_plan_time,omitempty"`
+}
+
+// defaultGraceDays spares a new habit on the day it is created, so adding one in the evening
+// doesn't cost a penalty the next morning.
+const defaultGraceDays = 1
+
+// GraceDays returns the penalty grace period for new habits in days.
+func (s Settings) GraceDays() int {
+	if s.PenaltyGraceDays == nil {
+		return defaultGraceDays
+	}
+	return *s.PenaltyGraceDays
+}
+
+// SkipTokensPerMonth returns how many skip tokens (skip.go) each habit gets per month.
+func (s Settings) SkipTokensPerMonth() int {
+	if s.MonthlySkipTokens == nil {
+		return defaultSkipTokens
+	}
+	return *s.MonthlySkipTokens
+}
+
+// InsightsReport is the AI-written report on one week (insights.go).
+type InsightsReport struct {
+	Week      string    `json:"week"` // the Monday the week starts on
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // AppData is the root structure we persist to JSON.
 type AppData struct {
-	Habits         []Habit              `json:"habits"`
-	Todos          []Todo               `json:"todos"`
-	History        map[string]DayRecord `json:"history"`
-	LastWeekReview string               `json:"last_week_review"`
-	CreatedAt      string               `json:"created_at"`
+	Habits                 []Habit                  `json:"habits"`
+	Todos                  []Todo                   `json:"todos"`
+	FocusSessions          []FocusSession           `json:"focus_sessions,omitempty"`
+	RunningTimers          map[int]time.Time        `json:"running_timers,omitempty"` // habit ID -> when its timer was started
+	Adjustments            []QuantityAdjustment     `json:"adjustments,omitempty"`    // audit trail of manual quantity changes
+	History                map[string]DayRecord     `json:"history"`
+	LastWeekReview         string                   `json:"last_week_review"`
+	LastMonthReview        string                   `json:"last_month_review,omitempty"`         // tierreview.go
+	LastQuarterReview      string                   `json:"last_quarter_review,omitempty"`       // tierreview.go
+	LastProcessedDate      string                   `json:"last_processed_date,omitempty"`       // last day whose misses were penalized
+	ReminderLog            map[int]ReminderDelivery `json:"reminder_log,omitempty"`              // habit ID -> its last reminder and escalation (reminders.go)
+	ReminderSentOn         map[int]string           `json:"reminder_sent_on,omitempty"`          // before schema 4: habit ID -> last day its reminder went out
+	SnoozedUntil           map[int]time.Time        `json:"snoozed_until,omitempty"`             // habit ID -> remind again at this time
+	LastReviewNudgeDate    string                   `json:"last_review_nudge_date,omitempty"`    // last day we reminded about a pending 7-day review
+	LastDiscordSummaryDate string                   `json:"last_discord_summary_date,omitempty"` // last day the Discord morning summary was posted
+	LastSummaryEmail       string                   `json:"last_summary_email,omitempty"`        // the week (its Monday) the last weekly summary email was about
+	LastWrapUpDate         string                   `json:"last_wrap_up_date,omitempty"`         // last day the day wrap-up went out (wrapup.go)
+	WrapUpHabits           []int                    `json:"wrap_up_habits,omitempty"`            // the habits that wrap-up listed, for replies by email (emailreply.go)
+	LastNotionExport       string                   `json:"last_notion_export,omitempty"`        // last day sent to the Notion database (notion.go)
+	LastMorningPlanDate    string                   `json:"last_morning_plan_date,omitempty"`    // last day the morning plan went out (plan.go)
+	DayFocus               *DayFocus                `json:"day_focus,omitempty"`                 // today's focus sentence on the plan (plan.go)
+	Insights               *InsightsReport          `json:"insights,omitempty"`                  // the latest weekly insights report (insights.go)
+	CreatedAt              string                   `json:"created_at"`
+	Settings               Settings                 `json:"settings"`
+	QuickTokens            []QuickToken             `json:"quick_tokens,omitempty"`
+	HabitTemplates         []HabitTemplate          `json:"habit_templates,omitempty"`    // your own templates (library.go)
+	SkipTokens             map[int]SkipBalance      `json:"skip_tokens,omitempty"`        // habit ID -> skip tokens left this month
+	SetupDone              bool                     `json:"setup_done,omitempty"`         // the first-run wizard was finished or skipped
+	Profile                Profile                  `json:"profile"`                      // XP and badges (gamify.go)
+	Challenges             []Challenge              `json:"challenges,omitempty"`         // challenge rooms (challenges.go)
+	ShareLinks             []ShareLink              `json:"share_links,omitempty"`        // read-only share links (share.go)
+	WidgetLinks            []WidgetLink             `json:"widget_links,omitempty"`       // embeddable habit images (widget.go)
+	PartnerCheckedOn       map[int]string           `json:"partner_checked_on,omitempty"` // habit ID -> last day checked for partner alerts
+	Strava                 *StravaAuth              `json:"strava,omitempty"`             // the connected Strava account (strava.go)
+	TodoLinks              []TodoLink               `json:"todo_links,omitempty"`         // todos synced with Todoist or TickTick (todosync.go)
+	Trash                  []TrashItem              `json:"trash,omitempty"`              // deleted habits and tasks, kept for 30 days (trash.go)
+	// Revision counts the saves. SaveData refuses to write a copy loaded before the last save, so
+	// two tabs (or a tab and a background job) can't silently undo each other (revision.go).
+	Revision int64 `json:"revision,omitempty"`
+	// SchemaVersion is the shape the data is in; older files are upgraded when read (schema.go).
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// Profile is the XP earned and the badges unlocked (badge key -> day it was unlocked).
+type Profile struct {
+	XP     int               `json:"xp"`
+	Badges map[string]string `json:"badges,omitempty"`
 }
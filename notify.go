@@ -0,0 +1,200 @@
+// notify.go - The notification engine: a small interface for "channels" that can deliver a
+// message (a webhook, the server log, ...) and a helper that sends to every configured channel.
+// Channels are configured with environment variables in .env, like OPENAI_KEY:
+//
+//	NOTIFY_WEBHOOK_URL=https://ntfy.sh/my-habits   (POSTs {"title": ..., "message": ...} as JSON)
+//	NOTIFY_EMAIL=me@example.com                    (email, sent through SMTP_HOST; see below)
+//	TELEGRAM_BOT_TOKEN=123:abc TELEGRAM_CHAT_ID=42 (a Telegram chat, via the Bot API)
+//
+// Email needs an SMTP server: SMTP_HOST, SMTP_PORT (default 587), SMTP_USER, SMTP_PASS and
+// SMTP_FROM (defaults to SMTP_USER).
+//
+// Browsers that enabled push notifications on the settings page are a channel too (webpush.go).
+// With no channel configured, notifications are written to the server log.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notifier is a channel that can deliver a notification. In Go, an interface lists methods;
+// any type with these methods satisfies it automatically (no "implements" keyword).
+type Notifier interface {
+	Name() string
+	Send(title, body string) error
+}
+
+// logNotifier writes notifications to the server log. Used when nothing else is configured.
+type logNotifier struct{}
+
+func (logNotifier) Name() string { return "log" }
+
+func (logNotifier) Send(title, body string) error {
+	log.Printf("notification: %s - %s", title, body)
+	return nil
+}
+
+// webhookNotifier POSTs the notification as JSON to a URL (ntfy, Slack/Discord-compatible
+// relays, Home Assistant webhooks, ...).
+type webhookNotifier struct {
+	url string
+}
+
+func (webhookNotifier) Name() string { return "webhook" }
+
+func (n webhookNotifier) Send(title, body string) error {
+	payload, err := json.Marshal(map[string]string{"title": title, "message": body})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(n.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// emailNotifier sends the notification as a plain-text email through an SMTP server.
+type emailNotifier struct {
+	host, port, user, pass, from, to string
+}
+
+func (emailNotifier) Name() string { return "email" }
+
+func (n emailNotifier) Send(title, body string) error {
+	msg := "From: " + n.from + "\r\n" +
+		"To: " + n.to + "\r\n" +
+		"Subject: " + title + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	var auth smtp.Auth
+	if n.user != "" {
+		auth = smtp.PlainAuth("", n.user, n.pass, n.host)
+	}
+	return smtp.SendMail(n.host+":"+n.port, auth, n.from, []string{n.to}, []byte(msg))
+}
+
+// telegramNotifier sends the notification to a Telegram chat through a bot
+// (create one by talking to @BotFather; the chat ID is where the bot posts).
+type telegramNotifier struct {
+	token, chatID string
+}
+
+func (telegramNotifier) Name() string { return "telegram" }
+
+func (n telegramNotifier) Send(title, body string) error {
+	form := url.Values{"chat_id": {n.chatID}, "text": {title + "\n" + body}}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.PostForm("https://api.telegram.org/bot"+n.token+"/sendMessage", form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telegram returned %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier returns an email channel to the address to, using the SMTP_* settings from .env.
+// ok is false when SMTP_HOST isn't set.
+func smtpNotifier(to string) (n emailNotifier, ok bool) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return n, false
+	}
+	n = emailNotifier{host: host, port: os.Getenv("SMTP_PORT"), user: os.Getenv("SMTP_USER"),
+		pass: os.Getenv("SMTP_PASS"), from: os.Getenv("SMTP_FROM"), to: to}
+	if n.port == "" {
+		n.port = "587"
+	}
+	if n.from == "" {
+		n.from = n.user
+	}
+	return n, true
+}
+
+// notifierNames are the names of all channels a habit can pick, configured or not.
+var notifierNames = []string{"webhook", "email", "telegram", "push"}
+
+// ConfiguredNotifiers returns the channels set up in the environment (the log if none).
+func ConfiguredNotifiers() []Notifier {
+	var out []Notifier
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		out = append(out, webhookNotifier{url: url})
+	}
+	if to := os.Getenv("NOTIFY_EMAIL"); to != "" {
+		if n, ok := smtpNotifier(to); ok {
+			out = append(out, n)
+		}
+	}
+	if token, chat := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_CHAT_ID"); token != "" && chat != "" {
+		out = append(out, telegramNotifier{token: token, chatID: chat})
+	}
+	if HasPushSubscriptions() {
+		out = append(out, pushNotifier{}) // browsers subscribed on the settings page (webpush.go)
+	}
+	if len(out) == 0 {
+		out = append(out, logNotifier{})
+	}
+	return out
+}
+
+// Notify sends a notification to every configured channel. A failing channel is logged and
+// doesn't stop the others; the error is only returned if no channel succeeded.
+func Notify(title, body string) error {
+	_, err := NotifyVia("", title, body)
+	return err
+}
+
+// NotifyVia is Notify for the one configured channel called via ("push", "telegram", ...), or
+// for all of them if via is "". It returns the names of the channels that delivered it.
+func NotifyVia(via, title, body string) ([]string, error) {
+	var sent []string
+	var lastErr error
+	for _, n := range ConfiguredNotifiers() {
+		if via != "" && n.Name() != via {
+			continue
+		}
+		if err := n.Send(title, body); err != nil {
+			log.Printf("notify via %s: %v", n.Name(), err)
+			lastErr = err
+			continue
+		}
+		sent = append(sent, n.Name())
+	}
+	if len(sent) == 0 && lastErr == nil {
+		lastErr = fmt.Errorf("notification channel %q isn't configured", via)
+	}
+	if len(sent) == 0 {
+		return nil, lastErr
+	}
+	return sent, nil
+}
+
+// NotifyChannels returns the names of the channels configured in the environment, for picking
+// one per habit (empty if notifications only go to the log).
+func NotifyChannels() []string {
+	var names []string
+	for _, n := range ConfiguredNotifiers() {
+		if n.Name() != "log" {
+			names = append(names, n.Name())
+		}
+	}
+	return names
+}
@@ -0,0 +1,268 @@
+// notion.go - Copying each day to a Notion database, so a life dashboard in Notion keeps working
+// while the habits are logged here. Once a day is over, one row (a Notion "page") is added for it.
+// Set in .env:
+//
+//	NOTION_TOKEN=secret_...          (an internal integration's token; share the database with it)
+//	NOTION_DATABASE_ID=1a2b3c...     (the 32 characters in the database's link, before "?v=")
+//
+// The row fills in the database's properties that it finds, by name (any case) and type:
+//
+//	the title property   the day, "2025-03-01"
+//	Date (date)          the day
+//	Done, Total (number) habits done, and habits there were that day (paused ones don't count)
+//	Rate (number)        Done / Total, from 0 to 1 (set the property's format to percent)
+//	Habits (text or multi-select)   the names of the habits done
+//	<a habit's name> (checkbox)     ticked if that habit was done
+//
+// Other properties are left empty, and private habits are never sent. A day is sent once, so
+// completions added to it later don't reach Notion. The first time, the last 7 days are sent.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// notionAPI is Notion's API address (a variable, like todoistAPI), and notionVersion the version
+// of it we speak.
+var notionAPI = "https://api.notion.com/v1"
+
+const notionVersion = "2022-06-28"
+
+// notionConfig is the Notion export's settings from .env.
+type notionConfig struct {
+	token, database string
+}
+
+// loadNotionConfig reads NOTION_TOKEN and NOTION_DATABASE_ID; ok is false if one is missing.
+func loadNotionConfig() (c notionConfig, ok bool) {
+	c = notionConfig{token: os.Getenv("NOTION_TOKEN"), database: strings.ReplaceAll(os.Getenv("NOTION_DATABASE_ID"), "-", "")}
+	return c, c.token != "" && c.database != ""
+}
+
+// notionRequest sends body (if not nil) as JSON and decodes the answer into out (if not nil).
+func notionRequest(client *http.Client, cfg notionConfig, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, notionAPI+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.token)
+	req.Header.Set("Notion-Version", notionVersion)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Notion explains errors in JSON: {"code": "object_not_found", "message": "..."}.
+		var e struct{ Code, Message string }
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&e)
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, e.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// notionSchema maps the database's property names, in lowercase, to their real name and type.
+type notionSchema map[string]struct{ Name, Type string }
+
+// fetchNotionSchema reads the database's properties.
+func fetchNotionSchema(client *http.Client, cfg notionConfig) (notionSchema, error) {
+	var db struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+	}
+	if err := notionRequest(client, cfg, http.MethodGet, "/databases/"+cfg.database, nil, &db); err != nil {
+		return nil, err
+	}
+	schema := make(notionSchema)
+	for name, p := range db.Properties {
+		schema[strings.ToLower(name)] = struct{ Name, Type string }{name, p.Type}
+	}
+	return schema, nil
+}
+
+// NotionDay is what a day's row says.
+type NotionDay struct {
+	Date  string
+	Done  []Habit // the habits done
+	Total []Habit // the habits there were (not private, not paused, created by then)
+}
+
+// NewNotionDay collects day from data.
+func NewNotionDay(data *AppData, day string) NotionDay {
+	d := NotionDay{Date: day}
+	rec := data.History[day]
+	habits, _ := todaysHabits(data, day)
+	for _, h := range SharedHabits(habits) {
+		if h.CreatedAt.Format(dateLayout) > day {
+			continue
+		}
+		d.Total = append(d.Total, h)
+		if containsInt(rec.CompletedHabits, h.ID) {
+			d.Done = append(d.Done, h)
+		}
+	}
+	return d
+}
+
+// notionText is a Notion rich text value.
+func notionText(s string) []map[string]any {
+	return []map[string]any{{"type": "text", "text": map[string]string{"content": s}}}
+}
+
+// NotionProperties is the row for d, with the properties schema has.
+func NotionProperties(d NotionDay, schema notionSchema) map[string]any {
+	props := make(map[string]any)
+	var names []string
+	for _, h := range d.Done {
+		names = append(names, h.Name)
+	}
+	for key, p := range schema {
+		switch {
+		case p.Type == "title":
+			props[p.Name] = map[string]any{"title": notionText(d.Date)}
+		case key == "date" && p.Type == "date":
+			props[p.Name] = map[string]any{"date": map[string]string{"start": d.Date}}
+		case key == "done" && p.Type == "number":
+			props[p.Name] = map[string]any{"number": len(d.Done)}
+		case key == "total" && p.Type == "number":
+			props[p.Name] = map[string]any{"number": len(d.Total)}
+		case key == "rate" && p.Type == "number":
+			rate := 0.0
+			if len(d.Total) > 0 {
+				rate = float64(len(d.Done)) / float64(len(d.Total))
+			}
+			props[p.Name] = map[string]any{"number": rate}
+		case key == "habits" && p.Type == "rich_text":
+			props[p.Name] = map[string]any{"rich_text": notionText(strings.Join(names, ", "))}
+		case key == "habits" && p.Type == "multi_select":
+			opts := []map[string]string{}
+			for _, n := range names {
+				opts = append(opts, map[string]string{"name": strings.ReplaceAll(n, ",", "")}) // commas aren't allowed in an option
+			}
+			props[p.Name] = map[string]any{"multi_select": opts}
+		case p.Type == "checkbox":
+			for _, h := range d.Total {
+				if strings.ToLower(h.Name) == key {
+					props[p.Name] = map[string]any{"checkbox": containsInt(habitIDs(d.Done), h.ID)}
+				}
+			}
+		}
+	}
+	return props
+}
+
+// habitIDs returns the habits' IDs.
+func habitIDs(habits []Habit) []int {
+	ids := make([]int, len(habits))
+	for i, h := range habits {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+// notionDaysToExport returns the finished days not sent yet: those after data.LastNotionExport
+// (the last 7 days the first time, and never more), up to the day before today.
+func notionDaysToExport(data *AppData, today time.Time) []string {
+	yesterday := today.AddDate(0, 0, -1).Format(dateLayout)
+	from := today.AddDate(0, 0, -7).Format(dateLayout)
+	if data.LastNotionExport != "" {
+		if last, err := ParseDate(data.LastNotionExport); err == nil {
+			if next := last.AddDate(0, 0, 1).Format(dateLayout); next > from {
+				from = next
+			}
+		}
+	}
+	if created := data.CreatedAt; len(created) >= 10 && created[:10] > from {
+		from = created[:10]
+	}
+	if from > yesterday {
+		return nil
+	}
+	days, _ := DatesInRange(from, yesterday)
+	return days
+}
+
+// ExportToNotion adds a row for each finished day not sent yet, and returns how many it added.
+func ExportToNotion(client *http.Client, cfg notionConfig) (int, error) {
+	data, err := LoadData()
+	if err != nil {
+		return 0, err
+	}
+	today, err := ParseDate(Today()) // in the settings' time zone
+	if err != nil {
+		return 0, err
+	}
+	days := notionDaysToExport(data, today)
+	if len(days) == 0 {
+		return 0, nil
+	}
+	schema, err := fetchNotionSchema(client, cfg)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, day := range days {
+		page := map[string]any{
+			"parent":     map[string]string{"database_id": cfg.database},
+			"properties": NotionProperties(NewNotionDay(data, day), schema),
+		}
+		if err = notionRequest(client, cfg, http.MethodPost, "/pages", page, nil); err != nil {
+			break
+		}
+		sent++
+		// Note each day as it goes, so a failure halfway doesn't send the first ones twice.
+		if err = recordNotionExport(day); err != nil {
+			break
+		}
+	}
+	return sent, err
+}
+
+// recordNotionExport sets data.LastNotionExport to day.
+func recordNotionExport(day string) error {
+	data, err := LoadData()
+	if err != nil {
+		return err
+	}
+	data.LastNotionExport = day
+	return SaveData(data)
+}
+
+// RunNotionExport sends the finished days to Notion every hour, if it's configured.
+func RunNotionExport() {
+	cfg, ok := loadNotionConfig()
+	if !ok {
+		return
+	}
+	client := &http.Client{Timeout: 20 * time.Second}
+	for {
+		if n, err := ExportToNotion(client, cfg); err != nil {
+			log.Println("notion:", err)
+		} else if n > 0 {
+			log.Printf("notion: added %d day(s)", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
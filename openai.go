@@ -1,4 +1,7 @@
-// openai.go - Calls OpenAI API to break a task into 3 simpler subtasks.
+// openai.go - Calls OpenAI API to break a task into 3 simpler subtasks, to suggest target
+// changes at the week review, to write the weekly insights report (insights.go), and to read a
+// habit described in words (parsehabit.go), and to put the todos in order (triage.go). Voice
+// notes are transcribed with Whisper (voice.go).
 
 package main
 
@@ -7,8 +10,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // openaiRequest and openaiResponse match the Chat Completions API.
@@ -30,33 +37,25 @@ type openaiResponse struct {
 	} `json:"choices"`
 }
 
-// BreakIntoSubtasks calls the OpenAI API to break the given task into exactly 3 simpler subtasks.
-// Returns up to 3 non-empty trimmed lines from the model response, or an error.
-func BreakIntoSubtasks(task string, apiKey string) ([]string, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_KEY is not set")
+// openAIKey returns the key to use: OPENAI_KEY from .env, or the one entered in the setup wizard.
+func openAIKey(data *AppData) string {
+	if key := os.Getenv("OPENAI_KEY"); key != "" {
+		return key
 	}
+	return data.Settings.OpenAIKey
+}
 
-	prompt := fmt.Sprintf(`Break down the following task into exactly 3 simpler subtasks. Return only the 3 subtasks, one per line. No numbering, bullets, or extra text.
-
-Task: %s`, task)
-
-	reqBody := openaiRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []openaiMessage{
-			{Role: "user", Content: prompt},
-		},
-	}
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
+// openaiPost sends body to an OpenAI API endpoint (e.g. "chat/completions") and returns the
+// response body. Every call to OpenAI goes through here.
+func openaiPost(endpoint, contentType string, body io.Reader, apiKey string) ([]byte, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_KEY is not set")
 	}
-
-	req, err := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", bytes.NewReader(body))
+	req, err := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/"+endpoint, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	resp, err := http.DefaultClient.Do(req)
@@ -72,16 +71,50 @@ Task: %s`, task)
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("openai api error %d: %s", resp.StatusCode, string(respBytes))
 	}
+	return respBytes, nil
+}
+
+// chatCompletion sends one prompt to the Chat Completions API and returns the reply text.
+func chatCompletion(prompt, apiKey string) (string, error) {
+	reqBody := openaiRequest{
+		Model: "gpt-3.5-turbo",
+		Messages: []openaiMessage{
+			{Role: "user", Content: prompt},
+		},
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+	respBytes, err := openaiPost("chat/completions", "application/json", bytes.NewReader(body), apiKey)
+	if err != nil {
+		return "", err
+	}
 
 	var apiResp openaiResponse
 	if err := json.Unmarshal(respBytes, &apiResp); err != nil {
-		return nil, err
+		return "", err
 	}
 	if len(apiResp.Choices) == 0 {
-		return nil, fmt.Errorf("openai returned no choices")
+		return "", fmt.Errorf("openai returned no choices")
 	}
+	return apiResp.Choices[0].Message.Content, nil
+}
+
+// maxSimplifyChars is the longest task that is sent to OpenAI (see limits.go).
+const maxSimplifyChars = 500
 
-	content := apiResp.Choices[0].Message.Content
+// BreakIntoSubtasks calls the OpenAI API to break the given task into exactly 3 simpler subtasks.
+// Returns up to 3 non-empty trimmed lines from the model response, or an error.
+func BreakIntoSubtasks(task string, apiKey string) ([]string, error) {
+	prompt := fmt.Sprintf(`Break down the following task into exactly 3 simpler subtasks. Return only the 3 subtasks, one per line. No numbering, bullets, or extra text.
+
+Task: %s`, task)
+
+	content, err := chatCompletion(prompt, apiKey)
+	if err != nil {
+		return nil, err
+	}
 	var out []string
 	for _, line := range strings.Split(content, "\n") {
 		s := strings.TrimSpace(line)
@@ -101,3 +134,235 @@ Task: %s`, task)
 	}
 	return out, nil
 }
+
+// ReviewSuggestion is the model's advice for one habit at the week review: Change is how much to
+// add to the target (negative = lower it), Reason a short explanation.
+type ReviewSuggestion struct {
+	Change int
+	Reason string
+}
+
+// SuggestReviewChanges asks the model how to adjust each habit, given how its week went.
+// It answers one line per habit, "<id>|<change>|<reason>"; lines that don't parse are skipped.
+func SuggestReviewChanges(habits []Habit, summaries map[int]CycleSummary, apiKey string) (map[int]ReviewSuggestion, error) {
+	var sb strings.Builder
+	for _, h := range habits {
+		s := summaries[h.ID]
+		fmt.Fprintf(&sb, "id=%d; habit=%s; target=%d %s; done %d of %d days; penalties=%d\n",
+			h.ID, h.Name, h.Quantity, h.Unit, s.Days-s.Misses, s.Days, s.Penalties)
+	}
+	prompt := `You coach someone building daily habits. Every week they may raise, keep or lower each habit's daily target. Targets should grow steadily when the habit was done almost every day, stay the same when it was done most days, and go down when it was missed often. Each missed day already lowered the target automatically.
+
+For each habit below, reply with exactly one line: <id>|<change>|<reason>
+where <change> is a whole number from -3 to 3 (how much to add to the target) and <reason> is one short sentence. No other text.
+
+` + sb.String()
+
+	content, err := chatCompletion(prompt, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int]ReviewSuggestion)
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		id, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+		change, err2 := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(parts[1]), "+"))
+		if err1 != nil || err2 != nil || change < -3 || change > 3 {
+			continue
+		}
+		out[id] = ReviewSuggestion{Change: change, Reason: strings.TrimSpace(parts[2])}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("could not parse suggestions from response")
+	}
+	return out, nil
+}
+
+// maxInsightsChars is the longest insights report that is kept; a longer reply is cut off.
+const maxInsightsChars = 2000
+
+// WriteWeeklyInsights asks the model for a short report on the week, from the numbers in stats
+// (never the history itself). It returns plain text, a few sentences or short paragraphs.
+func WriteWeeklyInsights(stats WeekStats, apiKey string) (string, error) {
+	var sb strings.Builder
+	for _, h := range stats.Habits {
+		fmt.Fprintf(&sb, "habit=%s; target=%d %s; last week done %d of %d days; last 4 weeks: weekdays %d of %d, weekends %d of %d; by weekday Mon-Sun: %s; streak=%d days\n",
+			h.Name, h.Target, h.Unit, h.WeekDone, h.WeekDays, h.WeekdayDone, h.WeekdayDays, h.WeekendDone, h.WeekendDays, h.WeekdayRates(), h.Streak)
+	}
+	prompt := `You coach someone building daily habits. Below are their numbers for the week ` + stats.Week + ` to ` + stats.To + `, with the four weeks up to it for comparison.
+
+Write a short report for them (at most 120 words), speaking to them as "you": two to four observations about patterns in the numbers (which days or habits go well or badly, what changed), and one concrete suggestion for the coming week. Quote percentages. Plain text only, no headings, lists or markdown.
+
+` + sb.String()
+
+	content, err := chatCompletion(prompt, apiKey)
+	if err != nil {
+		return "", err
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", fmt.Errorf("openai returned an empty report")
+	}
+	if r := []rune(content); len(r) > maxInsightsChars {
+		content = string(r[:maxInsightsChars])
+	}
+	return content, nil
+}
+
+// ParseHabitWithAI asks the model to read a habit described in words. It answers one line,
+// "<name>|<quantity>|<unit>|<schedule>|<HH:MM or empty>"; an answer that doesn't parse is an error.
+func ParseHabitWithAI(text, apiKey string) (ParsedHabit, error) {
+	prompt := `Read this description of a daily habit and reply with exactly one line:
+<name>|<quantity>|<unit>|<schedule>|<time>
+where <name> is a short name for the habit (e.g. "Squats", "Read"), <quantity> a whole number (how much per day), <unit> what is counted (e.g. "squats", "pages", "minutes"), <schedule> is "daily", "weekdays", "weekends" or days like "mon, wed, fri", and <time> the time of day as HH:MM (24-hour; morning = 08:00, evening = 19:00) or empty if none is mentioned. No other text.
+
+Description: ` + text
+
+	content, err := chatCompletion(prompt, apiKey)
+	if err != nil {
+		return ParsedHabit{}, err
+	}
+	parts := strings.Split(strings.TrimSpace(strings.Split(strings.TrimSpace(content), "\n")[0]), "|")
+	if len(parts) != 5 {
+		return ParsedHabit{}, fmt.Errorf("could not parse habit from response")
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	qty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ParsedHabit{}, fmt.Errorf("could not parse habit from response")
+	}
+	p := ParsedHabit{Name: parts[0], Quantity: qty, Unit: parts[2], Schedule: strings.ToLower(parts[3]), Source: "ai"}
+	if _, err := time.Parse("15:04", parts[4]); err == nil {
+		p.ReminderTime = parts[4]
+	}
+	if p.Schedule == "" {
+		p.Schedule = "daily"
+	}
+	return p, nil
+}
+
+// transcribeAudio sends a recording to Whisper and returns what was said. filename tells the API
+// the format (".m4a", ".webm", ".mp3", ...).
+func transcribeAudio(audio io.Reader, filename, apiKey string) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("model", "whisper-1")
+	mw.WriteField("response_format", "text")
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	respBytes, err := openaiPost("audio/transcriptions", mw.FormDataContentType(), &body, apiKey)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(respBytes)), nil
+}
+
+// TriageSuggestion is the model's place for one todo: the priority it should have and why.
+type TriageSuggestion struct {
+	TodoID   int
+	Priority string // "high", "medium" or "low"
+	Reason   string
+}
+
+// SuggestTodoOrder asks the model to put the todos in the order to do them, weighing urgency
+// (due dates), effort, and how they relate to the habits still open today. It answers one line
+// per todo, first to last, "<id>|<priority>|<reason>"; lines that don't parse, unknown IDs and
+// repeats are skipped.
+func SuggestTodoOrder(todos []Todo, habits []Habit, today, apiKey string) ([]TriageSuggestion, error) {
+	var sb strings.Builder
+	for _, t := range todos {
+		fmt.Fprintf(&sb, "id=%d; task=%s; priority=%s; due=%s\n", t.ID, t.Text, t.Priority, t.DueDate)
+	}
+	var hb strings.Builder
+	for _, h := range habits {
+		fmt.Fprintf(&hb, "- %s (%d %s)\n", h.Name, h.Quantity, h.Unit)
+	}
+	if hb.Len() == 0 {
+		hb.WriteString("(none)\n")
+	}
+	prompt := `Today is ` + today + `. Put this person's open tasks in the order they should do them. Weigh urgency (due dates, overdue first), effort (quick wins early, big tasks when there is time), and how a task relates to the daily habits they still have to do today (a task that a habit needs, or that can be done together with one, goes near it).
+
+Reply with one line per task, first to last: <id>|<priority>|<reason>
+where <priority> is high, medium or low and <reason> is one short sentence. Every task exactly once, no other text.
+
+Habits still to do today:
+` + hb.String() + `
+Tasks:
+` + sb.String()
+
+	content, err := chatCompletion(prompt, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]bool)
+	for _, t := range todos {
+		known[t.ID] = true
+	}
+	var out []TriageSuggestion
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(parts[0]), "id="))
+		priority := strings.ToLower(strings.TrimSpace(parts[1]))
+		if err != nil || !known[id] || priority == "" || !ValidPriority(priority) {
+			continue
+		}
+		known[id] = false // each todo once
+		out = append(out, TriageSuggestion{TodoID: id, Priority: priority, Reason: strings.TrimSpace(parts[2])})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("could not parse an order from response")
+	}
+	return out, nil
+}
+
+// maxFocusChars is the longest focus suggestion that is kept; a longer reply is cut off.
+const maxFocusChars = 300
+
+// SuggestFocus asks the model for one sentence on what to focus on today, from the habits still
+// open (with their streaks) and the todos due. It's shown on top of the day's plan (plan.go).
+func SuggestFocus(habits []Habit, streaks map[int]int, todos []Todo, today, apiKey string) (string, error) {
+	var sb strings.Builder
+	for _, h := range habits {
+		fmt.Fprintf(&sb, "- habit: %s (%d %s), streak %d days\n", h.Name, h.Quantity, h.Unit, streaks[h.ID])
+	}
+	for _, t := range todos {
+		fmt.Fprintf(&sb, "- task: %s, priority %s, due %s\n", t.Text, t.Priority, t.DueDate)
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("(nothing)\n")
+	}
+	prompt := `You coach someone building daily habits. Today is ` + today + `. Below is what they have planned for today.
+
+Write ONE short sentence (at most 25 words), speaking to them as "you", on what to focus on today and why: a streak worth protecting, an overdue task, or what to do first. Plain text only.
+
+` + sb.String()
+
+	content, err := chatCompletion(prompt, apiKey)
+	if err != nil {
+		return "", err
+	}
+	content = strings.Trim(strings.TrimSpace(content), `"`)
+	if content == "" {
+		return "", fmt.Errorf("openai returned an empty suggestion")
+	}
+	if r := []rune(content); len(r) > maxFocusChars {
+		content = string(r[:maxFocusChars])
+	}
+	return content, nil
+}
@@ -0,0 +1,261 @@
+// parsehabit.go - Adding a habit by describing it: "do 20 squats every weekday morning". The
+// sentence is read into a name, a daily amount and unit, when in the week, and a reminder time,
+// which then fill in the add-habit form on the main page to check and confirm. Nothing is added
+// until you press Add.
+//
+// With an OpenAI key the model reads the sentence (ParseHabitWithAI in openai.go); without one,
+// or when the model's answer doesn't make sense, ParseHabitText reads it with simple rules. Both
+// give a ParsedHabit. Habits are daily here, so "every weekday" is shown but not kept: skip tokens
+// (skip.go) cover the days off.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxHabitTextChars is the longest description that is read (and sent to OpenAI).
+const maxHabitTextChars = 200
+
+// ParsedHabit is what was read from a description.
+type ParsedHabit struct {
+	Name         string
+	Quantity     int
+	Unit         string
+	Schedule     string // "daily", "weekdays", "weekends", or days like "mon, wed, fri"
+	ReminderTime string // "HH:MM", "" if no time was mentioned
+	Source       string // "ai" or "rules"; "" when the add form sent it back
+	Duplicate    bool   // a habit with this name exists: adding it needs confirming (handlers.go)
+}
+
+// numberWords are the amounts written out that the rules understand.
+var numberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8,
+	"nine": 9, "ten": 10, "twelve": 12, "fifteen": 15, "twenty": 20, "thirty": 30, "forty": 40,
+	"fifty": 50, "sixty": 60, "hundred": 100,
+}
+
+// dayWords maps day names to the short form used in ParsedHabit.Schedule.
+var dayWords = map[string]string{
+	"monday": "mon", "mondays": "mon", "tuesday": "tue", "tuesdays": "tue", "wednesday": "wed",
+	"wednesdays": "wed", "thursday": "thu", "thursdays": "thu", "friday": "fri", "fridays": "fri",
+	"saturday": "sat", "saturdays": "sat", "sunday": "sun", "sundays": "sun",
+}
+
+// dayOrder is the order days are listed in.
+var dayOrder = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// partOfDay maps words like "morning" to the reminder time they stand for.
+var partOfDay = map[string]string{
+	"morning": "08:00", "mornings": "08:00", "noon": "12:00", "lunch": "12:00", "afternoon": "15:00",
+	"afternoons": "15:00", "evening": "19:00", "evenings": "19:00", "night": "21:00", "tonight": "21:00",
+}
+
+// fillerWords are left out of a habit's name.
+var fillerWords = map[string]bool{
+	"i": true, "want": true, "to": true, "will": true, "should": true, "do": true, "a": true, "an": true,
+	"the": true, "please": true, "for": true, "my": true, "some": true, "about": true, "like": true,
+	"would": true, "id": true, "add": true, "habit": true, "x": true, "go": true,
+}
+
+// stopWords end a habit's name: what follows is about when, not what.
+var stopWords = map[string]bool{
+	"every": true, "each": true, "daily": true, "on": true, "at": true, "in": true, "before": true,
+	"after": true, "per": true, "weekdays": true, "weekday": true, "weekends": true, "weekend": true,
+	"day": true, "days": true, "today": true, "morning": true, "evening": true, "night": true,
+}
+
+// clockPattern finds times like "at 7", "at 7:30", "7am", "19:00".
+var clockPattern = regexp.MustCompile(`\b(?:at )?(\d{1,2})(?::(\d{2}))? ?(am|pm)\b|\bat (\d{1,2})(?::(\d{2}))?\b|\b(\d{1,2}):(\d{2})\b`)
+
+// clockTime turns hour, minutes and am/pm into "HH:MM" ("" if it isn't a time).
+func clockTime(hour, min, ampm string) string {
+	h, err := strconv.Atoi(hour)
+	if err != nil {
+		return ""
+	}
+	m := 0
+	if min != "" {
+		m, _ = strconv.Atoi(min)
+	}
+	switch {
+	case ampm == "pm" && h < 12:
+		h += 12
+	case ampm == "am" && h == 12:
+		h = 0
+	}
+	if h > 23 || m > 59 {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d", h, m)
+}
+
+// ParseHabitText reads a description with simple rules: the first number is the amount and the
+// word after it the unit; the words before the number (and an "of ..." after the unit) make the
+// name; "every weekday", "on mondays", "morning", "at 7am" give the schedule and reminder time.
+func ParseHabitText(text string) ParsedHabit {
+	p := ParsedHabit{Quantity: 1, Unit: "times", Schedule: "daily", Source: "rules"}
+	lower := strings.ToLower(strings.TrimSpace(text))
+
+	// The time first, then remove it so its numbers aren't read as the amount.
+	if m := clockPattern.FindStringSubmatch(lower); m != nil {
+		switch {
+		case m[1] != "":
+			p.ReminderTime = clockTime(m[1], m[2], m[3])
+		case m[4] != "":
+			p.ReminderTime = clockTime(m[4], m[5], "")
+		default:
+			p.ReminderTime = clockTime(m[6], m[7], "")
+		}
+		lower = strings.Replace(lower, m[0], " ", 1)
+	}
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	for i, w := range words {
+		words[i] = strings.ReplaceAll(w, "'", "")
+	}
+
+	var days []string
+	seen := make(map[string]bool)
+	for _, w := range words {
+		switch {
+		case w == "weekday" || w == "weekdays":
+			p.Schedule = "weekdays"
+		case w == "weekend" || w == "weekends":
+			p.Schedule = "weekends"
+		case dayWords[w] != "" && !seen[dayWords[w]]:
+			seen[dayWords[w]] = true
+		case partOfDay[w] != "" && p.ReminderTime == "":
+			p.ReminderTime = partOfDay[w]
+		}
+	}
+	for _, d := range dayOrder {
+		if seen[d] {
+			days = append(days, d)
+		}
+	}
+	if len(days) > 0 {
+		p.Schedule = strings.Join(days, ", ")
+	}
+
+	// The amount: the first number (or number word), and the unit after it.
+	at := -1
+	for i, w := range words {
+		if n, err := strconv.Atoi(w); err == nil && n > 0 {
+			p.Quantity, at = n, i
+			break
+		}
+		if n, ok := numberWords[w]; ok {
+			p.Quantity, at = n, i
+			break
+		}
+	}
+	var name []string
+	keep := func(ws []string) {
+		for _, w := range ws {
+			if stopWords[w] || dayWords[w] != "" || partOfDay[w] != "" {
+				return
+			}
+			if !fillerWords[w] {
+				name = append(name, w)
+			}
+		}
+	}
+	if at < 0 {
+		keep(words)
+	} else {
+		keep(words[:at])
+		rest := words[at+1:]
+		if len(rest) > 0 && rest[0] == "x" {
+			rest = rest[1:]
+		}
+		if len(rest) > 0 && !stopWords[rest[0]] && dayWords[rest[0]] == "" && partOfDay[rest[0]] == "" {
+			p.Unit = rest[0]
+			rest = rest[1:]
+			if len(rest) > 0 && rest[0] == "of" {
+				keep(rest[1:])
+			}
+		}
+	}
+	if len(name) == 0 && p.Unit != "times" {
+		name = []string{p.Unit}
+	}
+	if len(name) > 0 {
+		r := []rune(strings.Join(name, " "))
+		r[0] = unicode.ToUpper(r[0])
+		p.Name = string(r)
+	}
+	return p
+}
+
+// valid reports whether p can fill in the add-habit form.
+func (p ParsedHabit) valid() bool {
+	return p.Name != "" && p.Quantity > 0 && p.Quantity <= 999 && p.Unit != ""
+}
+
+// HandleParseHabit reads a description and sends it to the main page's add-habit form, filled in.
+// POST, Form: text=do 20 squats every weekday morning
+func HandleParseHabit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	text := strings.TrimSpace(r.FormValue("text"))
+	if text == "" || len([]rune(text)) > maxHabitTextChars {
+		http.Redirect(w, r, "/?error=describe#add-habit", http.StatusFound)
+		return
+	}
+	data, err := LoadDataWithoutHistory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p := ParseHabitText(text)
+	if key := openAIKey(data); key != "" {
+		if ai, err := ParseHabitWithAI(text, key); err == nil && ai.valid() {
+			p = ai
+		}
+	}
+	if !p.valid() {
+		http.Redirect(w, r, "/?error=describe#add-habit", http.StatusFound)
+		return
+	}
+	q := url.Values{
+		"draft":         {"1"},
+		"name":          {p.Name},
+		"quantity":      {strconv.Itoa(p.Quantity)},
+		"unit":          {p.Unit},
+		"schedule":      {p.Schedule},
+		"reminder_time": {p.ReminderTime},
+		"via":           {p.Source},
+	}
+	http.Redirect(w, r, "/?"+q.Encode()+"#add-habit", http.StatusFound)
+}
+
+// DraftFromQuery reads the filled-in form HandleParseHabit (or HandleAddHabit, for a duplicate
+// name) sent to the main page (nil if none).
+func DraftFromQuery(q url.Values) *ParsedHabit {
+	if q.Get("draft") != "1" {
+		return nil
+	}
+	p := &ParsedHabit{
+		Name:         strings.TrimSpace(q.Get("name")),
+		Unit:         strings.TrimSpace(q.Get("unit")),
+		Schedule:     q.Get("schedule"),
+		ReminderTime: q.Get("reminder_time"),
+		Source:       q.Get("via"),
+		Duplicate:    q.Get("duplicate") == "1",
+	}
+	p.Quantity, _ = strconv.Atoi(q.Get("quantity"))
+	if !p.valid() {
+		return nil
+	}
+	return p
+}
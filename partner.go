@@ -0,0 +1,186 @@
+// partner.go - Accountability partner check-ins. On the settings page you name a partner (an
+// email address and/or a webhook URL). For each habit you opt in under "Habit settings", the
+// partner hears about it when you miss it two days in a row, or when you break a streak of
+// 14 days or more. The messages are templates (text/template, like reminders.go) with the
+// variables .Habit, .Missed (days missed in a row) and .Streak (the streak that was broken).
+// The check runs once a day, for yesterday, from the reminder loop (RunReminders).
+// Private habits (privacy.go) never trigger an alert. Email needs SMTP_HOST (see notify.go).
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// partnerStreakThreshold is the shortest streak whose end is worth telling the partner about.
+const partnerStreakThreshold = 14
+
+const defaultPartnerMissTemplate = `Heads-up: I missed {{.Habit}} {{.Missed}} days in a row. A nudge would help!`
+const defaultPartnerStreakTemplate = `I just broke my {{.Streak}} day streak on {{.Habit}}. Help me get back on track?`
+
+// PartnerVars are the variables a partner message template can use.
+type PartnerVars struct {
+	Habit  string
+	Missed int
+	Streak int
+}
+
+// RenderPartnerMessage fills in text (or def when text is empty) with vars.
+func RenderPartnerMessage(text, def string, vars PartnerVars) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		text = def
+	}
+	t, err := template.New("partner").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, vars); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// partnerNotifiers returns the channels that reach the partner (none if no partner is set).
+func partnerNotifiers(s Settings) []Notifier {
+	var out []Notifier
+	if s.PartnerWebhook != "" {
+		out = append(out, webhookNotifier{url: s.PartnerWebhook})
+	}
+	if s.PartnerEmail != "" {
+		if n, ok := smtpNotifier(s.PartnerEmail); ok { // without SMTP_HOST there's no email
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// partnerAlert returns the message for h about day, or "" if there's nothing to tell: the habit
+// was done (or excused), or this isn't the second miss in a row or the end of a long streak.
+func partnerAlert(data *AppData, h *Habit, day string) string {
+	if !habitMissedOn(data, h, day) {
+		return ""
+	}
+	t, err := ParseDate(day)
+	if err != nil {
+		return ""
+	}
+	before := t.AddDate(0, 0, -1).Format(dateLayout)
+	s := data.Settings
+	var msg string
+	if streak := streakEndingOn(data, h.ID, before); streak >= partnerStreakThreshold {
+		msg, err = RenderPartnerMessage(s.PartnerStreakTemplate, defaultPartnerStreakTemplate, PartnerVars{Habit: h.Name, Streak: streak})
+	} else if habitMissedOn(data, h, before) && !habitMissedOn(data, h, t.AddDate(0, 0, -2).Format(dateLayout)) {
+		msg, err = RenderPartnerMessage(s.PartnerMissTemplate, defaultPartnerMissTemplate, PartnerVars{Habit: h.Name, Missed: 2})
+	}
+	if err != nil {
+		log.Printf("partner template: %v", err)
+		return ""
+	}
+	return msg
+}
+
+// SendPartnerAlerts tells the partner about yesterday's misses of the opted-in habits. Each habit
+// is checked once per day (data.PartnerCheckedOn). Returns how many alerts were sent.
+func SendPartnerAlerts(data *AppData, now time.Time) int {
+	notifiers := partnerNotifiers(data.Settings)
+	if len(notifiers) == 0 {
+		return 0
+	}
+	yesterday := now.AddDate(0, 0, -1).Format(dateLayout)
+	if data.PartnerCheckedOn == nil {
+		data.PartnerCheckedOn = make(map[int]string)
+	}
+	sent := 0
+	for _, h := range SharedHabits(data.Habits) {
+		if !h.NotifyPartner || data.PartnerCheckedOn[h.ID] == yesterday {
+			continue
+		}
+		data.PartnerCheckedOn[h.ID] = yesterday
+		msg := partnerAlert(data, &h, yesterday)
+		if msg == "" {
+			continue
+		}
+		for _, n := range notifiers {
+			if err := n.Send("Accountability check-in", msg); err != nil {
+				log.Printf("partner via %s: %v", n.Name(), err)
+			}
+		}
+		sent++
+	}
+	return sent
+}
+
+// HandlePartnerSettings handles POST from the settings page to set the partner and templates.
+// Form: partner_email=...&partner_webhook=...&partner_miss_template=...&partner_streak_template=...
+func HandlePartnerSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s := data.Settings
+	s.PartnerEmail = strings.TrimSpace(r.FormValue("partner_email"))
+	s.PartnerWebhook = strings.TrimSpace(r.FormValue("partner_webhook"))
+	s.PartnerMissTemplate = strings.TrimSpace(r.FormValue("partner_miss_template"))
+	s.PartnerStreakTemplate = strings.TrimSpace(r.FormValue("partner_streak_template"))
+	valid := (s.PartnerEmail == "" || strings.Contains(s.PartnerEmail, "@")) &&
+		(s.PartnerWebhook == "" || strings.HasPrefix(s.PartnerWebhook, "http://") || strings.HasPrefix(s.PartnerWebhook, "https://"))
+	// Render both templates once, so a typo shows up now rather than when a habit is missed.
+	vars := PartnerVars{Habit: "Workout", Missed: 2, Streak: 21}
+	if _, err := RenderPartnerMessage(s.PartnerMissTemplate, defaultPartnerMissTemplate, vars); err != nil {
+		valid = false
+	}
+	if _, err := RenderPartnerMessage(s.PartnerStreakTemplate, defaultPartnerStreakTemplate, vars); err != nil {
+		valid = false
+	}
+	if !valid {
+		http.Redirect(w, r, "/settings?error=partner#partner", http.StatusFound)
+		return
+	}
+	data.Settings = s
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?partner=1#partner", http.StatusFound)
+}
+
+// HandleHabitPartner handles POST to opt a habit in or out of partner alerts.
+// Form: habit_id=1&notify_partner=1
+func HandleHabitPartner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.NotifyPartner = r.FormValue("notify_partner") == "1"
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?partner=1", http.StatusFound)
+}
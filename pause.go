@@ -0,0 +1,115 @@
+// pause.go - Pausing a habit for a while (an injury, a holiday, a busy month) without deleting it.
+// A paused habit keeps its target and history, but leaves today's list: it isn't reminded, gets
+// no miss penalties, its streak waits for it instead of breaking, and the week review leaves its
+// target alone. A pause starts today and lasts until a chosen day or until it is resumed.
+// After resuming, the paused days stay recorded (Pauses, every pause the habit had), so the
+// streak from before a pause still counts.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// PausePeriod is one pause of a habit, From to To (inclusive; To "" = until resumed).
+type PausePeriod struct {
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+}
+
+// covers reports whether the pause includes day.
+func (p PausePeriod) covers(day string) bool {
+	return day >= p.From && (p.To == "" || day <= p.To)
+}
+
+// PausedOn reports whether the habit was (or is) paused on day, in any of its pauses.
+func (h Habit) PausedOn(day string) bool {
+	for _, p := range h.Pauses {
+		if p.covers(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastPause is the habit's latest pause (the current one, while it's paused).
+func (h Habit) LastPause() PausePeriod {
+	if len(h.Pauses) == 0 {
+		return PausePeriod{}
+	}
+	return h.Pauses[len(h.Pauses)-1]
+}
+
+// PauseHabit pauses h from today until the day until ("" = until resumed). Pausing again while
+// paused changes the end of the current pause; earlier pauses are kept. It returns an error
+// code for the page: "" on success, "pause" if until is not a date from today on.
+func PauseHabit(h *Habit, until, today string) string {
+	if until != "" {
+		if _, err := ParseDate(until); err != nil || until < today {
+			return "pause"
+		}
+	}
+	if n := len(h.Pauses); n > 0 && h.Pauses[n-1].covers(today) {
+		h.Pauses[n-1].To = until
+	} else {
+		h.Pauses = append(h.Pauses, PausePeriod{From: today, To: until})
+	}
+	return ""
+}
+
+// ResumeHabit ends h's current pause: today counts again. A pause that hadn't started any days
+// before today is simply forgotten; earlier pauses stay as they were.
+func ResumeHabit(h *Habit, today string) {
+	yesterday := today
+	if t, err := ParseDate(today); err == nil {
+		yesterday = t.AddDate(0, 0, -1).Format(dateLayout)
+	}
+	n := len(h.Pauses)
+	if n == 0 {
+		return
+	}
+	last := &h.Pauses[n-1]
+	if last.From > yesterday {
+		h.Pauses = h.Pauses[:n-1]
+	} else if last.To == "" || last.To >= today {
+		last.To = yesterday
+	}
+}
+
+// HandlePauseHabit handles POST to pause or resume a habit.
+// Form: habit_id=1&until=2025-02-14 (optional) to pause, habit_id=1&resume=1 to resume.
+func HandlePauseHabit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	flag := "paused=1"
+	if r.FormValue("resume") == "1" {
+		ResumeHabit(habit, Today())
+		flag = "resumed=1"
+	} else if code := PauseHabit(habit, r.FormValue("until"), Today()); code != "" {
+		http.Redirect(w, r, "/?error="+code, http.StatusFound)
+		return
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?"+flag, http.StatusFound)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+// TestPauseTwiceKeepsFirstPause pauses a habit, resumes it, and pauses it again: the first
+// pause's days must still bridge the streak.
+func TestPauseTwiceKeepsFirstPause(t *testing.T) {
+	data := &AppData{History: make(map[string]DayRecord), Habits: []Habit{{ID: 1, Name: "Run", Quantity: 1}}}
+	h := &data.Habits[0]
+	for _, day := range []string{"2026-03-01", "2026-03-02", "2026-03-03"} {
+		SetHabitCompleted(data, 1, day, true)
+	}
+	if code := PauseHabit(h, "", "2026-03-04"); code != "" {
+		t.Fatalf("first pause: %q", code)
+	}
+	ResumeHabit(h, "2026-03-06") // paused on the 4th and 5th
+	for _, day := range []string{"2026-03-06", "2026-03-07"} {
+		SetHabitCompleted(data, 1, day, true)
+	}
+	if code := PauseHabit(h, "2026-03-20", "2026-03-08"); code != "" {
+		t.Fatalf("second pause: %q", code)
+	}
+
+	want := []PausePeriod{{From: "2026-03-04", To: "2026-03-05"}, {From: "2026-03-08", To: "2026-03-20"}}
+	if len(h.Pauses) != len(want) || h.Pauses[0] != want[0] || h.Pauses[1] != want[1] {
+		t.Fatalf("pauses = %+v, want %+v", h.Pauses, want)
+	}
+	for day, paused := range map[string]bool{"2026-03-03": false, "2026-03-04": true, "2026-03-05": true, "2026-03-06": false, "2026-03-08": true, "2026-03-21": false} {
+		if got := h.PausedOn(day); got != paused {
+			t.Errorf("PausedOn(%s) = %v, want %v", day, got, paused)
+		}
+	}
+	if got := streakEndingOn(data, 1, "2026-03-07"); got != 5 {
+		t.Errorf("streak across the first pause = %d, want 5", got)
+	}
+}
+
+// TestPauseAgainWhilePaused changes the end of the current pause instead of adding one.
+func TestPauseAgainWhilePaused(t *testing.T) {
+	h := &Habit{ID: 1}
+	PauseHabit(h, "2026-03-10", "2026-03-01")
+	PauseHabit(h, "2026-03-15", "2026-03-05")
+	if len(h.Pauses) != 1 || h.Pauses[0] != (PausePeriod{From: "2026-03-01", To: "2026-03-15"}) {
+		t.Fatalf("pauses = %+v, want one pause from the 1st to the 15th", h.Pauses)
+	}
+}
@@ -0,0 +1,346 @@
+// photos.go - Photos as proof: a progress picture, the meal you cooked, the page you read. A photo
+// is uploaded with the 📷 form under a habit, which also marks the habit done for today (like the
+// Done button, with the same week review and chain checks). The files are kept in the photo
+// store (blobs.go): UPLOADS_DIR (default ./uploads), one folder per habit, or an S3 bucket. The
+// day's DayRecord lists them (Photos), so they go along with backups and sync as names only.
+// The habit's page (/habit?id=1) shows them by day.
+//
+// Only JPEG, PNG, GIF and WebP are accepted, told apart by their first bytes rather than the
+// file name, up to PHOTO_MAX_MB (default 10) each. Photos of private habits (privacy.go) never
+// leave the app: they're left out wherever the history is shared.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Photo is one uploaded picture of a habit on a day.
+type Photo struct {
+	Name string    `json:"name"` // its key in the habit's folder of the photo store
+	At   time.Time `json:"at"`
+}
+
+// photoTypes maps the image types we accept to the extension their files get.
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// photoName matches the names savePhoto gives files, so a request can't reach anything else.
+var photoName = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-[A-Za-z0-9_-]+\.(jpg|png|gif|webp)$`)
+
+// errPhotoFile says what's wrong with an upload, for the page.
+var errPhotoFile = errors.New("upload a JPEG, PNG, GIF or WebP photo")
+
+// uploadsDir is where photos are kept: UPLOADS_DIR, or ./uploads.
+func uploadsDir() string {
+	if dir := os.Getenv("UPLOADS_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+// maxPhotoBytes is the largest photo accepted: PHOTO_MAX_MB, default 10.
+func maxPhotoBytes() int64 {
+	return int64(envInt("PHOTO_MAX_MB", 10)) << 20
+}
+
+// photoBlobs is the store photos are kept in (blobs.go).
+func photoBlobs() BlobStore {
+	return newBlobStore(uploadsDir(), "photos/")
+}
+
+// photoKey is the key of the photo called name of habitID in the store.
+func photoKey(habitID int, name string) string {
+	return strconv.Itoa(habitID) + "/" + name
+}
+
+// savePhoto checks the image in file and writes it to habitID's folder, named after day. It
+// returns errPhotoFile for anything that isn't an accepted image or is too large.
+func savePhoto(file io.Reader, habitID int, day string) (string, error) {
+	// Read one byte more than allowed, to notice a file that's too large.
+	content, err := io.ReadAll(io.LimitReader(file, maxPhotoBytes()+1))
+	if err != nil {
+		return "", err
+	}
+	contentType := http.DetectContentType(content)
+	ext, ok := photoTypes[contentType]
+	if !ok || int64(len(content)) > maxPhotoBytes() || len(content) == 0 {
+		return "", errPhotoFile
+	}
+	name := day + "-" + newQuickToken()[:12] + ext
+	return name, photoBlobs().Put(photoKey(habitID, name), content, contentType)
+}
+
+// AddPhoto records a saved photo of habitID on date.
+func AddPhoto(data *AppData, habitID int, date, name string, at time.Time) {
+	rec := data.History[date]
+	rec.Date = date
+	if rec.Photos == nil {
+		rec.Photos = make(map[int][]Photo)
+	}
+	rec.Photos[habitID] = append(rec.Photos[habitID], Photo{Name: name, At: at})
+	data.History[date] = rec
+}
+
+// RemovePhoto forgets the photo called name of habitID on date. It reports false if there's no
+// such photo. The file stays until deletePhotoFile, once the data without it is saved.
+func RemovePhoto(data *AppData, habitID int, date, name string) bool {
+	rec, ok := data.History[date]
+	if !ok {
+		return false
+	}
+	list := rec.Photos[habitID]
+	for i, p := range list {
+		if p.Name != name {
+			continue
+		}
+		if len(list) == 1 {
+			delete(rec.Photos, habitID)
+		} else {
+			rec.Photos[habitID] = append(list[:i:i], list[i+1:]...)
+		}
+		data.History[date] = rec
+		return true
+	}
+	return false
+}
+
+// deletePhotoFile deletes the file of habitID's photo called name. A file left behind only
+// takes space, so a failure is logged rather than shown.
+func deletePhotoFile(habitID int, name string) {
+	if err := photoBlobs().Delete(photoKey(habitID, name)); err != nil {
+		log.Println("removing photo:", err)
+	}
+}
+
+// containsPhoto reports whether list has a photo called name.
+func containsPhoto(list []Photo, name string) bool {
+	for _, p := range list {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PhotoDay is one day in a habit's gallery.
+type PhotoDay struct {
+	Date   string
+	Photos []Photo
+}
+
+// HabitPhotos returns h's photos by day, newest day first.
+func HabitPhotos(data *AppData, habitID int) []PhotoDay {
+	var days []PhotoDay
+	for date, rec := range data.History {
+		if list := rec.Photos[habitID]; len(list) > 0 {
+			days = append(days, PhotoDay{Date: date, Photos: list})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date > days[j].Date })
+	return days
+}
+
+// HandleHabitPhoto handles POST /habit-photo: saves a photo of a habit for today and marks the
+// habit done, if it isn't yet. Form (multipart): habit_id=1, photo=<image>, back=habit (optional,
+// return to the habit's page instead of the main page)
+func HandleHabitPhoto(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoBytes()+1<<20) // room for the other fields
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	// Where to go afterwards, with the outcome added to the query.
+	back := "/?"
+	if r.FormValue("back") == "habit" {
+		back = "/habit?id=" + strconv.Itoa(habitID) + "&"
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	today := Today()
+	done := containsInt(data.History[today].CompletedHabits, habitID)
+	if !done {
+		// Like the Done button: a due week review and unfinished prerequisites come first.
+		if redirect := completionRedirect(data, habit, today); redirect != "" {
+			http.Redirect(w, r, redirect, http.StatusFound)
+			return
+		}
+	}
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		http.Redirect(w, r, back+"error=photo", http.StatusFound)
+		return
+	}
+	defer file.Close()
+	name, err := savePhoto(file, habitID, today)
+	if err == errPhotoFile {
+		http.Redirect(w, r, back+"error=photo", http.StatusFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	AddPhoto(data, habitID, today, name, time.Now())
+	if !done {
+		SetHabitCompleted(data, habitID, today, true)
+	}
+	if err := SaveData(data); err != nil {
+		deletePhotoFile(habitID, name) // nothing refers to it
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, back+"photo=1", http.StatusFound)
+}
+
+// HandleDeletePhoto handles POST /habit-photo/delete. Form: habit_id=1&date=2025-03-01&name=...
+func HandleDeletePhoto(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := r.FormValue("name")
+	if !RemovePhoto(data, habitID, r.FormValue("date"), name) {
+		http.Redirect(w, r, "/habit?id="+strconv.Itoa(habitID)+"&error=notfound", http.StatusFound)
+		return
+	}
+	// Only once the data no longer lists it: if saving fails, the photo is still there.
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	deletePhotoFile(habitID, name)
+	http.Redirect(w, r, "/habit?id="+strconv.Itoa(habitID)+"&deleted=1", http.StatusFound)
+}
+
+// HandlePhotoFile handles GET /photos/{habit ID}/{name}: the picture itself.
+func HandlePhotoFile(w http.ResponseWriter, r *http.Request) {
+	idStr, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/photos/"), "/")
+	habitID, err := strconv.Atoi(idStr)
+	if err != nil || !photoName.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := photoBlobs().Get(photoKey(habitID, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(content))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable") // names never change
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// HabitPageData is what habit.html gets.
+type HabitPageData struct {
+	Settings  Settings
+	Revision  int64 // sent back with the forms (revision.go)
+	Dates     DateStyle
+	Habit     Habit
+	Streak    int
+	DoneDays  int
+	Days      []PhotoDay
+	MaxMB     int
+	Household HouseholdView // the members who share it (household.go)
+	Message   string
+}
+
+// HandleHabitPage handles GET /habit?id=1: one habit's page with its notes and photos.
+func HandleHabitPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	pd := HabitPageData{
+		Settings:  data.Settings,
+		Revision:  data.Revision,
+		Dates:     data.Settings.Dates(),
+		Habit:     *habit,
+		Streak:    GetStreakForHabit(data, habitID),
+		Days:      HabitPhotos(data, habitID),
+		MaxMB:     int(maxPhotoBytes() >> 20),
+		Household: NewHouseholdView(data, *habit),
+	}
+	for _, rec := range data.History {
+		if containsInt(rec.CompletedHabits, habitID) {
+			pd.DoneDays++
+		}
+	}
+	switch {
+	case r.URL.Query().Get("photo") == "1":
+		pd.Message = "Photo saved."
+	case r.URL.Query().Get("deleted") == "1":
+		pd.Message = "Photo deleted."
+	case r.URL.Query().Get("error") == "photo":
+		pd.Message = fmt.Sprintf("Upload a JPEG, PNG, GIF or WebP photo of up to %d MB.", pd.MaxMB)
+	case r.URL.Query().Get("error") == "notfound":
+		pd.Message = "Photo not found."
+	case r.URL.Query().Get("household") == "1":
+		pd.Message = "Member added. Send them their link."
+	case r.URL.Query().Get("household") == "removed":
+		pd.Message = "Member removed. Their link no longer works."
+	case r.URL.Query().Get("error") == "household":
+		pd.Message = "Enter a name of up to 40 characters that isn't taken. Private habits can't be shared."
+	}
+	if err := tmpl.ExecuteTemplate(w, "habit.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,231 @@
+// plan.go - The plan for the day (/today): a compact checklist of today's habits (those with
+// their own reminder time first, in time order), the todos due today or overdue, and one
+// sentence on what to focus on. With an OpenAI key the sentence is the AI coach's
+// (SuggestFocus in openai.go, sent only non-private habits); without one a simple rule picks it:
+// the longest streak at stake, else an overdue todo. It's worked out once a day and kept in
+// data.DayFocus. The page prints on one sheet. If a morning plan time is set under Settings,
+// the same plan is sent as a notification then.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DayFocus is the focus sentence worked out for Day.
+type DayFocus struct {
+	Day  string `json:"day"`
+	Text string `json:"text"`
+	ByAI bool   `json:"by_ai,omitempty"`
+}
+
+// PlanHabit is one habit on the plan.
+type PlanHabit struct {
+	Habit
+	Time   string // its own reminder time, "" if it has none
+	Done   bool
+	Streak int
+}
+
+// PlanTodo is one todo on the plan.
+type PlanTodo struct {
+	Todo
+	Overdue bool
+}
+
+// TodayPlanData is what today.html gets.
+type TodayPlanData struct {
+	Settings Settings
+	Dates    DateStyle
+	Today    string
+	Focus    DayFocus
+	Habits   []PlanHabit
+	Todos    []PlanTodo
+	Left     int // habits not done yet
+}
+
+// BuildTodayPlan collects the plan for now's day. Paused and skipped habits aren't on it.
+func BuildTodayPlan(data *AppData, now time.Time) TodayPlanData {
+	today := now.Format(dateLayout)
+	rec := data.History[today]
+	pd := TodayPlanData{Settings: data.Settings, Dates: data.Settings.Dates(), Today: today}
+	for _, h := range data.Habits {
+		if h.PausedOn(today) || containsInt(rec.SkippedHabits, h.ID) {
+			continue
+		}
+		ph := PlanHabit{Habit: h, Time: h.ReminderTime, Done: containsInt(rec.CompletedHabits, h.ID), Streak: GetStreakForHabit(data, h.ID)}
+		if !ph.Done {
+			pd.Left++
+		}
+		pd.Habits = append(pd.Habits, ph)
+	}
+	// Habits with a time first, earliest first; the others keep their order after them.
+	sort.SliceStable(pd.Habits, func(i, j int) bool {
+		a, b := pd.Habits[i].Time, pd.Habits[j].Time
+		return a != "" && (b == "" || a < b)
+	})
+	for _, t := range data.Todos {
+		if t.DueDate != "" && t.DueDate <= today {
+			pd.Todos = append(pd.Todos, PlanTodo{Todo: t, Overdue: IsOverdue(t, today)})
+		}
+	}
+	return pd
+}
+
+// focusWithoutAI picks the focus sentence by rule: the longest streak still open today, else the
+// first overdue todo, else the first habit left.
+func focusWithoutAI(pd TodayPlanData) string {
+	var best *PlanHabit
+	for i, h := range pd.Habits {
+		if !h.Done && h.Streak >= 3 && (best == nil || h.Streak > best.Streak) {
+			best = &pd.Habits[i]
+		}
+	}
+	if best != nil {
+		return fmt.Sprintf("Keep your %d-day %s streak going: do it first.", best.Streak, best.Name)
+	}
+	for _, t := range pd.Todos {
+		if t.Overdue {
+			return fmt.Sprintf("Clear the overdue “%s” before anything new.", t.Text)
+		}
+	}
+	for _, h := range pd.Habits {
+		if !h.Done {
+			return fmt.Sprintf("Start with %s: %d %s.", h.Name, h.Quantity, h.Unit)
+		}
+	}
+	return "Nothing left on the plan: a good day to get ahead on a todo."
+}
+
+// TodayFocus returns the focus sentence for pd's day, working it out if data has none for the
+// day yet. It reports whether data.DayFocus changed (and needs saving).
+func TodayFocus(data *AppData, pd TodayPlanData) (DayFocus, bool) {
+	if data.DayFocus != nil && data.DayFocus.Day == pd.Today {
+		return *data.DayFocus, false
+	}
+	focus := DayFocus{Day: pd.Today, Text: focusWithoutAI(pd)}
+	if key := openAIKey(data); key != "" {
+		// Private habits (privacy.go) are not sent to OpenAI.
+		var open []Habit
+		streaks := make(map[int]int)
+		for _, h := range pd.Habits {
+			if !h.Done && !h.Private {
+				open = append(open, h.Habit)
+				streaks[h.ID] = h.Streak
+			}
+		}
+		var todos []Todo
+		for _, t := range pd.Todos {
+			todos = append(todos, t.Todo)
+		}
+		if text, err := SuggestFocus(open, streaks, todos, pd.Today, key); err != nil {
+			log.Println("focus suggestion:", err)
+		} else {
+			focus.Text, focus.ByAI = text, true
+		}
+	}
+	data.DayFocus = &focus
+	return focus, true
+}
+
+// morningPlanMessage writes the plan as a notification, with a link to the page.
+func morningPlanMessage(pd TodayPlanData) string {
+	var sb strings.Builder
+	sb.WriteString(pd.Focus.Text + "\n")
+	if len(pd.Habits) > 0 {
+		sb.WriteString("\nHabits:\n")
+		for _, h := range pd.Habits {
+			line := fmt.Sprintf("- %s: %d %s", h.Name, h.Quantity, h.Unit)
+			if h.Time != "" {
+				line = fmt.Sprintf("- %s %s: %d %s", h.Time, h.Name, h.Quantity, h.Unit)
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+	if len(pd.Todos) > 0 {
+		sb.WriteString("\nTodos due:\n")
+		for _, t := range pd.Todos {
+			line := "- " + t.Text
+			if t.Overdue {
+				line += " (overdue)"
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String() + "\n" + publicURL() + "/today"
+}
+
+// SendMorningPlan sends the day's plan once its time has come (Settings.MorningPlanTime),
+// unless it's turned off. data.LastMorningPlanDate makes sure it goes out once a day.
+func SendMorningPlan(data *AppData, now time.Time) bool {
+	at, err := time.Parse("15:04", data.Settings.MorningPlanTime)
+	today := now.Format(dateLayout)
+	if err != nil || data.LastMorningPlanDate == today {
+		return false
+	}
+	if now.Before(time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())) {
+		return false
+	}
+	pd := BuildTodayPlan(data, now)
+	pd.Focus, _ = TodayFocus(data, pd)
+	if err := Notify("Plan for today", morningPlanMessage(pd)); err != nil {
+		return false // try again next minute
+	}
+	data.LastMorningPlanDate = today
+	return true
+}
+
+// HandleTodayPlan handles GET /today: the day's plan as a checklist.
+func HandleTodayPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := BuildTodayPlan(data, time.Now())
+	var changed bool
+	pd.Focus, changed = TodayFocus(data, pd)
+	if changed {
+		// Keep the sentence for the rest of the day; the plan still shows if saving fails.
+		if err := SaveData(data); err != nil {
+			log.Println("today plan:", err)
+		}
+	}
+	if err := tmpl.ExecuteTemplate(w, "today.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleMorningPlanSettings handles POST from the settings page to set the time of the morning
+// plan notification (empty = off). Form: morning_plan_time=07:00
+func HandleMorningPlanSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	at := strings.TrimSpace(r.FormValue("morning_plan_time"))
+	if _, err := time.Parse("15:04", at); err != nil && at != "" {
+		http.Redirect(w, r, "/settings?error=morningplan#morning-plan", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Settings.MorningPlanTime = at
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?morningplan=1#morning-plan", http.StatusFound)
+}
@@ -0,0 +1,153 @@
+// privacy.go - Private habits. A habit marked Private only shows up in your own session (the web
+// pages, your notifications, your backups). Every view that other people can see leaves it out:
+// the Discord channel (discord.go) and archives made with -shareable (archive.go). New shared
+// views should read habits through SharedHabits / SharedHistory too.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// SharedHabits returns the habits that may be shown to others (all but the private ones).
+func SharedHabits(habits []Habit) []Habit {
+	var out []Habit
+	for _, h := range habits {
+		if !h.Private {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// PrivateHabitIDs returns the IDs of the private habits, for filtering history records.
+func PrivateHabitIDs(data *AppData) map[int]bool {
+	ids := make(map[int]bool)
+	for _, h := range data.Habits {
+		if h.Private {
+			ids[h.ID] = true
+		}
+	}
+	return ids
+}
+
+// StripPrivate returns a copy of rec without anything about the habits in private.
+func StripPrivate(rec DayRecord, private map[int]bool) DayRecord {
+	keep := func(ids []int) []int {
+		var out []int
+		for _, id := range ids {
+			if !private[id] {
+				out = append(out, id)
+			}
+		}
+		return out
+	}
+	rec.CompletedHabits = keep(rec.CompletedHabits)
+	rec.PenaltyAppliedForHabits = keep(rec.PenaltyAppliedForHabits)
+	rec.SkippedHabits = keep(rec.SkippedHabits)
+	keepMap := func(m map[int]int) map[int]int {
+		if m == nil {
+			return nil
+		}
+		out := make(map[int]int)
+		for id, v := range m {
+			if !private[id] {
+				out[id] = v
+			}
+		}
+		return out
+	}
+	rec.MinutesLogged = keepMap(rec.MinutesLogged)
+	rec.PenaltyAmounts = keepMap(rec.PenaltyAmounts)
+	if rec.CheckIns != nil {
+		checkIns := make(map[int][]CheckIn)
+		for id, list := range rec.CheckIns {
+			if !private[id] {
+				checkIns[id] = list
+			}
+		}
+		rec.CheckIns = checkIns
+	}
+	if rec.Photos != nil {
+		photos := make(map[int][]Photo)
+		for id, list := range rec.Photos {
+			if !private[id] {
+				photos[id] = list
+			}
+		}
+		rec.Photos = photos
+	}
+	if rec.CompletionSources != nil {
+		sources := make(map[int]string)
+		for id, s := range rec.CompletionSources {
+			if !private[id] {
+				sources[id] = s
+			}
+		}
+		rec.CompletionSources = sources
+	}
+	// Reviews are kept, but without private habits, and the reflection is for you only.
+	stripReview := func(r *WeekReview) *WeekReview {
+		if r == nil {
+			return nil
+		}
+		out := &WeekReview{}
+		for _, d := range r.Decisions {
+			if !private[d.HabitID] {
+				out.Decisions = append(out.Decisions, d)
+			}
+		}
+		return out
+	}
+	rec.WeekReview = stripReview(rec.WeekReview)
+	rec.MonthReview = stripReview(rec.MonthReview)
+	rec.QuarterReview = stripReview(rec.QuarterReview)
+	return rec
+}
+
+// sharedHistory is a HistorySource (history.go) that hides the private habits of another one.
+type sharedHistory struct {
+	src     HistorySource
+	private map[int]bool
+}
+
+// SharedHistory wraps src so the days it yields say nothing about the private habits.
+func SharedHistory(src HistorySource, private map[int]bool) HistorySource {
+	return sharedHistory{src: src, private: private}
+}
+
+func (s sharedHistory) Days(from, to string, fn func(DayRecord) bool) error {
+	return s.src.Days(from, to, func(rec DayRecord) bool {
+		return fn(StripPrivate(rec, s.private))
+	})
+}
+
+// HandleHabitPrivacy handles POST to mark a habit private or shared. Form: habit_id=1&private=1
+func HandleHabitPrivacy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.Private = r.FormValue("private") == "1"
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?privacy=1", http.StatusFound)
+}
@@ -0,0 +1,39 @@
+// profiling.go - Go's profiler (net/http/pprof) for finding out where the time goes on a
+// running instance, e.g. while load-testing a big dataset (seed.go). It's off unless .env has
+//
+//	PPROF=1
+//	ADMIN_TOKEN=...
+//
+// and then every request under /debug/pprof/ needs the admin token (as for /admin/reset):
+//
+//	curl -H "Authorization: Bearer $ADMIN_TOKEN" -o cpu.pprof "http://localhost:8080/debug/pprof/profile?seconds=30"
+//	go tool pprof -http :9090 cpu.pprof
+//
+// net/http/pprof adds its pages to the default multiplexer as soon as it's imported, so
+// GuardProfiling turns them away rather than leaving them out.
+
+package main
+
+import (
+	"net/http"
+	_ "net/http/pprof" // the /debug/pprof/ pages
+	"os"
+	"strings"
+)
+
+// profilingEnabled reports whether PPROF=1 is set in .env.
+func profilingEnabled() bool {
+	return os.Getenv("PPROF") == "1"
+}
+
+// GuardProfiling answers 404 for /debug/pprof/ unless profiling is on and the request carries
+// ADMIN_TOKEN. Everything else goes to next.
+func GuardProfiling(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/pprof") && !(profilingEnabled() && adminAuthorized(r)) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
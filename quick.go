@@ -0,0 +1,130 @@
+// quick.go - One-tap quick-log links. Each link is a secret URL for one habit:
+//
+//	http://homeserver:8080/quick/3q2-VZb1...
+//
+// Opening it (a plain GET) marks the habit done for today, so it works from a phone home-screen
+// shortcut or an NFC tag. The token in the URL is the only thing protecting it, so links are
+// made and revoked on the /settings page. Quick links skip the habit's confirmation mode
+// (confirm.go): tapping a dedicated shortcut is already the deliberate action.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newQuickToken returns a random, URL-safe token (128 bits, so it can't be guessed).
+func newQuickToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// FindQuickToken returns the quick-log token with the given value, or nil.
+func FindQuickToken(data *AppData, token string) *QuickToken {
+	for i := range data.QuickTokens {
+		if data.QuickTokens[i].Token == token {
+			return &data.QuickTokens[i]
+		}
+	}
+	return nil
+}
+
+// QuickLinkURL is the full URL to put in a shortcut or on an NFC tag.
+func QuickLinkURL(token string) string {
+	return publicURL() + "/quick/" + token
+}
+
+// QuickPageData is what quick.html shows after a tap.
+type QuickPageData struct {
+	Settings Settings
+	Title    string
+	Message  string
+}
+
+// HandleQuickLog handles GET /quick/{token}: marks the token's habit done for today.
+// Opening it twice is harmless; the second time it just says the habit is already done.
+func HandleQuickLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/quick/")
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The page changes data, so browsers and the service worker must never serve it from cache.
+	w.Header().Set("Cache-Control", "no-store")
+	pd := QuickPageData{Settings: data.Settings}
+	qt := FindQuickToken(data, token)
+	var habit *Habit
+	if qt != nil {
+		habit = FindHabitByID(data, qt.HabitID)
+	}
+	if habit == nil {
+		w.WriteHeader(http.StatusNotFound)
+		pd.Title = "Link not valid"
+		pd.Message = "This quick-log link was revoked or its habit was deleted."
+	} else {
+		today := Today()
+		pd.Title = habit.Name
+		if containsInt(data.History[today].CompletedHabits, habit.ID) {
+			pd.Message = "Already done today. 🎉"
+		} else if msg := completionBlocked(data, habit, today); msg != "" {
+			pd.Message = msg + "."
+		} else {
+			SetHabitCompleted(data, habit.ID, today, true)
+			qt.LastUsed = time.Now()
+			if err := SaveData(data); err != nil {
+				saveFailed(w, err)
+				return
+			}
+			pd.Message = "Done for today: " + strconv.Itoa(habit.Quantity) + " " + habit.Unit + ". 🎉"
+		}
+	}
+	if err := tmpl.ExecuteTemplate(w, "quick.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleQuickTokens handles POST from the settings page to create or revoke a quick-log link.
+// Form: habit_id=3 (create) or revoke=<token>
+func HandleQuickTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if revoke := r.FormValue("revoke"); revoke != "" {
+		var kept []QuickToken
+		for _, qt := range data.QuickTokens {
+			if qt.Token != revoke {
+				kept = append(kept, qt)
+			}
+		}
+		data.QuickTokens = kept
+	} else {
+		habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+		if err != nil || FindHabitByID(data, habitID) == nil {
+			http.Redirect(w, r, "/settings?error=notfound", http.StatusFound)
+			return
+		}
+		data.QuickTokens = append(data.QuickTokens, QuickToken{Token: newQuickToken(), HabitID: habitID, CreatedAt: time.Now()})
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?quick=1#quick-links", http.StatusFound)
+}
@@ -0,0 +1,360 @@
+// reminders.go - Daily habit reminders. At each habit's reminder time (its own ReminderTime, or
+// REMINDER_TIME in .env, default 20:00) a habit that isn't done yet gets a reminder through the
+// notification engine (notify.go). Every reminder has a link to snooze it for 30 minutes.
+// The text comes from the habit's own reminder template, so every habit can speak differently:
+//
+//	{{.Name}} time! {{.Quantity}} {{.Unit}} keeps your {{.Streak}} day streak alive. {{.Motivation}}
+//
+// Templates use Go's text/template syntax. Available variables: .Name, .Quantity, .Unit,
+// .Streak and .Motivation (the habit's "why", also set per habit).
+//
+// A habit can send its reminder to one channel only (ReminderVia, e.g. "push"), and escalate to a
+// second one (EscalateVia, e.g. "telegram") when it's still not done two hours after the
+// reminder went out. data.ReminderLog keeps, per habit, the day, time and channels of its last
+// reminder and whether it was escalated.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// escalateAfter is how long a reminded habit can stay open before the reminder is escalated.
+const escalateAfter = 2 * time.Hour
+
+// ReminderDelivery is the state of a habit's reminder on Day: when and where it went out
+// (SentAt, Via) and the channel it was escalated to, if it was.
+type ReminderDelivery struct {
+	Day          string    `json:"day"`
+	SentAt       time.Time `json:"sent_at,omitempty"`
+	Via          []string  `json:"via,omitempty"`
+	EscalatedVia string    `json:"escalated_via,omitempty"`
+}
+
+// defaultReminderTemplate is used for habits without their own template.
+const defaultReminderTemplate = `Don't forget {{.Name}} today: {{.Quantity}} {{.Unit}}.{{if .Streak}} You're on a {{.Streak}} day streak!{{end}}{{if .Motivation}} Remember why: {{.Motivation}}{{end}}`
+
+// ReminderVars are the variables a reminder template can use.
+type ReminderVars struct {
+	Name       string
+	Quantity   int
+	Unit       string
+	Streak     int
+	Motivation string
+}
+
+// RenderReminder fills in the habit's reminder template (or the default one).
+func RenderReminder(h Habit, streak int) (string, error) {
+	text := h.ReminderTemplate
+	if strings.TrimSpace(text) == "" {
+		text = defaultReminderTemplate
+	}
+	t, err := template.New("reminder").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	vars := ReminderVars{Name: h.Name, Quantity: h.Quantity, Unit: h.Unit, Streak: streak, Motivation: h.Motivation}
+	if err := t.Execute(&sb, vars); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// reminderClock returns today's reminder time from REMINDER_TIME ("HH:MM", default 20:00).
+func reminderClock(now time.Time) time.Time {
+	hh, mm := 20, 0
+	if t, err := time.Parse("15:04", os.Getenv("REMINDER_TIME")); err == nil {
+		hh, mm = t.Hour(), t.Minute()
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), hh, mm, 0, 0, now.Location())
+}
+
+// habitReminderClock returns when today's reminder for h is due: its own ReminderTime, or
+// REMINDER_TIME for habits without one.
+func habitReminderClock(h Habit, now time.Time) time.Time {
+	if t, err := time.Parse("15:04", h.ReminderTime); err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	}
+	return reminderClock(now)
+}
+
+// reminderMessage renders h's reminder, falling back to the default template if the habit's own
+// one is broken (a typo shouldn't cost the reminder), and adds a snooze link.
+func reminderMessage(data *AppData, h Habit) string {
+	streak := GetStreakForHabit(data, h.ID)
+	msg, err := RenderReminder(h, streak)
+	if err != nil {
+		log.Printf("reminder template for %q: %v", h.Name, err)
+		fallback := h
+		fallback.ReminderTemplate = ""
+		msg, _ = RenderReminder(fallback, streak)
+	}
+	return msg + "\nSnooze 30 min: " + SnoozeLink(h.ID, 30, time.Now())
+}
+
+// SendDueReminders sends the reminder of every habit that isn't done yet and whose reminder time
+// (or snooze) has come. data.ReminderLog makes sure each habit is reminded once a day; a
+// snooze (data.SnoozedUntil) sends it once more when it runs out, and a habit with EscalateVia
+// is reminded there too when it's still open escalateAfter later. Returns how many were sent.
+func SendDueReminders(data *AppData, now time.Time) int {
+	today := now.Format(dateLayout)
+	done := data.History[today].CompletedHabits
+	if data.ReminderLog == nil {
+		data.ReminderLog = make(map[int]ReminderDelivery)
+	}
+	sent := 0
+	for _, h := range data.Habits {
+		if h.PausedOn(today) {
+			continue
+		}
+		snooze, snoozed := data.SnoozedUntil[h.ID]
+		if containsInt(done, h.ID) {
+			if snoozed {
+				delete(data.SnoozedUntil, h.ID) // done in the meantime: nothing to remind about
+			}
+			continue
+		}
+		last := data.ReminderLog[h.ID]
+		switch {
+		case snoozed && now.Before(snooze):
+			continue
+		case snoozed:
+			delete(data.SnoozedUntil, h.ID)
+		case last.Day == today:
+			if escalationDue(h, last, now) {
+				if escalateReminder(data, h, now) {
+					sent++
+				}
+			}
+			continue
+		case now.Before(habitReminderClock(h, now)):
+			continue
+		}
+		via, err := NotifyVia(h.ReminderVia, h.Name, reminderMessage(data, h))
+		if err != nil && h.ReminderVia != "" {
+			// The habit's channel isn't set up (any more): better every channel than none.
+			via, err = NotifyVia("", h.Name, reminderMessage(data, h))
+		}
+		if err == nil {
+			sent++
+		}
+		if last.Day != today {
+			last = ReminderDelivery{Day: today}
+		}
+		last.SentAt, last.Via = now, via
+		data.ReminderLog[h.ID] = last
+	}
+	return sent
+}
+
+// escalationDue reports whether h's reminder, last sent as described by last, should now go to
+// its second channel: h has one, the reminder went out escalateAfter ago (a snoozed one counts
+// from when the snooze ran out) and it wasn't escalated yet.
+func escalationDue(h Habit, last ReminderDelivery, now time.Time) bool {
+	return h.EscalateVia != "" && last.EscalatedVia == "" && !last.SentAt.IsZero() &&
+		!now.Before(last.SentAt.Add(escalateAfter))
+}
+
+// escalateReminder sends h's reminder again through h.EscalateVia and records that in
+// data.ReminderLog. A channel that fails counts as escalated too, so it isn't retried every
+// minute. Reports whether the reminder was delivered.
+func escalateReminder(data *AppData, h Habit, now time.Time) bool {
+	last := data.ReminderLog[h.ID]
+	last.EscalatedVia = h.EscalateVia
+	data.ReminderLog[h.ID] = last
+	hours := int(now.Sub(last.SentAt).Hours())
+	body := fmt.Sprintf("Still not done %d hours after your reminder.\n%s", hours, reminderMessage(data, h))
+	if _, err := NotifyVia(h.EscalateVia, h.Name, body); err != nil {
+		log.Printf("escalating the reminder for %q: %v", h.Name, err)
+		return false
+	}
+	return true
+}
+
+// RunReminders checks once a minute for habits whose reminder is due (and for the nudge about a
+// pending week review, see review.go), tells open pages what's coming up (events.go) and empties
+// old items from the trash (trash.go). Run it in its own goroutine: go RunReminders()
+func RunReminders() {
+	for range time.Tick(time.Minute) {
+		if err := CheckReminders(time.Now()); err != nil {
+			log.Println("reminders:", err)
+		}
+	}
+}
+
+// CheckReminders is one minute of RunReminders: it sends what is due at now and saves what it
+// sent, so nothing goes out twice.
+func CheckReminders(now time.Time) error {
+	data, err := LoadData()
+	if err != nil {
+		return err
+	}
+	before, _ := json.Marshal(data)
+	snoozes := make(map[int]time.Time, len(data.SnoozedUntil))
+	for id, t := range data.SnoozedUntil {
+		snoozes[id] = t
+	}
+	SendDueReminders(data, now)
+	SendPartnerAlerts(data, now) // accountability partner, once a day (partner.go)
+	SendDayWrapUp(data, now)     // what's left today, at the wrap-up time (wrapup.go)
+	SendMorningPlan(data, now)   // the day's plan, at the morning plan time (plan.go)
+	PublishReminders(data, now)  // "due soon" and "week review" on open pages (events.go)
+	PurgeExpiredTrash(data, now) // deleted more than 30 days ago (trash.go)
+	if !now.Before(reminderClock(now)) {
+		SendWeekReviewNudge(data, now)
+		SendWeeklySummary(data, now) // once a week, if SUMMARY_EMAIL is set (insights.go)
+	}
+	// Only save when something changed (a reminder was sent, a snooze ran out, the trash
+	// was emptied).
+	if after, _ := json.Marshal(data); bytes.Equal(before, after) {
+		return nil
+	}
+	// Sending took a while, and a save from a page may have come in meanwhile. Then record
+	// what was sent in the data as it is now, or the same notifications go out next minute.
+	sent := data
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			if data, err = LoadData(); err != nil {
+				return err
+			}
+			keepReminderMarks(data, sent, snoozes, now)
+		}
+		if err = SaveData(data); !errors.Is(err, ErrDataChanged) {
+			break
+		}
+	}
+	return err
+}
+
+// keepReminderMarks copies into data what a reminder check recorded in sent: which reminders,
+// alerts, wrap-ups, plans, nudges and summaries went out, and the snoozes it ended (those that
+// were snoozes before it ran and haven't been changed since). The trash is emptied again.
+func keepReminderMarks(data, sent *AppData, snoozes map[int]time.Time, now time.Time) {
+	data.ReminderLog = sent.ReminderLog
+	data.PartnerCheckedOn = sent.PartnerCheckedOn
+	data.LastWrapUpDate, data.WrapUpHabits = sent.LastWrapUpDate, sent.WrapUpHabits
+	data.LastMorningPlanDate = sent.LastMorningPlanDate
+	data.LastReviewNudgeDate = sent.LastReviewNudgeDate
+	data.LastSummaryEmail = sent.LastSummaryEmail
+	for id, t := range snoozes {
+		if _, kept := sent.SnoozedUntil[id]; !kept && data.SnoozedUntil[id].Equal(t) {
+			delete(data.SnoozedUntil, id)
+		}
+	}
+	PurgeExpiredTrash(data, now)
+}
+
+// SnoozeLink returns a signed link (see review.go) that snoozes a habit's reminder. The link
+// only works on the day it was made.
+func SnoozeLink(habitID, minutes int, now time.Time) string {
+	value := fmt.Sprintf("%d/%d/%s", habitID, minutes, now.Format(dateLayout))
+	q := url.Values{"habit_id": {strconv.Itoa(habitID)}, "minutes": {strconv.Itoa(minutes)}, "sig": {signLink("snooze", value)}}
+	return publicURL() + "/snooze?" + q.Encode()
+}
+
+// HandleSnooze snoozes a habit's reminder: GET from the link in a notification (must be signed),
+// or POST from the form on the main page. Query/form: habit_id=1&minutes=30
+func HandleSnooze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err1 := strconv.Atoi(r.FormValue("habit_id"))
+	minutes, err2 := strconv.Atoi(r.FormValue("minutes"))
+	if err1 != nil || err2 != nil || minutes < 5 || minutes > 12*60 {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	now := time.Now()
+	if r.Method == http.MethodGet {
+		value := fmt.Sprintf("%d/%d/%s", habitID, minutes, now.Format(dateLayout))
+		if !validLink("snooze", value, r.FormValue("sig")) {
+			http.Redirect(w, r, "/?error=link", http.StatusFound)
+			return
+		}
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if FindHabitByID(data, habitID) == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	if data.SnoozedUntil == nil {
+		data.SnoozedUntil = make(map[int]time.Time)
+	}
+	data.SnoozedUntil[habitID] = now.Add(time.Duration(minutes) * time.Minute)
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?snoozed="+strconv.Itoa(minutes), http.StatusFound)
+}
+
+// HandleHabitReminder handles POST to set a habit's motivation, reminder template, time and
+// channels. Empty values are allowed (empty template = default message, empty time =
+// REMINDER_TIME, empty reminder_via = every channel, empty escalate_via = no escalation).
+// The template is checked by rendering it once, so a typo is reported right away instead of at
+// reminder time. Form: habit_id=1&motivation=...&reminder_template=...&reminder_time=07:30
+// &reminder_via=push&escalate_via=telegram
+func HandleHabitReminder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	updated := *habit
+	updated.Motivation = strings.TrimSpace(r.FormValue("motivation"))
+	updated.ReminderTemplate = strings.TrimSpace(r.FormValue("reminder_template"))
+	updated.ReminderTime = strings.TrimSpace(r.FormValue("reminder_time"))
+	updated.ReminderVia = r.FormValue("reminder_via")
+	updated.EscalateVia = r.FormValue("escalate_via")
+	for _, via := range []string{updated.ReminderVia, updated.EscalateVia} {
+		if via != "" && !containsString(notifierNames, via) {
+			http.Redirect(w, r, "/?error=reminder", http.StatusFound)
+			return
+		}
+	}
+	if _, err := time.Parse("15:04", updated.ReminderTime); err != nil && updated.ReminderTime != "" {
+		http.Redirect(w, r, "/?error=reminder", http.StatusFound)
+		return
+	}
+	if _, err := RenderReminder(updated, 0); err != nil {
+		http.Redirect(w, r, "/?error=reminder", http.StatusFound)
+		return
+	}
+	*habit = updated
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?reminder=1", http.StatusFound)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTempDir runs the rest of the test in an empty folder, so data.json and the journal (relative
+// paths) are the test's own, and goes back to the original folder afterwards.
+func useTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("WRITE_DELAY_MS", "0")
+}
+
+// TestReminderNotSentTwiceAfterConflict saves the data from "a page" while a reminder is being
+// sent, so the reminder check's save runs into ErrDataChanged. The reminder must still be
+// recorded as sent (and the page's change kept), so the next check doesn't send it again.
+func TestReminderNotSentTwiceAfterConflict(t *testing.T) {
+	useTempDir(t)
+	var mu sync.Mutex
+	sends := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct{ Title string }
+		json.NewDecoder(r.Body).Decode(&msg)
+		if msg.Title != "Read" {
+			return // the wrap-up, the morning plan and so on
+		}
+		mu.Lock()
+		sends++
+		first := sends == 1
+		mu.Unlock()
+		if first {
+			d, err := LoadData()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			d.Todos = append(d.Todos, Todo{ID: 1, Text: "added meanwhile"})
+			if err := SaveData(d); err != nil {
+				t.Error(err)
+			}
+		}
+	}))
+	defer hook.Close()
+	t.Setenv("NOTIFY_WEBHOOK_URL", hook.URL)
+
+	data, err := LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Habits = append(data.Habits, Habit{ID: 1, Name: "Read", Quantity: 1, Unit: "page", ReminderTime: "00:00", CreatedAt: time.Now()})
+	if err := SaveData(data); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := CheckReminders(now.Add(time.Duration(i) * time.Minute)); err != nil {
+			t.Fatalf("check %d: %v", i+1, err)
+		}
+	}
+	if sends != 1 {
+		t.Errorf("the reminder was sent %d times, want once", sends)
+	}
+	data, err = LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.ReminderLog[1].Day != now.Format(dateLayout) {
+		t.Errorf("ReminderLog = %+v, want today's reminder recorded", data.ReminderLog)
+	}
+	if len(data.Todos) != 1 {
+		t.Errorf("the page's save was lost: todos = %+v", data.Todos)
+	}
+}
@@ -0,0 +1,142 @@
+// restore.go - Restoring a backup from /backups (autobackup.go). Restore under a backup first
+// opens a preview that compares it with the data as it is now: how many habits and todos each
+// has, which habits would come back or go, and which days of history each covers. Only typing
+// "restore" there replaces the data, and before it does, the current data is written as a
+// "pre-restore" snapshot, so a restore can itself be undone from the same page.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotSummary is what a set of data holds, to compare backups by.
+type SnapshotSummary struct {
+	Habits int
+	Todos  int
+	Days   int    // days in the history
+	First  string // first and last day in the history ("" if it's empty)
+	Last   string
+}
+
+// SummarizeData sums up data.
+func SummarizeData(data *AppData) SnapshotSummary {
+	sum := SnapshotSummary{Habits: len(data.Habits), Todos: len(data.Todos), Days: len(data.History)}
+	for date := range data.History {
+		if sum.First == "" || date < sum.First {
+			sum.First = date
+		}
+		if date > sum.Last {
+			sum.Last = date
+		}
+	}
+	return sum
+}
+
+// RestorePreviewData is what backup-restore.html gets.
+type RestorePreviewData struct {
+	Settings Settings
+	Revision int64
+	Dates    DateStyle
+	Name     string
+	Backup   SnapshotSummary
+	Current  SnapshotSummary
+	Back     []string // habits in the backup that aren't there now: they come back
+	Gone     []string // habits there now that aren't in the backup: they go
+	Lost     int      // days in the history now that the backup doesn't have
+	Message  string
+}
+
+// previewRestore compares the backup's data with the current data.
+func previewRestore(backup, current *AppData) RestorePreviewData {
+	pd := RestorePreviewData{Backup: SummarizeData(backup), Current: SummarizeData(current)}
+	for _, h := range backup.Habits {
+		if FindHabitByID(current, h.ID) == nil {
+			pd.Back = append(pd.Back, h.Name)
+		}
+	}
+	for _, h := range current.Habits {
+		if FindHabitByID(backup, h.ID) == nil {
+			pd.Gone = append(pd.Gone, h.Name)
+		}
+	}
+	sort.Strings(pd.Back)
+	sort.Strings(pd.Gone)
+	for date := range current.History {
+		if _, ok := backup.History[date]; !ok {
+			pd.Lost++
+		}
+	}
+	return pd
+}
+
+// HandleBackupRestore handles /backups/restore. GET ?name=snapshot-...json shows the preview;
+// POST replaces all data with the snapshot's. Form: name=snapshot-...json&confirm=restore
+func HandleBackupRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.FormValue("name")
+	if !snapshotName.MatchString(name) {
+		http.Redirect(w, r, "/backups?error=notfound", http.StatusFound)
+		return
+	}
+	snap := snapshotStore()
+	restored, err := ReadSnapshot(snap, name)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Redirect(w, r, "/backups?error=notfound", http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Println("restoring backup:", err)
+		http.Redirect(w, r, "/backups?error=restore", http.StatusFound)
+		return
+	}
+	old, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		pd := previewRestore(restored, old)
+		pd.Settings, pd.Revision, pd.Dates, pd.Name = old.Settings, old.Revision, RequestDates(r, old.Settings), name
+		switch r.URL.Query().Get("error") {
+		case "confirm":
+			pd.Message = "Type “restore” to confirm."
+		case "safety":
+			pd.Message = "The current data couldn't be backed up first, so nothing was restored. See the server log."
+		}
+		if err := tmpl.ExecuteTemplate(w, "backup-restore.html", pd); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	back := "/backups/restore?name=" + name + "&"
+	if strings.ToLower(strings.TrimSpace(r.FormValue("confirm"))) != "restore" {
+		http.Redirect(w, r, back+"error=confirm", http.StatusFound)
+		return
+	}
+	// Keep the data as it is now before replacing it: no safety copy, no restore.
+	before, err := WriteSnapshot(snap, preRestoreSnapshot, time.Now())
+	if err != nil {
+		log.Println("backup before restore:", err)
+		http.Redirect(w, r, back+"error=safety", http.StatusFound)
+		return
+	}
+	restored.Revision = old.Revision // it replaces the data on purpose
+	if err := SaveData(restored); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	log.Printf("restored %s (the data from before is in %s)", name, before)
+	http.Redirect(w, r, "/backups?restored="+name+"&before="+before, http.StatusFound)
+}
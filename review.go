@@ -0,0 +1,139 @@
+// review.go - Reminders for the week review. Once NeedsWeekReview turns true (7 days after the
+// last review, or on the review day chosen in the settings), a notification goes out through
+// the configured channels (notify.go) at reminder time, every day, until the review is completed.
+// It contains a deep link straight to the review form:
+//
+//	http://localhost:8080/review?since=2025-01-21&sig=...
+//
+// The link is signed (HMAC-SHA256) so only links the app made itself are accepted, and it is
+// tied to the pending review: once that review is done, old links just say so.
+// Set these in .env:
+//
+//	PUBLIC_URL=http://homeserver:8080   (where the link should point, default http://localhost:PORT)
+//	LINK_SECRET=some-long-secret        (optional; otherwise one is generated into link-secret.key)
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linkSecretFile keeps the generated signing key, so links keep working after a restart.
+const linkSecretFile = "link-secret.key"
+
+var (
+	linkSecretOnce sync.Once
+	linkSecretKey  []byte
+)
+
+// linkSecret returns the key for signing links: LINK_SECRET, or a random key kept in
+// link-secret.key (created on first use). sync.Once makes sure it is only worked out once.
+func linkSecret() []byte {
+	linkSecretOnce.Do(func() {
+		if s := os.Getenv("LINK_SECRET"); s != "" {
+			linkSecretKey = []byte(s)
+			return
+		}
+		if b, err := os.ReadFile(linkSecretFile); err == nil && len(strings.TrimSpace(string(b))) > 0 {
+			linkSecretKey = []byte(strings.TrimSpace(string(b)))
+			return
+		}
+		raw := make([]byte, 32)
+		rand.Read(raw)
+		linkSecretKey = []byte(hex.EncodeToString(raw))
+		// 0600: only the owner can read the key. It's in .gitignore: a key in the repository
+		// would let anyone sign links and login cookies for every install that uses it.
+		if err := os.WriteFile(linkSecretFile, linkSecretKey, 0600); err != nil {
+			log.Println("link secret: could not save the key, links signed now stop working after a restart:", err)
+		}
+	})
+	return linkSecretKey
+}
+
+// signLink returns the signature for a link of the given kind and value.
+func signLink(kind, value string) string {
+	mac := hmac.New(sha256.New, linkSecret())
+	mac.Write([]byte(kind + ":" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validLink checks a signature from signLink. hmac.Equal compares in constant time.
+func validLink(kind, value, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(signLink(kind, value)))
+}
+
+// publicURL is the address links in notifications point to: PUBLIC_URL, or localhost and PORT.
+func publicURL() string {
+	if u := os.Getenv("PUBLIC_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	if domains := httpsDomains(); httpsEnabled() && len(domains) > 0 {
+		return "https://" + domains[0] // tls.go
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+// WeekReviewLink returns the signed deep link to the pending review. The review is identified by
+// the date of the previous one, so the link stops working once this review is completed.
+func WeekReviewLink(data *AppData) string {
+	since := GetOrSetLastWeekReview(data)
+	q := url.Values{"since": {since}, "sig": {signLink("week-review", since)}}
+	return publicURL() + "/review?" + q.Encode()
+}
+
+// SendWeekReviewNudge notifies about a pending 7-day review, at most once a day (remembered in
+// data.LastReviewNudgeDate). It reports whether a nudge was sent.
+func SendWeekReviewNudge(data *AppData, now time.Time) bool {
+	today := now.Format(dateLayout)
+	needs, err := NeedsWeekReview(data)
+	if err != nil || !needs || data.LastReviewNudgeDate == today {
+		return false
+	}
+	days, _ := DaysBetween(GetOrSetLastWeekReview(data), today)
+	msg := fmt.Sprintf("Your week review is waiting (%d days since the last one). Choose how much to level up each habit: %s", days, WeekReviewLink(data))
+	if err := Notify("Weekly review", msg); err != nil {
+		return false // try again next minute
+	}
+	data.LastReviewNudgeDate = today
+	return true
+}
+
+// HandleReviewLink handles GET /review?since=...&sig=..., the deep link from the notification.
+// A valid link for the pending review goes straight to the review page (weekreview.go).
+func HandleReviewLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	since := r.URL.Query().Get("since")
+	if !validLink("week-review", since, r.URL.Query().Get("sig")) {
+		http.Redirect(w, r, "/?error=link", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if needs, _ := NeedsWeekReview(data); !needs || since != GetOrSetLastWeekReview(data) {
+		http.Redirect(w, r, "/?reviewdone=1", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/week-review", http.StatusFound)
+}
@@ -0,0 +1,88 @@
+// revision.go - Keeping two tabs from undoing each other's changes. Every save bumps
+// AppData.Revision, and SaveData refuses a copy of the data loaded before the last save
+// (ErrDataChanged). Pages go one step further: each page sends the revision it was rendered
+// at with its forms (the "revision" template adds the hidden field), so a form from a page that
+// is out of date gets 409 Conflict and "reload the page" instead of overwriting newer data.
+//
+// Scripts do the same with HTTP headers: GET /api/v1/today answers with an ETag ("12"), and
+// a request with If-Match: "12" is refused with 409 if the data has changed since. Forms and
+// requests without a revision are not checked.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// dataChangedMessage is what an outdated page or script is told.
+const dataChangedMessage = "Your data changed in another tab or window since this page was loaded. Reload the page and try again."
+
+// revisionETag is the ETag for a revision, e.g. "12" (with the quotes).
+func revisionETag(rev int64) string {
+	return `"` + strconv.FormatInt(rev, 10) + `"`
+}
+
+// currentRevision returns the revision of the data, from memory (see store.go).
+func currentRevision() (int64, error) {
+	data, err := storedData()
+	if err != nil {
+		return 0, err
+	}
+	return data.Revision, nil
+}
+
+// expectedRevision returns the revision a request was made from: the If-Match header or the
+// "revision" field of a plain form post. ok is false when the request names none.
+func expectedRevision(r *http.Request) (rev int64, ok bool) {
+	v := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`)
+	if v == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		v = r.PostFormValue("revision")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	return n, err == nil
+}
+
+// conflict answers 409 with dataChangedMessage: as JSON for the API, as text for pages.
+func conflict(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": dataChangedMessage})
+		return
+	}
+	http.Error(w, dataChangedMessage, http.StatusConflict)
+}
+
+// RevisionGuard refuses changes (POST, PUT, DELETE) made from an outdated revision before they
+// reach the handler.
+func RevisionGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if want, ok := expectedRevision(r); ok {
+				if cur, err := currentRevision(); err == nil && cur != want {
+					conflict(w, r)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// saveFailed answers a failed SaveData in a page handler: 409 if someone else saved first.
+func saveFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrDataChanged) {
+		http.Error(w, dataChangedMessage, http.StatusConflict)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// saveStatus is the HTTP status for a failed SaveData in a JSON handler.
+func saveStatus(err error) int {
+	if errors.Is(err, ErrDataChanged) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,117 @@
+// schema.go - Upgrading data files written by older versions of the app. AppData.SchemaVersion
+// says which shape the data is in; data from before it existed has none (0). When data is read
+// (decodeData in storage.go), every migration newer than its version runs, in order, and the
+// upgraded data is what the app works with and writes back at the next save.
+//
+// To change the shape of the data: add a migration at the end of schemaMigrations with the next
+// version number, and bump schemaVersion to it. Migrations must be safe on any old data, and
+// never depend on each other except through their order.
+
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// schemaVersion is the version of the data this build writes.
+const schemaVersion = 5
+
+// schemaMigration upgrades the data to Version from the version just before it.
+type schemaMigration struct {
+	Version int
+	Name    string // shown in the log when it runs
+	Apply   func(d *AppData)
+}
+
+var schemaMigrations = []schemaMigration{
+	{1, "fill in the app's start date", migrateAppCreatedAt},
+	{2, "fill in missing habit creation dates", migrateHabitCreatedAt},
+	{3, "fill in best streaks", refreshLongestStreaks},
+	{4, "move reminder days into the reminder log", migrateReminderLog},
+	{5, "keep habit pauses as a list", migratePauses},
+}
+
+// migrateData brings d up to schemaVersion. Data from a newer version is refused rather than
+// read: this build doesn't know its new fields and would drop them at the next save.
+func migrateData(d *AppData) error {
+	if d.SchemaVersion > schemaVersion {
+		return fmt.Errorf("the data was written by a newer version of the app (schema %d, this one knows up to %d): update the app", d.SchemaVersion, schemaVersion)
+	}
+	for _, m := range schemaMigrations {
+		if d.SchemaVersion < m.Version {
+			m.Apply(d)
+			d.SchemaVersion = m.Version
+			log.Printf("data upgraded to schema %d: %s", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// firstHistoryDay returns the earliest day in the history for which keep returns true ("" if none).
+func firstHistoryDay(d *AppData, keep func(DayRecord) bool) string {
+	first := ""
+	for day, rec := range d.History {
+		if (first == "" || day < first) && keep(rec) {
+			first = day
+		}
+	}
+	return first
+}
+
+// migrateAppCreatedAt sets the app's start date on data that never got one: the main page only
+// set it on the first visit, so files made by the CLI or an import could be without it. The
+// first day in the history is the best guess.
+func migrateAppCreatedAt(d *AppData) {
+	if d.CreatedAt == "" {
+		d.CreatedAt = firstHistoryDay(d, func(DayRecord) bool { return true })
+	}
+}
+
+// migrateHabitCreatedAt gives habits from before creation times were kept one: the first day
+// the history mentions the habit, or else the app's start date. Habits without a creation
+// time were skipped by the grace period and the "didn't exist yet" checks (logic.go).
+func migrateHabitCreatedAt(d *AppData) {
+	for i := range d.Habits {
+		h := &d.Habits[i]
+		if !h.CreatedAt.IsZero() {
+			continue
+		}
+		day := firstHistoryDay(d, func(rec DayRecord) bool {
+			_, timed := rec.MinutesLogged[h.ID]
+			return timed || containsInt(rec.CompletedHabits, h.ID) || containsInt(rec.SkippedHabits, h.ID) ||
+				containsInt(rec.PenaltyAppliedForHabits, h.ID)
+		})
+		if day == "" {
+			day = d.CreatedAt
+		}
+		if t, err := ParseDate(day); err == nil {
+			h.CreatedAt = t
+		}
+	}
+}
+
+// migrateReminderLog moves the day each habit was last reminded (ReminderSentOn) into the
+// reminder log, which also keeps when and where a reminder went out so it can be escalated.
+// Moved entries have no send time, so a reminder sent before the upgrade is never escalated.
+func migrateReminderLog(d *AppData) {
+	for id, day := range d.ReminderSentOn {
+		if d.ReminderLog == nil {
+			d.ReminderLog = make(map[int]ReminderDelivery)
+		}
+		d.ReminderLog[id] = ReminderDelivery{Day: day}
+	}
+	d.ReminderSentOn = nil
+}
+
+// migratePauses moves each habit's single pause (PausedFrom/PausedTo) into its list of pauses,
+// so a new pause no longer overwrites the days of the last one.
+func migratePauses(d *AppData) {
+	for i := range d.Habits {
+		h := &d.Habits[i]
+		if h.PausedFrom != "" {
+			h.Pauses = append(h.Pauses, PausePeriod{From: h.PausedFrom, To: h.PausedTo})
+		}
+		h.PausedFrom, h.PausedTo = "", ""
+	}
+}
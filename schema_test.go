@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// loadFixture reads testdata/name as it was written, without migrating it.
+func loadFixture(t *testing.T, name string) *AppData {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d AppData
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return &d
+}
+
+// snapshot is d as JSON, to compare two states of the data.
+func snapshot(t *testing.T, d *AppData) string {
+	t.Helper()
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestSchemaMigrations runs each migration on a file written just before it: the result must be
+// what the migration promises, running it a second time must change nothing, and migrateData
+// must then bring the file up to schemaVersion.
+func TestSchemaMigrations(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := ParseDate(s)
+		return d
+	}
+	steps := []struct {
+		fixture string
+		check   func(t *testing.T, d *AppData)
+	}{
+		{"schema_v0.json", func(t *testing.T, d *AppData) {
+			if d.CreatedAt != "2025-01-05" {
+				t.Errorf("CreatedAt = %q, want the first history day 2025-01-05", d.CreatedAt)
+			}
+		}},
+		{"schema_v1.json", func(t *testing.T, d *AppData) {
+			if got := d.Habits[0].CreatedAt; !got.Equal(date("2025-01-04")) {
+				t.Errorf("Read created %v, want 2025-01-04 (its first skip)", got)
+			}
+			if got := d.Habits[1].CreatedAt; !got.Equal(date("2025-01-01")) {
+				t.Errorf("Stretch created %v, want the app's start 2025-01-01", got)
+			}
+		}},
+		{"schema_v2.json", func(t *testing.T, d *AppData) {
+			if got := d.Habits[0].LongestStreak; got != 3 {
+				t.Errorf("LongestStreak = %d, want 3", got)
+			}
+		}},
+		{"schema_v3.json", func(t *testing.T, d *AppData) {
+			want := map[int]ReminderDelivery{1: {Day: "2025-01-06"}, 2: {Day: "2025-01-05"}}
+			if !reflect.DeepEqual(d.ReminderLog, want) || d.ReminderSentOn != nil {
+				t.Errorf("ReminderLog = %+v, ReminderSentOn = %+v; want %+v and nil", d.ReminderLog, d.ReminderSentOn, want)
+			}
+		}},
+		{"schema_v4.json", func(t *testing.T, d *AppData) {
+			want := []PausePeriod{{From: "2025-01-04", To: "2025-01-09"}}
+			h := d.Habits[0]
+			if !reflect.DeepEqual(h.Pauses, want) || h.PausedFrom != "" || h.PausedTo != "" {
+				t.Errorf("Read pauses = %+v (from %q to %q), want %+v and the old fields empty", h.Pauses, h.PausedFrom, h.PausedTo, want)
+			}
+			if len(d.Habits[1].Pauses) != 0 {
+				t.Errorf("Stretch got pauses %+v, it was never paused", d.Habits[1].Pauses)
+			}
+		}},
+	}
+	if len(steps) != len(schemaMigrations) {
+		t.Fatalf("%d fixtures for %d migrations: add one for the new migration", len(steps), len(schemaMigrations))
+	}
+	for i, step := range steps {
+		m := schemaMigrations[i]
+		t.Run(step.fixture, func(t *testing.T) {
+			d := loadFixture(t, step.fixture)
+			if d.SchemaVersion != m.Version-1 {
+				t.Fatalf("fixture has schema %d, want %d (just before %q)", d.SchemaVersion, m.Version-1, m.Name)
+			}
+			m.Apply(d)
+			d.SchemaVersion = m.Version
+			step.check(t, d)
+
+			once := snapshot(t, d)
+			m.Apply(d)
+			if twice := snapshot(t, d); twice != once {
+				t.Errorf("running %q twice changed the data:\n%s\n%s", m.Name, once, twice)
+			}
+
+			if err := migrateData(d); err != nil {
+				t.Fatal(err)
+			}
+			if d.SchemaVersion != schemaVersion {
+				t.Errorf("schema %d after migrateData, want %d", d.SchemaVersion, schemaVersion)
+			}
+		})
+	}
+}
+
+// TestMigrateDataTwice checks that migrating already current data changes nothing.
+func TestMigrateDataTwice(t *testing.T) {
+	d := loadFixture(t, "schema_v0.json")
+	if err := migrateData(d); err != nil {
+		t.Fatal(err)
+	}
+	once := snapshot(t, d)
+	if err := migrateData(d); err != nil {
+		t.Fatal(err)
+	}
+	if twice := snapshot(t, d); twice != once {
+		t.Errorf("migrateData changed current data:\n%s\n%s", once, twice)
+	}
+}
+
+// TestMigrateDataRefusesNewer checks that data from a newer build isn't read (and later
+// written back without the fields this build doesn't know).
+func TestMigrateDataRefusesNewer(t *testing.T) {
+	d := &AppData{SchemaVersion: schemaVersion + 1}
+	if err := migrateData(d); err == nil {
+		t.Fatal("data from a newer schema was accepted")
+	}
+}
@@ -0,0 +1,162 @@
+// seed.go - Made-up data for working on the app: any number of habits with months of history,
+// with the misses and penalties real use has, to try the pages (and how fast they are) on a big
+// dataset. Only in dev builds (devbuild.go):
+//
+//	go run -tags dev . -seed 25 -months 18                      (replace the data and exit)
+//	curl -X POST "http://localhost:8080/dev/seed?habits=25&months=18&seed=7"
+//
+// Unlike the /admin/reset scenarios (demo.go), which are small and picked by hand, the habits
+// here come from a list of common ones (numbered once it runs out). Each gets its own success
+// rate that drifts from week to week, and now and then a bad week (a cold, a holiday) makes
+// everything slip. The same numbers and seed give the same data on the same day. Settings are
+// kept; everything else is replaced.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits for generated data, so a typo doesn't make a dataset that takes minutes to build.
+const (
+	maxSeedHabits = 500
+	maxSeedMonths = 120
+)
+
+// seedHabits is the list generated habits are taken from, in order.
+var seedHabits = []demoHabit{
+	{name: "Pushups", quantity: 10, unit: "pushups"},
+	{name: "Read", quantity: 10, unit: "pages"},
+	{name: "Meditate", quantity: 5, unit: "minutes"},
+	{name: "Drink water", quantity: 6, unit: "glasses"},
+	{name: "Run", quantity: 2, unit: "km"},
+	{name: "Journal", quantity: 3, unit: "sentences"},
+	{name: "Squats", quantity: 15, unit: "squats"},
+	{name: "Language practice", quantity: 15, unit: "minutes"},
+	{name: "Stretch", quantity: 5, unit: "minutes"},
+	{name: "Walk", quantity: 5000, unit: "steps"},
+	{name: "Guitar", quantity: 20, unit: "minutes"},
+	{name: "Floss", quantity: 1, unit: "times"},
+	{name: "Plank", quantity: 60, unit: "seconds"},
+	{name: "Vegetables", quantity: 3, unit: "servings"},
+	{name: "Take vitamins", quantity: 1, unit: "times"},
+	{name: "Sketch", quantity: 1, unit: "drawings"},
+}
+
+// seedTodos are the todos generated data gets, a few per habit.
+var seedTodos = []string{
+	"Buy new running shoes", "Book a dentist appointment", "Plan next week", "Return library books",
+	"Call the bank", "Clean out the fridge", "Renew the gym membership", "Order a new notebook",
+	"Fix the bike light", "Write the monthly review", "Sort the photos", "Pay the electricity bill",
+}
+
+// SeedData generates habits habits with months of history up to the day of now, from the random
+// seed seed. habits and months are kept within maxSeedHabits and maxSeedMonths.
+func SeedData(habits, months int, seed int64, now time.Time) *AppData {
+	habits = min(max(habits, 1), maxSeedHabits)
+	months = min(max(months, 1), maxSeedMonths)
+	rng := rand.New(rand.NewSource(seed))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := today.AddDate(0, -months, 0)
+	total, _ := DaysBetween(start.Format(dateLayout), today.Format(dateLayout))
+
+	data := &AppData{Habits: []Habit{}, Todos: []Todo{}, History: make(map[string]DayRecord), SchemaVersion: schemaVersion}
+	data.CreatedAt = start.Format(dateLayout)
+	data.LastWeekReview = data.CreatedAt
+	data.SetupDone = true
+
+	base := make(map[int]float64) // each habit's usual success rate
+	for i := 0; i < habits; i++ {
+		sh := seedHabits[i%len(seedHabits)]
+		name := sh.name
+		if i >= len(seedHabits) {
+			name = fmt.Sprintf("%s %d", sh.name, i/len(seedHabits)+1)
+		}
+		h := NewHabit(data, name, sh.quantity, sh.unit)
+		// The first few habits are there from the start; the others were added along the way.
+		startedAfter := 0
+		if i >= 3 {
+			startedAfter = rng.Intn(total/2 + 1)
+		}
+		h.CreatedAt = start.AddDate(0, 0, startedAfter).Add(8 * time.Hour)
+		h.PenaltyExempt = rng.Intn(8) == 0
+		data.Habits = append(data.Habits, h)
+		base[h.ID] = 0.45 + rng.Float64()*0.5
+	}
+
+	// A week at a time, each with its own rates.
+	for week := start; week.Before(today); week = week.AddDate(0, 0, 7) {
+		end := week.AddDate(0, 0, 7)
+		if end.After(today) {
+			end = today
+		}
+		slump := rng.Float64() < 0.08
+		rates := make(map[int]float64)
+		for _, h := range data.Habits { // in order, not over the map, so the seed gives the same data
+			r := base[h.ID] + (rng.Float64()-0.5)*0.2
+			if slump {
+				r *= 0.3
+			}
+			rates[h.ID] = min(max(r, 0.05), 0.98)
+		}
+		simulateDays(data, rates, rng, week, end)
+	}
+
+	priorities := []string{"", "low", "medium", "high"}
+	for i := 0; i < (habits+2)/3; i++ {
+		t := Todo{ID: NextTodoID(data), Text: seedTodos[i%len(seedTodos)], Priority: priorities[rng.Intn(len(priorities))]}
+		if rng.Intn(3) > 0 {
+			t.DueDate = today.AddDate(0, 0, rng.Intn(22)-7).Format(dateLayout)
+		}
+		data.Todos = append(data.Todos, t)
+	}
+	refreshLongestStreaks(data)
+	return data
+}
+
+// replaceWithSeed replaces the data with fresh, keeping the settings.
+func replaceWithSeed(fresh *AppData) error {
+	old, err := LoadData()
+	if err != nil {
+		return err
+	}
+	fresh.Settings = old.Settings
+	fresh.Revision = old.Revision // it replaces the data on purpose
+	return SaveData(fresh)
+}
+
+// HandleDevSeed handles POST /dev/seed?habits=20&months=6[&seed=7] (dev builds only): it
+// replaces all data with generated data and answers with a short JSON summary.
+func HandleDevSeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	nums := map[string]int{"habits": 20, "months": 6, "seed": 1}
+	for name := range nums {
+		if s := r.FormValue(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, name+" must be a number", http.StatusBadRequest)
+				return
+			}
+			nums[name] = n
+		}
+	}
+	start := time.Now()
+	fresh := SeedData(nums["habits"], nums["months"], int64(nums["seed"]), start)
+	if err := replaceWithSeed(fresh); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"habits": len(fresh.Habits),
+		"todos":  len(fresh.Todos),
+		"days":   len(fresh.History),
+		"took":   time.Since(start).Round(time.Millisecond).String(),
+	})
+}
@@ -0,0 +1,163 @@
+// sessions.go - Doing a habit in parts over the day: 50 pushups as 5 sessions of 10. A habit with
+// Sessions set gets a "+10" button next to Done; each press is a check-in, kept with its time in
+// that day's DayRecord (CheckIns), and the habit is marked complete once the check-ins add up to
+// its target - like the minutes of a timer (timer.go). Until then the calendar shades the day by
+// how far it got (heatmapLevel in handlers.go).
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxSessions is the most sessions a day's target can be split into.
+const maxSessions = 24
+
+// CheckIn is one session of a habit done in parts.
+type CheckIn struct {
+	At     time.Time `json:"at"`
+	Amount int       `json:"amount"`
+}
+
+// SessionSize is how much one session of h is: the target split into h.Sessions parts, rounded
+// up (50 in 4 sessions = 13). 0 if h isn't split.
+func (h Habit) SessionSize() int {
+	if h.Sessions < 2 {
+		return 0
+	}
+	return (h.Quantity + h.Sessions - 1) / h.Sessions
+}
+
+// CheckedIn is how much of habitID was checked in on the day of rec.
+func CheckedIn(rec DayRecord, habitID int) int {
+	total := 0
+	for _, c := range rec.CheckIns[habitID] {
+		total += c.Amount
+	}
+	return total
+}
+
+// LogCheckIn records a session of h on date at the time at, and marks the habit complete
+// when the day's check-ins reach its target.
+func LogCheckIn(data *AppData, h *Habit, date string, at time.Time, amount int) {
+	if amount <= 0 {
+		return
+	}
+	rec := data.History[date]
+	rec.Date = date
+	if rec.CheckIns == nil {
+		rec.CheckIns = make(map[int][]CheckIn)
+	}
+	rec.CheckIns[h.ID] = append(rec.CheckIns[h.ID], CheckIn{At: at, Amount: amount})
+	data.History[date] = rec
+	if CheckedIn(rec, h.ID) >= h.Quantity {
+		SetHabitCompleted(data, h.ID, date, true)
+	}
+}
+
+// UndoCheckIn takes back the last session of h on date; the habit is no longer complete if
+// that leaves it short of its target. It reports false if there was nothing to take back.
+func UndoCheckIn(data *AppData, h *Habit, date string) bool {
+	rec := data.History[date]
+	list := rec.CheckIns[h.ID]
+	if len(list) == 0 {
+		return false
+	}
+	if len(list) == 1 {
+		delete(rec.CheckIns, h.ID)
+	} else {
+		rec.CheckIns[h.ID] = list[:len(list)-1]
+	}
+	data.History[date] = rec
+	if CheckedIn(rec, h.ID) < h.Quantity && containsInt(rec.CompletedHabits, h.ID) {
+		SetHabitCompleted(data, h.ID, date, false)
+	}
+	return true
+}
+
+// HandleCheckIn handles POST to check in one session of a habit today, or take the last one back.
+// Form: habit_id=1 (optional amount=12, default the session size), or habit_id=1&undo=1
+func HandleCheckIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil || habit.SessionSize() == 0 {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	today := Today()
+	if r.FormValue("undo") == "1" {
+		if !UndoCheckIn(data, habit, today) {
+			http.Redirect(w, r, "/", http.StatusFound) // nothing to take back
+			return
+		}
+	} else {
+		// Like the Done button: a due week review and unfinished prerequisites come first.
+		if redirect := completionRedirect(data, habit, today); redirect != "" {
+			http.Redirect(w, r, redirect, http.StatusFound)
+			return
+		}
+		amount := habit.SessionSize()
+		if n, err := strconv.Atoi(r.FormValue("amount")); err == nil && n > 0 {
+			amount = n
+		}
+		LogCheckIn(data, habit, today, time.Now(), amount)
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// HandleHabitSessions handles POST to split a habit's daily target into sessions (1 = in one go).
+// Form: habit_id=1&sessions=5
+func HandleHabitSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	sessions, err := strconv.Atoi(r.FormValue("sessions"))
+	if err != nil || sessions < 1 || sessions > maxSessions {
+		http.Redirect(w, r, "/?error=sessions", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.Sessions = sessions
+	if sessions == 1 {
+		habit.Sessions = 0
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?sessionsset=1", http.StatusFound)
+}
@@ -0,0 +1,222 @@
+// settings.go - The /settings page: preferences stored in data.Settings (theme, accent colour,
+// language, date style, penalty grace period for new habits, skip tokens per month, time zone, when the week review is)
+// and the list of quick-log links (quick.go).
+// The layout puts the theme on <html data-theme="..."> and the accent colour into --accent,
+// so every page that includes {{template "theme" .Settings}} follows the choice.
+
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accentPattern matches a colour as sent by <input type="color">: "#" and six hex digits.
+var accentPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidTheme reports whether t is a theme we know ("" means the default, dark).
+func ValidTheme(t string) bool {
+	return t == "" || t == "dark" || t == "light" || t == "system"
+}
+
+// SettingsPageData is what settings.html gets.
+type SettingsPageData struct {
+	Settings         Settings
+	Revision         int64  // sent back with the forms (revision.go)
+	Lang             Locale // the language the pages are shown in (i18n.go)
+	Languages        []LanguageOption
+	DateStyles       []DateStyle // to pick how dates are written (dates.go)
+	Habits           []Habit
+	QuickLinks       []QuickLinkView
+	ShareLinks       []ShareLinkView
+	Widgets          []WidgetView
+	Shareable        []Habit     // habits that can go on a share link (not private)
+	StravaConfigured bool        // STRAVA_CLIENT_ID is set (strava.go)
+	Strava           *StravaAuth // the connected account, if any
+	TodoSync         TodoSyncView
+	PasswordSet      bool     // APP_PASSWORD is set: show "Log out" (auth.go)
+	Weekdays         []string // "Sunday" … "Saturday", for the review day
+	NextReview       string   // the day the next week review is due (NextReviewDate)
+	// The default partner messages (partner.go), shown as placeholders.
+	PartnerMissDefault   string
+	PartnerStreakDefault string
+	Message              string
+}
+
+// ShareLinkView is a share link as listed on the settings page.
+type ShareLinkView struct {
+	ShareLink
+	URL    string
+	Habits string // the names of its habits
+}
+
+// WidgetView is a widget as listed on the settings page.
+type WidgetView struct {
+	WidgetLink
+	HabitName string // "" if the habit was deleted
+	URL       string
+}
+
+// QuickLinkView is a quick-log link as listed on the settings page.
+type QuickLinkView struct {
+	QuickToken
+	HabitName string // "" if the habit was deleted
+	URL       string
+}
+
+// HandleSettings shows the settings page (GET) and saves it (POST).
+// Form: theme=light&accent=%23c17c54&language=de&date_locale=en-GB&grace_days=1&skip_tokens=2&timezone=Europe/Berlin
+// &review_cadence=weekly&review_weekday=0 (reset_accent=1 goes back to the default colour)
+func HandleSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		grace, err := strconv.Atoi(r.FormValue("grace_days"))
+		skips, err2 := strconv.Atoi(r.FormValue("skip_tokens"))
+		if err != nil || grace < 0 || grace > 30 || err2 != nil || skips < 0 || skips > 31 {
+			http.Redirect(w, r, "/settings?error=invalid", http.StatusFound)
+			return
+		}
+		theme := r.FormValue("theme")
+		accent := strings.TrimSpace(r.FormValue("accent"))
+		if r.FormValue("reset_accent") == "1" {
+			accent = ""
+		}
+		cadence := r.FormValue("review_cadence")
+		weekday, err := strconv.Atoi(r.FormValue("review_weekday"))
+		if err != nil || weekday < 0 || weekday > 6 || !ValidReviewCadence(cadence) {
+			http.Redirect(w, r, "/settings?error=invalid", http.StatusFound)
+			return
+		}
+		language, dateLocale := r.FormValue("language"), r.FormValue("date_locale")
+		if !ValidTheme(theme) || (accent != "" && !accentPattern.MatchString(accent)) || !ValidLanguage(language) || !ValidDateLocale(dateLocale) {
+			http.Redirect(w, r, "/settings?error=invalid", http.StatusFound)
+			return
+		}
+		tz := strings.TrimSpace(r.FormValue("timezone"))
+		if err := applyTimezone(tz); err != nil {
+			http.Redirect(w, r, "/settings?error=timezone", http.StatusFound)
+			return
+		}
+		data.Settings.Timezone = tz
+		data.Settings.Theme = theme
+		data.Settings.Accent = strings.ToLower(accent)
+		data.Settings.Language = language
+		data.Settings.DateLocale = dateLocale
+		data.Settings.PenaltyGraceDays = &grace
+		data.Settings.MonthlySkipTokens = &skips
+		data.Settings.ReviewCadence = cadence
+		data.Settings.ReviewWeekday = weekday
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, "/settings?saved=1", http.StatusFound)
+		return
+	}
+
+	pd := SettingsPageData{
+		Settings:             data.Settings,
+		Revision:             data.Revision,
+		Lang:                 RequestLocale(r, data.Settings),
+		Languages:            LanguageOptions(),
+		DateStyles:           DateStyleOptions(),
+		Habits:               data.Habits,
+		Shareable:            SharedHabits(data.Habits),
+		PartnerMissDefault:   defaultPartnerMissTemplate,
+		PartnerStreakDefault: defaultPartnerStreakTemplate,
+		StravaConfigured:     stravaTypesIfConfigured() != nil,
+		Strava:               data.Strava,
+		TodoSync:             NewTodoSyncView(data),
+		PasswordSet:          appPassword() != "",
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		pd.Weekdays = append(pd.Weekdays, d.String())
+	}
+	pd.NextReview, _ = NextReviewDate(data)
+	for _, qt := range data.QuickTokens {
+		v := QuickLinkView{QuickToken: qt, URL: QuickLinkURL(qt.Token)}
+		if h := FindHabitByID(data, qt.HabitID); h != nil {
+			v.HabitName = h.Name
+		}
+		pd.QuickLinks = append(pd.QuickLinks, v)
+	}
+	for _, l := range data.ShareLinks {
+		var names []string
+		for _, id := range l.HabitIDs {
+			if h := FindHabitByID(data, id); h != nil {
+				names = append(names, h.Name)
+			}
+		}
+		pd.ShareLinks = append(pd.ShareLinks, ShareLinkView{ShareLink: l, URL: ShareLinkURL(l.Token), Habits: strings.Join(names, ", ")})
+	}
+	for _, l := range data.WidgetLinks {
+		v := WidgetView{WidgetLink: l, URL: WidgetURL(l.Token)}
+		if h := FindHabitByID(data, l.HabitID); h != nil {
+			v.HabitName = h.Name
+		}
+		pd.Widgets = append(pd.Widgets, v)
+	}
+	switch {
+	case r.URL.Query().Get("saved") == "1":
+		pd.Message = "Settings saved."
+	case r.URL.Query().Get("quick") == "1":
+		pd.Message = "Quick-log links updated."
+	case r.URL.Query().Get("strava") == "1":
+		pd.Message = "Strava connected. Link habits to activity types under Habit settings."
+	case r.URL.Query().Get("strava") == "0":
+		pd.Message = "Strava disconnected."
+	case r.URL.Query().Get("error") == "strava":
+		pd.Message = "Could not connect to Strava. Check STRAVA_CLIENT_ID, STRAVA_CLIENT_SECRET and PUBLIC_URL."
+	case r.URL.Query().Get("imported") != "":
+		pd.Message = "Health data imported: " + r.URL.Query().Get("imported") + " habit days completed."
+	case r.URL.Query().Get("error") == "health":
+		pd.Message = "Could not read that file. Upload Apple Health's export.zip or Google Fit's Takeout."
+	case r.URL.Query().Get("partner") == "1":
+		pd.Message = "Accountability partner saved."
+	case r.URL.Query().Get("error") == "partner":
+		pd.Message = "Check the partner's email, the webhook URL (http:// or https://) and the templates."
+	case r.URL.Query().Get("morningplan") == "1":
+		pd.Message = "Morning plan saved."
+	case r.URL.Query().Get("error") == "morningplan":
+		pd.Message = "Enter the morning plan time as HH:MM, or leave it empty to turn it off."
+	case r.URL.Query().Get("wrapup") == "1":
+		pd.Message = "Day wrap-up saved."
+	case r.URL.Query().Get("error") == "wrapup":
+		pd.Message = "Enter the wrap-up time as HH:MM, or leave it empty to turn it off."
+	case r.URL.Query().Get("todosync") == "1":
+		pd.Message = "Todo sync saved."
+	case r.URL.Query().Get("synced") != "":
+		pd.Message = "Todos synced: " + r.URL.Query().Get("synced") + "."
+	case r.URL.Query().Get("error") == "todosync":
+		pd.Message = "The todo sync failed. Check the token; the reason is below."
+	case r.URL.Query().Get("shared") == "1":
+		pd.Message = "Share links updated."
+	case r.URL.Query().Get("error") == "share":
+		pd.Message = "Pick at least one habit to share."
+	case r.URL.Query().Get("widget") == "1":
+		pd.Message = "Widgets updated."
+	case r.URL.Query().Get("error") == "widget":
+		pd.Message = "Private habits can't have a widget."
+	case r.URL.Query().Get("error") == "notfound":
+		pd.Message = "Habit not found."
+	case r.URL.Query().Get("error") == "timezone":
+		pd.Message = "Unknown time zone. Use a name like Europe/Berlin or America/New_York."
+	case r.URL.Query().Get("error") == "invalid":
+		pd.Message = "Please choose a theme, a language and date style, a colour like #7c9cbf, 0–30 grace days and 0–31 skip tokens."
+	}
+	if err := tmpl.ExecuteTemplate(w, "settings.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,146 @@
+// setup.go - The first-run wizard at /setup. While there are no habits and no todos yet (and the
+// wizard wasn't finished or skipped), the main page sends you here. Four short steps:
+//
+//  1. time zone (data.Settings.Timezone; days start at midnight there)
+//  2. starter habits from the template library (library.go)
+//  3. an OpenAI key for "Simplify" (optional; OPENAI_KEY in .env wins if set)
+//  4. how miss penalties and the 7-day review work
+//
+// Every step is a normal form post saved with SaveData, like any other change.
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setupSteps is the number of steps in the wizard.
+const setupSteps = 4
+
+// SetupPageData is what setup.html gets.
+type SetupPageData struct {
+	Settings   Settings
+	Step       int
+	Steps      int
+	Timezone   string // the current choice, to prefill step 1
+	Categories []TemplateCategory
+	Have       map[string]bool // template key -> you already have it (step 2)
+	HasKey     bool            // an OpenAI key is set (step 3)
+	GraceDays  int
+	Message    string
+}
+
+// NeedsSetup reports whether the wizard should be shown: nothing entered yet and not done.
+func NeedsSetup(data *AppData) bool {
+	return !data.SetupDone && len(data.Habits) == 0 && len(data.Todos) == 0
+}
+
+// applyTimezone makes name (like "Europe/Berlin") the zone used for "today" and all times in the
+// app, by setting time.Local. An empty name keeps the system's zone.
+func applyTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	time.Local = loc
+	return nil
+}
+
+// ApplySavedTimezone applies the time zone from the settings at startup.
+func ApplySavedTimezone() {
+	data, err := LoadData()
+	if err != nil {
+		return // the server reports unreadable data on the first request
+	}
+	if err := applyTimezone(data.Settings.Timezone); err != nil {
+		log.Printf("time zone %q: %v", data.Settings.Timezone, err)
+	}
+}
+
+// HandleSetup shows a step of the wizard (GET /setup?step=2) and saves it (POST with step=N).
+// Step 1 form: timezone=Europe/Berlin. Step 2: template=pushups&template=water (see library.go).
+// Step 3: openai_key=sk-... Step 4 finishes. skip=1 on any step leaves the wizard for good.
+func HandleSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	step, err := strconv.Atoi(r.FormValue("step"))
+	if err != nil || step < 1 || step > setupSteps {
+		step = 1
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/setup?step="+strconv.Itoa(step)+"&error=invalid", http.StatusFound)
+			return
+		}
+		next := "/setup?step=" + strconv.Itoa(step+1)
+		switch {
+		case r.FormValue("skip") == "1" || step == setupSteps:
+			data.SetupDone = true
+			next = "/?setup=1"
+		case step == 1:
+			tz := strings.TrimSpace(r.FormValue("timezone"))
+			if err := applyTimezone(tz); err != nil {
+				http.Redirect(w, r, "/setup?step=1&error=timezone", http.StatusFound)
+				return
+			}
+			data.Settings.Timezone = tz
+		case step == 2:
+			for _, key := range r.Form["template"] {
+				if t := FindTemplate(data, key); t != nil {
+					AddHabitFromTemplate(data, *t)
+				}
+			}
+		case step == 3:
+			if key := strings.TrimSpace(r.FormValue("openai_key")); key != "" {
+				data.Settings.OpenAIKey = key
+			}
+		}
+		if data.CreatedAt == "" {
+			data.CreatedAt = Today()
+		}
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, next, http.StatusFound)
+		return
+	}
+
+	pd := SetupPageData{
+		Settings:   data.Settings,
+		Step:       step,
+		Steps:      setupSteps,
+		Timezone:   data.Settings.Timezone,
+		Categories: templateCategories(),
+		Have:       make(map[string]bool),
+		HasKey:     openAIKey(data) != "",
+		GraceDays:  data.Settings.GraceDays(),
+	}
+	for _, t := range starterTemplates {
+		pd.Have[t.Key] = hasHabitNamed(data, t.Name)
+	}
+	switch r.URL.Query().Get("error") {
+	case "timezone":
+		pd.Message = "Unknown time zone. Use a name like Europe/Berlin or America/New_York."
+	case "invalid":
+		pd.Message = "Something was wrong with that form."
+	}
+	if err := tmpl.ExecuteTemplate(w, "setup.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
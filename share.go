@@ -0,0 +1,144 @@
+// share.go - Public read-only share links. A link (/share/<token>) shows a snapshot of the habits
+// you picked: the last year's heatmap, completion rate and streaks. There are no buttons, no
+// todos and nothing else from the app, so it's safe to send to an accountability partner.
+// Links are made and revoked on the settings page, like quick-log links (quick.go). Private
+// habits (privacy.go) never show up, even if they were picked before being made private.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShareLink is a read-only link to some of your habits.
+type ShareLink struct {
+	Token     string    `json:"token"`
+	HabitIDs  []int     `json:"habit_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShareLinkURL is the full URL to send to someone.
+func ShareLinkURL(token string) string {
+	return publicURL() + "/share/" + token
+}
+
+// ShareHabit is one habit on the share page.
+type ShareHabit struct {
+	ArchiveHabit
+	Streak int // current streak (days in a row up to yesterday)
+}
+
+// SharePageData is what share.html gets.
+type SharePageData struct {
+	Settings Settings
+	Dates    DateStyle // the owner's date style (dates.go)
+	From     string
+	To       string
+	Habits   []ShareHabit
+}
+
+// HandleShare handles GET /share/{token}: the read-only snapshot of the link's habits.
+func HandleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/share/")
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var link *ShareLink
+	for i := range data.ShareLinks {
+		if data.ShareLinks[i].Token == token {
+			link = &data.ShareLinks[i]
+		}
+	}
+	if link == nil {
+		http.Error(w, "This share link was revoked.", http.StatusNotFound)
+		return
+	}
+
+	// Only the picked, non-private habits; the history is filtered the same way.
+	var picked []Habit
+	for _, h := range SharedHabits(data.Habits) {
+		if containsInt(link.HabitIDs, h.ID) {
+			picked = append(picked, h)
+		}
+	}
+	hidden := make(map[int]bool)
+	for _, h := range data.Habits {
+		if !containsInt(link.HabitIDs, h.ID) || h.Private {
+			hidden[h.ID] = true
+		}
+	}
+	view := &AppData{Habits: picked, History: data.History, Settings: data.Settings}
+
+	now := time.Now()
+	last, _ := ParseDate(now.Format(dateLayout))
+	first := last.AddDate(0, 0, -364)
+	ad, err := BuildArchiveRange(view, SharedHistory(MemoryHistory(data.History), hidden), first, last, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := SharePageData{Settings: data.Settings, Dates: ad.Dates, From: first.Format(dateLayout), To: last.Format(dateLayout)}
+	for i, ah := range ad.Habits {
+		pd.Habits = append(pd.Habits, ShareHabit{ArchiveHabit: ah, Streak: GetStreakForHabit(data, picked[i].ID)})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.ExecuteTemplate(w, "share.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleShareLinks handles POST from the settings page to create or revoke a share link.
+// Form: habit_id=1&habit_id=3 (create) or revoke=<token>
+func HandleShareLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Redirect(w, r, "/settings?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if revoke := r.FormValue("revoke"); revoke != "" {
+		var kept []ShareLink
+		for _, l := range data.ShareLinks {
+			if l.Token != revoke {
+				kept = append(kept, l)
+			}
+		}
+		data.ShareLinks = kept
+	} else {
+		var ids []int
+		for _, v := range r.Form["habit_id"] {
+			id, err := strconv.Atoi(v)
+			if err != nil || FindHabitByID(data, id) == nil {
+				http.Redirect(w, r, "/settings?error=notfound", http.StatusFound)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			http.Redirect(w, r, "/settings?error=share#share-links", http.StatusFound)
+			return
+		}
+		data.ShareLinks = append(data.ShareLinks, ShareLink{Token: newQuickToken(), HabitIDs: ids, CreatedAt: time.Now()})
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?shared=1#share-links", http.StatusFound)
+}
@@ -0,0 +1,280 @@
+// sharecard.go - Cards to show off a streak milestone (7, 30, 100 or 365 days, see gamify.go):
+// "30-day streak! Meditate", drawn by the server in the habit's color. Each milestone has a
+// signed link (/share-card/3/30?sig=...) that works without the password:
+//
+//	/share-card/3/30       a small page with Open Graph tags, so a shared link shows the card
+//	/share-card/3/30.png   the card as a 1200x630 PNG, the size social networks use for previews
+//	/share-card/3/30.svg   the same card as SVG, sharper, with the habit's icon and any letters
+//
+// Reaching a milestone sends a notification (notify.go) with the link in it, and the
+// achievements page lists the links of every milestone a habit has reached. The PNG is drawn
+// with a small built-in font (pixelfont.go), so it only has capital letters and no emoji.
+// Private habits (privacy.go) have no cards: their links answer 404.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sizes of a share card, in pixels.
+const (
+	shareCardWidth   = 1200
+	shareCardHeight  = 630
+	shareCardPadding = 80
+)
+
+// shareCardMaxAge is how long browsers and link previews may keep a card. A card never changes
+// unless the habit is renamed or recolored.
+const shareCardMaxAge = 24 * time.Hour
+
+// streakMilestones are the streaks that earn a bonus (gamify.go), shortest first.
+func streakMilestones() []int {
+	var days []int
+	for d := range streakBonusXP {
+		days = append(days, d)
+	}
+	sort.Ints(days)
+	return days
+}
+
+// ShareCardPath is the signed path of the share page for habitID's milestone.
+func ShareCardPath(habitID, days int) string {
+	value := fmt.Sprintf("%d/%d", habitID, days)
+	return "/share-card/" + value + "?sig=" + signLink("share-card", value)
+}
+
+// ShareCardURL is ShareCardPath as a full URL to send to someone.
+func ShareCardURL(habitID, days int) string {
+	return publicURL() + ShareCardPath(habitID, days)
+}
+
+// shareCardImagePath is the path of the card's image; ext is ".png" or ".svg".
+func shareCardImagePath(habitID, days int, ext string) string {
+	value := fmt.Sprintf("%d/%d", habitID, days)
+	return "/share-card/" + value + ext + "?sig=" + signLink("share-card", value)
+}
+
+// ShareCard is what's on a card.
+type ShareCard struct {
+	Habit    string
+	Icon     string
+	Color    string // "#rrggbb"
+	Days     int
+	Headline string // "30-day streak!"
+	Footer   string // the next milestone, or how long it's been
+}
+
+// NewShareCard fills in the card for h's milestone of days.
+func NewShareCard(h *Habit, days int) ShareCard {
+	c := ShareCard{Habit: h.Name, Icon: h.Icon, Color: h.Color, Days: days, Headline: fmt.Sprintf("%d-day streak!", days)}
+	if c.Color == "" {
+		c.Color = widgetThemes["light"].done
+	}
+	c.Footer = "A whole year, every single day"
+	for _, next := range streakMilestones() {
+		if next > days {
+			c.Footer = fmt.Sprintf("Next stop: %d days", next)
+			break
+		}
+	}
+	return c
+}
+
+// shareCardColors are the colors both kinds of card use besides the habit's own.
+var shareCardColors = struct{ background, text, muted string }{"#0d1117", "#ffffff", "#8b949e"}
+
+// parseHexColor turns "#rrggbb" (see ValidColor) into a color; anything else is black.
+func parseHexColor(s string) color.RGBA {
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(s) != 7 {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 255}
+}
+
+// RenderShareCardSVG draws the card as SVG.
+func RenderShareCardSVG(c ShareCard) []byte {
+	name := c.Habit
+	if c.Icon != "" {
+		name = c.Icon + " " + c.Habit
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s: %s">`,
+		shareCardWidth, shareCardHeight, shareCardWidth, shareCardHeight, html.EscapeString(c.Habit), c.Headline)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="%s"/>`, shareCardWidth, shareCardHeight, shareCardColors.background)
+	fmt.Fprintf(&sb, `<rect y="%d" width="%d" height="24" fill="%s"/>`, shareCardHeight-24, shareCardWidth, c.Color)
+	sb.WriteString(`<g font-family="-apple-system,BlinkMacSystemFont,Segoe UI,Helvetica,Arial,sans-serif">`)
+	fmt.Fprintf(&sb, `<text x="%d" y="120" fill="%s" font-size="32">Habit Tracker</text>`, shareCardPadding, shareCardColors.muted)
+	fmt.Fprintf(&sb, `<text x="%d" y="280" fill="%s" font-size="120" font-weight="700">%s</text>`, shareCardPadding, c.Color, c.Headline)
+	fmt.Fprintf(&sb, `<text x="%d" y="400" fill="%s" font-size="72" font-weight="600" textLength="%d" lengthAdjust="spacingAndGlyphs">%s</text>`,
+		shareCardPadding, shareCardColors.text, min(len([]rune(name))*40, shareCardWidth-2*shareCardPadding), html.EscapeString(name))
+	fmt.Fprintf(&sb, `<text x="%d" y="520" fill="%s" font-size="36">%s</text>`, shareCardPadding, shareCardColors.muted, c.Footer)
+	sb.WriteString(`</g></svg>`)
+	return []byte(sb.String())
+}
+
+// RenderShareCardPNG draws the card as PNG, with the same layout as the SVG.
+func RenderShareCardPNG(c ShareCard) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, shareCardWidth, shareCardHeight))
+	accent := parseHexColor(c.Color)
+	fillRect(img, img.Bounds(), parseHexColor(shareCardColors.background))
+	fillRect(img, image.Rect(0, shareCardHeight-24, shareCardWidth, shareCardHeight), accent)
+
+	room := shareCardWidth - 2*shareCardPadding
+	lines := []struct {
+		text     string
+		y        int // top of the line
+		maxScale int
+		color    color.RGBA
+	}{
+		{"Habit Tracker", 90, 4, parseHexColor(shareCardColors.muted)},
+		{c.Headline, 170, 14, accent},
+		{c.Habit, 330, 9, parseHexColor(shareCardColors.text)},
+		{c.Footer, 480, 5, parseHexColor(shareCardColors.muted)},
+	}
+	for _, l := range lines {
+		text := pixelText(l.text)
+		// As big as fits: a long habit name gets smaller letters, and is cut if even that's too wide.
+		scale := l.maxScale
+		for scale > 3 && pixelWidth(text, scale) > room {
+			scale--
+		}
+		for len(text) > 0 && pixelWidth(text, scale) > room {
+			text = text[:len(text)-1]
+		}
+		drawPixelText(img, shareCardPadding, l.y, scale, text, l.color)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// notifiedMilestones remembers the milestones already announced ("habit/days/date"), so
+// unticking and ticking a habit again doesn't send the notification twice.
+var notifiedMilestones sync.Map
+
+// notifyMilestone sends the notification for h reaching a streak of days on date, with the link
+// to its share card. It's called by awardCompletion and sends in the background, so completing
+// a habit never waits for a slow channel.
+func notifyMilestone(h *Habit, days int, date string) {
+	if _, sent := notifiedMilestones.LoadOrStore(fmt.Sprintf("%d/%d/%s", h.ID, days, date), true); sent {
+		return
+	}
+	title := fmt.Sprintf("🔥 %d-day streak!", days)
+	body := fmt.Sprintf("%s: %d days in a row.", h.Name, days)
+	if !h.Private {
+		body += " Share it: " + ShareCardURL(h.ID, days)
+	}
+	go func() {
+		if err := Notify(title, body); err != nil {
+			log.Println("milestone notification:", err)
+		}
+	}()
+}
+
+// ShareCardView is a milestone on the achievements page, with the link to its card.
+type ShareCardView struct {
+	Habit string
+	Days  int
+	Path  string
+}
+
+// reachedMilestones returns the milestones each shared habit has reached (its longest streak).
+func reachedMilestones(data *AppData) []ShareCardView {
+	var out []ShareCardView
+	for _, h := range SharedHabits(data.Habits) {
+		for _, days := range streakMilestones() {
+			if h.LongestStreak >= days {
+				out = append(out, ShareCardView{Habit: h.Name, Days: days, Path: ShareCardPath(h.ID, days)})
+			}
+		}
+	}
+	return out
+}
+
+// ShareCardPageData is what share-card.html gets.
+type ShareCardPageData struct {
+	Settings Settings
+	Card     ShareCard
+	PageURL  string
+	ImageURL string // the PNG: link previews don't show SVG
+	SVGPath  string
+}
+
+// HandleShareCard handles GET /share-card/{habit}/{days}[.png|.svg]?sig=...: the share page
+// or the card itself.
+func HandleShareCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/share-card/")
+	ext := ""
+	for _, e := range []string{".png", ".svg"} {
+		if s, ok := strings.CutSuffix(rest, e); ok {
+			rest, ext = s, e
+		}
+	}
+	idText, daysText, _ := strings.Cut(rest, "/")
+	id, err1 := strconv.Atoi(idText)
+	days, err2 := strconv.Atoi(daysText)
+	if err1 != nil || err2 != nil || streakBonusXP[days] == 0 || !validLink("share-card", rest, r.URL.Query().Get("sig")) {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, id)
+	if habit == nil || habit.Private {
+		http.NotFound(w, r)
+		return
+	}
+	card := NewShareCard(habit, days)
+
+	switch ext {
+	case ".svg":
+		w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(shareCardMaxAge.Seconds())))
+		w.Write(RenderShareCardSVG(card))
+	case ".png":
+		img, err := RenderShareCardPNG(card)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(shareCardMaxAge.Seconds())))
+		w.Write(img)
+	default:
+		pd := ShareCardPageData{
+			Settings: data.Settings,
+			Card:     card,
+			PageURL:  ShareCardURL(id, days),
+			ImageURL: publicURL() + shareCardImagePath(id, days, ".png"),
+			SVGPath:  shareCardImagePath(id, days, ".svg"),
+		}
+		if err := tmpl.ExecuteTemplate(w, "share-card.html", pd); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// shortcuts.go - Keyboard shortcuts on the main page: the keys 1 to 9 mark the first nine habits
+// of today's list done, or undo them. The page sends the key press to POST /api/v1/complete, a
+// JSON version of the Done/Undo buttons, and shows the result. Each habit's number is shown next
+// to it, and GET /api/v1/today lists it too ("key"), so the list and the keys always agree:
+// both come from todaysHabits, which keeps the order habits were added in.
+//
+// Habits that ask for a confirmation (confirm.go) aren't toggled from the keyboard; their key
+// goes to the confirmation on the page instead.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// shortcutKeys is how many habits get a number key.
+const shortcutKeys = 9
+
+// todaysHabits splits the habits into today's list and the ones paused today, in the order they
+// were added.
+func todaysHabits(data *AppData, day string) (habits, paused []Habit) {
+	habits, paused = []Habit{}, []Habit{}
+	for _, h := range data.Habits {
+		if h.PausedOn(day) {
+			paused = append(paused, h)
+		} else {
+			habits = append(habits, h)
+		}
+	}
+	return habits, paused
+}
+
+// habitKeys maps the first habits of today's list to their number key (habit ID -> 1 to 9).
+func habitKeys(habits []Habit) map[int]int {
+	keys := make(map[int]int)
+	for i, h := range habits {
+		if i == shortcutKeys {
+			break
+		}
+		keys[h.ID] = i + 1
+	}
+	return keys
+}
+
+// CompleteRequest is the body of POST /api/v1/complete.
+type CompleteRequest struct {
+	HabitID int    `json:"habit_id"`
+	Action  string `json:"action"` // "complete", "uncomplete" or "toggle" (the default)
+}
+
+// CompleteResponse is the habit after the change and how many are still open today.
+type CompleteResponse struct {
+	Habit      TodayHabit `json:"habit"`
+	Incomplete int        `json:"incomplete"`
+}
+
+// HandleCompleteAPI handles POST /api/v1/complete: marks one of today's habits done or not, as
+// the Done and Undo buttons do. What the buttons would send elsewhere - to the week review, to a
+// confirmation, to finish a habit's prerequisites first - is answered with 409 and the reason.
+func HandleCompleteAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if req.Action != "" && req.Action != "toggle" && req.Action != "complete" && req.Action != "uncomplete" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown action"})
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	today := Today()
+	habit := FindHabitByID(data, req.HabitID)
+	if habit == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "habit not found"})
+		return
+	}
+	done := containsInt(data.History[today].CompletedHabits, habit.ID)
+	complete := req.Action == "complete" || (req.Action != "uncomplete" && !done)
+	var refuse string
+	switch {
+	case habit.PausedOn(today):
+		refuse = habit.Name + " is paused today"
+	case habit.Confirm != "":
+		refuse = habit.Name + " needs confirming on the page"
+	case complete:
+		refuse = completionBlocked(data, habit, today) // a due week review, prerequisites (deps.go)
+	}
+	if refuse != "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": refuse})
+		return
+	}
+
+	if complete != done {
+		SetHabitCompleted(data, habit.ID, today, complete)
+		if err := SaveData(data); err != nil {
+			writeJSON(w, saveStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	habits, _ := todaysHabits(data, today)
+	writeJSON(w, http.StatusOK, CompleteResponse{
+		Habit:      todayHabit(data, *habit, habitKeys(habits)[habit.ID]),
+		Incomplete: IncompleteHabitsToday(data),
+	})
+}
@@ -0,0 +1,316 @@
+// simulate.go - "What if" for the rules (/simulate). It replays your real history - which days
+// each habit was done, skipped or paused, when the week reviews were - once under the rules the
+// app uses now and once under other rules you pick, and draws how each target would have gone.
+// Nothing is saved: it is for trying out a gentler penalty or a stricter growth rule before
+// changing how you work.
+//
+// The history doesn't say what a target was on a given day, so each habit starts from the target
+// that, replayed under the current rules, ends closest to where the habit is today. Your own
+// changes (the −/+ buttons, quarterly resets) are replayed in both runs.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SimRules are the rules a simulation runs under.
+type SimRules struct {
+	Penalty   string // "default" (what the app does: −2, or −1 below 3), "fixed", "percent" or "none"
+	Amount    int    // "fixed": how much a miss takes off
+	Percent   int    // "percent": how many percent a miss takes off (always at least 1)
+	GraceDays int    // days a new habit is spared penalties
+	Growth    string // "actual" (what you chose at each review), "step" or "none"
+	Step      int    // "step": what each review adds (0 = each habit's weekly step)
+	MinRate   int    // "step": only grow after a week done at least this many percent
+}
+
+// currentSimRules are the rules the app uses now.
+func currentSimRules(s Settings) SimRules {
+	return SimRules{Penalty: "default", GraceDays: s.GraceDays(), Growth: "actual"}
+}
+
+// valid reports whether the rules can be simulated.
+func (r SimRules) valid() bool {
+	switch r.Penalty {
+	case "default", "none":
+	case "fixed":
+		if r.Amount < 1 || r.Amount > 999 {
+			return false
+		}
+	case "percent":
+		if r.Percent < 1 || r.Percent > 100 {
+			return false
+		}
+	default:
+		return false
+	}
+	return (r.Growth == "actual" || r.Growth == "step" || r.Growth == "none") &&
+		r.GraceDays >= 0 && r.GraceDays <= 30 && r.Step >= 0 && r.Step <= 999 && r.MinRate >= 0 && r.MinRate <= 100
+}
+
+// penalize returns the target q after a missed day.
+func (r SimRules) penalize(q int) int {
+	switch r.Penalty {
+	case "fixed":
+		q -= r.Amount
+	case "percent":
+		d := q * r.Percent / 100
+		if d < 1 {
+			d = 1
+		}
+		q -= d
+	case "none":
+	default:
+		h := Habit{Quantity: q}
+		ApplyMissPenalty(&h)
+		q = h.Quantity
+	}
+	if q < 1 {
+		q = 1
+	}
+	return q
+}
+
+// simResult is one habit's run: its target at the end of each day, and how many penalties.
+type simResult struct {
+	Targets   []int
+	Penalties int
+}
+
+// simulateHabit replays days (in order) for h from the target start under rules.
+// manual maps day -> the changes you made to h by hand that day.
+func simulateHabit(data *AppData, h Habit, days []string, start int, rules SimRules, manual map[string]int) simResult {
+	res := simResult{Targets: make([]int, 0, len(days))}
+	q := start
+	done, counted := 0, 0 // since the last review, for MinRate
+	created := ""
+	if !h.CreatedAt.IsZero() {
+		created = h.CreatedAt.Format(dateLayout)
+	}
+	limit := func(q int) int {
+		if h.MaxQuantity > 0 && q > h.MaxQuantity {
+			q = h.MaxQuantity
+		}
+		if q < 1 {
+			q = 1
+		}
+		return q
+	}
+	for _, day := range days {
+		rec := data.History[day]
+		if day < created {
+			res.Targets = append(res.Targets, q)
+			continue
+		}
+		q = limit(q + manual[day])
+		// A review on this day comes before the day's own miss, as in the app (the miss is
+		// only penalized the next morning).
+		if (rec.WeekReviewDone || rec.WeekReview != nil) && !h.PausedOn(day) {
+			switch rules.Growth {
+			case "actual":
+				step := h.WeeklyStep() // reviews from before decisions were kept grew by the step
+				if rec.WeekReview != nil {
+					step = 0
+					for _, d := range rec.WeekReview.Decisions {
+						if d.HabitID == h.ID {
+							step = d.To - d.From
+						}
+					}
+				}
+				q = limit(q + step)
+			case "step":
+				if counted == 0 || done*100/counted >= rules.MinRate {
+					step := rules.Step
+					if step == 0 {
+						step = h.WeeklyStep()
+					}
+					q = limit(q + step)
+				}
+			}
+			done, counted = 0, 0
+		}
+		completed := containsInt(rec.CompletedHabits, h.ID)
+		excused := containsInt(rec.SkippedHabits, h.ID) || h.PausedOn(day) || InGracePeriod(h, day, rules.GraceDays)
+		if !excused {
+			counted++
+			if completed {
+				done++
+			} else if !h.PenaltyExempt { // exempt habits never shrink, whatever the rules
+				q = limit(rules.penalize(q))
+				res.Penalties++
+			}
+		}
+		res.Targets = append(res.Targets, q)
+	}
+	return res
+}
+
+// manualChanges returns, per habit and day, the target changes made by hand: −/+ adjustments
+// and quarterly review resets. They happened whatever the rules, so both runs replay them.
+func manualChanges(data *AppData) map[int]map[string]int {
+	out := make(map[int]map[string]int)
+	add := func(id int, day string, delta int) {
+		if out[id] == nil {
+			out[id] = make(map[string]int)
+		}
+		out[id][day] += delta
+	}
+	for _, a := range data.Adjustments {
+		add(a.HabitID, a.Time.In(time.Local).Format(dateLayout), a.To-a.From)
+	}
+	for day, rec := range data.History {
+		if rec.QuarterReview != nil {
+			for _, d := range rec.QuarterReview.Decisions {
+				add(d.HabitID, day, d.To-d.From)
+			}
+		}
+	}
+	return out
+}
+
+// simStart finds the start target whose replay under the current rules ends closest to now.
+func simStart(data *AppData, h Habit, days []string, rules SimRules, manual map[string]int) int {
+	best, bestDiff := h.Quantity, -1
+	top := h.Quantity*4 + 50
+	if h.MaxQuantity > 0 && top > h.MaxQuantity {
+		top = h.MaxQuantity
+	}
+	for s := 1; s <= top; s++ {
+		res := simulateHabit(data, h, days, s, rules, manual)
+		diff := res.Targets[len(res.Targets)-1] - h.Quantity
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = s, diff
+		}
+		if diff == 0 {
+			break
+		}
+	}
+	return best
+}
+
+// chartPoints turns targets into the points of an SVG polyline in a width x height box, with
+// max at the top.
+func chartPoints(targets []int, max, width, height int) string {
+	var sb strings.Builder
+	for i, q := range targets {
+		x := 0
+		if len(targets) > 1 {
+			x = i * width / (len(targets) - 1)
+		}
+		y := height - 2 - q*(height-4)/max
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%d,%d", x, y)
+	}
+	return sb.String()
+}
+
+// SimHabitView is one habit on the /simulate page.
+type SimHabitView struct {
+	Name, Unit       string
+	Start            int // the target at the start of the period
+	Now              int // the real target today
+	Current, WhatIf  int // the target at the end, under the current and the other rules
+	CurrentPenalties int
+	WhatIfPenalties  int
+	CurrentPoints    string // SVG polyline points
+	WhatIfPoints     string
+	Max              int // the top of the chart
+}
+
+// SimulatePageData is what simulate.html gets.
+type SimulatePageData struct {
+	Settings Settings
+	Rules    SimRules
+	Days     int    // how far back the replay starts
+	From     string // its first day
+	Habits   []SimHabitView
+	Message  string
+}
+
+// simDayChoices are the periods the page offers.
+var simDayChoices = map[int]bool{30: true, 90: true, 180: true, 365: true}
+
+// HandleSimulate shows the simulator (GET /simulate). Query: days=90&penalty=fixed&amount=1
+// &percent=20&grace=1&growth=step&step=1&min_rate=80 (all optional; missing = today's rules).
+func HandleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	current := currentSimRules(data.Settings)
+	q := r.URL.Query()
+	number := func(name string, def int) int {
+		if n, err := strconv.Atoi(q.Get(name)); err == nil {
+			return n
+		}
+		return def
+	}
+	rules := SimRules{
+		Penalty:   q.Get("penalty"),
+		Amount:    number("amount", 1),
+		Percent:   number("percent", 20),
+		GraceDays: number("grace", current.GraceDays),
+		Growth:    q.Get("growth"),
+		Step:      number("step", 0),
+		MinRate:   number("min_rate", 0),
+	}
+	if rules.Penalty == "" {
+		rules.Penalty = current.Penalty
+	}
+	if rules.Growth == "" {
+		rules.Growth = current.Growth
+	}
+	pd := SimulatePageData{Settings: data.Settings, Rules: rules, Days: number("days", 90)}
+	if !simDayChoices[pd.Days] {
+		pd.Days = 90
+	}
+	if !rules.valid() {
+		pd.Message = "Check the rules: amounts 1–999, percent 1–100, grace 0–30 days, rate 0–100%."
+		pd.Rules = current
+		rules = current
+	}
+	yesterday, _ := ParseDate(Yesterday())
+	pd.From = yesterday.AddDate(0, 0, 1-pd.Days).Format(dateLayout)
+	days, err := DatesInRange(pd.From, Yesterday())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	manual := manualChanges(data)
+	for _, h := range data.Habits {
+		start := simStart(data, h, days, current, manual[h.ID])
+		cur := simulateHabit(data, h, days, start, current, manual[h.ID])
+		alt := simulateHabit(data, h, days, start, rules, manual[h.ID])
+		v := SimHabitView{
+			Name: h.Name, Unit: h.Unit, Start: start, Now: h.Quantity,
+			Current: cur.Targets[len(cur.Targets)-1], WhatIf: alt.Targets[len(alt.Targets)-1],
+			CurrentPenalties: cur.Penalties, WhatIfPenalties: alt.Penalties, Max: 1,
+		}
+		for _, t := range append(cur.Targets, alt.Targets...) {
+			if t > v.Max {
+				v.Max = t
+			}
+		}
+		v.CurrentPoints = chartPoints(cur.Targets, v.Max, 300, 80)
+		v.WhatIfPoints = chartPoints(alt.Targets, v.Max, 300, 80)
+		pd.Habits = append(pd.Habits, v)
+	}
+	if err := tmpl.ExecuteTemplate(w, "simulate.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,102 @@
+// skip.go - Skip tokens. Every habit gets a few tokens per month (Settings, default 2) that
+// excuse a day: a skipped day is never penalized and doesn't break the streak. You can skip
+// today ahead of time (sick, travelling) or excuse a day of the last week you missed; if that
+// day was already penalized, the penalty is undone.
+// The balance is kept in data.SkipTokens and refills at the start of each month.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultSkipTokens is how many skip tokens a habit gets per month if the settings don't say.
+const defaultSkipTokens = 2
+
+// skipWindowDays is how far back a missed day can still be excused.
+const skipWindowDays = 7
+
+// SkipBalance is a habit's skip tokens left in Month ("2006-01").
+type SkipBalance struct {
+	Month string `json:"month"`
+	Left  int    `json:"left"`
+}
+
+// SkipTokensLeft returns how many tokens the habit has left this month (a new month starts full).
+func SkipTokensLeft(data *AppData, habitID int, now time.Time) int {
+	b, ok := data.SkipTokens[habitID]
+	if !ok || b.Month != now.Format("2006-01") {
+		return data.Settings.SkipTokensPerMonth()
+	}
+	return b.Left
+}
+
+// SkipDay spends one of the habit's tokens to excuse day. It undoes a penalty already applied
+// for that day (using the amount recorded in PenaltyAmounts). It returns an error code for the
+// page: "" on success, "skip" if the day can't be skipped, "notokens" if none are left.
+func SkipDay(data *AppData, h *Habit, day string, now time.Time) string {
+	today := now.Format(dateLayout)
+	oldest := now.AddDate(0, 0, -skipWindowDays).Format(dateLayout)
+	if _, err := ParseDate(day); err != nil || day > today || day < oldest {
+		return "skip"
+	}
+	if !h.ExistedOn(day) {
+		return "skip"
+	}
+	rec := data.History[day]
+	if containsInt(rec.CompletedHabits, h.ID) || containsInt(rec.SkippedHabits, h.ID) {
+		return "skip"
+	}
+	left := SkipTokensLeft(data, h.ID, now)
+	if left <= 0 {
+		return "notokens"
+	}
+
+	rec.Date = day
+	rec.SkippedHabits = append(rec.SkippedHabits, h.ID)
+	refundMissPenalty(&rec, h)
+	data.History[day] = rec
+	if data.SkipTokens == nil {
+		data.SkipTokens = make(map[int]SkipBalance)
+	}
+	data.SkipTokens[h.ID] = SkipBalance{Month: now.Format("2006-01"), Left: left - 1}
+	return ""
+}
+
+// HandleSkip handles POST to spend a skip token. Form: habit_id=1&date=2025-01-28 (default today)
+func HandleSkip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	day := r.FormValue("date")
+	if day == "" {
+		day = Today()
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	if code := SkipDay(data, habit, day, time.Now()); code != "" {
+		http.Redirect(w, r, "/?error="+code, http.StatusFound)
+		return
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?skipped=1", http.StatusFound)
+}
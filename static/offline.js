@@ -0,0 +1,62 @@
+// offline.js - Offline completion queue. When the device is offline, clicking Done/Undo doesn't
+// reach the server; instead the completion is stored in localStorage with the local date, and
+// sent to /api/v1/batch as soon as the connection comes back.
+(function() {
+  var KEY = 'habit-offline-queue';
+
+  function load() {
+    try { return JSON.parse(localStorage.getItem(KEY)) || []; } catch (e) { return []; }
+  }
+  function save(queue) { localStorage.setItem(KEY, JSON.stringify(queue)); }
+  function localDate() {
+    var d = new Date();
+    var m = d.getMonth() + 1, day = d.getDate();
+    return d.getFullYear() + '-' + (m < 10 ? '0' : '') + m + '-' + (day < 10 ? '0' : '') + day;
+  }
+
+  function flush() {
+    var queue = load();
+    if (!queue.length || !navigator.onLine) return;
+    fetch('/api/v1/batch', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ completions: queue })
+    }).then(function(res) {
+      if (!res.ok) return;
+      save([]);
+      window.location.reload();
+    }).catch(function() { /* still offline; try again later */ });
+  }
+
+  document.addEventListener('submit', function(e) {
+    var form = e.target;
+    if (navigator.onLine || form.getAttribute('action') !== '/complete') return;
+    e.preventDefault();
+    var action = form.querySelector('input[name="action"]');
+    var queue = load();
+    queue.push({
+      habit_id: parseInt(form.querySelector('input[name="habit_id"]').value, 10),
+      action: action ? action.value : 'complete',
+      date: localDate()
+    });
+    save(queue);
+    var btn = form.querySelector('button');
+    if (btn) { btn.textContent = 'Queued'; btn.disabled = true; }
+  });
+
+  // App icon badge: the number of habits still open today (installed app only, where supported).
+  function updateBadge() {
+    if (!navigator.setAppBadge || !navigator.onLine) return;
+    fetch('/api/v1/badge').then(function(res) { return res.json(); }).then(function(b) {
+      if (b.count > 0) navigator.setAppBadge(b.count); else navigator.clearAppBadge();
+    }).catch(function() {});
+  }
+
+  window.addEventListener('online', flush);
+  flush();
+  updateBadge();
+
+  if ('serviceWorker' in navigator) {
+    navigator.serviceWorker.register('/static/sw.js', { scope: '/' });
+  }
+})();
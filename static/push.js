@@ -0,0 +1,56 @@
+// push.js - The "Push notifications" button on the settings page. Subscribing needs a service
+// worker (sw.js shows the notifications), the user's permission, and the server's VAPID public
+// key from GET /subscribe. The resulting subscription is sent to POST /subscribe.
+(function() {
+  var btn = document.getElementById('push-toggle');
+  var status = document.getElementById('push-status');
+  if (!btn) return;
+  if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+    status.textContent = 'This browser does not support push notifications.';
+    return;
+  }
+
+  // The VAPID key is base64url; pushManager.subscribe wants raw bytes.
+  function keyBytes(b64) {
+    var s = (b64 + '='.repeat((4 - b64.length % 4) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+    var raw = atob(s), out = new Uint8Array(raw.length);
+    for (var i = 0; i < raw.length; i++) out[i] = raw.charCodeAt(i);
+    return out;
+  }
+
+  function send(method, sub) {
+    return fetch('/subscribe', {
+      method: method,
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(sub)
+    }).then(function(res) { if (!res.ok) throw new Error('server said ' + res.status); });
+  }
+
+  navigator.serviceWorker.register('/static/sw.js', { scope: '/' }).then(function() {
+    return navigator.serviceWorker.ready;
+  }).then(function(reg) {
+    function show(sub) {
+      btn.disabled = false;
+      btn.textContent = sub ? 'Disable on this device' : 'Enable on this device';
+      status.textContent = sub ? 'Enabled.' : '';
+    }
+    reg.pushManager.getSubscription().then(show);
+
+    btn.addEventListener('click', function() {
+      btn.disabled = true;
+      reg.pushManager.getSubscription().then(function(sub) {
+        if (sub) {
+          return send('DELETE', sub).then(function() { return sub.unsubscribe(); }).then(function() { show(null); });
+        }
+        return fetch('/subscribe').then(function(res) { return res.json(); }).then(function(k) {
+          return reg.pushManager.subscribe({ userVisibleOnly: true, applicationServerKey: keyBytes(k.public_key) });
+        }).then(function(sub) {
+          return send('POST', sub).then(function() { show(sub); });
+        });
+      }).catch(function(err) {
+        btn.disabled = false;
+        status.textContent = 'Could not change push notifications: ' + err.message;
+      });
+    });
+  });
+})();
@@ -0,0 +1,58 @@
+// sw.js - Service worker for the installable app. It keeps a copy of the last loaded page and
+// the static files, so the app still opens without a connection. Completions made while offline
+// are queued by offline.js (in the page) and sent to /api/v1/batch when the connection is back.
+// The worker is served from /static/ with "Service-Worker-Allowed: /" so it can control "/".
+
+const CACHE = 'habits-v3';
+const ASSETS = ['/', '/static/offline.js', '/static/push.js', '/static/manifest.json', '/static/icon.svg'];
+
+self.addEventListener('install', (event) => {
+  event.waitUntil(caches.open(CACHE).then((cache) => cache.addAll(ASSETS)));
+  self.skipWaiting();
+});
+
+self.addEventListener('activate', (event) => {
+  event.waitUntil(
+    caches.keys().then((keys) => Promise.all(keys.filter((k) => k !== CACHE).map((k) => caches.delete(k))))
+  );
+  self.clients.claim();
+});
+
+// Web Push (webpush.go): show the notification, and open the app when it is clicked.
+self.addEventListener('push', (event) => {
+  let msg = { title: 'Habit Tracker', body: '', url: '/' };
+  try { msg = Object.assign(msg, event.data.json()); } catch (e) { /* not JSON: keep the defaults */ }
+  event.waitUntil(self.registration.showNotification(msg.title, {
+    body: msg.body,
+    icon: '/static/icon.svg',
+    data: { url: msg.url },
+  }));
+});
+
+self.addEventListener('notificationclick', (event) => {
+  event.notification.close();
+  event.waitUntil(self.clients.openWindow(event.notification.data.url || '/'));
+});
+
+self.addEventListener('fetch', (event) => {
+  const req = event.request;
+  if (req.method !== 'GET') return; // form posts go to the network (offline.js queues them)
+  const url = new URL(req.url);
+  if (url.origin !== location.origin || url.pathname.startsWith('/api/')) return;
+
+  if (req.mode === 'navigate') {
+    // Pages: network first, so you always see fresh data; fall back to the cached page offline.
+    event.respondWith(
+      fetch(req)
+        .then((res) => {
+          const copy = res.clone();
+          caches.open(CACHE).then((cache) => cache.put('/', copy));
+          return res;
+        })
+        .catch(() => caches.match('/'))
+    );
+    return;
+  }
+  // Static files: cache first.
+  event.respondWith(caches.match(req).then((hit) => hit || fetch(req)));
+});
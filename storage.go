@@ -5,8 +5,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 )
 
 // dataFile is the path to our JSON file. In Go, we can declare variables at package level.
@@ -17,28 +21,83 @@ const dataFile = "data.json"
 // sync.Mutex has Lock() and Unlock() methods.
 var mu sync.Mutex
 
-// LoadData reads the JSON file from disk and decodes it into an AppData struct.
+// lastSaved remembers the modification time and size of the file we last wrote, so the
+// file watcher (see conflicts.go) can tell our own writes apart from changes made by others.
+var lastSaved struct {
+	mod  time.Time
+	size int64
+}
+
+// ErrDataChanged is what SaveData returns when the data was saved again after d was loaded:
+// writing d would throw that change away. Load again, redo the change, and save.
+var ErrDataChanged = errors.New("the data changed since it was loaded")
+
+// slowStorageThreshold returns how long a file read or write may take before it is logged as
+// slow: SLOW_STORAGE_MS in .env, default 250 ms. Slow SD cards and network folders show up here.
+func slowStorageThreshold() time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv("SLOW_STORAGE_MS")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return 250 * time.Millisecond
+}
+
+// warnIfSlow logs a warning if a storage operation that began at start took longer than the
+// threshold. slog writes structured key=value pairs, e.g.
+//
+//	WARN slow storage operation op=write file=data.json bytes=48213 took=612ms threshold=250ms
+//
+// Note the time before the operation and call it right after: warnIfSlow("read", path, n, start)
+func warnIfSlow(op, file string, size int, start time.Time) {
+	took := time.Since(start)
+	limit := slowStorageThreshold()
+	if took <= limit {
+		return
+	}
+	slog.Warn("slow storage operation", "op", op, "file", file, "bytes", size,
+		"took", took.Round(time.Millisecond), "threshold", limit)
+}
+
+// LoadData returns the app data as an AppData struct.
 // It returns a pointer to AppData - in Go, we often use pointers (*AppData) to avoid
 // copying large structs. The caller can modify the data and then call SaveData.
+// The file is only read the first time (and after another program changed it); after that
+// the data comes from memory, as a copy that is the caller's own (see store.go).
 func LoadData() (*AppData, error) {
-	mu.Lock()         // Acquire the lock - only one goroutine can hold it at a time
-	defer mu.Unlock() // defer runs when the function returns - we always unlock, even on error
+	d, err := storedData()
+	if err != nil {
+		return nil, err
+	}
+	return cloneData(d), nil
+}
 
+// loadDataFile does the actual reading for LoadData. It takes a path so we can also read
+// other copies of the data, like sync conflict files. The caller handles locking.
+func loadDataFile(path string) (*AppData, error) {
 	// os.ReadFile reads the entire file into a byte slice ([]byte).
 	// In Go, error is a built-in interface type - functions often return (value, error).
-	bytes, err := os.ReadFile(dataFile)
+	start := time.Now()
+	bytes, err := os.ReadFile(path)
+	warnIfSlow("read", path, len(bytes), start)
+	if err == nil {
+		bytes, err = openData(bytes) // decrypts, if DATA_PASSPHRASE is set (encrypt.go)
+	}
 	if err != nil {
 		// os.IsNotExist checks if the error is "file not found" - first run
 		if os.IsNotExist(err) {
 			return &AppData{
-				Habits:  []Habit{},
-				Todos:   []Todo{},
-				History: make(map[string]DayRecord), // maps must be initialized with make() before use
+				Habits:        []Habit{},
+				Todos:         []Todo{},
+				History:       make(map[string]DayRecord), // maps must be initialized with make() before use
+				SchemaVersion: schemaVersion,              // new data needs no upgrades (schema.go)
 			}, nil
 		}
 		return nil, err // Pass through other errors (permission, etc.)
 	}
+	return decodeData(bytes)
+}
 
+// decodeData decodes the JSON of an AppData (a file's content, or a database row).
+func decodeData(bytes []byte) (*AppData, error) {
 	var data AppData
 	// json.Unmarshal decodes JSON bytes into a struct. We pass a pointer &data so Unmarshal can fill it.
 	if err := json.Unmarshal(bytes, &data); err != nil {
@@ -52,21 +111,86 @@ func LoadData() (*AppData, error) {
 	if data.Todos == nil {
 		data.Todos = []Todo{}
 	}
+	// Data written by an older version of the app is upgraded to the current shape.
+	if err := migrateData(&data); err != nil {
+		return nil, err
+	}
 	return &data, nil
 }
 
-// SaveData encodes the AppData struct to JSON and writes it to the file.
+// SaveData keeps the changes in d: they are appended to the change journal (journal.go),
+// and d becomes the data in memory, which store.go writes to the file shortly after.
 // We use a pointer receiver (d *AppData) so we don't copy the whole struct.
+// If the data was saved since d was loaded, nothing is kept and ErrDataChanged is returned.
 func SaveData(d *AppData) error {
+	if pg != nil {
+		return pgSaveData(d, nil, false) // postgres.go
+	}
 	mu.Lock()
 	defer mu.Unlock()
 
+	// nil if data.json can't be read: then there's nothing to compare with, as on the first run.
+	prev, _ := storedDataLocked()
+	if prev != nil && prev.Revision != d.Revision {
+		return ErrDataChanged
+	}
+	events, err := journalChanges(prev, d)
+	if err != nil || len(events) == 0 {
+		// Nothing changed: don't save, so the revision (and other tabs' pages) stay current.
+		return err
+	}
+	err = keepData(d)
+	broadcastChanges(events, d.Revision) // open pages update themselves (live.go)
+	return err
+}
+
+// saveWithEvents is SaveData for changes that arrive as journal events (from sync): the events
+// are appended to the journal as they are, instead of being worked out by comparing.
+func saveWithEvents(d *AppData, events []JournalEvent) error {
+	if pg != nil {
+		return pgSaveData(d, events, true)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	if prev, err := storedDataLocked(); err == nil && prev.Revision != d.Revision {
+		return ErrDataChanged
+	}
+	if err := writeJournalEvents(events); err != nil {
+		return err
+	}
+	err := keepData(d)
+	broadcastChanges(events, d.Revision)
+	return err
+}
+
+// writeDataFile writes d to data.json. The caller holds mu.
+func writeDataFile(d *AppData) error {
 	// json.MarshalIndent produces pretty-printed JSON (with indentation) - easier to read/debug.
 	// The second argument is the prefix for each line (empty), third is indent string.
 	bytes, err := json.MarshalIndent(d, "", "  ")
+	if err == nil {
+		bytes, err = sealData(bytes) // encrypts, if DATA_PASSPHRASE is set (encrypt.go)
+	}
 	if err != nil {
 		return err
 	}
 	// os.WriteFile writes bytes to a file. 0644 means: owner read+write, others read only (Unix permissions).
-	return os.WriteFile(dataFile, bytes, 0644)
+	start := time.Now()
+	err = os.WriteFile(dataFile, bytes, 0644)
+	warnIfSlow("write", dataFile, len(bytes), start)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dataFile); err == nil {
+		lastSaved.mod, lastSaved.size = fi.ModTime(), fi.Size()
+	}
+	return nil
+}
+
+// wroteItOurselves reports whether fi describes the file exactly as SaveData last left it.
+func wroteItOurselves(fi os.FileInfo) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return fi.ModTime().Equal(lastSaved.mod) && fi.Size() == lastSaved.size
 }
@@ -0,0 +1,258 @@
+// store.go - Keeping the data in memory. Reading and parsing all of data.json on every request
+// gets slow once there are years of history, so the file is read once and the data kept:
+//
+//   - LoadData hands out a copy of the data in memory (a copy, so the caller can change it
+//     before SaveData without anyone else seeing half a change). Readers only take the read
+//     side of an RWMutex, so they never wait for each other - only, briefly, for a save.
+//   - SaveData still appends the changes to the journal (journal.go) right away, then replaces
+//     the data in memory and writes data.json a moment later. Saves that come in quick
+//     succession are written once. Set the delay in .env: WRITE_DELAY_MS=1000 (the default;
+//     0 writes on every save, as before).
+//   - Pending changes are written when the server is stopped (Ctrl+C, or SIGTERM from systemd
+//     or Docker) and at the end of a terminal command. If the program is killed before that,
+//     the journal still has them: -rebuild-journal gets them back.
+//
+// When another program changes data.json (the sync tool, a terminal command), the next read
+// notices the new modification time and reads the file again. If our own changes were still
+// waiting to be written then, they are kept in a conflict copy next to it, to merge from the
+// web page (conflicts.go).
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// store is the data in memory. Its fields only change while holding both mu and the store's
+// own lock, so holding either one is enough to read them. data is replaced on every save and
+// never changed in place: a reader may keep using the pointer after unlocking.
+var store struct {
+	sync.RWMutex
+	data       *AppData  // nil until data.json is first read
+	mod        time.Time // data.json's modification time and size when data was read or written
+	size       int64     // (both zero while there is no file)
+	dirty      bool      // data has changes data.json doesn't have yet
+	dirtySince time.Time // when the oldest of those changes was made
+	timer      *time.Timer
+}
+
+// writeDelay returns how long after a save data.json is written: WRITE_DELAY_MS in .env,
+// default 1 second. 0 writes right away.
+func writeDelay() time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv("WRITE_DELAY_MS")); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return time.Second
+}
+
+// fileStamp returns data.json's modification time and size, or zeros when it can't be read.
+func fileStamp() (time.Time, int64) {
+	fi, err := os.Stat(dataFile)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+// storedData returns the data in memory, reading data.json first if it isn't loaded yet or
+// another program has changed it. The result is shared: read it, don't change it.
+func storedData() (*AppData, error) {
+	if pg != nil {
+		return pgStoredData()
+	}
+	mod, size := fileStamp()
+	store.RLock()
+	d := store.data
+	fresh := d != nil && mod.Equal(store.mod) && size == store.size
+	store.RUnlock()
+	if fresh {
+		return d, nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return storedDataLocked()
+}
+
+// storedDataLocked is storedData for callers that hold mu.
+func storedDataLocked() (*AppData, error) {
+	if pg != nil {
+		return pgLoadLocked()
+	}
+	mod, size := fileStamp()
+	if store.data != nil && mod.Equal(store.mod) && size == store.size {
+		return store.data, nil
+	}
+	if store.data != nil && store.dirty {
+		keepConflictCopy()
+	}
+	d, err := loadDataFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	store.Lock()
+	reread := store.data != nil
+	store.data, store.mod, store.size, store.dirty = d, mod, size, false
+	store.Unlock()
+	if reread {
+		// Another program changed data.json: open pages show its version (live.go).
+		broadcastLive(LiveEvent{Type: "change", Revision: d.Revision, Changes: []LiveChange{{Op: "reload"}}})
+	}
+	return d, nil
+}
+
+// keepData makes d, with the next revision, the data in memory and writes it to data.json
+// now or after writeDelay. The caller holds mu and has journaled the changes.
+func keepData(d *AppData) error {
+	d.Revision++
+	kept := cloneData(d) // the caller may go on changing d
+	store.Lock()
+	if !store.dirty {
+		store.dirtySince = time.Now()
+	}
+	store.data, store.dirty = kept, true
+	store.Unlock()
+
+	delay := writeDelay()
+	if delay == 0 {
+		if err := flushLocked(); err != nil {
+			scheduleFlush(time.Second) // try again; the change is in memory and in the journal
+			return err
+		}
+		return nil
+	}
+	// Each save pushes the write back, but not beyond ten delays after the first unwritten
+	// change, so a steady stream of saves still reaches the disk.
+	if time.Since(store.dirtySince) < 10*delay || store.timer == nil {
+		scheduleFlush(delay)
+	}
+	return nil
+}
+
+// scheduleFlush (re)starts the timer that writes pending changes. The caller holds mu.
+func scheduleFlush(delay time.Duration) {
+	if store.timer == nil {
+		store.timer = time.AfterFunc(delay, flushInBackground)
+		return
+	}
+	store.timer.Reset(delay)
+}
+
+// flushInBackground is the timer's function: it writes pending changes, and tries again a
+// little later if that fails.
+func flushInBackground() {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := flushLocked(); err != nil {
+		log.Println("writing data.json:", err)
+		scheduleFlush(5 * time.Second)
+	}
+}
+
+// FlushData writes pending changes to data.json now. main calls it before the program exits.
+func FlushData() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if store.timer != nil {
+		store.timer.Stop()
+	}
+	return flushLocked()
+}
+
+// flushLocked writes pending changes to data.json. The caller holds mu.
+func flushLocked() error {
+	if !store.dirty {
+		return nil
+	}
+	if mod, size := fileStamp(); !mod.Equal(store.mod) || size != store.size {
+		// Someone else wrote data.json while our changes waited: don't overwrite theirs.
+		keepConflictCopy()
+		store.Lock()
+		store.data, store.dirty = nil, false // the next read loads their version
+		store.Unlock()
+		return nil
+	}
+	if err := writeDataFile(store.data); err != nil {
+		return err
+	}
+	mod, size := fileStamp()
+	store.Lock()
+	store.mod, store.size, store.dirty = mod, size, false
+	store.Unlock()
+	return nil
+}
+
+// keepConflictCopy writes the data in memory to a conflict copy next to data.json, named like
+// Syncthing's so FindConflictFiles offers it for merging. The caller holds mu.
+func keepConflictCopy() {
+	ext := filepath.Ext(dataFile)
+	name := strings.TrimSuffix(dataFile, ext) + ".sync-conflict-" + time.Now().Format("20060102-150405") + "-UNSAVED" + ext
+	bytes, err := json.MarshalIndent(store.data, "", "  ")
+	if err == nil {
+		bytes, err = sealData(bytes)
+	}
+	if err == nil {
+		err = os.WriteFile(name, bytes, 0644)
+	}
+	if err != nil {
+		log.Println("data.json changed on disk before our changes were written, and keeping them failed:", err)
+		return
+	}
+	log.Printf("data.json changed on disk before our changes were written; they are in %s, merge them from the web page", name)
+}
+
+// cloneData returns a deep copy of d: no map, slice or pointer is shared with d.
+func cloneData(d *AppData) *AppData {
+	return deepCopy(reflect.ValueOf(d)).Interface().(*AppData)
+}
+
+// deepCopy copies v and everything it points to. The reflect package lets one function walk
+// any Go value: pointers, structs, slices and maps are rebuilt, everything else (numbers,
+// strings, and unexported fields like the inside of a time.Time) is copied as it is.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(deepCopy(v.Elem()))
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,321 @@
+// strava.go - Completing exercise habits from Strava. Connect your account once on the settings
+// page (OAuth); every 30 minutes the app then reads your activities of the last week and
+// completes each linked habit on the days its activity type reaches the habit's minimum
+// distance and/or duration (activities of the same day add up). Set a habit's Strava link
+// under "Habit settings", e.g. "Run" ← Run, at least 5 km.
+//
+// Create an API application at https://www.strava.com/settings/api with PUBLIC_URL's host as
+// the "Authorization Callback Domain", then set in .env:
+//
+//	STRAVA_CLIENT_ID=12345
+//	STRAVA_CLIENT_SECRET=...
+//
+// The tokens are kept in data.json (data.Strava). Completions are tagged "strava".
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stravaAuthorizeURL = "https://www.strava.com/oauth/authorize"
+	stravaTokenURL     = "https://www.strava.com/oauth/token"
+	stravaDeauthorize  = "https://www.strava.com/oauth/deauthorize"
+	stravaAPI          = "https://www.strava.com/api/v3"
+)
+
+// stravaTypes are the activity types a habit can be linked to ("" = not linked).
+var stravaTypes = []string{"Run", "Ride", "Swim", "Walk", "Hike", "WeightTraining", "Yoga", "Workout"}
+
+// StravaAuth is the connected Strava account.
+type StravaAuth struct {
+	Athlete      string `json:"athlete"` // first name, to show on the settings page
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"` // Unix time the access token stops working
+}
+
+// StravaActivity is the part of a Strava activity we use.
+type StravaActivity struct {
+	SportType      string  `json:"sport_type"`
+	Type           string  `json:"type"`
+	Distance       float64 `json:"distance"`    // meters
+	MovingTime     int     `json:"moving_time"` // seconds
+	StartDateLocal string  `json:"start_date_local"`
+}
+
+// stravaClient returns the app's Strava client ID and secret (empty when not configured).
+func stravaClient() (id, secret string) {
+	return os.Getenv("STRAVA_CLIENT_ID"), os.Getenv("STRAVA_CLIENT_SECRET")
+}
+
+// stravaTypesIfConfigured returns stravaTypes for the habit settings, or nil when Strava isn't
+// set up (then the form is left out).
+func stravaTypesIfConfigured() []string {
+	if id, _ := stravaClient(); id == "" {
+		return nil
+	}
+	return stravaTypes
+}
+
+// stravaToken calls the token endpoint (for a new code or a refresh) and returns the account.
+func stravaToken(form url.Values) (*StravaAuth, error) {
+	id, secret := stravaClient()
+	form.Set("client_id", id)
+	form.Set("client_secret", secret)
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.PostForm(stravaTokenURL, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("strava token: %s", resp.Status)
+	}
+	var out struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresAt    int64  `json:"expires_at"`
+		Athlete      struct {
+			FirstName string `json:"firstname"`
+		} `json:"athlete"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &StravaAuth{Athlete: out.Athlete.FirstName, AccessToken: out.AccessToken, RefreshToken: out.RefreshToken, ExpiresAt: out.ExpiresAt}, nil
+}
+
+// FetchStravaActivities returns the activities since after. It refreshes the access token first
+// if it runs out within a minute (auth is updated in place; the caller saves it).
+func FetchStravaActivities(auth *StravaAuth, after time.Time) ([]StravaActivity, error) {
+	if time.Now().Add(time.Minute).Unix() >= auth.ExpiresAt {
+		fresh, err := stravaToken(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {auth.RefreshToken}})
+		if err != nil {
+			return nil, err
+		}
+		fresh.Athlete = auth.Athlete // the refresh answer has no athlete
+		*auth = *fresh
+	}
+	req, err := http.NewRequest(http.MethodGet, stravaAPI+"/athlete/activities?per_page=100&after="+strconv.FormatInt(after.Unix(), 10), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+auth.AccessToken)
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("strava activities: %s", resp.Status)
+	}
+	var acts []StravaActivity
+	err = json.NewDecoder(resp.Body).Decode(&acts)
+	return acts, err
+}
+
+// ApplyStravaActivities completes each linked habit on the days its activities reach the
+// habit's minimums. Returns how many completions were added.
+func ApplyStravaActivities(data *AppData, acts []StravaActivity, now time.Time) int {
+	type total struct {
+		km      float64
+		minutes int
+	}
+	totals := make(map[string]map[string]total) // activity type -> day -> total
+	for _, a := range acts {
+		if len(a.StartDateLocal) < 10 {
+			continue
+		}
+		kind := a.SportType
+		if kind == "" {
+			kind = a.Type
+		}
+		day := a.StartDateLocal[:10] // local time of the activity, so the day you did it
+		if totals[kind] == nil {
+			totals[kind] = make(map[string]total)
+		}
+		t := totals[kind][day]
+		t.km += a.Distance / 1000
+		t.minutes += a.MovingTime / 60
+		totals[kind][day] = t
+	}
+	today := now.Format(dateLayout)
+	added := 0
+	for i := range data.Habits {
+		h := &data.Habits[i]
+		if h.StravaType == "" {
+			continue
+		}
+		for day, t := range totals[h.StravaType] {
+			if day > today || t.km < h.StravaMinKm || t.minutes < h.StravaMinMinutes {
+				continue
+			}
+			if completeFromSource(data, h, day, "strava") {
+				added++
+			}
+		}
+	}
+	return added
+}
+
+// RunStravaSync syncs every 30 minutes while a Strava account is connected. Run it in its own
+// goroutine: go RunStravaSync()
+func RunStravaSync() {
+	if id, _ := stravaClient(); id == "" {
+		return
+	}
+	for range time.Tick(30 * time.Minute) {
+		data, err := LoadData()
+		if err != nil || data.Strava == nil {
+			continue
+		}
+		now := time.Now()
+		acts, err := FetchStravaActivities(data.Strava, now.AddDate(0, 0, -7))
+		if err != nil {
+			log.Println("strava:", err)
+			continue
+		}
+		ApplyStravaActivities(data, acts, now)
+		// Always save: the access token may have been refreshed.
+		if err := SaveData(data); err != nil {
+			log.Println("strava:", err)
+		}
+	}
+}
+
+// HandleStravaConnect sends you to Strava to allow access (GET /strava/connect).
+func HandleStravaConnect(w http.ResponseWriter, r *http.Request) {
+	id, _ := stravaClient()
+	if id == "" {
+		http.Redirect(w, r, "/settings?error=strava#strava", http.StatusFound)
+		return
+	}
+	// The state is signed (review.go) so the callback only accepts answers to our own request.
+	state := time.Now().Format(dateLayout)
+	q := url.Values{
+		"client_id":       {id},
+		"redirect_uri":    {publicURL() + "/strava/callback"},
+		"response_type":   {"code"},
+		"approval_prompt": {"auto"},
+		"scope":           {"activity:read_all"},
+		"state":           {state + "." + signLink("strava", state)},
+	}
+	http.Redirect(w, r, stravaAuthorizeURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// HandleStravaCallback is where Strava sends you back with a code (GET /strava/callback).
+func HandleStravaCallback(w http.ResponseWriter, r *http.Request) {
+	state, sig, _ := strings.Cut(r.URL.Query().Get("state"), ".")
+	code := r.URL.Query().Get("code")
+	if !validLink("strava", state, sig) || code == "" {
+		http.Redirect(w, r, "/settings?error=strava#strava", http.StatusFound)
+		return
+	}
+	auth, err := stravaToken(url.Values{"grant_type": {"authorization_code"}, "code": {code}})
+	if err != nil {
+		log.Println("strava:", err)
+		http.Redirect(w, r, "/settings?error=strava#strava", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Strava = auth
+	// Sync right away, so the habits are up to date without waiting for the next round.
+	if acts, err := FetchStravaActivities(data.Strava, time.Now().AddDate(0, 0, -7)); err == nil {
+		ApplyStravaActivities(data, acts, time.Now())
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?strava=1#strava", http.StatusFound)
+}
+
+// HandleStravaDisconnect forgets the Strava account (POST /strava/disconnect).
+func HandleStravaDisconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if data.Strava != nil {
+		// Also revoke the app's access on Strava's side; if that fails we forget it anyway.
+		client := &http.Client{Timeout: 10 * time.Second}
+		if resp, err := client.PostForm(stravaDeauthorize, url.Values{"access_token": {data.Strava.AccessToken}}); err == nil {
+			resp.Body.Close()
+		}
+	}
+	data.Strava = nil
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?strava=0#strava", http.StatusFound)
+}
+
+// HandleHabitStrava handles POST to link a habit to a Strava activity type.
+// Form: habit_id=1&strava_type=Run&strava_min_km=5&strava_min_minutes=0 (empty type = not linked)
+func HandleHabitStrava(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	kind := r.FormValue("strava_type")
+	km, err1 := strconv.ParseFloat(orZero(r.FormValue("strava_min_km")), 64)
+	minutes, err2 := strconv.Atoi(orZero(r.FormValue("strava_min_minutes")))
+	known := kind == "" || containsString(stravaTypes, kind)
+	if !known || err1 != nil || err2 != nil || km < 0 || minutes < 0 {
+		http.Redirect(w, r, "/?error=strava", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	habit := FindHabitByID(data, habitID)
+	if habit == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	habit.StravaType, habit.StravaMinKm, habit.StravaMinMinutes = kind, km, minutes
+	if kind == "" {
+		habit.StravaMinKm, habit.StravaMinMinutes = 0, 0
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?strava=1", http.StatusFound)
+}
+
+// orZero returns s, or "0" if it's empty (an empty number field means no minimum).
+func orZero(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "0"
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,270 @@
+// sync.go - Keep two (or more) instances in step, e.g. a laptop and a home server.
+// One instance is the authority (the server); the others are clients that regularly push their
+// new journal events (journal.go) to it and pull the events they haven't seen yet.
+//
+// Configure it in .env:
+//
+//	SYNC_TOKEN=some-long-secret              (both sides; the server only accepts this token)
+//	SYNC_SERVER_URL=http://homeserver:8080   (clients only: the authority to sync with)
+//	SYNC_INTERVAL=1m                         (clients only, optional)
+//
+// Conflicts are resolved per record with "last write wins": an event is only applied if it is
+// newer than the last event already seen for the same record (same habit, todo, day, ...).
+// Records are matched by ID, so start a new client from an empty folder (or from a copy of the
+// server's data.json and journal.jsonl) rather than from a different data set.
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncStateFile remembers, on a client, how far it has synced. It is kept out of data.json so
+// it isn't journaled and synced itself.
+const syncStateFile = "sync-state.json"
+
+// syncMu makes sure only one sync (incoming request or outgoing push/pull) runs at a time.
+var syncMu sync.Mutex
+
+// SyncRequest is what a client sends to /api/v1/sync.
+// Cursor is the position in the server's journal the client has pulled up to.
+type SyncRequest struct {
+	Device string         `json:"device"`
+	Cursor int            `json:"cursor"`
+	Events []JournalEvent `json:"events"`
+}
+
+// SyncResponse carries the server's events the client hasn't seen, and the new cursor.
+type SyncResponse struct {
+	Cursor   int            `json:"cursor"`
+	Accepted int            `json:"accepted"` // how many pushed events the server applied
+	Events   []JournalEvent `json:"events"`
+}
+
+// syncState is the client's progress, stored in sync-state.json.
+type syncState struct {
+	ServerCursor int       `json:"server_cursor"`
+	PushedUntil  time.Time `json:"pushed_until"` // own events up to this time have been pushed
+}
+
+// recordKey identifies the record an event is about, e.g. "habit/3" or "day/2025-01-28".
+func recordKey(ev JournalEvent) string {
+	return ev.Entity + "/" + ev.Key
+}
+
+// newerThan reports whether a should win over b under last-write-wins. Equal times are
+// broken by device name so every instance picks the same winner.
+func newerThan(a, b JournalEvent) bool {
+	if !a.Time.Equal(b.Time) {
+		return a.Time.After(b.Time)
+	}
+	return a.Device > b.Device
+}
+
+// applyRemoteEvents applies events from another device to the local data and journal, skipping
+// events we already have and events older than what we know for the same record.
+// It returns the events that were applied.
+func applyRemoteEvents(incoming []JournalEvent) ([]JournalEvent, error) {
+	if len(incoming) == 0 {
+		return nil, nil
+	}
+	known, err := readJournal()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	latest := make(map[string]JournalEvent)
+	for _, ev := range known {
+		seen[ev.ID] = true
+		if prev, ok := latest[recordKey(ev)]; !ok || newerThan(ev, prev) {
+			latest[recordKey(ev)] = ev
+		}
+	}
+
+	data, err := LoadData()
+	if err != nil {
+		return nil, err
+	}
+	var accepted []JournalEvent
+	for _, ev := range incoming {
+		if seen[ev.ID] {
+			continue
+		}
+		seen[ev.ID] = true
+		if prev, ok := latest[recordKey(ev)]; ok && !newerThan(ev, prev) {
+			continue // we already have a newer version of this record
+		}
+		if err := ApplyJournalEvent(data, ev); err != nil {
+			return nil, fmt.Errorf("event %s: %w", ev.ID, err)
+		}
+		latest[recordKey(ev)] = ev
+		accepted = append(accepted, ev)
+	}
+	if len(accepted) == 0 {
+		return nil, nil
+	}
+	return accepted, saveWithEvents(data, accepted)
+}
+
+// syncAuthorized checks the "Authorization: Bearer <SYNC_TOKEN>" header.
+// subtle.ConstantTimeCompare takes the same time however many characters match, so the
+// token can't be guessed one character at a time by measuring response times.
+func syncAuthorized(r *http.Request) bool {
+	token := os.Getenv("SYNC_TOKEN")
+	if token == "" {
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// HandleSyncAPI is the server side of sync: POST /api/v1/sync with a SyncRequest as JSON.
+// It applies the client's events and answers with the server's events after the client's cursor
+// (leaving out the client's own events).
+func HandleSyncAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !syncAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req SyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad sync request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	accepted, err := applyRemoteEvents(req.Events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	all, err := readJournal()
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := SyncResponse{Cursor: len(all), Accepted: len(accepted), Events: []JournalEvent{}}
+	if req.Cursor < 0 || req.Cursor > len(all) {
+		req.Cursor = 0 // server journal was replaced: send everything again (duplicates are skipped)
+	}
+	for _, ev := range all[req.Cursor:] {
+		if ev.Device != req.Device {
+			resp.Events = append(resp.Events, ev)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// loadSyncState reads sync-state.json (a zero state if it doesn't exist yet).
+func loadSyncState() (syncState, error) {
+	var st syncState
+	b, err := os.ReadFile(syncStateFile)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, json.Unmarshal(b, &st)
+}
+
+// saveSyncState writes sync-state.json.
+func saveSyncState(st syncState) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(syncStateFile, b, 0644)
+}
+
+// SyncOnce does one push/pull round with the server at serverURL.
+func SyncOnce(serverURL, token string) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	st, err := loadSyncState()
+	if err != nil {
+		return err
+	}
+	events, err := readJournal()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	me := DeviceID()
+	req := SyncRequest{Device: me, Cursor: st.ServerCursor, Events: []JournalEvent{}}
+	pushedUntil := st.PushedUntil
+	for _, ev := range events {
+		if ev.Device == me && ev.Time.After(st.PushedUntil) {
+			req.Events = append(req.Events, ev)
+			if ev.Time.After(pushedUntil) {
+				pushedUntil = ev.Time
+			}
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(serverURL, "/")+"/api/v1/sync", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sync server returned %s", resp.Status)
+	}
+	var sr SyncResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return err
+	}
+
+	applied, err := applyRemoteEvents(sr.Events)
+	if err != nil {
+		return err
+	}
+	if len(req.Events) > 0 || len(applied) > 0 {
+		log.Printf("sync: pushed %d (%d accepted), pulled %d", len(req.Events), sr.Accepted, len(applied))
+	}
+	st.ServerCursor = sr.Cursor
+	st.PushedUntil = pushedUntil
+	return saveSyncState(st)
+}
+
+// RunSyncClient syncs with SYNC_SERVER_URL every SYNC_INTERVAL (default one minute).
+// Run it in its own goroutine: go RunSyncClient(url)
+func RunSyncClient(serverURL string) {
+	interval := time.Minute
+	if d, err := time.ParseDuration(os.Getenv("SYNC_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+	token := os.Getenv("SYNC_TOKEN")
+	for {
+		if err := SyncOnce(serverURL, token); err != nil {
+			log.Println("sync:", err)
+		}
+		time.Sleep(interval)
+	}
+}
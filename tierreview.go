@@ -0,0 +1,223 @@
+// tierreview.go - Reviews above the week review. Once a month, the monthly review looks back over
+// the month: how often each habit was done and how its target moved through the week reviews.
+// Once a quarter, the quarterly review shows the same for the three months and asks whether each
+// goal still fits: targets and ceilings can be reset outright instead of nudged week by week.
+//
+// A monthly (quarterly) review is due from the first day of a new month (quarter), once the last
+// one is at least two (six) weeks back, so a fresh start doesn't get one after a few days. They
+// don't block anything like the week review does; the main page reminds you until they're done.
+// A quarterly review counts as that month's monthly review too. What was decided is kept in the
+// day's record (DayRecord.MonthReview, QuarterReview), and /reviews lists them.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lastTierReview returns the day a monthly or quarterly review period starts: the last review,
+// or the day the app was started to be used.
+func lastTierReview(data *AppData, last string) string {
+	if last != "" {
+		return last
+	}
+	if data.CreatedAt != "" {
+		return data.CreatedAt
+	}
+	return Today()
+}
+
+// nextPeriodStart returns the first day of the period of months months (1 = month, 3 = quarter)
+// after the one day is in.
+func nextPeriodStart(day time.Time, months int) time.Time {
+	m := int(day.Month()) - 1
+	start := time.Date(day.Year(), time.Month(m-m%months+1), 1, 0, 0, 0, 0, time.UTC)
+	return start.AddDate(0, months, 0)
+}
+
+// NextMonthReviewDate returns the day the next monthly review is due.
+func NextMonthReviewDate(data *AppData) (string, error) {
+	last, err := ParseDate(lastTierReview(data, data.LastMonthReview))
+	if err != nil {
+		return "", err
+	}
+	return nextPeriodStart(last.AddDate(0, 0, 14), 1).Format(dateLayout), nil
+}
+
+// NextQuarterReviewDate returns the day the next quarterly review is due.
+func NextQuarterReviewDate(data *AppData) (string, error) {
+	last, err := ParseDate(lastTierReview(data, data.LastQuarterReview))
+	if err != nil {
+		return "", err
+	}
+	return nextPeriodStart(last.AddDate(0, 0, 42), 3).Format(dateLayout), nil
+}
+
+// NeedsMonthReview reports whether the monthly review is due.
+func NeedsMonthReview(data *AppData) (bool, error) {
+	next, err := NextMonthReviewDate(data)
+	if err != nil {
+		return false, err
+	}
+	return Today() >= next, nil
+}
+
+// NeedsQuarterReview reports whether the quarterly review is due.
+func NeedsQuarterReview(data *AppData) (bool, error) {
+	next, err := NextQuarterReviewDate(data)
+	if err != nil {
+		return false, err
+	}
+	return Today() >= next, nil
+}
+
+// TierHabitView is one habit on the monthly or quarterly review page.
+type TierHabitView struct {
+	Habit
+	Summary       CycleSummary
+	Rate          int // percent of the counted days the habit was done
+	StartQuantity int // the target at the start of the period, from its first week review (0 = unknown)
+}
+
+// TierReviewPageData is what tier-review.html gets.
+type TierReviewPageData struct {
+	Settings    Settings
+	Revision    int64  // sent back with the forms (revision.go)
+	Tier        string // "month" or "quarter"
+	NeedsReview bool
+	NextReview  string // when the review is due next (if it isn't due now)
+	Since       string // the first day looked back on
+	WeekReviews []PastReview
+	Habits      []TierHabitView
+	Message     string
+}
+
+// HandleMonthReview shows the monthly review (GET /month-review) and completes it (POST).
+// Form: reflection=<text> (optional).
+func HandleMonthReview(w http.ResponseWriter, r *http.Request) {
+	handleTierReview(w, r, "month")
+}
+
+// HandleQuarterReview shows the quarterly review (GET /quarter-review) and completes it (POST).
+// Form: target_<habit_id>=<number> and max_<habit_id>=<number or empty> for every habit,
+// reflection=<text> (optional).
+func HandleQuarterReview(w http.ResponseWriter, r *http.Request) {
+	handleTierReview(w, r, "quarter")
+}
+
+// handleTierReview does the work for both tiers.
+func handleTierReview(w http.ResponseWriter, r *http.Request, tier string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := "/" + tier + "-review"
+	since := lastTierReview(data, data.LastMonthReview)
+	if tier == "quarter" {
+		since = lastTierReview(data, data.LastQuarterReview)
+	}
+
+	if r.Method == http.MethodPost {
+		reflection := r.FormValue("reflection")
+		if len(reflection) > maxReflectionChars {
+			http.Redirect(w, r, page+"?error=reflection", http.StatusFound)
+			return
+		}
+		review := &WeekReview{Decisions: []ReviewDecision{}, Reflection: strings.TrimSpace(reflection)}
+		if tier == "quarter" {
+			// Check every habit before changing any, so a bad value changes nothing.
+			targets, maxes := make(map[int]int), make(map[int]int)
+			for _, h := range data.Habits {
+				id := strconv.Itoa(h.ID)
+				target, err := strconv.Atoi(r.FormValue("target_" + id))
+				max := 0 // empty = no ceiling
+				if s := strings.TrimSpace(r.FormValue("max_" + id)); s != "" && err == nil {
+					max, err = strconv.Atoi(s)
+				}
+				if err != nil || target < 1 || max < 0 || (max > 0 && target > max) {
+					http.Redirect(w, r, page+"?error=invalid", http.StatusFound)
+					return
+				}
+				targets[h.ID], maxes[h.ID] = target, max
+			}
+			for i := range data.Habits {
+				h := &data.Habits[i]
+				d := ReviewDecision{HabitID: h.ID, Name: h.Name, Unit: h.Unit, Action: "keep", From: h.Quantity, To: targets[h.ID]}
+				switch {
+				case d.To > d.From:
+					d.Action = "increase"
+				case d.To < d.From:
+					d.Action = "decrease"
+				}
+				h.Quantity, h.MaxQuantity = targets[h.ID], maxes[h.ID]
+				h.CycleStartQuantity = h.Quantity
+				review.Decisions = append(review.Decisions, d)
+			}
+		}
+		rec := data.History[Today()]
+		rec.Date = Today()
+		if tier == "quarter" {
+			rec.QuarterReview = review
+			data.LastQuarterReview = Today()
+		} else {
+			rec.MonthReview = review
+		}
+		data.History[Today()] = rec
+		data.LastMonthReview = Today()
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, "/?tierreview="+tier, http.StatusFound)
+		return
+	}
+
+	pd := TierReviewPageData{Settings: data.Settings, Revision: data.Revision, Tier: tier, Since: since}
+	if tier == "quarter" {
+		pd.NeedsReview, _ = NeedsQuarterReview(data)
+		pd.NextReview, _ = NextQuarterReviewDate(data)
+	} else {
+		pd.NeedsReview, _ = NeedsMonthReview(data)
+		pd.NextReview, _ = NextMonthReviewDate(data)
+	}
+	starts := make(map[int]int) // habit ID -> From of its first week review in the period
+	for _, pr := range PastReviews(data) {
+		if pr.Kind != "week" || pr.Date < since {
+			continue
+		}
+		pd.WeekReviews = append(pd.WeekReviews, pr)
+		if pr.Review == nil {
+			continue
+		}
+		for _, d := range pr.Review.Decisions {
+			if _, ok := starts[d.HabitID]; !ok {
+				starts[d.HabitID] = d.From
+			}
+		}
+	}
+	summaries := SummariesBetween(data, since, Yesterday())
+	for _, h := range data.Habits {
+		v := TierHabitView{Habit: h, Summary: summaries[h.ID], StartQuantity: starts[h.ID]}
+		if v.Summary.Days > 0 {
+			v.Rate = (v.Summary.Days - v.Summary.Misses) * 100 / v.Summary.Days
+		}
+		pd.Habits = append(pd.Habits, v)
+	}
+	switch {
+	case r.URL.Query().Get("error") == "invalid":
+		pd.Message = "Every target must be at least 1, and no more than its maximum (leave the maximum empty for none)."
+	case r.URL.Query().Get("error") == "reflection":
+		pd.Message = "That reflection is too long. Keep it under 2000 characters."
+	}
+	if err := tmpl.ExecuteTemplate(w, "tier-review.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
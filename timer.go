@@ -0,0 +1,108 @@
+// timer.go - Start/stop timers for time-based habits (e.g. "Meditate 10 minutes").
+// Instead of clicking Done, start the timer when you begin and stop it when you finish:
+// the elapsed minutes are logged in that day's DayRecord, and the habit is marked complete
+// as soon as the logged minutes reach the target. Focus sessions (focus.go) log here too.
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LogHabitMinutes adds minutes to a habit's total for the given day and marks the habit
+// complete when the day's total reaches its target.
+func LogHabitMinutes(data *AppData, habitID int, date string, minutes int) {
+	if minutes <= 0 {
+		return
+	}
+	rec := data.History[date]
+	rec.Date = date
+	// A map inside a struct is nil until we make it; writing to a nil map panics.
+	if rec.MinutesLogged == nil {
+		rec.MinutesLogged = make(map[int]int)
+	}
+	rec.MinutesLogged[habitID] += minutes
+	data.History[date] = rec
+	if h := FindHabitByID(data, habitID); h != nil && IsTimeBased(*h) && rec.MinutesLogged[habitID] >= TargetMinutes(*h) {
+		SetHabitCompleted(data, habitID, date, true)
+	}
+}
+
+// MinutesLoggedOn returns the minutes logged for a habit on a day (timers and focus sessions).
+func MinutesLoggedOn(data *AppData, habitID int, date string) int {
+	return data.History[date].MinutesLogged[habitID] // reading a nil map is fine and gives 0
+}
+
+// elapsedMinutes rounds the time between start and end to the nearest whole minute.
+func elapsedMinutes(start, end time.Time) int {
+	return int(math.Round(end.Sub(start).Minutes()))
+}
+
+// HandleStartTimer handles POST to start the timer for a habit. Form: habit_id=1
+func HandleStartTimer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if FindHabitByID(data, habitID) == nil {
+		http.Redirect(w, r, "/?error=notfound", http.StatusFound)
+		return
+	}
+	if data.RunningTimers == nil {
+		data.RunningTimers = make(map[int]time.Time)
+	}
+	if _, running := data.RunningTimers[habitID]; !running {
+		data.RunningTimers[habitID] = time.Now()
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// HandleStopTimer handles POST to stop a habit's timer and log the elapsed minutes.
+// The minutes go to the day the timer was started, so a session that runs past midnight
+// still counts for the evening it began. Form: habit_id=1
+func HandleStopTimer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	habitID, err := strconv.Atoi(r.FormValue("habit_id"))
+	if err != nil {
+		http.Redirect(w, r, "/?error=invalid", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	started, running := data.RunningTimers[habitID]
+	if !running {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	delete(data.RunningTimers, habitID)
+	minutes := elapsedMinutes(started, time.Now())
+	LogHabitMinutes(data, habitID, started.Format(dateLayout), minutes)
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?timer="+strconv.Itoa(minutes), http.StatusFound)
+}
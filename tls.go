@@ -0,0 +1,67 @@
+// tls.go - Serving HTTPS directly, without a reverse proxy in front. Point a domain name at
+// this machine, open ports 80 and 443, and set in .env:
+//
+//	HTTPS=true
+//	DOMAIN=habits.example.com        (several names: habits.example.com,www.habits.example.com)
+//	ACME_EMAIL=you@example.com       (optional: Let's Encrypt writes here about problems)
+//
+// Certificates come from Let's Encrypt through autocert: it gets one on the first visit and
+// renews it before it expires. They are kept in CERT_DIR (default "certs"), so a restart doesn't
+// ask again. Port 80 answers Let's Encrypt's checks and redirects everything else to https://.
+// PORT is not used in this mode.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// httpsEnabled reports whether HTTPS=true is set in .env.
+func httpsEnabled() bool {
+	return os.Getenv("HTTPS") == "true"
+}
+
+// httpsDomains returns the names in DOMAIN, the only ones certificates are requested for.
+func httpsDomains() []string {
+	var domains []string
+	for _, d := range strings.Split(os.Getenv("DOMAIN"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// ListenAndServeHTTPS serves handler on port 443 with Let's Encrypt certificates, and the
+// redirect on port 80. Like http.ListenAndServe, it only returns on an error.
+func ListenAndServeHTTPS(handler http.Handler) error {
+	domains := httpsDomains()
+	if len(domains) == 0 {
+		return errors.New("HTTPS=true needs DOMAIN, the name the certificate is for")
+	}
+	dir := os.Getenv("CERT_DIR")
+	if dir == "" {
+		dir = "certs"
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,                 // agree to Let's Encrypt's terms
+		HostPolicy: autocert.HostWhitelist(domains...), // no certificates for other names
+		Cache:      autocert.DirCache(dir),
+		Email:      os.Getenv("ACME_EMAIL"),
+	}
+	// With a nil handler, HTTPHandler answers the ACME challenges and redirects the rest to https.
+	go func() {
+		if err := http.ListenAndServe(":80", m.HTTPHandler(nil)); err != nil {
+			log.Fatal("port 80: ", err)
+		}
+	}()
+	srv := &http.Server{Addr: ":443", Handler: handler, TLSConfig: m.TLSConfig()}
+	// The certificate comes from TLSConfig, so no certificate files are passed here.
+	return srv.ListenAndServeTLS("", "")
+}
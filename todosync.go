@@ -0,0 +1,538 @@
+// todosync.go - Keeping the todos in step with Todoist or TickTick. Every 15 minutes
+// (TODO_SYNC_EVERY) the open tasks there are fetched: new ones become todos here, changed ones
+// are updated, and tasks completed or deleted there leave the list. The other way, a synced todo
+// completed here is completed there too. A todo deleted here (it's in the trash) is only gone
+// here, and comes back if it's restored; once it's deleted for good (or split up by Simplify) it
+// is unlinked, so its task, still open there, is fetched again as a new todo.
+//
+// The API tokens are entered under Settings → Todoist and TickTick (Todoist: Settings →
+// Integrations → Developer; TickTick: an access token from its developer portal); without one
+// nothing is synced. Rules there turn projects into tags, one per line, and "-" leaves a
+// project out:
+//
+//	Work = work
+//	Shopping = errands
+//	Someday = -
+//
+// Which todo is which task is kept in data.TodoLinks.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The APIs' addresses (variables, so a build can point them elsewhere with -ldflags -X).
+var (
+	todoistAPI  = "https://api.todoist.com/api/v1"
+	tickTickAPI = "https://api.ticktick.com/open/v1"
+)
+
+// TodoLink ties a todo to a task in Todoist or TickTick.
+type TodoLink struct {
+	Service   string `json:"service"` // "todoist" or "ticktick"
+	TaskID    string `json:"task_id"`
+	ProjectID string `json:"project_id,omitempty"` // TickTick needs it to complete the task
+	TodoID    int    `json:"todo_id"`
+	Done      bool   `json:"done,omitempty"` // the todo was completed here: complete the task there
+}
+
+// key is how a task is looked up: "todoist:123".
+func (l TodoLink) key() string { return l.Service + ":" + l.TaskID }
+
+// remoteTask is an open task in Todoist or TickTick, in our terms.
+type remoteTask struct {
+	Link     TodoLink // without TodoID
+	Project  string   // the project's name, for the rules
+	Text     string
+	Priority string // "", "low", "medium" or "high"
+	DueDate  string // YYYY-MM-DD, "" if none
+}
+
+// todoService is a task app we sync with.
+type todoService interface {
+	Name() string
+	OpenTasks() ([]remoteTask, error)
+	Complete(l TodoLink) error
+}
+
+// todoServices returns the services that have a token in settings, by name.
+func todoServices(s Settings) map[string]todoService {
+	client := &http.Client{Timeout: 20 * time.Second}
+	out := make(map[string]todoService)
+	if s.TodoistToken != "" {
+		out["todoist"] = todoistService{token: s.TodoistToken, client: client}
+	}
+	if s.TickTickToken != "" {
+		out["ticktick"] = tickTickService{token: s.TickTickToken, client: client}
+	}
+	return out
+}
+
+// todoAPI makes one request with the token and decodes the JSON answer into out (if not nil).
+func todoAPI(client *http.Client, method, u, token string, out any) error {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// todoistService talks to Todoist's API (v1). Its priorities go from 1 (normal) to 4 (urgent).
+type todoistService struct {
+	token  string
+	client *http.Client
+}
+
+func (todoistService) Name() string { return "todoist" }
+
+// todoistAll fetches every page of a list (Todoist returns 200 at a time, with a cursor).
+func (s todoistService) todoistAll(path string, each func(json.RawMessage) error) error {
+	cursor := ""
+	for {
+		u := todoistAPI + path + "?limit=200"
+		if cursor != "" {
+			u += "&cursor=" + url.QueryEscape(cursor)
+		}
+		var page struct {
+			Results    []json.RawMessage `json:"results"`
+			NextCursor string            `json:"next_cursor"`
+		}
+		if err := todoAPI(s.client, http.MethodGet, u, s.token, &page); err != nil {
+			return err
+		}
+		for _, r := range page.Results {
+			if err := each(r); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func (s todoistService) OpenTasks() ([]remoteTask, error) {
+	projects := make(map[string]string)
+	err := s.todoistAll("/projects", func(raw json.RawMessage) error {
+		var p struct{ ID, Name string }
+		err := json.Unmarshal(raw, &p)
+		projects[p.ID] = p.Name
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var tasks []remoteTask
+	err = s.todoistAll("/tasks", func(raw json.RawMessage) error {
+		var t struct {
+			ID        string `json:"id"`
+			Content   string `json:"content"`
+			ProjectID string `json:"project_id"`
+			Priority  int    `json:"priority"`
+			Due       *struct {
+				Date string `json:"date"`
+			} `json:"due"`
+		}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		rt := remoteTask{
+			Link:     TodoLink{Service: "todoist", TaskID: t.ID, ProjectID: t.ProjectID},
+			Project:  projects[t.ProjectID],
+			Text:     t.Content,
+			Priority: map[int]string{2: "low", 3: "medium", 4: "high"}[t.Priority],
+		}
+		if t.Due != nil && len(t.Due.Date) >= 10 {
+			rt.DueDate = t.Due.Date[:10] // "2025-03-01" or "2025-03-01T09:00:00"
+		}
+		tasks = append(tasks, rt)
+		return nil
+	})
+	return tasks, err
+}
+
+func (s todoistService) Complete(l TodoLink) error {
+	return todoAPI(s.client, http.MethodPost, todoistAPI+"/tasks/"+url.PathEscape(l.TaskID)+"/close", s.token, nil)
+}
+
+// tickTickService talks to TickTick's Open API. Its priorities are 0 (none), 1, 3 and 5 (high),
+// and tasks are fetched one project at a time; the inbox isn't in the list of projects.
+type tickTickService struct {
+	token  string
+	client *http.Client
+}
+
+func (tickTickService) Name() string { return "ticktick" }
+
+func (s tickTickService) OpenTasks() ([]remoteTask, error) {
+	var projects []struct{ ID, Name string }
+	if err := todoAPI(s.client, http.MethodGet, tickTickAPI+"/project", s.token, &projects); err != nil {
+		return nil, err
+	}
+	projects = append(projects, struct{ ID, Name string }{"inbox", "Inbox"})
+	var tasks []remoteTask
+	for _, p := range projects {
+		var pd struct {
+			Tasks []struct {
+				ID        string `json:"id"`
+				ProjectID string `json:"projectId"`
+				Title     string `json:"title"`
+				Priority  int    `json:"priority"`
+				DueDate   string `json:"dueDate"` // "2025-03-01T09:00:00+0000"
+				Status    int    `json:"status"`  // 0 = open
+			} `json:"tasks"`
+		}
+		if err := todoAPI(s.client, http.MethodGet, tickTickAPI+"/project/"+url.PathEscape(p.ID)+"/data", s.token, &pd); err != nil {
+			return nil, err
+		}
+		for _, t := range pd.Tasks {
+			if t.Status != 0 {
+				continue
+			}
+			rt := remoteTask{
+				Link:     TodoLink{Service: "ticktick", TaskID: t.ID, ProjectID: t.ProjectID},
+				Project:  p.Name,
+				Text:     t.Title,
+				Priority: map[int]string{1: "low", 3: "medium", 5: "high"}[t.Priority],
+			}
+			if due, err := time.Parse("2006-01-02T15:04:05-0700", t.DueDate); err == nil {
+				rt.DueDate = due.In(time.Local).Format(dateLayout)
+			} else if len(t.DueDate) >= 10 {
+				rt.DueDate = t.DueDate[:10]
+			}
+			tasks = append(tasks, rt)
+		}
+	}
+	return tasks, nil
+}
+
+func (s tickTickService) Complete(l TodoLink) error {
+	return todoAPI(s.client, http.MethodPost, tickTickAPI+"/project/"+url.PathEscape(l.ProjectID)+"/task/"+url.PathEscape(l.TaskID)+"/complete", s.token, nil)
+}
+
+// ParseTodoRules reads the project rules ("Work = work", "Someday = -"): project name in
+// lowercase -> tag, "-" to leave the project out. Lines without "=" are ignored.
+func ParseTodoRules(text string) map[string]string {
+	rules := make(map[string]string)
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for sc.Scan() {
+		project, tag, ok := strings.Cut(sc.Text(), "=")
+		if project, tag = strings.TrimSpace(project), strings.TrimSpace(tag); ok && project != "" && tag != "" {
+			rules[strings.ToLower(project)] = tag
+		}
+	}
+	return rules
+}
+
+// TodoSyncResult is what one sync did.
+type TodoSyncResult struct {
+	Imported  int // new tasks that became todos
+	Updated   int // todos changed to match their task
+	DoneThere int // todos removed because their task was completed (or deleted) there
+	DoneHere  int // tasks completed there because their todo was completed here
+}
+
+func (r TodoSyncResult) String() string {
+	return fmt.Sprintf("%d new, %d updated, %d done there, %d done here", r.Imported, r.Updated, r.DoneThere, r.DoneHere)
+}
+
+// markTodoDone notes that todo id was completed here, so the next sync completes its task.
+// Only ticking a todo off does this; deleting one never completes anything there.
+func markTodoDone(data *AppData, id int) {
+	for i := range data.TodoLinks {
+		if data.TodoLinks[i].TodoID == id {
+			data.TodoLinks[i].Done = true
+		}
+	}
+}
+
+// dropTodoLink forgets the task of todo id, which is gone for good (purged from the trash, or
+// replaced by its subtasks).
+func dropTodoLink(data *AppData, id int) {
+	var kept []TodoLink
+	for _, l := range data.TodoLinks {
+		if l.TodoID != id {
+			kept = append(kept, l)
+		}
+	}
+	data.TodoLinks = kept
+}
+
+// findTodo returns the todo with the given ID, or nil.
+func findTodo(data *AppData, id int) *Todo {
+	for i := range data.Todos {
+		if data.Todos[i].ID == id {
+			return &data.Todos[i]
+		}
+	}
+	return nil
+}
+
+// applyTodoSync brings data in line with the open tasks of the services in fetched. closed are
+// the tasks just completed there (their links go); rules are from ParseTodoRules.
+func applyTodoSync(data *AppData, open map[string]remoteTask, fetched, closed map[string]bool, rules map[string]string) TodoSyncResult {
+	var res TodoSyncResult
+	res.DoneHere = len(closed)
+	pending := make(map[string]remoteTask, len(open))
+	for k, t := range open {
+		pending[k] = t
+	}
+	var links []TodoLink
+	for _, l := range data.TodoLinks {
+		if closed[l.key()] {
+			continue
+		}
+		if !fetched[l.Service] {
+			links = append(links, l) // its service failed or has no token now: leave it be
+			continue
+		}
+		task, isOpen := pending[l.key()]
+		delete(pending, l.key())
+		if !isOpen {
+			// Completed or deleted there: the todo goes too (unless it's already gone here).
+			for i, t := range data.Todos {
+				if t.ID == l.TodoID {
+					data.Todos = append(data.Todos[:i], data.Todos[i+1:]...)
+					res.DoneThere++
+					break
+				}
+			}
+			continue
+		}
+		links = append(links, l)
+		if todo := findTodo(data, l.TodoID); todo != nil {
+			updated := todoFromTask(task, rules, todo.ID)
+			if !sameTodo(*todo, updated) {
+				*todo = updated
+				res.Updated++
+			}
+		}
+	}
+
+	// The rest are new. Sorted, so the todos get their IDs in the same order every time.
+	keys := make([]string, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		task := pending[k]
+		if rules[strings.ToLower(task.Project)] == "-" {
+			continue
+		}
+		todo := todoFromTask(task, rules, NextTodoID(data))
+		data.Todos = append(data.Todos, todo)
+		l := task.Link
+		l.TodoID = todo.ID
+		links = append(links, l)
+		res.Imported++
+	}
+	data.TodoLinks = links
+	return res
+}
+
+// todoFromTask is the todo for task, with ID id.
+func todoFromTask(task remoteTask, rules map[string]string, id int) Todo {
+	t := Todo{ID: id, Text: task.Text, Priority: task.Priority, DueDate: task.DueDate}
+	if tag := rules[strings.ToLower(task.Project)]; tag != "" && tag != "-" {
+		t.Tags = []string{tag}
+	}
+	return t
+}
+
+// sameTodo reports whether two todos look the same.
+func sameTodo(a, b Todo) bool {
+	return a.Text == b.Text && a.Priority == b.Priority && a.DueDate == b.DueDate && strings.Join(a.Tags, ",") == strings.Join(b.Tags, ",")
+}
+
+// errNoTodoServices is returned by SyncTodos when no token is set.
+var errNoTodoServices = errors.New("no Todoist or TickTick token in settings")
+
+// SyncTodos syncs once with every service that has a token.
+func SyncTodos() (TodoSyncResult, error) {
+	data, err := LoadData()
+	if err != nil {
+		return TodoSyncResult{}, err
+	}
+	services := todoServices(data.Settings)
+	if len(services) == 0 {
+		return TodoSyncResult{}, errNoTodoServices
+	}
+
+	// Todos completed here: complete their tasks.
+	closed := make(map[string]bool)
+	var errs []string
+	for _, l := range data.TodoLinks {
+		svc := services[l.Service]
+		if svc == nil || !l.Done {
+			continue
+		}
+		if err := svc.Complete(l); err != nil {
+			errs = append(errs, svc.Name()+": "+err.Error())
+			continue
+		}
+		closed[l.key()] = true
+	}
+	open := make(map[string]remoteTask)
+	fetched := make(map[string]bool)
+	for name, svc := range services {
+		tasks, err := svc.OpenTasks()
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+			continue
+		}
+		fetched[name] = true
+		for _, t := range tasks {
+			open[t.Link.key()] = t
+		}
+	}
+
+	// The requests took a while: apply them to the data as it is now, again if it changed meanwhile.
+	rules := ParseTodoRules(data.Settings.TodoSyncRules)
+	var res TodoSyncResult
+	for attempt := 0; attempt < 3; attempt++ {
+		if data, err = LoadData(); err != nil {
+			break
+		}
+		res = applyTodoSync(data, open, fetched, closed, rules)
+		if err = SaveData(data); !errors.Is(err, ErrDataChanged) {
+			break
+		}
+	}
+	if err == nil && len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "; "))
+	}
+	return res, err
+}
+
+// todoSyncStatus is the outcome of the last sync, for the settings page.
+var todoSyncStatus struct {
+	sync.Mutex
+	At     time.Time
+	Result TodoSyncResult
+	Err    string
+}
+
+// syncTodosAndRecord runs SyncTodos and keeps its outcome in todoSyncStatus.
+func syncTodosAndRecord() (TodoSyncResult, error) {
+	res, err := SyncTodos()
+	todoSyncStatus.Lock()
+	defer todoSyncStatus.Unlock()
+	todoSyncStatus.At, todoSyncStatus.Result, todoSyncStatus.Err = time.Now(), res, ""
+	if err != nil {
+		todoSyncStatus.Err = err.Error()
+	}
+	return res, err
+}
+
+// todoSyncInterval is how often todos are synced: TODO_SYNC_EVERY, default 15m.
+func todoSyncInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("TODO_SYNC_EVERY")); err == nil && d >= time.Minute {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// RunTodoSync syncs the todos every todoSyncInterval, once a token is set in settings.
+func RunTodoSync() {
+	for {
+		if _, err := syncTodosAndRecord(); err != nil && !errors.Is(err, errNoTodoServices) {
+			log.Println("todo sync:", err)
+		}
+		time.Sleep(todoSyncInterval())
+	}
+}
+
+// TodoSyncView is the todo sync card on the settings page.
+type TodoSyncView struct {
+	TodoistSet  bool
+	TickTickSet bool
+	Linked      int    // todos linked to a task
+	Last        string // how the last sync went, "" if there was none
+}
+
+// NewTodoSyncView fills in the card.
+func NewTodoSyncView(data *AppData) TodoSyncView {
+	v := TodoSyncView{TodoistSet: data.Settings.TodoistToken != "", TickTickSet: data.Settings.TickTickToken != "", Linked: len(data.TodoLinks)}
+	todoSyncStatus.Lock()
+	defer todoSyncStatus.Unlock()
+	switch {
+	case todoSyncStatus.At.IsZero() || (!v.TodoistSet && !v.TickTickSet):
+	case todoSyncStatus.Err != "":
+		v.Last = "Last sync " + todoSyncStatus.At.Format("15:04") + " failed: " + todoSyncStatus.Err
+	default:
+		v.Last = "Last sync " + todoSyncStatus.At.Format("15:04") + ": " + todoSyncStatus.Result.String() + "."
+	}
+	return v
+}
+
+// HandleTodoSyncSettings handles POST from the settings page: save the tokens and rules, and
+// sync now if asked. Form: todoist_token=...&ticktick_token=...&todo_sync_rules=...
+// [&forget=todoist|ticktick][&sync=1]. An empty token field keeps the saved token.
+func HandleTodoSyncSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s := &data.Settings
+	if t := strings.TrimSpace(r.FormValue("todoist_token")); t != "" {
+		s.TodoistToken = t
+	}
+	if t := strings.TrimSpace(r.FormValue("ticktick_token")); t != "" {
+		s.TickTickToken = t
+	}
+	switch r.FormValue("forget") {
+	case "todoist":
+		s.TodoistToken = ""
+	case "ticktick":
+		s.TickTickToken = ""
+	}
+	s.TodoSyncRules = strings.TrimSpace(r.FormValue("todo_sync_rules"))
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	if r.FormValue("sync") == "" {
+		http.Redirect(w, r, "/settings?todosync=1#todo-sync", http.StatusFound)
+		return
+	}
+	res, err := syncTodosAndRecord()
+	if err != nil {
+		log.Println("todo sync:", err)
+		http.Redirect(w, r, "/settings?error=todosync#todo-sync", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/settings?synced="+url.QueryEscape(res.String())+"#todo-sync", http.StatusFound)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTodoSyncCompletesOnlyDoneTodos syncs with a fake Todoist after one linked todo was ticked
+// off and another was deleted and purged from the trash: only the first task may be completed
+// there, and the purged todo's link must be gone.
+func TestTodoSyncCompletesOnlyDoneTodos(t *testing.T) {
+	useTempDir(t)
+	var mu sync.Mutex
+	var closed []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/close"):
+			mu.Lock()
+			closed = append(closed, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/close"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/tasks":
+			w.Write([]byte(`{"results": [{"id": "2", "content": "Call the bank", "project_id": "p"}]}`))
+		default:
+			w.Write([]byte(`{"results": []}`))
+		}
+	}))
+	defer api.Close()
+	defer func(old string) { todoistAPI = old }(todoistAPI)
+	todoistAPI = api.URL
+
+	data, err := LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Settings.TodoistToken = "test"
+	data.Todos = []Todo{{ID: 1, Text: "Buy milk"}, {ID: 2, Text: "Call the bank"}}
+	data.TodoLinks = []TodoLink{{Service: "todoist", TaskID: "1", TodoID: 1}, {Service: "todoist", TaskID: "2", TodoID: 2}}
+	if _, errs := applyBulk(data, []BulkOp{{Op: "complete_todo", TodoID: 1}}); errs != nil {
+		t.Fatal(errs)
+	}
+	trashTodo(data, 2, time.Now().AddDate(0, 0, -40))
+	PurgeExpiredTrash(data, time.Now())
+	if err := SaveData(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SyncTodos(); err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 || closed[0] != "1" {
+		t.Errorf("completed in Todoist: %q, want only the ticked-off task 1", closed)
+	}
+	data, err = LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range data.TodoLinks {
+		if l.TodoID == 2 || l.TaskID == "1" {
+			t.Errorf("link left over: %+v", l)
+		}
+	}
+}
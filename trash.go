@@ -0,0 +1,260 @@
+// trash.go - Deleting without regret. A deleted habit or task isn't gone at once: it moves to the
+// trash (AppData.Trash) and can be put back from /trash for trashRetention, with its history (a
+// habit's days are kept by its ID and simply count again) and its place in habit chains (deps.go).
+// After that the reminder scheduler (reminders.go) drops it for good; "Delete forever" on the
+// trash page does so right away.
+//
+// IDs of trashed habits and tasks aren't given to new ones (NextHabitID, NextTodoID), so a
+// restored habit can always have its own ID back.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// trashRetention is how long deleted habits and tasks are kept.
+const trashRetention = 30 * 24 * time.Hour
+
+// TrashItem is a deleted habit or task. One of Habit and Todo is set.
+type TrashItem struct {
+	Habit      *Habit    `json:"habit,omitempty"`
+	Todo       *Todo     `json:"todo,omitempty"`
+	Dependents []int     `json:"dependents,omitempty"` // habits that only counted after this one
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+// Kind is "habit" or "todo".
+func (t TrashItem) Kind() string {
+	if t.Habit != nil {
+		return "habit"
+	}
+	return "todo"
+}
+
+// ItemID is the habit's or task's ID.
+func (t TrashItem) ItemID() int {
+	if t.Habit != nil {
+		return t.Habit.ID
+	}
+	return t.Todo.ID
+}
+
+// Name is the habit's name or the task's text.
+func (t TrashItem) Name() string {
+	if t.Habit != nil {
+		return t.Habit.Name
+	}
+	return t.Todo.Text
+}
+
+// Expires is when the item is dropped for good.
+func (t TrashItem) Expires() time.Time { return t.DeletedAt.Add(trashRetention) }
+
+// trashHabit moves habit id to the trash, taking it out of other habits' chains. It reports
+// false if there is no such habit.
+func trashHabit(data *AppData, id int, now time.Time) bool {
+	for i, h := range data.Habits {
+		if h.ID != id {
+			continue
+		}
+		data.Habits = append(data.Habits[:i], data.Habits[i+1:]...)
+		item := TrashItem{Habit: &h, DeletedAt: now}
+		// Drop the deleted habit from chains, so nothing waits for it (deps.go).
+		for j := range data.Habits {
+			other := &data.Habits[j]
+			if !containsInt(other.DependsOn, id) {
+				continue
+			}
+			var deps []int
+			for _, dep := range other.DependsOn {
+				if dep != id {
+					deps = append(deps, dep)
+				}
+			}
+			other.DependsOn = deps
+			item.Dependents = append(item.Dependents, other.ID)
+		}
+		data.Trash = append(data.Trash, item)
+		return true
+	}
+	return false
+}
+
+// trashTodo moves task id to the trash. It reports false if there is no such task.
+func trashTodo(data *AppData, id int, now time.Time) bool {
+	for i, t := range data.Todos {
+		if t.ID == id {
+			data.Todos = append(data.Todos[:i], data.Todos[i+1:]...)
+			data.Trash = append(data.Trash, TrashItem{Todo: &t, DeletedAt: now})
+			return true
+		}
+	}
+	return false
+}
+
+// findTrash returns the index of the trashed item, or -1.
+func findTrash(data *AppData, kind string, id int) int {
+	for i, t := range data.Trash {
+		if t.Kind() == kind && t.ItemID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// restoreTrash puts a trashed item back: a habit in its place by ID and in the chains it was
+// taken out of, a task at the end of the list. It returns the item's name, or "" if it isn't in
+// the trash or a habit with its ID exists again (added on another device, sync.go).
+func restoreTrash(data *AppData, kind string, id int) string {
+	i := findTrash(data, kind, id)
+	if i < 0 {
+		return ""
+	}
+	item := data.Trash[i]
+	if item.Habit != nil {
+		if FindHabitByID(data, id) != nil {
+			return ""
+		}
+		at := sort.Search(len(data.Habits), func(j int) bool { return data.Habits[j].ID > id })
+		data.Habits = append(data.Habits[:at], append([]Habit{*item.Habit}, data.Habits[at:]...)...)
+		for _, depID := range item.Dependents {
+			if h := FindHabitByID(data, depID); h != nil && !containsInt(h.DependsOn, id) {
+				h.DependsOn = append(h.DependsOn, id)
+			}
+		}
+	} else {
+		t := *item.Todo
+		for _, other := range data.Todos {
+			if other.ID == t.ID {
+				t.ID = NextTodoID(data)
+				break
+			}
+		}
+		data.Todos = append(data.Todos, t)
+	}
+	data.Trash = append(data.Trash[:i], data.Trash[i+1:]...)
+	return item.Name()
+}
+
+// PurgeExpiredTrash drops items deleted more than trashRetention ago and returns how many.
+func PurgeExpiredTrash(data *AppData, now time.Time) int {
+	kept := data.Trash[:0]
+	for _, t := range data.Trash {
+		if now.Before(t.Expires()) {
+			kept = append(kept, t)
+		} else if t.Todo != nil {
+			dropTodoLink(data, t.Todo.ID)
+		}
+	}
+	purged := len(data.Trash) - len(kept)
+	if len(kept) == 0 {
+		kept = nil
+	}
+	data.Trash = kept
+	return purged
+}
+
+// TrashPageData is what trash.html gets.
+type TrashPageData struct {
+	Settings Settings
+	Revision int64 // sent back with the forms (revision.go)
+	Dates    DateStyle
+	Items    []TrashItem // newest first
+	Days     int         // trashRetention in days
+	Message  string
+}
+
+// HandleTrash shows the trash: GET /trash.
+func HandleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	pd := TrashPageData{
+		Settings: data.Settings,
+		Revision: data.Revision,
+		Dates:    RequestDates(r, data.Settings),
+		Days:     int(trashRetention / (24 * time.Hour)),
+	}
+	for i := len(data.Trash) - 1; i >= 0; i-- {
+		if now.Before(data.Trash[i].Expires()) { // not purged yet: the scheduler runs once a minute
+			pd.Items = append(pd.Items, data.Trash[i])
+		}
+	}
+	switch q := r.URL.Query(); {
+	case q.Get("restored") != "":
+		pd.Message = "Restored “" + q.Get("restored") + "”."
+	case q.Get("purged") == "1":
+		pd.Message = "Deleted for good."
+	case q.Get("error") == "restore":
+		pd.Message = "That can't be restored: it's no longer in the trash, or a habit with its ID exists again."
+	case q.Get("error") == "notfound":
+		pd.Message = "That's no longer in the trash."
+	}
+	if err := tmpl.ExecuteTemplate(w, "trash.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleTrashRestore puts an item back. POST /trash/restore, Form: kind=habit&id=3
+func HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := restoreTrash(data, r.FormValue("kind"), id)
+	if name == "" {
+		http.Redirect(w, r, "/trash?error=restore", http.StatusFound)
+		return
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/trash?restored="+url.QueryEscape(name), http.StatusFound)
+}
+
+// HandleTrashPurge deletes an item for good. POST /trash/delete, Form: kind=todo&id=7
+func HandleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	i := findTrash(data, r.FormValue("kind"), id)
+	if i < 0 {
+		http.Redirect(w, r, "/trash?error=notfound", http.StatusFound)
+		return
+	}
+	if t := data.Trash[i].Todo; t != nil {
+		dropTodoLink(data, t.ID)
+	}
+	data.Trash = append(data.Trash[:i], data.Trash[i+1:]...)
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/trash?purged=1", http.StatusFound)
+}
@@ -0,0 +1,152 @@
+// triage.go - Putting the todo list in order with AI (/triage). The open todos with their due
+// dates, and the habits still to do today (never private ones), go to the model, which suggests
+// the order to do them in and a priority for each, with a reason: what's urgent, what's quick,
+// what belongs with a habit. Nothing changes until you press Accept: then the list is stored in
+// that order (the "Added" sort on the main page) with the suggested priorities.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxTriageTodos is how many todos are sent at most; the rest keep their place at the end.
+const maxTriageTodos = 50
+
+// TriageRow is one todo in the suggested order.
+type TriageRow struct {
+	Todo
+	Rank      int    // 1 = do first
+	Suggested string // the suggested priority
+	Reason    string
+}
+
+// TriagePageData is what triage.html gets.
+type TriagePageData struct {
+	Settings   Settings
+	Revision   int64 // sent back with the forms (revision.go)
+	Todos      []Todo
+	Rows       []TriageRow // the suggestion, empty until asked for
+	Order      string      // the suggested order as todo IDs, "3,1,2", for the Accept form
+	CanSuggest bool
+	Message    string
+}
+
+// ApplyTriage stores the todos in order (todo IDs, first to last) with the given priorities.
+// Todos missing from order keep their order after the others; unknown IDs are ignored.
+func ApplyTriage(data *AppData, order []int, priorities map[int]string) {
+	byID := make(map[int]Todo, len(data.Todos))
+	for _, t := range data.Todos {
+		byID[t.ID] = t
+	}
+	sorted := make([]Todo, 0, len(data.Todos))
+	placed := make(map[int]bool)
+	for _, id := range order {
+		if t, ok := byID[id]; ok && !placed[id] {
+			sorted = append(sorted, t)
+			placed[id] = true
+		}
+	}
+	for _, t := range data.Todos {
+		if !placed[t.ID] {
+			sorted = append(sorted, t)
+		}
+	}
+	for i := range sorted {
+		if p, ok := priorities[sorted[i].ID]; ok && ValidPriority(p) {
+			sorted[i].Priority = p
+		}
+	}
+	data.Todos = sorted
+}
+
+// HandleTriage shows the todos (GET /triage) and asks the model for an order (POST).
+func HandleTriage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := TriagePageData{Settings: data.Settings, Revision: data.Revision, Todos: data.Todos, CanSuggest: openAIKey(data) != ""}
+
+	if r.Method == http.MethodPost && len(data.Todos) > 0 {
+		todos := data.Todos
+		if len(todos) > maxTriageTodos {
+			todos = todos[:maxTriageTodos]
+		}
+		// Private habits (privacy.go) are not sent to OpenAI.
+		var open []Habit
+		for _, h := range SharedHabits(data.Habits) {
+			if !h.PausedOn(Today()) && !containsInt(data.History[Today()].CompletedHabits, h.ID) {
+				open = append(open, h)
+			}
+		}
+		suggestions, err := SuggestTodoOrder(todos, open, Today(), openAIKey(data))
+		if err != nil {
+			pd.Message = "Could not get a suggestion. Check OPENAI_KEY and try again."
+		} else {
+			byID := make(map[int]Todo)
+			for _, t := range data.Todos {
+				byID[t.ID] = t
+			}
+			var ids []string
+			for _, s := range suggestions {
+				pd.Rows = append(pd.Rows, TriageRow{Todo: byID[s.TodoID], Rank: len(pd.Rows) + 1, Suggested: s.Priority, Reason: s.Reason})
+				ids = append(ids, strconv.Itoa(s.TodoID))
+			}
+			pd.Order = strings.Join(ids, ",")
+			if len(suggestions) < len(data.Todos) {
+				pd.Message = "Tasks without a suggestion keep their priority and go after these."
+			}
+		}
+	}
+	if r.URL.Query().Get("error") == "invalid" {
+		pd.Message = "That suggestion couldn't be applied. Ask for a new one."
+	}
+	if err := tmpl.ExecuteTemplate(w, "triage.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleTriageAccept stores a suggested order. POST /triage/accept
+// Form: order=3,1,2 and priority_<todo_id>=high|medium|low for the todos in it.
+func HandleTriageAccept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var order []int
+	priorities := make(map[int]string)
+	for _, s := range strings.Split(r.FormValue("order"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			http.Redirect(w, r, "/triage?error=invalid", http.StatusFound)
+			return
+		}
+		order = append(order, id)
+		if p := r.FormValue("priority_" + strconv.Itoa(id)); p != "" {
+			if !ValidPriority(p) {
+				http.Redirect(w, r, "/triage?error=invalid", http.StatusFound)
+				return
+			}
+			priorities[id] = p
+		}
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ApplyTriage(data, order, priorities)
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?todo=triaged", http.StatusFound)
+}
@@ -0,0 +1,199 @@
+// tui.go - A full-screen dashboard in the terminal, for people who live in tmux:
+//
+//	./crescendo tui
+//
+// It lists today's habits with their target, streak and the last two weeks as a mini heatmap
+// (■ done, · missed). Keys: ↑/↓ or k/j to move, space or Enter to tick/untick the selected habit
+// for today, r to reload (picks up changes made in the browser), q to quit.
+//
+// It works on data.json like the other commands (cli.go). Keys are read one at a time by
+// switching the terminal to raw mode with stty; where that isn't available (Windows), type the
+// keys and press Enter.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// tuiHeatmapDays is how many days the mini heatmap shows, ending today.
+const tuiHeatmapDays = 14
+
+// ANSI escape codes for the dashboard.
+const (
+	ansiClear = "\033[H\033[2J"
+	ansiGreen = "\033[32m"
+	ansiDim   = "\033[2m"
+	ansiBold  = "\033[1m"
+	ansiReset = "\033[0m"
+)
+
+// renderTUI draws the dashboard: a header, one line per habit (the selected one marked), and a
+// status message. Lines end in \r\n because raw mode doesn't return the cursor by itself.
+func renderTUI(data *AppData, cursor int, msg string, now time.Time) string {
+	today := now.Format(dateLayout)
+	var sb strings.Builder
+	sb.WriteString(ansiClear)
+	fmt.Fprintf(&sb, "%sHabits · %s%s\r\n\r\n", ansiBold, now.Format("Mon 2 Jan 2006"), ansiReset)
+	if len(data.Habits) == 0 {
+		sb.WriteString("No habits yet. Add some in the browser, then press r.\r\n")
+	}
+	done := data.History[today].CompletedHabits
+	nameWidth := 0
+	for _, h := range data.Habits {
+		if n := len([]rune(h.Name)); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	for i, h := range data.Habits {
+		pointer := "  "
+		if i == cursor {
+			pointer = "› "
+		}
+		box := "[ ]"
+		if containsInt(done, h.ID) {
+			box = ansiGreen + "[x]" + ansiReset
+		}
+		target := fmt.Sprintf("%d %s", h.Quantity, h.Unit)
+		fmt.Fprintf(&sb, "%s%s %-*s  %-14s %3d🔥  %s\r\n", pointer, box, nameWidth, h.Name, target, GetStreakForHabit(data, h.ID), tuiHeatmap(data, h, now))
+	}
+	sb.WriteString("\r\n" + ansiDim + "↑/↓ move · space tick · r reload · q quit" + ansiReset + "\r\n")
+	if msg != "" {
+		sb.WriteString(msg + "\r\n")
+	}
+	return sb.String()
+}
+
+// tuiHeatmap is the habit's last tuiHeatmapDays days, oldest first: ■ done, · not done, and a
+// blank for days before the habit existed.
+func tuiHeatmap(data *AppData, h Habit, now time.Time) string {
+	created := ""
+	if !h.CreatedAt.IsZero() {
+		created = h.CreatedAt.Format(dateLayout)
+	}
+	var sb strings.Builder
+	for i := tuiHeatmapDays - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(dateLayout)
+		switch {
+		case containsInt(data.History[day].CompletedHabits, h.ID):
+			sb.WriteString(ansiGreen + "■" + ansiReset)
+		case day < created:
+			sb.WriteString(" ")
+		default:
+			sb.WriteString(ansiDim + "·" + ansiReset)
+		}
+	}
+	return sb.String()
+}
+
+// rawTerminal switches the terminal to raw mode (keys arrive one by one, without echo) and
+// returns a function that restores it. It fails when stdin isn't a terminal or there's no stty.
+func rawTerminal() (restore func(), err error) {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(saved) }, nil
+}
+
+// tuiToggle ticks or unticks the habit at position cursor for today and saves. It returns the
+// reloaded data and a message for the status line.
+func tuiToggle(cursor int) (*AppData, string, error) {
+	data, err := LoadData()
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor < 0 || cursor >= len(data.Habits) {
+		return data, "", nil
+	}
+	h := &data.Habits[cursor]
+	today := Today()
+	done := containsInt(data.History[today].CompletedHabits, h.ID)
+	if !done {
+		if msg := completionBlocked(data, h, today); msg != "" {
+			return data, msg + ".", nil
+		}
+	}
+	SetHabitCompleted(data, h.ID, today, !done)
+	if err := SaveData(data); err != nil {
+		return nil, "", err
+	}
+	if done {
+		return data, h.Name + " unticked.", nil
+	}
+	return data, "✅ " + h.Name + " done.", nil
+}
+
+// RunTUI runs the dashboard until q (or the end of in).
+func RunTUI(in io.Reader, out io.Writer) error {
+	if restore, err := rawTerminal(); err == nil {
+		defer restore()
+	}
+	data, err := LoadData()
+	if err != nil {
+		return err
+	}
+	cursor, msg := 0, ""
+	keys := bufio.NewReader(in)
+	for {
+		if cursor >= len(data.Habits) {
+			cursor = len(data.Habits) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+		fmt.Fprint(out, renderTUI(data, cursor, msg, time.Now()))
+		msg = ""
+
+		key, err := keys.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch key {
+		case 'q', 3: // 3 is Ctrl+C, which raw mode delivers as a key
+			fmt.Fprint(out, ansiClear)
+			return nil
+		case 'k':
+			cursor--
+		case 'j':
+			cursor++
+		case 27: // arrow keys arrive as ESC [ A (up) / ESC [ B (down)
+			if b, _ := keys.ReadByte(); b == '[' {
+				switch b, _ := keys.ReadByte(); b {
+				case 'A':
+					cursor--
+				case 'B':
+					cursor++
+				}
+			}
+		case ' ', '\r':
+			if data, msg, err = tuiToggle(cursor); err != nil {
+				return err
+			}
+		case 'r':
+			if data, err = LoadData(); err != nil {
+				return err
+			}
+			msg = "Reloaded."
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// validation.go - Checking form input field by field. A handler reads its form through a
+// Validator, which notes what's wrong with each field ("Enter a whole number from 1 to 999"). If
+// anything is, the page is shown again (HTTP 422) with what was typed still in the form and the
+// message next to the field, instead of a redirect to a general error banner that loses the input.
+// The main page does this for adding a habit or task and for a habit's name, growth and look
+// (renderIndex in handlers.go); the template reads the form back with FormState.For. Messages are
+// in English until Localize translates them for the page (i18n.go).
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldErrors maps a form field's name to what's wrong with it.
+type FieldErrors map[string]string
+
+// FormState is a form that was sent back because of errors.
+type FormState struct {
+	Form    string     // which form: "add-habit", "add-todo", "rename", "growth", "look" or "notes"
+	HabitID int        // the habit a habit's own form is for, 0 for the others
+	Values  url.Values // what was sent
+	Errors  FieldErrors
+	args    map[string][]any // the values in each message, filled in by Localize
+}
+
+// For returns f if it is the given form (for habitID), or an empty FormState.
+func (f FormState) For(form string, habitID int) FormState {
+	if f.Form != form || f.HabitID != habitID {
+		return FormState{}
+	}
+	return f
+}
+
+// Sent reports whether the form was sent back (so its values replace the usual ones).
+func (f FormState) Sent() bool { return f.Form != "" }
+
+// Value is what was sent in field ("" if the form wasn't sent back).
+func (f FormState) Value(field string) string { return f.Values.Get(field) }
+
+// Error is what's wrong with field ("" if nothing).
+func (f FormState) Error(field string) string { return f.Errors[field] }
+
+// Localize returns f with its messages in l's language.
+func (f FormState) Localize(l Locale) FormState {
+	errs := make(FieldErrors, len(f.Errors))
+	for field, msg := range f.Errors {
+		errs[field] = l.T(msg, f.args[field]...)
+	}
+	f.Errors, f.args = errs, nil
+	return f
+}
+
+// Validator reads a form's fields, noting an error for each one that's wrong.
+type Validator struct {
+	r      *http.Request
+	Errors FieldErrors
+	args   map[string][]any
+}
+
+// NewValidator starts checking r's form.
+func NewValidator(r *http.Request) *Validator {
+	return &Validator{r: r, Errors: FieldErrors{}, args: map[string][]any{}}
+}
+
+// fail notes msg (with fmt verbs for args) for field; the first problem with a field is the
+// one shown.
+func (v *Validator) fail(field, msg string, args ...any) {
+	if _, ok := v.Errors[field]; !ok {
+		v.Errors[field] = msg
+		v.args[field] = args
+	}
+}
+
+// Valid reports whether no field had an error.
+func (v *Validator) Valid() bool { return len(v.Errors) == 0 }
+
+// State is the form to send back: form and habitID as in FormState, with the values sent.
+func (v *Validator) State(form string, habitID int) FormState {
+	return FormState{Form: form, HabitID: habitID, Values: v.r.Form, Errors: v.Errors, args: v.args}
+}
+
+// Text returns the trimmed field, noting missing (like "Please enter a task.") if it is empty
+// and missing isn't "", or an error if it is longer than maxChars (0 for no limit).
+func (v *Validator) Text(field, missing string, maxChars int) string {
+	s := strings.TrimSpace(v.r.FormValue(field))
+	switch {
+	case s == "" && missing != "":
+		v.fail(field, missing)
+	case maxChars > 0 && len([]rune(s)) > maxChars:
+		v.fail(field, "Keep it to %d characters.", maxChars)
+	}
+	return s
+}
+
+// Int returns the field as a whole number from min to max (maxInt for no limit), or def if it
+// is empty.
+func (v *Validator) Int(field string, def, min, max int) int {
+	s := strings.TrimSpace(v.r.FormValue(field))
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		if max == maxInt {
+			v.fail(field, "Enter a whole number of at least %d.", min)
+		} else {
+			v.fail(field, "Enter a whole number from %d to %d.", min, max)
+		}
+		return def
+	}
+	return n
+}
+
+// maxInt is the max to give Int for "no upper limit".
+const maxInt = int(^uint(0) >> 1)
+
+// Date returns the field as YYYY-MM-DD ("" if empty).
+func (v *Validator) Date(field string) string {
+	s := strings.TrimSpace(v.r.FormValue(field))
+	if s == "" {
+		return ""
+	}
+	if _, err := ParseDate(s); err != nil {
+		v.fail(field, "Enter a date like 2025-02-01.")
+		return ""
+	}
+	return s
+}
+
+// Clock returns the field as HH:MM ("" if empty).
+func (v *Validator) Clock(field string) string {
+	s := strings.TrimSpace(v.r.FormValue(field))
+	if s == "" {
+		return ""
+	}
+	if _, err := time.Parse("15:04", s); err != nil {
+		v.fail(field, "Enter a time like 07:30.")
+		return ""
+	}
+	return s
+}
+
+// Color returns the field as a "#rrggbb" color ("" if empty).
+func (v *Validator) Color(field string) string {
+	c := strings.TrimSpace(v.r.FormValue(field))
+	if !ValidColor(c) {
+		v.fail(field, "Pick a color from the list.")
+		return ""
+	}
+	return strings.ToLower(c)
+}
+
+// Priority returns the field if it is a todo priority (or empty).
+func (v *Validator) Priority(field string) string {
+	p := v.r.FormValue(field)
+	if !ValidPriority(p) {
+		v.fail(field, "Pick high, medium, low or no priority.")
+		return ""
+	}
+	return p
+}
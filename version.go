@@ -0,0 +1,98 @@
+// version.go - Which build is running. Release builds set the version with the linker:
+//
+//	go build -ldflags "-X main.version=1.4.0" -o crescendo .
+//
+// The rest comes from debug.ReadBuildInfo: Go stamps a binary built in a git checkout with the
+// commit, its time, and whether there were uncommitted changes. (Set main.commit the same way
+// for builds made outside git, e.g. from a source tarball.) It is shown on /about and at the
+// bottom of the main page, and backups record it (backup.go) so a restore knows what wrote them.
+
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// version and commit can be set at build time with -ldflags "-X main.version=...".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version    string
+	Commit     string // full hash, "" if unknown
+	CommitTime string // RFC 3339, "" if unknown
+	Modified   bool   // built with uncommitted changes
+	GoVersion  string
+	Platform   string // e.g. linux/arm64
+}
+
+var buildInfo = sync.OnceValue(func() BuildInfo {
+	b := BuildInfo{Version: version, Commit: commit, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if b.Commit == "" {
+					b.Commit = s.Value
+				}
+			case "vcs.time":
+				b.CommitTime = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	return b
+})
+
+// GetBuildInfo returns what is known about the running binary (worked out once).
+func GetBuildInfo() BuildInfo {
+	return buildInfo()
+}
+
+// String is the short form for the footer: "1.4.0 (3f2a9c1)", "dev (3f2a9c1, modified)".
+func (b BuildInfo) String() string {
+	s := b.Version
+	short := b.Commit
+	if len(short) > 7 {
+		short = short[:7]
+	}
+	switch {
+	case short != "" && b.Modified:
+		s += " (" + short + ", modified)"
+	case short != "":
+		s += " (" + short + ")"
+	}
+	return s
+}
+
+// AboutPageData is what templates/about.html shows.
+type AboutPageData struct {
+	Settings Settings
+	Build    BuildInfo
+	Revision int64 // how many times the data has been saved (revision.go)
+	Instance InstanceStats
+}
+
+// HandleAbout shows the version page (GET /about).
+func HandleAbout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := AboutPageData{Settings: data.Settings, Build: GetBuildInfo(), Revision: data.Revision, Instance: NewInstanceStats(data)}
+	if err := tmpl.ExecuteTemplate(w, "about.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,148 @@
+// voice.go - Adding a task by voice. Record a voice note on your phone, upload it, and Whisper
+// (OpenAI's speech-to-text, see openai.go) turns it into the text of a new todo. The main page
+// has an upload button next to the task form (phones offer to record right there); scripts and
+// phone automations (an iOS Shortcut, Tasker) can post the recording to the API instead:
+//
+//	curl -u :password -F audio=@note.m4a http://localhost:8080/api/v1/voice-todo
+//
+// which answers with the new todo as JSON. Both need an OpenAI key; the recording isn't kept.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxVoiceUpload caps voice notes; it is also the most Whisper accepts.
+const maxVoiceUpload = 25 << 20
+
+// maxVoiceTodoChars is the longest todo a voice note makes; a longer transcript is cut off.
+const maxVoiceTodoChars = 500
+
+// voiceExtensions are the recording formats Whisper understands.
+var voiceExtensions = map[string]bool{
+	".m4a": true, ".mp3": true, ".mp4": true, ".mpeg": true, ".mpga": true, ".wav": true, ".webm": true, ".ogg": true, ".oga": true, ".flac": true,
+}
+
+// errVoice* say what went wrong with a voice note, for the page and the API.
+var (
+	errVoiceNoKey   = errors.New("transcribing needs an OpenAI key (OPENAI_KEY)")
+	errVoiceFile    = errors.New("upload a recording (m4a, mp3, wav, webm, ogg or flac, up to 25 MB) as \"audio\"")
+	errVoiceSilence = errors.New("nothing could be heard in the recording")
+)
+
+// readVoiceNote transcribes the recording in the request's "audio" field into a todo (without
+// an ID yet), with the optional priority and due_date fields like the task form. err is one of
+// the errVoice* errors, or a problem with Whisper.
+func readVoiceNote(w http.ResponseWriter, r *http.Request, apiKey string) (Todo, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxVoiceUpload+1<<20) // room for the other fields
+	file, header, err := r.FormFile("audio")
+	if err != nil {
+		return Todo{}, errVoiceFile
+	}
+	defer file.Close()
+	if header.Size > maxVoiceUpload || !voiceExtensions[strings.ToLower(filepath.Ext(header.Filename))] {
+		return Todo{}, errVoiceFile
+	}
+	if apiKey == "" {
+		return Todo{}, errVoiceNoKey
+	}
+	t := Todo{Priority: r.FormValue("priority"), DueDate: strings.TrimSpace(r.FormValue("due_date"))}
+	if !ValidPriority(t.Priority) {
+		t.Priority = ""
+	}
+	if _, err := ParseDate(t.DueDate); err != nil {
+		t.DueDate = ""
+	}
+	text, err := transcribeAudio(file, header.Filename, apiKey)
+	if err != nil {
+		log.Println("voice todo:", err)
+		return Todo{}, err
+	}
+	t.Text = strings.Join(strings.Fields(text), " ")
+	if t.Text == "" {
+		return Todo{}, errVoiceSilence
+	}
+	if r := []rune(t.Text); len(r) > maxVoiceTodoChars {
+		t.Text = string(r[:maxVoiceTodoChars])
+	}
+	return t, nil
+}
+
+// HandleVoiceTodo handles POST /voice-todo, the upload form on the main page.
+// Form (multipart): audio=<recording>, priority=high (optional), due_date=2025-02-01 (optional)
+func HandleVoiceTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Only the key for now: the data is loaded after transcribing, which takes a while, so
+	// changes made meanwhile aren't refused as outdated (revision.go).
+	settings, err := LoadDataWithoutHistory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t, err := readVoiceNote(w, r, openAIKey(settings))
+	if errors.Is(err, errVoiceFile) {
+		http.Redirect(w, r, "/?error=voice-file", http.StatusFound)
+		return
+	} else if err != nil {
+		http.Redirect(w, r, "/?error=voice", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.ID = NextTodoID(data)
+	data.Todos = append(data.Todos, t)
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/?todo=voice", http.StatusFound)
+}
+
+// HandleVoiceTodoAPI handles POST /api/v1/voice-todo: the same as the form, answering with the
+// new todo ({"id": 7, "text": "...", ...}) or {"error": "..."}.
+func HandleVoiceTodoAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	settings, err := LoadDataWithoutHistory() // see HandleVoiceTodo
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	t, err := readVoiceNote(w, r, openAIKey(settings))
+	switch {
+	case errors.Is(err, errVoiceFile), errors.Is(err, errVoiceSilence):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, errVoiceNoKey):
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "could not transcribe the recording"})
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	t.ID = NextTodoID(data)
+	data.Todos = append(data.Todos, t)
+	if err := SaveData(data); err != nil {
+		writeJSON(w, saveStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
@@ -0,0 +1,461 @@
+// webpush.go - Web Push notifications: the browser gives us a "subscription" (an endpoint URL
+// at the browser vendor's push service plus two keys), and we can then send it messages even
+// when no tab is open. Two standards are involved, both implemented here with the standard library:
+//   - VAPID (RFC 8292): we sign every request with our own key pair, generated on first use and
+//     kept in vapid-key.pem, so the push service knows the messages come from us.
+//   - Message encryption (RFC 8291, "aes128gcm"): the message is encrypted for the subscription's
+//     keys, so the push service can't read it.
+//
+// Subscriptions belong to this instance's browsers, so they are kept in push-subscriptions.json
+// rather than in data.json (which is synced to other devices). Every configured time of day
+// (PUSH_TIMES, default 21:00 and 23:00) subscribers get "3 habits left today" if anything is
+// still open. Push is also a channel of the notification engine (notify.go), so the evening
+// habit reminders arrive as push notifications too. Optional .env settings:
+//
+//	PUSH_TIMES=21:00,23:00
+//	VAPID_SUBJECT=mailto:me@example.com   (a contact for the push service; default mailto:admin@localhost)
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	vapidKeyFile       = "vapid-key.pem"
+	pushStateFile      = "push-subscriptions.json"
+	pushRecordSize     = 4096 // the "rs" field of an aes128gcm message
+	pushDefaultTimes   = "21:00,23:00"
+	pushDefaultSubject = "mailto:admin@localhost"
+)
+
+// PushSubscription is what the browser's pushManager.subscribe() returns (as JSON).
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"` // the browser's public key, base64url
+		Auth   string `json:"auth"`   // a shared secret, base64url
+	} `json:"keys"`
+}
+
+// pushState is the content of push-subscriptions.json.
+type pushState struct {
+	Subscriptions []PushSubscription `json:"subscriptions"`
+	LastNag       string             `json:"last_nag,omitempty"` // "2025-01-28 21:00": the last scheduled nag sent
+}
+
+// pushMu guards push-subscriptions.json and the VAPID key file.
+var pushMu sync.Mutex
+
+// b64 is base64url without padding, the encoding used everywhere in Web Push.
+var b64 = base64.RawURLEncoding
+
+func loadPushState() (pushState, error) {
+	var st pushState
+	b, err := os.ReadFile(pushStateFile)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, json.Unmarshal(b, &st)
+}
+
+func savePushState(st pushState) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pushStateFile, b, 0600)
+}
+
+// vapidKey returns our VAPID key pair, generating and saving it on first use.
+// The caller holds pushMu.
+func vapidKey() (*ecdsa.PrivateKey, error) {
+	if b, err := os.ReadFile(vapidKeyFile); err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("%s: not a PEM file", vapidKeyFile)
+		}
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an ECDSA key", vapidKeyFile)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return key, os.WriteFile(vapidKeyFile, pemBytes, 0600)
+}
+
+// vapidPublicKey is the public key in the uncompressed form browsers expect, base64url.
+func vapidPublicKey(key *ecdsa.PrivateKey) (string, error) {
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return b64.EncodeToString(pub.Bytes()), nil
+}
+
+// vapidAuthorization builds the "Authorization: vapid t=<JWT>, k=<public key>" header for an
+// endpoint. The JWT is signed with ES256 (ECDSA P-256 + SHA-256).
+func vapidAuthorization(key *ecdsa.PrivateKey, endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = pushDefaultSubject
+	}
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + b64.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// A JWT ES256 signature is r and s as two 32-byte big-endian numbers.
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	pub, err := vapidPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + unsigned + "." + b64.EncodeToString(sig) + ", k=" + pub, nil
+}
+
+// hkdf is HKDF-SHA256 (RFC 5869) for outputs of up to 32 bytes, all Web Push needs.
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+// encryptPush encrypts a message for a subscription (RFC 8291) and returns the request body.
+// Every message gets a fresh key pair (its public half travels in the header) and a random salt.
+func encryptPush(sub PushSubscription, message []byte) ([]byte, error) {
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptPushWith(sub, message, asPrivate, salt)
+}
+
+// encryptPushWith does the work of encryptPush with a given key pair and salt.
+func encryptPushWith(sub PushSubscription, message []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublicBytes, err := b64.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	authSecret, err := b64.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	shared, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublic...)
+	ikm := hkdf(authSecret, shared, keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (here: only) record.
+	ciphertext := gcm.Seal(nil, nonce, append(message, 0x02), nil)
+
+	// Header: salt (16) | record size (4) | key id length (1) | key id (our public key).
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(pushRecordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	body.Write(ciphertext)
+	return body.Bytes(), nil
+}
+
+// errPushGone means the subscription no longer exists (the user unsubscribed or the browser
+// dropped it) and should be forgotten.
+var errPushGone = errors.New("push subscription expired")
+
+// sendPush delivers one encrypted message to one subscription.
+func sendPush(key *ecdsa.PrivateKey, sub PushSubscription, message []byte) error {
+	body, err := encryptPush(sub, message)
+	if err != nil {
+		return err
+	}
+	auth, err := vapidAuthorization(key, sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400") // the push service may hold it for a day if the device is offline
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errPushGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SendPushToAll sends a notification to every subscription and forgets expired ones.
+// It returns how many deliveries succeeded.
+func SendPushToAll(title, body string) (int, error) {
+	pushMu.Lock()
+	defer pushMu.Unlock()
+	st, err := loadPushState()
+	if err != nil || len(st.Subscriptions) == 0 {
+		return 0, err
+	}
+	key, err := vapidKey()
+	if err != nil {
+		return 0, err
+	}
+	message, err := json.Marshal(map[string]string{"title": title, "body": body, "url": "/"})
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	var kept []PushSubscription
+	var lastErr error
+	for _, sub := range st.Subscriptions {
+		err := sendPush(key, sub, message)
+		switch {
+		case errors.Is(err, errPushGone):
+			continue // drop it
+		case err != nil:
+			lastErr = err
+		default:
+			sent++
+		}
+		kept = append(kept, sub)
+	}
+	if len(kept) != len(st.Subscriptions) {
+		st.Subscriptions = kept
+		if err := savePushState(st); err != nil {
+			return sent, err
+		}
+	}
+	if sent == 0 {
+		return 0, lastErr
+	}
+	return sent, nil
+}
+
+// HasPushSubscriptions reports whether any browser is subscribed (used by ConfiguredNotifiers).
+func HasPushSubscriptions() bool {
+	pushMu.Lock()
+	defer pushMu.Unlock()
+	st, err := loadPushState()
+	return err == nil && len(st.Subscriptions) > 0
+}
+
+// pushNotifier is the Web Push channel of the notification engine.
+type pushNotifier struct{}
+
+func (pushNotifier) Name() string { return "push" }
+
+func (pushNotifier) Send(title, body string) error {
+	_, err := SendPushToAll(title, body)
+	return err
+}
+
+// pushTimes returns today's nag times from PUSH_TIMES ("HH:MM,HH:MM"), as "HH:MM" strings.
+func pushTimes() []string {
+	raw := os.Getenv("PUSH_TIMES")
+	if raw == "" {
+		raw = pushDefaultTimes
+	}
+	var out []string
+	for _, s := range strings.Split(raw, ",") {
+		if t, err := time.Parse("15:04", strings.TrimSpace(s)); err == nil {
+			out = append(out, t.Format("15:04"))
+		}
+	}
+	return out
+}
+
+// dueNag returns the latest nag slot ("2025-01-28 21:00") that has passed today, or "".
+func dueNag(now time.Time) string {
+	slot := ""
+	clock := now.Format("15:04")
+	for _, t := range pushTimes() {
+		if t <= clock && (slot == "" || t > slot[len(slot)-5:]) {
+			slot = now.Format(dateLayout) + " " + t
+		}
+	}
+	return slot
+}
+
+// RunPushReminders checks once a minute whether a nag slot has passed and, if habits are still
+// open today, pushes "N habits left today". Run it in its own goroutine: go RunPushReminders()
+func RunPushReminders() {
+	for range time.Tick(time.Minute) {
+		slot := dueNag(time.Now())
+		if slot == "" {
+			continue
+		}
+		pushMu.Lock()
+		st, err := loadPushState()
+		pushMu.Unlock()
+		if err != nil || len(st.Subscriptions) == 0 || st.LastNag >= slot {
+			continue
+		}
+		data, err := LoadData()
+		if err != nil {
+			log.Println("push:", err)
+			continue
+		}
+		if left := IncompleteHabitsToday(data); left > 0 {
+			noun := "habits"
+			if left == 1 {
+				noun = "habit"
+			}
+			if _, err := SendPushToAll(fmt.Sprintf("%d %s left today", left, noun), "There's still time before midnight."); err != nil {
+				log.Println("push:", err)
+			}
+		}
+		// Remember the slot even if nothing was open, so it isn't checked again.
+		pushMu.Lock()
+		if st, err := loadPushState(); err == nil {
+			st.LastNag = slot
+			savePushState(st)
+		}
+		pushMu.Unlock()
+	}
+}
+
+// HandleSubscribe handles /subscribe:
+//   - GET returns {"public_key": "..."}, the VAPID key the browser needs to subscribe
+//   - POST stores a subscription (the JSON from pushManager.subscribe())
+//   - DELETE removes it again (body: the same JSON, only "endpoint" is used)
+func HandleSubscribe(w http.ResponseWriter, r *http.Request) {
+	pushMu.Lock()
+	defer pushMu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		key, err := vapidKey()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		pub, err := vapidPublicKey(key)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"public_key": pub})
+	case http.MethodPost, http.MethodDelete:
+		var sub PushSubscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil || !strings.HasPrefix(sub.Endpoint, "https://") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid subscription"})
+			return
+		}
+		if r.Method == http.MethodPost && (sub.Keys.P256dh == "" || sub.Keys.Auth == "") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "subscription keys missing"})
+			return
+		}
+		st, err := loadPushState()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		var kept []PushSubscription
+		for _, s := range st.Subscriptions {
+			if s.Endpoint != sub.Endpoint {
+				kept = append(kept, s)
+			}
+		}
+		if r.Method == http.MethodPost {
+			kept = append(kept, sub)
+		}
+		st.Subscriptions = kept
+		if err := savePushState(st); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"subscriptions": len(kept)})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,242 @@
+// websocket.go - A small WebSocket client (RFC 6455), enough for the Discord gateway (discord.go);
+// live.go uses the same frames for the server side.
+// The standard library has no WebSocket package, and the protocol is simple: after an HTTP
+// "Upgrade" handshake, both sides exchange frames over the same TCP connection. Each frame is a
+// header (final flag, opcode, length, mask) followed by the payload. Frames sent by a client
+// must be masked (XORed with 4 random bytes).
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes (the kind of frame).
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsMaxMessage limits how big a message we accept, so a broken peer can't exhaust memory.
+const wsMaxMessage = 16 << 20
+
+// wsGUID is the fixed string from the RFC used to compute Sec-WebSocket-Accept.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsConn is an open WebSocket connection. Reads must happen from one goroutine; writes are
+// guarded by writeMu so a heartbeat goroutine can write while another goroutine reads.
+type wsConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	mask    bool // true on the client side: our frames must be masked
+	writeMu sync.Mutex
+}
+
+// wsAccept computes the Sec-WebSocket-Accept value the server must answer for a key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// dialWebSocket connects to a ws:// or wss:// URL and performs the opening handshake.
+func dialWebSocket(rawURL string) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	switch u.Scheme {
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: handshake failed: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, br: br, mask: true}, nil
+}
+
+// WriteMessage sends one frame with the given opcode.
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode} // 0x80 = final frame
+	maskBit := byte(0)
+	if c.mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	data := payload
+	if c.mask {
+		key := make([]byte, 4)
+		rand.Read(key)
+		header = append(header, key...)
+		data = make([]byte, len(payload))
+		for i, b := range payload {
+			data[i] = b ^ key[i%4]
+		}
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame reads one raw frame.
+func (c *wsConn) readFrame() (final bool, opcode byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.br, h[:]); err != nil {
+		return
+	}
+	final = h[0]&0x80 != 0
+	opcode = h[0] & 0x0F
+	masked := h[1]&0x80 != 0
+	n := uint64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		err = errors.New("websocket: frame too large")
+		return
+	}
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, key[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return
+}
+
+// ReadMessage returns the next text or binary message, joining fragmented frames. Pings are
+// answered with pongs automatically. A close frame is answered and returned as io.EOF.
+func (c *wsConn) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		final, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.WriteMessage(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.WriteMessage(wsClose, payload)
+			if len(payload) >= 2 {
+				return 0, nil, fmt.Errorf("websocket closed (%d): %s: %w", binary.BigEndian.Uint16(payload), payload[2:], io.EOF)
+			}
+			return 0, nil, io.EOF
+		case wsText, wsBinary:
+			opcode, message = op, payload
+		case wsContinuation:
+			message = append(message, payload...)
+		}
+		if len(message) > wsMaxMessage {
+			return 0, nil, errors.New("websocket: message too large")
+		}
+		if final && opcode != 0 {
+			return opcode, message, nil
+		}
+	}
+}
+
+// Close closes the connection (without waiting for the peer's close frame).
+func (c *wsConn) Close() error {
+	c.WriteMessage(wsClose, []byte{0x03, 0xE8}) // 1000 = normal closure
+	return c.conn.Close()
+}
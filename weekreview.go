@@ -0,0 +1,216 @@
+// weekreview.go - The 7-day review page (/week-review). Every habit is listed with how its week
+// went (days done, misses, penalties) and you choose per habit to increase, keep or decrease its
+// target, and can write a few lines about the week. With an OpenAI key, "Suggest changes" asks
+// the model for a recommendation per habit based on the week's completion rate; the suggestions
+// only prefill the form.
+// While a review is due it can't be put off: the main page shows it in a box over everything
+// else, and habits can't be completed until it is done. The outcome is kept in the day's record
+// (DayRecord.WeekReview), and /reviews lists all past reviews.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// ReviewHabitView is one habit on the review page, with the choice to prefill.
+type ReviewHabitView struct {
+	Habit
+	Summary    CycleSummary
+	Rate       int    // percent of the counted days the habit was done
+	Action     string // "increase", "keep" or "decrease"
+	Amount     int
+	Suggestion string // the model's reason, if suggestions were asked for
+}
+
+// WeekReviewPageData is what week-review.html gets.
+type WeekReviewPageData struct {
+	Settings    Settings
+	Revision    int64 // sent back with the forms (revision.go)
+	NeedsReview bool
+	NextReview  string // when the review is due next (if it isn't due now)
+	Habits      []ReviewHabitView
+	CanSuggest  bool // an OpenAI key is set
+	Suggested   bool
+	Message     string
+}
+
+// maxReflectionChars caps the text written about the week at a review.
+const maxReflectionChars = 2000
+
+// reviewChoice turns a suggested change into the form's action and amount.
+func reviewChoice(change int) (string, int) {
+	switch {
+	case change > 0:
+		return "increase", change
+	case change < 0:
+		return "decrease", -change
+	}
+	return "keep", 1
+}
+
+// HandleWeekReview shows the review page (GET; ?suggest=1 asks the model first) and completes the
+// review (POST). Form: action_<habit_id>=increase|keep|decrease (one for every habit on the
+// page), amount_<habit_id>=<number> and reflection=<text> (optional).
+func HandleWeekReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/week-review?error=invalid", http.StatusFound)
+			return
+		}
+		changes := make(map[int]int)
+		for _, h := range data.Habits {
+			if h.PausedOn(Today()) {
+				continue
+			}
+			id := strconv.Itoa(h.ID)
+			amount, err := strconv.Atoi(r.FormValue("amount_" + id))
+			if err != nil || amount < 0 {
+				amount = 0
+			}
+			switch r.FormValue("action_" + id) {
+			case "increase":
+				changes[h.ID] = amount
+			case "decrease":
+				changes[h.ID] = -amount
+			case "keep":
+			default:
+				// Every habit needs a decision (a habit added since the page was loaded has none).
+				http.Redirect(w, r, "/week-review?error=invalid", http.StatusFound)
+				return
+			}
+		}
+		if len(r.FormValue("reflection")) > maxReflectionChars {
+			http.Redirect(w, r, "/week-review?error=reflection", http.StatusFound)
+			return
+		}
+		CompleteWeekReview(data, changes, r.FormValue("reflection"))
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		http.Redirect(w, r, "/?review=1", http.StatusFound)
+		return
+	}
+
+	needs, _ := NeedsWeekReview(data)
+	pd := WeekReviewPageData{
+		Settings:    data.Settings,
+		Revision:    data.Revision,
+		NeedsReview: needs,
+		CanSuggest:  openAIKey(data) != "",
+	}
+	if !needs {
+		pd.NextReview, _ = NextReviewDate(data)
+	}
+	summaries := ReviewSummaries(data)
+
+	// Private habits (privacy.go) are not sent to OpenAI.
+	var suggestions map[int]ReviewSuggestion
+	if needs && r.URL.Query().Get("suggest") == "1" {
+		suggestions, err = SuggestReviewChanges(SharedHabits(data.Habits), summaries, openAIKey(data))
+		if err != nil {
+			pd.Message = "Could not get suggestions. Check OPENAI_KEY and try again."
+		} else {
+			pd.Suggested = true
+		}
+	}
+
+	for _, h := range data.Habits {
+		if h.PausedOn(Today()) {
+			continue // keeps its target (pause.go)
+		}
+		v := ReviewHabitView{Habit: h, Summary: summaries[h.ID], Action: "increase", Amount: h.WeeklyStep()}
+		if h.MaxQuantity > 0 && h.Quantity >= h.MaxQuantity {
+			v.Action = "keep" // already at its ceiling
+		}
+		if v.Summary.Days > 0 {
+			v.Rate = (v.Summary.Days - v.Summary.Misses) * 100 / v.Summary.Days
+		}
+		if s, ok := suggestions[h.ID]; ok {
+			v.Action, v.Amount = reviewChoice(s.Change)
+			v.Suggestion = s.Reason
+		}
+		pd.Habits = append(pd.Habits, v)
+	}
+	switch {
+	case r.URL.Query().Get("error") == "invalid":
+		pd.Message = "Something was wrong with that form: choose increase, keep or decrease for every habit."
+	case r.URL.Query().Get("error") == "reflection":
+		pd.Message = "That reflection is too long. Keep it under 2000 characters."
+	case r.URL.Query().Get("blocked") == "1" && needs:
+		pd.Message = "Finish the week review first: habits can be completed again once it's done."
+	}
+	if err := tmpl.ExecuteTemplate(w, "week-review.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// PastReview is one completed review on /reviews. Review is nil for week reviews done before
+// their decisions were kept.
+type PastReview struct {
+	Date   string
+	Kind   string // "week", "month" or "quarter" (tierreview.go)
+	Review *WeekReview
+}
+
+// ReviewHistoryPageData is what reviews.html gets.
+type ReviewHistoryPageData struct {
+	Settings Settings
+	Reviews  []PastReview // oldest first
+}
+
+// PastReviews returns the completed reviews in the history, oldest first (on the same day: the
+// week review, then the monthly, then the quarterly one).
+func PastReviews(data *AppData) []PastReview {
+	var out []PastReview
+	for day, rec := range data.History {
+		if rec.WeekReviewDone || rec.WeekReview != nil {
+			out = append(out, PastReview{Date: day, Kind: "week", Review: rec.WeekReview})
+		}
+		if rec.MonthReview != nil {
+			out = append(out, PastReview{Date: day, Kind: "month", Review: rec.MonthReview})
+		}
+		if rec.QuarterReview != nil {
+			out = append(out, PastReview{Date: day, Kind: "quarter", Review: rec.QuarterReview})
+		}
+	}
+	order := map[string]int{"week": 0, "month": 1, "quarter": 2}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Date != out[j].Date {
+			return out[i].Date < out[j].Date
+		}
+		return order[out[i].Kind] < order[out[j].Kind]
+	})
+	return out
+}
+
+// HandleReviewHistory shows the past reviews (GET /reviews): what each one changed and what was
+// written about the week (or month, or quarter), so you can see how the targets grew.
+func HandleReviewHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pd := ReviewHistoryPageData{Settings: data.Settings, Reviews: PastReviews(data)}
+	if err := tmpl.ExecuteTemplate(w, "reviews.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,204 @@
+// widget.go - A small picture of one habit for your own website or GitHub profile: its name, the
+// current streak and a heatmap of the last weeks, as an SVG image at a secret link:
+//
+//	![Reading](https://habits.example.com/widget/Xy3k9Q.svg)
+//	<img src="https://habits.example.com/widget/Xy3k9Q.svg?weeks=26&theme=dark" alt="Reading">
+//
+// weeks (4 to 53, default 20) sets how far back it goes, theme=dark suits dark pages. The image
+// is drawn again on every request, so it's always current; the cache headers let browsers and
+// GitHub's image proxy keep it for a few minutes. Widgets are made and revoked on the settings
+// page, like share links (share.go), and show one habit each. A private habit (privacy.go) has
+// no widget: its link answers 404 until the habit is shared again.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WidgetLink is the secret link to one habit's widget.
+type WidgetLink struct {
+	Token     string    `json:"token"`
+	HabitID   int       `json:"habit_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WidgetURL is the address of the widget's image.
+func WidgetURL(token string) string {
+	return publicURL() + "/widget/" + token + ".svg"
+}
+
+// widgetMaxAge is how long browsers and proxies may keep a widget before asking again.
+const widgetMaxAge = 10 * time.Minute
+
+// widgetColors are the colors of a widget in one theme.
+type widgetColors struct {
+	background, border, text, muted, missed, done string
+}
+
+var widgetThemes = map[string]widgetColors{
+	"light": {background: "#ffffff", border: "#d0d7de", text: "#1f2328", muted: "#656d76", missed: "#ebedf0", done: "#40c463"},
+	"dark":  {background: "#0d1117", border: "#30363d", text: "#e6edf3", muted: "#8b949e", missed: "#161b22", done: "#39d353"},
+}
+
+// Sizes in the SVG, in pixels.
+const (
+	widgetCell     = 10 // a day's square
+	widgetGap      = 3
+	widgetPadding  = 10
+	widgetHeader   = 24 // the line with the name and the streak
+	widgetMinWidth = 240
+)
+
+// RenderWidget draws ah (one habit's heatmap, from BuildArchiveRange) with its streak as SVG.
+func RenderWidget(ah ArchiveHabit, streak int, colors widgetColors) []byte {
+	done := colors.done
+	if ah.Color != "" {
+		done = ah.Color // the habit's own color (appearance.go)
+	}
+	weeks := (len(ah.Cells) + 6) / 7
+	// Wide enough for the name and the streak even with only a few weeks.
+	width := max(2*widgetPadding+weeks*(widgetCell+widgetGap)-widgetGap, widgetMinWidth)
+	height := 2*widgetPadding + widgetHeader + 7*(widgetCell+widgetGap) - widgetGap
+	title := ah.Name
+	if ah.Icon != "" {
+		title = ah.Icon + " " + ah.Name
+	}
+	streakText := fmt.Sprintf("%d-day streak", streak)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s: %s">`,
+		width, height, width, height, html.EscapeString(ah.Name), streakText)
+	fmt.Fprintf(&sb, `<rect x="0.5" y="0.5" width="%d" height="%d" rx="6" fill="%s" stroke="%s"/>`, width-1, height-1, colors.background, colors.border)
+	sb.WriteString(`<g font-family="-apple-system,BlinkMacSystemFont,Segoe UI,Helvetica,Arial,sans-serif" font-size="12">`)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" fill="%s" font-weight="600">%s</text>`, widgetPadding, widgetPadding+12, colors.text, html.EscapeString(title))
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" fill="%s" text-anchor="end">%s</text>`, width-widgetPadding, widgetPadding+12, colors.muted, streakText)
+	sb.WriteString(`</g>`)
+	for i, c := range ah.Cells {
+		if c.Type == "pad" {
+			continue
+		}
+		fill := colors.missed
+		if c.Type == "done" {
+			fill = done
+		}
+		x := widgetPadding + (i/7)*(widgetCell+widgetGap)
+		y := widgetPadding + widgetHeader + (i%7)*(widgetCell+widgetGap)
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" rx="2" fill="%s"><title>%s</title></rect>`,
+			x, y, widgetCell, widgetCell, fill, c.Date)
+	}
+	sb.WriteString(`</svg>`)
+	return []byte(sb.String())
+}
+
+// HandleWidget handles GET /widget/{token}.svg[?weeks=20&theme=dark]: the widget's image.
+func HandleWidget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/widget/"), ".svg")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var habit *Habit
+	for _, l := range data.WidgetLinks {
+		if l.Token == token {
+			habit = FindHabitByID(data, l.HabitID)
+		}
+	}
+	if habit == nil || habit.Private {
+		http.NotFound(w, r)
+		return
+	}
+	weeks := 20
+	if n, err := strconv.Atoi(r.URL.Query().Get("weeks")); err == nil {
+		weeks = min(max(n, 4), 53)
+	}
+	colors := widgetThemes["light"]
+	if r.URL.Query().Get("theme") == "dark" {
+		colors = widgetThemes["dark"]
+	}
+
+	now := time.Now()
+	last, _ := ParseDate(now.Format(dateLayout))
+	first := last.AddDate(0, 0, -(weeks*7 - 1))
+	view := &AppData{Habits: []Habit{*habit}, History: data.History, Settings: data.Settings}
+	ad, err := BuildArchiveRange(view, MemoryHistory(data.History), first, last, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	svg := RenderWidget(ad.Habits[0], GetStreakForHabit(data, habit.ID), colors)
+
+	// The same picture gets the same ETag, so a proxy asking again gets a short 304.
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(widgetMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	// An SVG opened on its own is a document: keep scripts and outside content out of it.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(svg)
+}
+
+// HandleWidgetLinks handles POST from the settings page to create or revoke a widget.
+// Form: habit_id=1 (create) or revoke=<token>
+func HandleWidgetLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if revoke := r.FormValue("revoke"); revoke != "" {
+		var kept []WidgetLink
+		for _, l := range data.WidgetLinks {
+			if l.Token != revoke {
+				kept = append(kept, l)
+			}
+		}
+		data.WidgetLinks = kept
+	} else {
+		id, err := strconv.Atoi(r.FormValue("habit_id"))
+		if err != nil {
+			http.Redirect(w, r, "/settings?error=invalid", http.StatusFound)
+			return
+		}
+		habit := FindHabitByID(data, id)
+		if habit == nil {
+			http.Redirect(w, r, "/settings?error=notfound", http.StatusFound)
+			return
+		}
+		if habit.Private {
+			http.Redirect(w, r, "/settings?error=widget#widgets", http.StatusFound)
+			return
+		}
+		data.WidgetLinks = append(data.WidgetLinks, WidgetLink{Token: newQuickToken(), HabitID: id, CreatedAt: time.Now()})
+	}
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?widget=1#widgets", http.StatusFound)
+}
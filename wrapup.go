@@ -0,0 +1,180 @@
+// wrapup.go - The day wrap-up: once a day, at the time set under Settings → Day wrap-up (e.g.
+// 21:00), a notification lists the habits still open and the todos due today (or overdue). Every
+// line has a link that completes it straight from the notification: a quick-log link for habits
+// (quick.go, made on first use and listed on the settings page like any other) and a signed link
+// for todos that only works on the day it was sent (like the snooze links in reminders.go).
+// Sent by email, it can also be answered: a reply saying "done" marks its habits done (emailreply.go).
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wrapUpItem is one line of the wrap-up: what's left and the link that completes it.
+type wrapUpItem struct {
+	Text    string
+	Link    string
+	HabitID int // for habits
+}
+
+// quickTokenFor returns a quick-log token for habitID, making one if the habit has none yet.
+func quickTokenFor(data *AppData, habitID int, now time.Time) string {
+	for _, qt := range data.QuickTokens {
+		if qt.HabitID == habitID {
+			return qt.Token
+		}
+	}
+	qt := QuickToken{Token: newQuickToken(), HabitID: habitID, CreatedAt: now}
+	data.QuickTokens = append(data.QuickTokens, qt)
+	return qt.Token
+}
+
+// TodoDoneLink returns a signed link that completes a todo. It only works on the day it was made.
+func TodoDoneLink(todoID int, now time.Time) string {
+	value := fmt.Sprintf("%d/%s", todoID, now.Format(dateLayout))
+	q := url.Values{"todo_id": {strconv.Itoa(todoID)}, "sig": {signLink("todo-done", value)}}
+	return publicURL() + "/quick-todo?" + q.Encode()
+}
+
+// wrapUpItems lists what's still open on today: habits not done, skipped or paused, and todos
+// due today or earlier.
+func wrapUpItems(data *AppData, now time.Time) (habits, todos []wrapUpItem) {
+	today := now.Format(dateLayout)
+	rec := data.History[today]
+	for _, h := range data.Habits {
+		if h.PausedOn(today) || containsInt(rec.CompletedHabits, h.ID) || containsInt(rec.SkippedHabits, h.ID) {
+			continue
+		}
+		text := fmt.Sprintf("%s: %d %s", h.Name, h.Quantity, h.Unit)
+		habits = append(habits, wrapUpItem{Text: text, Link: QuickLinkURL(quickTokenFor(data, h.ID, now)), HabitID: h.ID})
+	}
+	for _, t := range data.Todos {
+		if t.DueDate == "" || t.DueDate > today {
+			continue
+		}
+		text := t.Text
+		if IsOverdue(t, today) {
+			text += " (overdue)"
+		}
+		todos = append(todos, wrapUpItem{Text: text, Link: TodoDoneLink(t.ID, now)})
+	}
+	return habits, todos
+}
+
+// wrapUpMessage writes the wrap-up notification.
+func wrapUpMessage(habits, todos []wrapUpItem) string {
+	var sb strings.Builder
+	if len(habits) > 0 {
+		fmt.Fprintf(&sb, "Habits left today (%d):\n", len(habits))
+		for _, it := range habits {
+			fmt.Fprintf(&sb, "- %s → %s\n", it.Text, it.Link)
+		}
+	}
+	if len(todos) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "Todos due (%d):\n", len(todos))
+		for _, it := range todos {
+			fmt.Fprintf(&sb, "- %s → %s\n", it.Text, it.Link)
+		}
+	}
+	if len(habits) > 0 && inboundEmailEnabled() {
+		sb.WriteString("\nBy email, reply “done” to mark all these habits done, or “done Read, Run” for some.")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// SendDayWrapUp sends the day's wrap-up once its time has come, unless it's turned off or
+// nothing is left. data.LastWrapUpDate makes sure it goes out once a day.
+func SendDayWrapUp(data *AppData, now time.Time) bool {
+	at, err := time.Parse("15:04", data.Settings.WrapUpTime)
+	today := now.Format(dateLayout)
+	if err != nil || data.LastWrapUpDate == today {
+		return false
+	}
+	if now.Before(time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())) {
+		return false
+	}
+	habits, todos := wrapUpItems(data, now)
+	if len(habits)+len(todos) > 0 {
+		if err := Notify("Day wrap-up", wrapUpMessage(habits, todos)); err != nil {
+			return false // try again next minute
+		}
+	}
+	data.LastWrapUpDate = today
+	data.WrapUpHabits = nil
+	for _, it := range habits {
+		data.WrapUpHabits = append(data.WrapUpHabits, it.HabitID)
+	}
+	return true
+}
+
+// HandleQuickTodo handles GET /quick-todo?todo_id=3&sig=..., the link next to a todo in the
+// wrap-up: it completes the todo, like ticking it on the main page.
+func HandleQuickTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	todoID, err := strconv.Atoi(r.URL.Query().Get("todo_id"))
+	value := fmt.Sprintf("%d/%s", todoID, Today())
+	if err != nil || !validLink("todo-done", value, r.URL.Query().Get("sig")) {
+		http.Redirect(w, r, "/?error=link", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store") // like quick-log links: never from a cache
+	pd := QuickPageData{Settings: data.Settings, Title: "Todo", Message: "Already done. 🎉"}
+	for i, t := range data.Todos {
+		if t.ID != todoID {
+			continue
+		}
+		data.Todos = append(data.Todos[:i], data.Todos[i+1:]...)
+		markTodoDone(data, todoID)
+		if err := SaveData(data); err != nil {
+			saveFailed(w, err)
+			return
+		}
+		pd.Title, pd.Message = t.Text, "Done. 🎉"
+		break
+	}
+	if err := tmpl.ExecuteTemplate(w, "quick.html", pd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleWrapUpSettings handles POST from the settings page to set the time of the day wrap-up
+// (empty = off). Form: wrap_up_time=21:00
+func HandleWrapUpSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	at := strings.TrimSpace(r.FormValue("wrap_up_time"))
+	if _, err := time.Parse("15:04", at); err != nil && at != "" {
+		http.Redirect(w, r, "/settings?error=wrapup#wrap-up", http.StatusFound)
+		return
+	}
+	data, err := LoadData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Settings.WrapUpTime = at
+	if err := SaveData(data); err != nil {
+		saveFailed(w, err)
+		return
+	}
+	http.Redirect(w, r, "/settings?wrapup=1#wrap-up", http.StatusFound)
+}